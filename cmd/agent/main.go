@@ -0,0 +1,119 @@
+// Command agent runs on a host and serves its Docker daemon to a mini-cloud
+// control plane, which reaches it through a node's "agent" URL
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"log/slog"
+	"mini-cloud/internal/agent"
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/logging"
+	"mini-cloud/internal/resourcemanager"
+	"mini-cloud/internal/tracing"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logs := logging.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}), slog.LevelInfo)
+	slog.SetDefault(logs.Logger("agent"))
+
+	addr := flag.String("addr", ":9090", "address to listen on")
+	dockerHost := flag.String("docker-host", "", "Docker daemon to serve (default: DOCKER_HOST or the local daemon)")
+	cpu := flag.Float64("cpu", 0, "CPU cores offered to the cluster")
+	memory := flag.Int("memory", 0, "memory in MB offered to the cluster")
+	gpu := flag.Int("gpu", 0, "GPUs offered to the cluster")
+	disk := flag.Int("disk", 0, "disk in MB offered to the cluster")
+	joinURL := flag.String("join", "", "control plane URL to join; the agent then serves mutual TLS only")
+	joinToken := flag.String("join-token", os.Getenv("MINI_CLOUD_JOIN_TOKEN"), "join token (default: MINI_CLOUD_JOIN_TOKEN)")
+	joinCA := flag.String("join-ca", "", "CA file verifying the control plane's HTTPS certificate (default: system roots)")
+	nodeID := flag.String("node-id", "", "ID of this node in the control plane's config, required with -join")
+	certDir := flag.String("cert-dir", "agent-pki", "directory keeping the node certificate")
+	insecure := flag.Bool("insecure", false, "serve plain HTTP without authentication when not joining; anyone reaching -addr controls the Docker daemon")
+	logLevel := flag.String("log-level", "info", "log level")
+	flag.Parse()
+
+	if err := logs.Apply(*logLevel); err != nil {
+		fatal("invalid -log-level", "error", err)
+	}
+
+	if *cpu <= 0 || *memory <= 0 {
+		fatal("-cpu and -memory must be positive")
+	}
+	if *joinURL == "" && !*insecure {
+		fatal("refusing to serve the Docker daemon without mutual TLS; use -join, or -insecure on a trusted network")
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx)
+	if err != nil {
+		fatal("failed to set up tracing", "error", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	var dc *docker.DockerClient
+	if *dockerHost != "" {
+		dc, err = docker.NewDockerClientWithHost(*dockerHost)
+	} else {
+		dc, err = docker.NewDockerClient()
+	}
+	if err != nil {
+		fatal("failed to create docker client", "error", err)
+	}
+
+	capacity := resourcemanager.ResourceSpec{CPU: *cpu, Memory: *memory, GPU: *gpu, DiskMB: *disk}
+	server := &http.Server{Addr: *addr, Handler: agent.NewServer(dc, capacity).Handler()}
+	if *joinURL != "" {
+		if *nodeID == "" || *joinToken == "" {
+			fatal("-join needs -node-id and -join-token")
+		}
+		var roots *x509.CertPool
+		if *joinCA != "" {
+			pem, err := os.ReadFile(*joinCA)
+			if err != nil {
+				fatal("failed to read -join-ca", "error", err)
+			}
+			roots = x509.NewCertPool()
+			roots.AppendCertsFromPEM(pem)
+		}
+		if server.TLSConfig, err = agent.Join(ctx, *joinURL, *joinToken, *nodeID, *certDir, roots); err != nil {
+			fatal("failed to join the cluster", "error", err)
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("agent shutdown failed", "error", err)
+		}
+	}()
+
+	if server.TLSConfig == nil {
+		slog.Warn("serving the Docker daemon over plain HTTP without authentication", "addr", *addr)
+	}
+	slog.Info("starting node agent", "addr", *addr, "mtls", server.TLSConfig != nil)
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		fatal("agent failed", "error", err)
+	}
+}
+
+// fatal logs an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
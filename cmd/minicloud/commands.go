@@ -0,0 +1,706 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// container is the part of a container response shown in tables
+type container struct {
+	ID         string
+	NodeID     string
+	Namespace  string
+	Name       string
+	Image      string
+	Status     string
+	CPU        float64
+	MemoryMB   int64
+	AgeSeconds int64
+	HostPorts  map[string]int
+	Live       *struct{ Status, Health string }
+}
+
+// node is the part of a node response shown in tables
+type node struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	Capacity  resources
+	Allocated resources
+}
+
+type resources struct {
+	CPU    float64 `json:"cpu"`
+	Memory int     `json:"memory"`
+}
+
+// keyValueFlags collects repeated key=value flags
+type keyValueFlags map[string]string
+
+func (l keyValueFlags) String() string { return "" }
+
+func (l keyValueFlags) Type() string { return "key=value" }
+
+func (l keyValueFlags) Set(v string) error {
+	k, val, ok := strings.Cut(v, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected key=value, got %q", v)
+	}
+	l[k] = val
+	return nil
+}
+
+// parsePort parses a docker-style port flag such as "8080:80" or "53/udp"
+// into a port request
+func parsePort(v string) (map[string]any, error) {
+	spec, proto, _ := strings.Cut(v, "/")
+	host, ctr, mapped := strings.Cut(spec, ":")
+	if !mapped {
+		host, ctr = "", spec
+	}
+	p := map[string]any{}
+	n, err := strconv.Atoi(ctr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid container port in %q", v)
+	}
+	p["containerPort"] = n
+	if host != "" {
+		if n, err = strconv.Atoi(host); err != nil {
+			return nil, fmt.Errorf("invalid host port in %q", v)
+		}
+		p["hostPort"] = n
+	}
+	if proto != "" {
+		p["protocol"] = proto
+	}
+	return p, nil
+}
+
+// parseMount parses a docker-style volume flag such as "data:/var/lib/data" or
+// "/srv/site:/usr/share/nginx/html:ro" into a mount request
+func parseMount(v string) (map[string]any, error) {
+	parts := strings.Split(v, ":")
+	if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && parts[2] != "ro" && parts[2] != "rw") {
+		return nil, fmt.Errorf("invalid mount %q (expected source:target[:ro])", v)
+	}
+	m := map[string]any{"source": parts[0], "target": parts[1], "type": "volume"}
+	if strings.HasPrefix(parts[0], "/") {
+		m["type"] = "bind"
+	}
+	if len(parts) == 3 && parts[2] == "ro" {
+		m["readOnly"] = true
+	}
+	return m, nil
+}
+
+func newProvisionCmd(g *globals) *cobra.Command {
+	var (
+		file, name, image, ttl, restart string
+		cpu                             float64
+		memory                          int64
+		replicas                        int
+		portFlags, mountFlags           []string
+	)
+	labels, env := keyValueFlags{}, keyValueFlags{}
+	cmd := &cobra.Command{
+		Use:   "provision",
+		Short: "Provision a container",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			req := map[string]any{}
+			if file != "" {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					return err
+				}
+				if err := json.Unmarshal(data, &req); err != nil {
+					return fmt.Errorf("failed to parse %s: %w", file, err)
+				}
+			}
+			flags := cmd.Flags()
+			for flag, set := range map[string]func(){
+				"name":     func() { req["name"] = name },
+				"image":    func() { req["image"] = image },
+				"cpu":      func() { req["cpu"] = cpu },
+				"memory":   func() { req["memory"] = memory },
+				"ttl":      func() { req["ttl"] = ttl },
+				"restart":  func() { req["restartPolicy"] = restart },
+				"replicas": func() { req["replicas"] = replicas },
+				"label":    func() { req["labels"] = labels },
+				"env":      func() { req["env"] = env },
+			} {
+				if flags.Changed(flag) {
+					set()
+				}
+			}
+			if flags.Changed("port") {
+				ports := make([]map[string]any, 0, len(portFlags))
+				for _, v := range portFlags {
+					p, err := parsePort(v)
+					if err != nil {
+						return err
+					}
+					ports = append(ports, p)
+				}
+				req["ports"] = ports
+			}
+			if flags.Changed("volume") {
+				mounts := make([]map[string]any, 0, len(mountFlags))
+				for _, v := range mountFlags {
+					m, err := parseMount(v)
+					if err != nil {
+						return err
+					}
+					mounts = append(mounts, m)
+				}
+				req["mounts"] = mounts
+			}
+			if req["image"] == nil {
+				return errors.New("an image is required (--image or -f)")
+			}
+
+			c, err := g.client()
+			if err != nil {
+				return err
+			}
+			data, err := c.do(http.MethodPost, c.path("/provision"), req)
+			if err != nil {
+				return err
+			}
+			if g.output == "json" {
+				return printJSON(data)
+			}
+			// Replicated provisions answer with a list, possibly partial
+			var resp struct {
+				container
+				Containers []container `json:"containers"`
+				Error      string      `json:"error"`
+			}
+			if err := json.Unmarshal(data, &resp); err != nil {
+				return err
+			}
+			if resp.Containers == nil {
+				return printContainers([]container{resp.container})
+			}
+			if err := printContainers(resp.Containers); err != nil {
+				return err
+			}
+			if resp.Error != "" {
+				return errors.New(resp.Error)
+			}
+			return nil
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&file, "file", "f", "", "JSON provision request file, as accepted by POST /provision; other flags override it")
+	flags.StringVar(&name, "name", "", "container name (default: generated)")
+	flags.StringVar(&image, "image", "", "image to run")
+	flags.Float64Var(&cpu, "cpu", 0, "CPU cores to reserve")
+	flags.Int64Var(&memory, "memory", 0, "memory in MB to reserve")
+	flags.StringVar(&ttl, "ttl", "", `time to live, e.g. "1h"`)
+	flags.StringVar(&restart, "restart", "", "restart policy: never, on-failure[:max] or always")
+	flags.IntVar(&replicas, "replicas", 0, "number of replicas, named name-0 ... name-(n-1)")
+	flags.Var(labels, "label", "container label key=value (repeatable)")
+	flags.Var(env, "env", "environment variable KEY=value (repeatable)")
+	flags.StringArrayVarP(&mountFlags, "volume", "v", nil, "mount source:target[:ro], a host path or a volume name (repeatable)")
+	flags.StringArrayVar(&portFlags, "port", nil, "publish [hostPort:]containerPort[/udp] (repeatable)")
+	return cmd
+}
+
+func newTerminateCmd(g *globals) *cobra.Command {
+	return &cobra.Command{
+		Use:   "terminate ID...",
+		Short: "Terminate containers by ID",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			c, err := g.client()
+			if err != nil {
+				return err
+			}
+			var errs []error
+			for _, id := range args {
+				if _, err := c.do(http.MethodPost, c.path("/terminate/"+url.PathEscape(id)), nil); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", id, err))
+					continue
+				}
+				fmt.Println("terminated", id)
+			}
+			return errors.Join(errs...)
+		},
+	}
+}
+
+func newStatusCmd(g *globals) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status ID",
+		Short: "Show a container",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			c, err := g.client()
+			if err != nil {
+				return err
+			}
+			data, err := c.do(http.MethodGet, c.path("/status/"+url.PathEscape(args[0])), nil)
+			if err != nil {
+				return err
+			}
+			if g.output == "json" {
+				return printJSON(data)
+			}
+			var ctr container
+			if err := json.Unmarshal(data, &ctr); err != nil {
+				return err
+			}
+			return printContainers([]container{ctr})
+		},
+	}
+}
+
+func newLogsCmd(g *globals) *cobra.Command {
+	var (
+		tail   string
+		follow bool
+	)
+	cmd := &cobra.Command{
+		Use:   "logs ID",
+		Short: "Print a container's recent output",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			c, err := g.client()
+			if err != nil {
+				return err
+			}
+			q := url.Values{}
+			if tail != "" {
+				q.Set("tail", tail)
+			}
+			if follow {
+				q.Set("follow", "true")
+			}
+			path := c.path("/logs/" + url.PathEscape(args[0]))
+			if len(q) > 0 {
+				path += "?" + q.Encode()
+			}
+			if follow {
+				return followLogs(c, path)
+			}
+			data, err := c.do(http.MethodGet, path, nil)
+			if err != nil {
+				return err
+			}
+			if g.output == "json" {
+				return printJSON(data)
+			}
+			var logs struct{ Stdout, Stderr string }
+			if err := json.Unmarshal(data, &logs); err != nil {
+				return err
+			}
+			fmt.Fprint(os.Stdout, logs.Stdout)
+			fmt.Fprint(os.Stderr, logs.Stderr)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&tail, "tail", "", `number of lines from the end, or "all" (default 100)`)
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "keep printing new output until the container stops")
+	return cmd
+}
+
+// followLogs prints the lines of a followed log stream as they arrive
+func followLogs(c *client, path string) error {
+	body, err := c.stream(path)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, 1024*1024)
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data := []byte(strings.TrimPrefix(line, "data: "))
+			if event == "end" {
+				var end struct{ Reason string }
+				if err := json.Unmarshal(data, &end); err == nil && end.Reason != "container stopped" {
+					return errors.New(end.Reason)
+				}
+				return nil
+			}
+			var l struct{ Stream, Line string }
+			if err := json.Unmarshal(data, &l); err != nil {
+				return err
+			}
+			out := os.Stdout
+			if l.Stream == "stderr" {
+				out = os.Stderr
+			}
+			fmt.Fprintln(out, l.Line)
+		}
+	}
+	return scanner.Err()
+}
+
+func newStatsCmd(g *globals) *cobra.Command {
+	return &cobra.Command{
+		Use:   "stats ID...",
+		Short: "Show containers' actual resource usage",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			c, err := g.client()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			if g.output == "table" {
+				fmt.Fprintln(w, "ID\tNODE\tCPU%\tCPU RESERVED\tMEMORY\tMEMORY RESERVED\tNET RX/TX\tBLOCK R/W")
+			}
+			var errs []error
+			for _, id := range args {
+				data, err := c.do(http.MethodGet, c.path("/stats/"+url.PathEscape(id)), nil)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", id, err))
+					continue
+				}
+				if g.output == "json" {
+					if err := printJSON(data); err != nil {
+						return err
+					}
+					continue
+				}
+				var s struct {
+					ID, NodeID                      string
+					CPUPercent, ReservedCPU         float64
+					MemoryUsageMB, ReservedMemoryMB int64
+					NetworkRxBytes, NetworkTxBytes  uint64
+					BlockReadBytes, BlockWriteBytes uint64
+				}
+				if err := json.Unmarshal(data, &s); err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "%s\t%s\t%.1f\t%g\t%dMB\t%dMB\t%s/%s\t%s/%s\n", shortID(s.ID), s.NodeID,
+					s.CPUPercent, s.ReservedCPU, s.MemoryUsageMB, s.ReservedMemoryMB,
+					formatBytes(s.NetworkRxBytes), formatBytes(s.NetworkTxBytes),
+					formatBytes(s.BlockReadBytes), formatBytes(s.BlockWriteBytes))
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			return errors.Join(errs...)
+		},
+	}
+}
+
+func newListCmd(g *globals) *cobra.Command {
+	filters := []string{"node", "image", "status", "limit", "offset"}
+	values := make(map[string]*string, len(filters))
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List containers",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			q := url.Values{}
+			for _, name := range filters {
+				if cmd.Flags().Changed(name) {
+					q.Set(name, *values[name])
+				}
+			}
+
+			c, err := g.client()
+			if err != nil {
+				return err
+			}
+			path := c.path("/list")
+			if len(q) > 0 {
+				path += "?" + q.Encode()
+			}
+			data, err := c.do(http.MethodGet, path, nil)
+			if err != nil {
+				return err
+			}
+			if g.output == "json" {
+				return printJSON(data)
+			}
+			var ctrs []container
+			if err := json.Unmarshal(data, &ctrs); err != nil {
+				return err
+			}
+			return printContainers(ctrs)
+		},
+	}
+	for _, name := range filters {
+		values[name] = cmd.Flags().String(name, "", "filter by "+name)
+	}
+	return cmd
+}
+
+func newNodesCmd(g *globals) *cobra.Command {
+	return &cobra.Command{
+		Use:   "nodes",
+		Short: "List nodes",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			c, err := g.client()
+			if err != nil {
+				return err
+			}
+			data, err := c.do(http.MethodGet, "/nodes", nil)
+			if err != nil {
+				return err
+			}
+			if g.output == "json" {
+				return printJSON(data)
+			}
+			var nodes []node
+			if err := json.Unmarshal(data, &nodes); err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tSTATUS\tCPU\tMEMORY")
+			for _, n := range nodes {
+				fmt.Fprintf(w, "%s\t%s\t%g/%g\t%d/%dMB\n", n.ID, n.Status,
+					n.Allocated.CPU, n.Capacity.CPU, n.Allocated.Memory, n.Capacity.Memory)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newImagesCmd(g *globals) *cobra.Command {
+	var nodeID string
+	cmd := &cobra.Command{
+		Use:   "images",
+		Short: "List the images cached on the nodes",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			c, err := g.client()
+			if err != nil {
+				return err
+			}
+			q := url.Values{}
+			if nodeID != "" {
+				q.Set("node", nodeID)
+			}
+			data, err := c.do(http.MethodGet, "/images?"+q.Encode(), nil)
+			if err != nil {
+				return err
+			}
+			if g.output == "json" {
+				return printJSON(data)
+			}
+			var images []struct {
+				Node, Image string
+				Size        uint64
+				PulledAt    *time.Time
+			}
+			if err := json.Unmarshal(data, &images); err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NODE\tIMAGE\tSIZE\tPULLED")
+			for _, img := range images {
+				pulled := "-"
+				if img.PulledAt != nil {
+					pulled = time.Since(*img.PulledAt).Round(time.Second).String() + " ago"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", img.Node, img.Image, formatBytes(img.Size), pulled)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&nodeID, "node", "", "only images on this node")
+	return cmd
+}
+
+func newPrepullCmd(g *globals) *cobra.Command {
+	var nodes []string
+	selector := keyValueFlags{}
+	cmd := &cobra.Command{
+		Use:   "prepull IMAGE",
+		Short: "Pull an image on the nodes ahead of time",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			c, err := g.client()
+			if err != nil {
+				return err
+			}
+			req := map[string]any{"image": args[0], "nodes": nodes, "nodeSelector": selector}
+			data, err := c.do(http.MethodPost, "/images/prepull", req)
+			if err != nil {
+				return err
+			}
+			if g.output == "json" {
+				return printJSON(data)
+			}
+			var resp struct {
+				Nodes []struct{ Node, Error string }
+			}
+			if err := json.Unmarshal(data, &resp); err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NODE\tRESULT")
+			var failed int
+			for _, n := range resp.Nodes {
+				result := "pulled"
+				if n.Error != "" {
+					result, failed = n.Error, failed+1
+				}
+				fmt.Fprintf(w, "%s\t%s\n", n.Node, result)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if failed > 0 {
+				return fmt.Errorf("pull failed on %d node(s)", failed)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVar(&nodes, "node", nil, "pull on this node (repeatable, default: every node)")
+	cmd.Flags().Var(selector, "selector", "only nodes with label key=value (repeatable)")
+	return cmd
+}
+
+func newDeploymentsCmd(g *globals) *cobra.Command {
+	return &cobra.Command{
+		Use:   "deployments",
+		Short: "List deployments and their ready replicas",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			c, err := g.client()
+			if err != nil {
+				return err
+			}
+			data, err := c.do(http.MethodGet, "/deployments", nil)
+			if err != nil {
+				return err
+			}
+			if g.output == "json" {
+				return printJSON(data)
+			}
+			var deployments []struct {
+				Name, Image     string
+				Replicas, Ready int
+				CreatedAt       time.Time
+			}
+			if err := json.Unmarshal(data, &deployments); err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tIMAGE\tREADY\tAGE")
+			for _, d := range deployments {
+				age := time.Since(d.CreatedAt).Round(time.Second)
+				fmt.Fprintf(w, "%s\t%s\t%d/%d\t%s\n", d.Name, d.Image, d.Ready, d.Replicas, age)
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func newScaleCmd(g *globals) *cobra.Command {
+	return &cobra.Command{
+		Use:   "scale DEPLOYMENT REPLICAS",
+		Short: "Change a deployment's replica count",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			replicas, err := strconv.Atoi(args[1])
+			if err != nil || replicas < 0 {
+				return fmt.Errorf("invalid replica count %q", args[1])
+			}
+
+			c, err := g.client()
+			if err != nil {
+				return err
+			}
+			data, err := c.do(http.MethodPost, "/deployments/"+url.PathEscape(args[0])+"/scale", map[string]int{"replicas": replicas})
+			if err != nil {
+				return err
+			}
+			if g.output == "json" {
+				return printJSON(data)
+			}
+			var resp struct{ Errors []string }
+			if err := json.Unmarshal(data, &resp); err != nil {
+				return err
+			}
+			fmt.Printf("%s scaled to %d replicas\n", args[0], replicas)
+			for _, e := range resp.Errors {
+				fmt.Fprintln(os.Stderr, "warning:", e)
+			}
+			return nil
+		},
+	}
+}
+
+// formatBytes writes n with a binary unit, e.g. "1.5MiB"
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// printContainers writes containers as a table
+func printContainers(ctrs []container) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tNAMESPACE\tIMAGE\tNODE\tSTATUS\tCPU\tMEMORY\tAGE\tPORTS")
+	for _, c := range ctrs {
+		status := c.Status
+		if c.Live != nil && c.Live.Health != "" {
+			status += " (" + c.Live.Health + ")"
+		}
+		var ports []string
+		for _, port := range slices.Sorted(maps.Keys(c.HostPorts)) {
+			ports = append(ports, fmt.Sprintf("%d->%s", c.HostPorts[port], port))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%g\t%dMB\t%s\t%s\n", shortID(c.ID), c.Name, c.Namespace, c.Image,
+			c.NodeID, status, c.CPU, c.MemoryMB, time.Duration(c.AgeSeconds)*time.Second, strings.Join(ports, ","))
+	}
+	return w.Flush()
+}
+
+// printJSON writes an API response indented
+func printJSON(data []byte) error {
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(os.Stdout)
+	return err
+}
+
+// shortID abbreviates a Docker container ID the way the docker CLI does
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,238 @@
+// Command minicloud is a command-line client for the mini-cloud HTTP API
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Config holds where the server is and how to authenticate, read from
+// ~/.config/minicloud/config.json (or MINICLOUD_CONFIG) and overridden by flags
+type Config struct {
+	Server    string `json:"server"`    // e.g. "https://cloud.example.com:8443"
+	APIKey    string `json:"apiKey"`    // API key or JWT
+	CAFile    string `json:"caFile"`    // CA verifying the server's certificate
+	Namespace string `json:"namespace"` // if set, requests go through /namespaces/{namespace}/
+}
+
+// defaultConfigPath returns where the config file is looked up
+func defaultConfigPath() string {
+	if p := os.Getenv("MINICLOUD_CONFIG"); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "minicloud", "config.json")
+}
+
+// loadConfig reads the config file at path. A missing file is an empty config.
+func loadConfig(path string) (Config, error) {
+	var cfg Config
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// globals are the persistent flags every command accepts
+type globals struct {
+	configPath string
+	server     string
+	apiKey     string
+	namespace  string
+	output     string
+}
+
+// newRootCmd returns the minicloud command with every subcommand
+func newRootCmd() *cobra.Command {
+	var g globals
+	root := &cobra.Command{
+		Use:   "minicloud",
+		Short: "Command-line client for the mini-cloud HTTP API",
+		PersistentPreRunE: func(*cobra.Command, []string) error {
+			if g.output != "table" && g.output != "json" {
+				return fmt.Errorf("unknown output format %q", g.output)
+			}
+			return nil
+		},
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	flags := root.PersistentFlags()
+	flags.StringVar(&g.configPath, "config", defaultConfigPath(), "config file")
+	flags.StringVar(&g.server, "server", "", "API address (default from config, else http://localhost:8080)")
+	flags.StringVar(&g.apiKey, "api-key", "", "API key or token (default from config or MINICLOUD_API_KEY)")
+	flags.StringVar(&g.namespace, "namespace", "", "namespace to work in (default from config)")
+	flags.StringVarP(&g.output, "output", "o", "table", "output format: table or json")
+
+	root.AddCommand(
+		newProvisionCmd(&g),
+		newTerminateCmd(&g),
+		newStatusCmd(&g),
+		newLogsCmd(&g),
+		newStatsCmd(&g),
+		newListCmd(&g),
+		newNodesCmd(&g),
+		newImagesCmd(&g),
+		newPrepullCmd(&g),
+		newDeploymentsCmd(&g),
+		newScaleCmd(&g),
+	)
+	return root
+}
+
+// client builds an API client from the config file and flags
+func (g *globals) client() (*client, error) {
+	cfg, err := loadConfig(g.configPath)
+	if err != nil {
+		return nil, err
+	}
+	c := &client{
+		server:    cmp.Or(g.server, cfg.Server, "http://localhost:8080"),
+		apiKey:    cmp.Or(g.apiKey, os.Getenv("MINICLOUD_API_KEY"), cfg.APIKey),
+		namespace: cmp.Or(g.namespace, cfg.Namespace),
+		http:      &http.Client{Timeout: 10 * time.Minute},
+	}
+	c.server = strings.TrimSuffix(c.server, "/")
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		c.http.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}}
+	}
+	return c, nil
+}
+
+// client calls the mini-cloud API
+type client struct {
+	server    string
+	apiKey    string
+	namespace string
+	http      *http.Client
+}
+
+// apiError is an error response from the server
+type apiError struct {
+	Status  int
+	Message string
+	Reasons []string
+}
+
+func (e *apiError) Error() string {
+	msg := fmt.Sprintf("%s (%d)", e.Message, e.Status)
+	for _, r := range e.Reasons {
+		msg += "\n  " + r
+	}
+	return msg
+}
+
+// path prefixes a container endpoint with the client's namespace, if any
+func (c *client) path(p string) string {
+	if c.namespace == "" {
+		return p
+	}
+	return "/namespaces/" + c.namespace + p
+}
+
+// do sends body (if non-nil) as JSON and returns the raw response body,
+// turning error statuses into *apiError. 207 responses are returned as is.
+func (c *client) do(method, path string, body any) ([]byte, error) {
+	resp, err := c.send(c.http, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+	return io.ReadAll(resp)
+}
+
+// stream sends a GET to path and returns the response body as it arrives,
+// without the client's timeout. The caller must close it.
+func (c *client) stream(path string) (io.ReadCloser, error) {
+	hc := *c.http
+	hc.Timeout = 0
+	return c.send(&hc, http.MethodGet, path, nil)
+}
+
+// send sends body (if non-nil) as JSON with hc and returns the response
+// body, turning error statuses into *apiError
+func (c *client) send(hc *http.Client, method, path string, body any) (io.ReadCloser, error) {
+	var in io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		in = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.server+path, in)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		e := &apiError{Status: resp.StatusCode}
+		var parsed struct {
+			Error   string   `json:"error"`
+			Reasons []string `json:"reasons"`
+		}
+		if json.Unmarshal(data, &parsed) == nil && parsed.Error != "" {
+			e.Message, e.Reasons = parsed.Error, parsed.Reasons
+		} else {
+			e.Message = strings.TrimSpace(string(data))
+		}
+		return nil, e
+	}
+	return resp.Body, nil
+}
+
+func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "minicloud:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,272 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/docker/dockertest"
+	"mini-cloud/internal/resourcemanager"
+)
+
+// newTestAgent serves an in-memory runtime through an agent and returns a
+// client for it
+func newTestAgent(t *testing.T) (*Client, *dockertest.Runtime) {
+	t.Helper()
+	rt := dockertest.New()
+	srv := httptest.NewServer(NewServer(rt, resourcemanager.ResourceSpec{CPU: 4, Memory: 4096}).Handler())
+	t.Cleanup(srv.Close)
+	return NewClient(srv.URL + "/"), rt
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	c, rt := newTestAgent(t)
+	ctx := context.Background()
+
+	capacity, err := c.Capacity(ctx)
+	if err != nil {
+		t.Fatalf("Capacity: %v", err)
+	}
+	if capacity.CPU != 4 || capacity.Memory != 4096 {
+		t.Errorf("capacity %+v, want 4 CPU and 4096MB", capacity)
+	}
+
+	spec := docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1, Memory: 256, Command: []string{"nginx", "-g", "daemon off;"}}
+	id, err := c.CreateContainer(ctx, spec)
+	if err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+	if err := c.StartContainer(ctx, id); err != nil {
+		t.Fatalf("StartContainer: %v", err)
+	}
+	got, ok := rt.Container(id)
+	if !ok || got.State != dockertest.StateRunning || len(got.Spec.Command) != 3 {
+		t.Fatalf("container on the agent's runtime: %+v, want web running with its command", got)
+	}
+
+	list, err := c.ListContainers(ctx)
+	if err != nil {
+		t.Fatalf("ListContainers: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != id {
+		t.Errorf("listed %+v, want only %s", list, id)
+	}
+	inspect, err := c.InspectContainer(ctx, id)
+	if err != nil {
+		t.Fatalf("InspectContainer: %v", err)
+	}
+	if inspect.State == nil || !inspect.State.Running {
+		t.Errorf("inspected state %+v, want running", inspect.State)
+	}
+
+	if err := c.UpdateContainer(ctx, id, 2, 512, -1); err != nil {
+		t.Fatalf("UpdateContainer: %v", err)
+	}
+	if got, _ := rt.Container(id); got.CPU != 2 || got.MemoryMB != 512 || got.SwapMB != -1 {
+		t.Errorf("limits %v CPU, %dMB, %dMB swap after update; want 2, 512 and unlimited", got.CPU, got.MemoryMB, got.SwapMB)
+	}
+
+	if err := c.StopContainer(ctx, id, 5); err != nil {
+		t.Fatalf("StopContainer: %v", err)
+	}
+	if err := c.RemoveContainer(ctx, id); err != nil {
+		t.Fatalf("RemoveContainer: %v", err)
+	}
+	if _, ok := rt.Container(id); ok {
+		t.Error("container still on the agent's runtime after remove")
+	}
+}
+
+func TestClientExecTTY(t *testing.T) {
+	c, rt := newTestAgent(t)
+	ctx := context.Background()
+	id, err := c.CreateContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx"})
+	if err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+	if err := c.StartContainer(ctx, id); err != nil {
+		t.Fatalf("StartContainer: %v", err)
+	}
+	rt.SetExecResult(id, docker.ExecResult{ExitCode: 1})
+
+	sess, err := c.ExecTTY(ctx, id, []string{"sh"})
+	if err != nil {
+		t.Fatalf("ExecTTY: %v", err)
+	}
+	defer sess.Close()
+	if _, err := sess.Write([]byte("exit\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if out, err := io.ReadAll(sess); err != nil || string(out) != "exit\n" {
+		t.Errorf("terminal output %q, %v; want the echoed input", out, err)
+	}
+	if code, err := sess.ExitCode(ctx); err != nil || code != 1 {
+		t.Errorf("exit code %d, %v; want 1", code, err)
+	}
+}
+
+func TestClientLogs(t *testing.T) {
+	c, rt := newTestAgent(t)
+	ctx := context.Background()
+	id, err := c.CreateContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx"})
+	if err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+	rt.SetLogs(id, "a\nb\n", "c\n")
+
+	logs, err := c.ContainerLogs(ctx, id, docker.LogOptions{Tail: 1})
+	if err != nil {
+		t.Fatalf("ContainerLogs: %v", err)
+	}
+	defer logs.Close()
+	var stdout, stderr strings.Builder
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, logs); err != nil {
+		t.Fatalf("demultiplexing logs: %v", err)
+	}
+	if stdout.String() != "b\n" || stderr.String() != "c\n" {
+		t.Errorf("logs: stdout %q, stderr %q; want the last line of each", stdout.String(), stderr.String())
+	}
+
+	if _, err := c.ContainerLogs(ctx, "missing", docker.LogOptions{}); !cerrdefs.IsNotFound(err) {
+		t.Errorf("logs of a missing container: err = %v, want not found", err)
+	}
+}
+
+func TestClientImages(t *testing.T) {
+	c, rt := newTestAgent(t)
+	ctx := context.Background()
+	rt.AddImage(docker.Image{ID: "sha256:ng", Tags: []string{"nginx:latest"}, SizeBytes: 100})
+
+	images, err := c.ListImages(ctx)
+	if err != nil {
+		t.Fatalf("ListImages: %v", err)
+	}
+	if len(images) != 1 || images[0].ID != "sha256:ng" || images[0].Tags[0] != "nginx:latest" || images[0].SizeBytes != 100 {
+		t.Errorf("listed %+v, want nginx", images)
+	}
+
+	id, err := c.CreateContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx"})
+	if err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+	if err := c.RemoveImage(ctx, "nginx"); !cerrdefs.IsConflict(err) {
+		t.Errorf("removing an image in use: err = %v, want conflict", err)
+	}
+	if err := c.RemoveContainer(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveImage(ctx, "nginx"); err != nil {
+		t.Fatalf("RemoveImage: %v", err)
+	}
+	if rt.HasImage("nginx") {
+		t.Error("image still on the agent's runtime after remove")
+	}
+}
+
+func TestClientImageDigest(t *testing.T) {
+	c, rt := newTestAgent(t)
+	digest := "sha256:" + strings.Repeat("a", 64)
+	rt.SetImageDigest("nginx", digest)
+
+	if got, err := c.ImageDigest(context.Background(), "nginx"); err != nil || got != digest {
+		t.Errorf("ImageDigest = %q, %v; want %s", got, err, digest)
+	}
+	if got, err := c.ImageDigest(context.Background(), "dev/app"); err != nil || got != "" {
+		t.Errorf("digest of a local image = %q, %v; want none", got, err)
+	}
+}
+
+func TestClientProbe(t *testing.T) {
+	c, rt := newTestAgent(t)
+	ctx := context.Background()
+	id, err := c.CreateContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx"})
+	if err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+	probe := docker.Probe{Type: docker.ProbeHTTP, Port: 80}
+
+	if res, err := c.Probe(ctx, id, probe); err != nil || !res.Healthy {
+		t.Errorf("Probe = %+v, %v; want healthy", res, err)
+	}
+	rt.SetProbeResult(id, docker.ProbeResult{Message: "HTTP 503"})
+	if res, err := c.Probe(ctx, id, probe); err != nil || res.Healthy || res.Message != "HTTP 503" {
+		t.Errorf("Probe = %+v, %v; want the failure", res, err)
+	}
+	if _, err := c.Probe(ctx, "missing", probe); !cerrdefs.IsNotFound(err) {
+		t.Errorf("probing a missing container: err = %v, want not found", err)
+	}
+}
+
+func TestClientVolumes(t *testing.T) {
+	c, _ := newTestAgent(t)
+	ctx := context.Background()
+
+	if err := c.CreateVolume(ctx, "pgdata", map[string]string{"mini-cloud.namespace": "a"}); err != nil {
+		t.Fatalf("CreateVolume: %v", err)
+	}
+	volumes, err := c.ListVolumes(ctx)
+	if err != nil {
+		t.Fatalf("ListVolumes: %v", err)
+	}
+	if len(volumes) != 1 || volumes[0].Name != "pgdata" || volumes[0].Labels["mini-cloud.namespace"] != "a" {
+		t.Errorf("listed %+v, want pgdata with its labels", volumes)
+	}
+	if err := c.RemoveVolume(ctx, "pgdata"); err != nil {
+		t.Fatalf("RemoveVolume: %v", err)
+	}
+	if err := c.RemoveVolume(ctx, "pgdata"); !cerrdefs.IsNotFound(err) {
+		t.Errorf("removing it again: err = %v, want not found", err)
+	}
+}
+
+func TestClientNetworks(t *testing.T) {
+	c, _ := newTestAgent(t)
+	ctx := context.Background()
+
+	id, err := c.CreateContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx", Network: "mini-cloud-ns-a"})
+	if err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+	networks, err := c.ListNetworks(ctx)
+	if err != nil {
+		t.Fatalf("ListNetworks: %v", err)
+	}
+	if len(networks) != 1 || networks[0] != "mini-cloud-ns-a" {
+		t.Errorf("listed %v, want the container's network", networks)
+	}
+	if err := c.RemoveNetwork(ctx, "mini-cloud-ns-a"); !cerrdefs.IsConflict(err) {
+		t.Errorf("removing a network in use: err = %v, want conflict", err)
+	}
+	if err := c.RemoveContainer(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveNetwork(ctx, "mini-cloud-ns-a"); err != nil {
+		t.Errorf("RemoveNetwork: %v", err)
+	}
+}
+
+func TestClientKeepsErrorClass(t *testing.T) {
+	c, rt := newTestAgent(t)
+	ctx := context.Background()
+
+	if err := c.StartContainer(ctx, "missing"); !cerrdefs.IsNotFound(err) {
+		t.Errorf("starting a missing container: err = %v, want not found", err)
+	}
+	if _, err := c.CreateContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx"}); err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+	if _, err := c.CreateContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx"}); !cerrdefs.IsConflict(err) {
+		t.Errorf("creating a duplicate name: err = %v, want conflict", err)
+	}
+
+	rt.SetPingError(dockertest.ErrInjected)
+	if err := c.Ping(ctx); err == nil {
+		t.Error("Ping succeeded against an unreachable daemon")
+	}
+}
@@ -0,0 +1,240 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	containerTypes "github.com/docker/docker/api/types/container"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/net/websocket"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/resourcemanager"
+	"mini-cloud/internal/terminal"
+)
+
+// Client is a container runtime backed by a remote node agent
+type Client struct {
+	baseURL string
+	http    *http.Client
+	tls     *tls.Config // for WebSocket connections, nil over plain HTTP
+}
+
+var _ docker.ContainerRuntime = (*Client)(nil)
+
+// NewClient returns a client for the agent at baseURL, e.g. "http://10.0.0.5:9090"
+func NewClient(baseURL string) *Client {
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), http: &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}}
+}
+
+// NewTLSClient returns a client for the agent at an https baseURL using cfg,
+// e.g. from ClientTLS
+func NewTLSClient(baseURL string, cfg *tls.Config) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), http: &http.Client{Transport: otelhttp.NewTransport(transport)}, tls: cfg}
+}
+
+// do sends in as JSON (if non-nil) to path and decodes the response into out
+// (if non-nil). Agent errors are returned with their errdefs class.
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	body, err := c.send(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode agent response: %w", err)
+	}
+	return nil
+}
+
+// send sends in as JSON (if non-nil) to path and returns the response body,
+// which the caller must close. Agent errors are returned with their errdefs class.
+func (c *Client) send(ctx context.Context, method, path string, in any) (io.ReadCloser, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var e errorResponse
+		if json.NewDecoder(resp.Body).Decode(&e) != nil || e.Error == "" {
+			e.Error = fmt.Sprintf("agent returned %s", resp.Status)
+		}
+		return nil, errorFor(resp.StatusCode, e.Error)
+	}
+	return resp.Body, nil
+}
+
+// containerPath returns the agent path for container id and an optional action
+func containerPath(id, action string) string {
+	p := "/v1/containers/" + url.PathEscape(id)
+	if action != "" {
+		p += "/" + action
+	}
+	return p
+}
+
+// Capacity returns the resources the agent's host offers to the cluster
+func (c *Client) Capacity(ctx context.Context) (resourcemanager.ResourceSpec, error) {
+	var capacity resourcemanager.ResourceSpec
+	err := c.do(ctx, http.MethodGet, "/v1/capacity", nil, &capacity)
+	return capacity, err
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/v1/ping", nil, nil)
+}
+
+// PullImage pulls image on the agent's host. Progress is not reported.
+func (c *Client) PullImage(ctx context.Context, image string, opts docker.PullOptions) error {
+	return c.do(ctx, http.MethodPost, "/v1/images/pull", pullRequest{Image: image, Auth: opts.Auth}, nil)
+}
+
+func (c *Client) ListImages(ctx context.Context) ([]docker.Image, error) {
+	var images []docker.Image
+	err := c.do(ctx, http.MethodGet, "/v1/images", nil, &images)
+	return images, err
+}
+
+func (c *Client) ImageDigest(ctx context.Context, image string) (string, error) {
+	var resp digestResponse
+	err := c.do(ctx, http.MethodGet, "/v1/images/digest?"+url.Values{"ref": {image}}.Encode(), nil, &resp)
+	return resp.Digest, err
+}
+
+func (c *Client) RemoveImage(ctx context.Context, ref string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/images?"+url.Values{"ref": {ref}}.Encode(), nil, nil)
+}
+
+func (c *Client) CreateContainer(ctx context.Context, spec docker.ContainerSpec) (string, error) {
+	var resp createResponse
+	err := c.do(ctx, http.MethodPost, "/v1/containers", spec, &resp)
+	return resp.ID, err
+}
+
+func (c *Client) StartContainer(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, containerPath(id, "start"), nil, nil)
+}
+
+func (c *Client) StopContainer(ctx context.Context, id string, timeout int) error {
+	return c.do(ctx, http.MethodPost, containerPath(id, "stop")+"?timeout="+strconv.Itoa(timeout), nil, nil)
+}
+
+func (c *Client) RestartContainer(ctx context.Context, id string, timeout int) error {
+	return c.do(ctx, http.MethodPost, containerPath(id, "restart")+"?timeout="+strconv.Itoa(timeout), nil, nil)
+}
+
+func (c *Client) RemoveContainer(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, containerPath(id, ""), nil, nil)
+}
+
+func (c *Client) ListContainers(ctx context.Context) ([]containerTypes.Summary, error) {
+	var containers []containerTypes.Summary
+	err := c.do(ctx, http.MethodGet, "/v1/containers", nil, &containers)
+	return containers, err
+}
+
+func (c *Client) InspectContainer(ctx context.Context, id string) (containerTypes.InspectResponse, error) {
+	var inspect containerTypes.InspectResponse
+	err := c.do(ctx, http.MethodGet, containerPath(id, ""), nil, &inspect)
+	return inspect, err
+}
+
+func (c *Client) UpdateContainer(ctx context.Context, id string, cpu float64, memoryMB, memorySwapMB int64) error {
+	req := updateRequest{CPU: cpu, MemoryMB: memoryMB, MemorySwapMB: memorySwapMB}
+	return c.do(ctx, http.MethodPost, containerPath(id, "update"), req, nil)
+}
+
+func (c *Client) Exec(ctx context.Context, id string, cmd []string) (docker.ExecResult, error) {
+	var res docker.ExecResult
+	err := c.do(ctx, http.MethodPost, containerPath(id, "exec"), execRequest{Cmd: cmd}, &res)
+	return res, err
+}
+
+func (c *Client) Probe(ctx context.Context, id string, p docker.Probe) (docker.ProbeResult, error) {
+	var res docker.ProbeResult
+	err := c.do(ctx, http.MethodPost, containerPath(id, "probe"), p, &res)
+	return res, err
+}
+
+func (c *Client) Stats(ctx context.Context, id string) (docker.ContainerStats, error) {
+	var stats docker.ContainerStats
+	err := c.do(ctx, http.MethodGet, containerPath(id, "stats"), nil, &stats)
+	return stats, err
+}
+
+// ExecTTY starts cmd on a TTY in the container over a WebSocket to the agent
+func (c *Client) ExecTTY(ctx context.Context, id string, cmd []string) (docker.ExecSession, error) {
+	location := "ws" + strings.TrimPrefix(c.baseURL, "http") + containerPath(id, "exec") + "?" + url.Values{"cmd": cmd}.Encode()
+	config, err := websocket.NewConfig(location, c.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	config.TlsConfig = c.tls
+	ws, err := config.DialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return terminal.NewSession(ws), nil
+}
+
+// ContainerLogs streams the container's logs, multiplexed as by the Docker API
+func (c *Client) ContainerLogs(ctx context.Context, id string, opts docker.LogOptions) (io.ReadCloser, error) {
+	q := url.Values{"tail": {strconv.Itoa(opts.Tail)}, "follow": {strconv.FormatBool(opts.Follow)}}
+	return c.send(ctx, http.MethodGet, containerPath(id, "logs")+"?"+q.Encode(), nil)
+}
+
+func (c *Client) CreateVolume(ctx context.Context, name string, labels map[string]string) error {
+	return c.do(ctx, http.MethodPost, "/v1/volumes", volumeRequest{Name: name, Labels: labels}, nil)
+}
+
+func (c *Client) ListVolumes(ctx context.Context) ([]docker.Volume, error) {
+	var volumes []docker.Volume
+	err := c.do(ctx, http.MethodGet, "/v1/volumes", nil, &volumes)
+	return volumes, err
+}
+
+func (c *Client) RemoveVolume(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/volumes/"+url.PathEscape(name), nil, nil)
+}
+
+func (c *Client) ListNetworks(ctx context.Context) ([]string, error) {
+	var networks []string
+	err := c.do(ctx, http.MethodGet, "/v1/networks", nil, &networks)
+	return networks, err
+}
+
+func (c *Client) RemoveNetwork(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/networks/"+url.PathEscape(name), nil, nil)
+}
@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"errors"
+	"net/http"
+
+	cerrdefs "github.com/containerd/errdefs"
+)
+
+// errorResponse is the JSON body of a failed agent request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// statusFor maps a runtime error to an HTTP status so that its class
+// (not found, conflict, ...) survives the trip to the client
+func statusFor(err error) int {
+	switch {
+	case cerrdefs.IsNotFound(err):
+		return http.StatusNotFound
+	case cerrdefs.IsConflict(err), cerrdefs.IsAlreadyExists(err):
+		return http.StatusConflict
+	case cerrdefs.IsInvalidArgument(err):
+		return http.StatusBadRequest
+	case cerrdefs.IsUnauthorized(err):
+		return http.StatusUnauthorized
+	case cerrdefs.IsPermissionDenied(err):
+		return http.StatusForbidden
+	case cerrdefs.IsUnavailable(err):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// errorFor rebuilds an error of the class matching an agent response status
+func errorFor(status int, msg string) error {
+	switch status {
+	case http.StatusNotFound:
+		return cerrdefs.ErrNotFound.WithMessage(msg)
+	case http.StatusConflict:
+		return cerrdefs.ErrConflict.WithMessage(msg)
+	case http.StatusBadRequest:
+		return cerrdefs.ErrInvalidArgument.WithMessage(msg)
+	case http.StatusUnauthorized:
+		return cerrdefs.ErrUnauthenticated.WithMessage(msg)
+	case http.StatusForbidden:
+		return cerrdefs.ErrPermissionDenied.WithMessage(msg)
+	case http.StatusServiceUnavailable:
+		return cerrdefs.ErrUnavailable.WithMessage(msg)
+	}
+	return errors.New(msg)
+}
@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mini-cloud/internal/pki"
+)
+
+// joinRequest is the body of the control plane's POST /join
+type joinRequest struct {
+	Token  string `json:"token"`
+	NodeID string `json:"nodeId"`
+	CSR    string `json:"csr"` // PEM certificate request
+}
+
+// joinResponse carries the node's certificate and the cluster CA
+type joinResponse struct {
+	Certificate string `json:"certificate"`
+	CA          string `json:"ca"`
+}
+
+// Join returns the TLS config for serving as nodeID to the control plane. The
+// node certificate in dir is reused while valid; otherwise a new one is
+// requested from the control plane at controlPlane with token and saved in
+// dir. roots verifies the control plane's API certificate; nil uses the
+// system roots.
+func Join(ctx context.Context, controlPlane, token, nodeID, dir string, roots *x509.CertPool) (*tls.Config, error) {
+	certPath := filepath.Join(dir, "node.pem")
+	keyPath := filepath.Join(dir, "node-key.pem")
+	caPath := filepath.Join(dir, "ca.pem")
+
+	if cfg, err := loadServerTLS(certPath, keyPath, caPath, nodeID); err == nil {
+		return cfg, nil
+	}
+
+	keyPEM, csrPEM, err := pki.NewRequest(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(joinRequest{Token: token, NodeID: nodeID, CSR: string(csrPEM)})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(controlPlane, "/")+"/join", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to join: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return nil, fmt.Errorf("control plane refused to join: %s %s", resp.Status, e.Error)
+	}
+	var joined joinResponse
+	if err := json.NewDecoder(resp.Body).Decode(&joined); err != nil {
+		return nil, fmt.Errorf("invalid join response: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	for path, data := range map[string][]byte{keyPath: keyPEM, certPath: []byte(joined.Certificate), caPath: []byte(joined.CA)} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			return nil, err
+		}
+	}
+	return loadServerTLS(certPath, keyPath, caPath, nodeID)
+}
+
+// loadServerTLS builds the agent's TLS config from saved files, failing if
+// the certificate is not for nodeID or is about to expire
+func loadServerTLS(certPath, keyPath, caPath, nodeID string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if leaf.Subject.CommonName != nodeID {
+		return nil, fmt.Errorf("certificate is for %q, not %q", leaf.Subject.CommonName, nodeID)
+	}
+	if time.Until(leaf.NotAfter) < pki.RenewBefore {
+		return nil, errors.New("certificate is about to expire")
+	}
+	caPEM, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("no CA certificate found")
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		// Only the control plane may drive the agent, not other nodes
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 || cs.PeerCertificates[0].Subject.CommonName != pki.ControlPlaneName {
+				return errors.New("client is not the control plane")
+			}
+			return nil
+		},
+	}, nil
+}
+
+// ClientTLS returns the control plane's TLS config for talking to the agent
+// of nodeID: the agent must present a certificate from ca naming nodeID
+func ClientTLS(ca *x509.CertPool, cert tls.Certificate, nodeID string) *tls.Config {
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		RootCAs:      ca,
+		Certificates: []tls.Certificate{cert},
+		ServerName:   nodeID,
+	}
+}
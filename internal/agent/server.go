@@ -0,0 +1,408 @@
+// Package agent lets a node's containers run on a remote host. The agent
+// binary serves a node's container runtime over HTTP and Client talks to it,
+// standing in for a local Docker daemon.
+package agent
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/resourcemanager"
+	"mini-cloud/internal/terminal"
+)
+
+// pullRequest is the body of POST /v1/images/pull
+type pullRequest struct {
+	Image string               `json:"image"`
+	Auth  *docker.RegistryAuth `json:"auth,omitempty"`
+}
+
+// createResponse is returned by POST /v1/containers
+type createResponse struct {
+	ID string `json:"id"`
+}
+
+// updateRequest is the body of POST /v1/containers/{id}/update
+type updateRequest struct {
+	CPU          float64 `json:"cpu"`
+	MemoryMB     int64   `json:"memoryMB"`
+	MemorySwapMB int64   `json:"memorySwapMB"`
+}
+
+// execRequest is the body of POST /v1/containers/{id}/exec
+type execRequest struct {
+	Cmd []string `json:"cmd"`
+}
+
+// digestResponse is the body returned by GET /v1/images/digest
+type digestResponse struct {
+	Digest string `json:"digest"` // empty for images without a registry digest
+}
+
+// volumeRequest is the body of POST /v1/volumes
+type volumeRequest struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Server exposes a container runtime and the host's capacity over HTTP
+type Server struct {
+	runtime  docker.ContainerRuntime
+	capacity resourcemanager.ResourceSpec
+	mux      *http.ServeMux
+}
+
+// NewServer creates an agent serving runtime, advertising capacity to the cluster
+func NewServer(runtime docker.ContainerRuntime, capacity resourcemanager.ResourceSpec) *Server {
+	s := &Server{runtime: runtime, capacity: capacity, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/v1/ping", s.handlePing)
+	s.mux.HandleFunc("/v1/capacity", s.handleCapacity)
+	s.mux.HandleFunc("/v1/images", s.handleImages)
+	s.mux.HandleFunc("/v1/images/pull", s.handlePull)
+	s.mux.HandleFunc("/v1/images/digest", s.handleImageDigest)
+	s.mux.HandleFunc("/v1/containers", s.handleContainers)
+	s.mux.HandleFunc("/v1/containers/", s.handleContainer) // expects /v1/containers/{id}[/action]
+	s.mux.HandleFunc("/v1/volumes", s.handleVolumes)
+	s.mux.HandleFunc("/v1/volumes/", s.handleVolume) // expects /v1/volumes/{name}
+	s.mux.HandleFunc("/v1/networks", s.handleNetworks)
+	s.mux.HandleFunc("/v1/networks/", s.handleNetwork) // expects /v1/networks/{name}
+	return s
+}
+
+// Handler returns the HTTP handler serving the agent API
+func (s *Server) Handler() http.Handler {
+	return otelhttp.NewHandler(s.mux, "mini-cloud-agent")
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: msg})
+}
+
+// writeRuntimeError reports a runtime error with a status matching its class
+func writeRuntimeError(w http.ResponseWriter, err error) {
+	writeError(w, statusFor(err), err.Error())
+}
+
+func (s *Server) handlePing(w http.ResponseWriter, r *http.Request) {
+	if err := s.runtime.Ping(r.Context()); err != nil {
+		writeRuntimeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleCapacity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	writeJSON(w, s.capacity)
+}
+
+func (s *Server) handlePull(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var req pullRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if err := s.runtime.PullImage(r.Context(), req.Image, docker.PullOptions{Auth: req.Auth}); err != nil {
+		writeRuntimeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleContainers lists containers on GET and creates one from a spec on POST
+func (s *Server) handleContainers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		containers, err := s.runtime.ListContainers(r.Context())
+		if err != nil {
+			writeRuntimeError(w, err)
+			return
+		}
+		writeJSON(w, containers)
+	case http.MethodPost:
+		var spec docker.ContainerSpec
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		id, err := s.runtime.CreateContainer(r.Context(), spec)
+		if err != nil {
+			writeRuntimeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, createResponse{ID: id})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleContainer serves GET and DELETE /v1/containers/{id} and the
+// start, stop, restart, update, exec, probe, stats and logs actions below it
+func (s *Server) handleContainer(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/containers/"), "/")
+	if id == "" {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	ctx := r.Context()
+
+	if action == "exec" && isWebSocket(r) {
+		s.execTTY(w, r, id)
+		return
+	}
+
+	allowed := r.Method == http.MethodPost
+	switch action {
+	case "":
+		allowed = r.Method == http.MethodGet || r.Method == http.MethodDelete
+	case "stats", "logs":
+		allowed = r.Method == http.MethodGet
+	}
+	if !allowed {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	timeout, _ := strconv.Atoi(r.URL.Query().Get("timeout"))
+	var err error
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		var inspect any
+		if inspect, err = s.runtime.InspectContainer(ctx, id); err == nil {
+			writeJSON(w, inspect)
+			return
+		}
+	case action == "":
+		err = s.runtime.RemoveContainer(ctx, id)
+	case action == "stats":
+		var stats docker.ContainerStats
+		if stats, err = s.runtime.Stats(ctx, id); err == nil {
+			writeJSON(w, stats)
+			return
+		}
+	case action == "logs":
+		opts := docker.LogOptions{}
+		opts.Tail, _ = strconv.Atoi(r.URL.Query().Get("tail"))
+		opts.Follow, _ = strconv.ParseBool(r.URL.Query().Get("follow"))
+		var logs io.ReadCloser
+		if logs, err = s.runtime.ContainerLogs(ctx, id, opts); err == nil {
+			defer logs.Close()
+			w.Header().Set("Content-Type", "application/vnd.docker.multiplexed-stream")
+			w.WriteHeader(http.StatusOK)
+			_, _ = io.Copy(flushWriter{w}, logs)
+			return
+		}
+	case action == "start":
+		err = s.runtime.StartContainer(ctx, id)
+	case action == "stop":
+		err = s.runtime.StopContainer(ctx, id, timeout)
+	case action == "restart":
+		err = s.runtime.RestartContainer(ctx, id, timeout)
+	case action == "update":
+		var req updateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		err = s.runtime.UpdateContainer(ctx, id, req.CPU, req.MemoryMB, req.MemorySwapMB)
+	case action == "exec":
+		var req execRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		var res docker.ExecResult
+		if res, err = s.runtime.Exec(ctx, id, req.Cmd); err == nil {
+			writeJSON(w, res)
+			return
+		}
+	case action == "probe":
+		var req docker.Probe
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		var res docker.ProbeResult
+		if res, err = s.runtime.Probe(ctx, id, req); err == nil {
+			writeJSON(w, res)
+			return
+		}
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	if err != nil {
+		writeRuntimeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isWebSocket reports whether r asks to upgrade to a WebSocket
+func isWebSocket(r *http.Request) bool {
+	return r.Method == http.MethodGet && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// execTTY runs the ?cmd= command on a TTY in container id and connects it to
+// a WebSocket, as described in package terminal
+func (s *Server) execTTY(w http.ResponseWriter, r *http.Request, id string) {
+	sess, err := s.runtime.ExecTTY(r.Context(), id, r.URL.Query()["cmd"])
+	if err != nil {
+		writeRuntimeError(w, err)
+		return
+	}
+	terminal.Attach(w, r, sess)
+}
+
+// flushWriter flushes every write, so that followed logs reach the client
+// as they are produced
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if f, ok := fw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
+
+// handleImages lists the images present on the node on GET and removes the
+// one given by ?ref= on DELETE
+func (s *Server) handleImages(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		images, err := s.runtime.ListImages(r.Context())
+		if err != nil {
+			writeRuntimeError(w, err)
+			return
+		}
+		writeJSON(w, images)
+	case http.MethodDelete:
+		ref := r.URL.Query().Get("ref")
+		if ref == "" {
+			writeError(w, http.StatusBadRequest, "Missing ref")
+			return
+		}
+		if err := s.runtime.RemoveImage(r.Context(), ref); err != nil {
+			writeRuntimeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleImageDigest serves GET /v1/images/digest?ref=
+func (s *Server) handleImageDigest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	digest, err := s.runtime.ImageDigest(r.Context(), r.URL.Query().Get("ref"))
+	if err != nil {
+		writeRuntimeError(w, err)
+		return
+	}
+	writeJSON(w, digestResponse{Digest: digest})
+}
+
+// handleVolumes lists managed volumes on GET and creates one on POST
+func (s *Server) handleVolumes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		volumes, err := s.runtime.ListVolumes(r.Context())
+		if err != nil {
+			writeRuntimeError(w, err)
+			return
+		}
+		writeJSON(w, volumes)
+	case http.MethodPost:
+		var req volumeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		if err := s.runtime.CreateVolume(r.Context(), req.Name, req.Labels); err != nil {
+			writeRuntimeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleVolume serves DELETE /v1/volumes/{name}
+func (s *Server) handleVolume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/v1/volumes/")
+	if name == "" {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if err := s.runtime.RemoveVolume(r.Context(), name); err != nil {
+		writeRuntimeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleNetworks lists the names of managed networks
+func (s *Server) handleNetworks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	networks, err := s.runtime.ListNetworks(r.Context())
+	if err != nil {
+		writeRuntimeError(w, err)
+		return
+	}
+	writeJSON(w, networks)
+}
+
+// handleNetwork serves DELETE /v1/networks/{name}
+func (s *Server) handleNetwork(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/v1/networks/")
+	if name == "" {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if err := s.runtime.RemoveNetwork(r.Context(), name); err != nil {
+		writeRuntimeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,145 +2,1800 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/time/rate"
+
+	"mini-cloud/internal/audit"
 	"mini-cloud/internal/cluster"
+	"mini-cloud/internal/config"
 	"mini-cloud/internal/docker"
+	"mini-cloud/internal/events"
+	"mini-cloud/internal/logging"
+	"mini-cloud/internal/manager"
+	"mini-cloud/internal/metrics"
+	"mini-cloud/internal/pki"
+	"mini-cloud/internal/resourcemanager"
+	"mini-cloud/internal/terminal"
 )
 
 // provisionRequest defines the JSON format for provisioning a container
 type provisionRequest struct {
-	Name   string  `json:"name"`
-	Image  string  `json:"image"`
+	Name          string   `json:"name"`
+	Namespace     string   `json:"namespace"`
+	Image         string   `json:"image"`
+	Command       []string `json:"command"`    // overrides the image's CMD
+	Entrypoint    []string `json:"entrypoint"` // overrides the image's ENTRYPOINT
+	CPU           float64  `json:"cpu"`
+	Memory        int64    `json:"memory"`
+	GPU           int      `json:"gpu"`
+	Disk          int      `json:"disk"` // in MB
+	TTL           string   `json:"ttl"`
+	RestartPolicy string   `json:"restartPolicy"` // never (default), on-failure[:max], always
+	StopTimeout   int      `json:"stopTimeout"`   // seconds to wait before SIGKILL on terminate
+	Replicas      int      `json:"replicas"`      // schedules name-0 ... name-(n-1) when > 1
+	Priority      int      `json:"priority"`      // may preempt lower-priority containers when the cluster is full
+	Burstable     bool     `json:"burstable"`     // may use idle capacity of reserved-full nodes
+	Network       string   `json:"network"`       // user-defined network, created on the node if missing
+	MemorySwap    int64    `json:"memorySwap"`    // memory plus swap in MB, -1 for unlimited
+	CPUShares     int64    `json:"cpuShares"`     // relative CPU weight, Docker default 1024
+	CPUQuota      int64    `json:"cpuQuota"`      // microseconds per 100ms period, replaces the cpu limit
+
+	HealthCheck  *healthCheckRequest  `json:"healthCheck"`
+	Probe        *probeRequest        `json:"probe"`
+	RegistryAuth *registryAuthRequest `json:"registryAuth"`
+	Ports        []portRequest        `json:"ports"`
+	Mounts       []mountRequest       `json:"mounts"`
+
+	NodeSelector        map[string]string `json:"nodeSelector"`        // only nodes with all these labels
+	AntiAffinityKey     string            `json:"antiAffinityKey"`     // spread containers sharing this key across nodes
+	RequireAntiAffinity bool              `json:"requireAntiAffinity"` // fail instead of co-locating
+	DependsOn           []string          `json:"dependsOn"`           // batch items to start first, by name
+	Labels              map[string]string `json:"labels"`              // container labels, e.g. {"app": "web"}
+	Env                 map[string]string `json:"env"`                 // environment variables, e.g. {"PORT": "8080"}
+	AntiAffinity        map[string]string `json:"antiAffinity"`        // avoid nodes running containers with these labels
+
+	RequestID string `json:"requestId"` // same as the Idempotency-Key header
+}
+
+// registryAuthRequest carries private registry credentials for the image pull
+type registryAuthRequest struct {
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	ServerAddress string `json:"serverAddress"`
+	Token         string `json:"token"` // pre-encoded base64 auth config
+}
+
+// toRegistryAuth converts the credentials for the runtime, nil if none were sent
+func (a *registryAuthRequest) toRegistryAuth() *docker.RegistryAuth {
+	if a == nil {
+		return nil
+	}
+	return &docker.RegistryAuth{
+		Username:      a.Username,
+		Password:      a.Password,
+		ServerAddress: a.ServerAddress,
+		Token:         a.Token,
+	}
+}
+
+// portRequest publishes a container port on the node
+type portRequest struct {
+	ContainerPort int    `json:"containerPort"`
+	HostPort      int    `json:"hostPort"` // omit to let Docker pick one
+	Protocol      string `json:"protocol"` // tcp (default) or udp
+}
+
+// toPorts validates the requested ports and converts them into port mappings
+func toPorts(reqs []portRequest) ([]docker.PortMapping, error) {
+	ports := make([]docker.PortMapping, 0, len(reqs))
+	hostPorts := make(map[string]bool)
+	for _, p := range reqs {
+		if p.ContainerPort < 1 || p.ContainerPort > 65535 || p.HostPort < 0 || p.HostPort > 65535 {
+			return nil, fmt.Errorf("Invalid port mapping %d:%d (ports must be 1-65535)", p.HostPort, p.ContainerPort)
+		}
+		if p.Protocol != "" && p.Protocol != "tcp" && p.Protocol != "udp" {
+			return nil, fmt.Errorf("Invalid port protocol %q (expected \"tcp\" or \"udp\")", p.Protocol)
+		}
+		m := docker.PortMapping{ContainerPort: p.ContainerPort, HostPort: p.HostPort, Protocol: p.Protocol}
+		if key := m.HostKey(); key != "" {
+			if hostPorts[key] {
+				return nil, fmt.Errorf("Host port %s is mapped twice", key)
+			}
+			hostPorts[key] = true
+		}
+		ports = append(ports, m)
+	}
+	return ports, nil
+}
+
+// healthCheckRequest configures a Docker health check for the container
+type healthCheckRequest struct {
+	Test     []string `json:"test"`     // e.g. ["curl", "-f", "http://localhost/"]
+	Interval string   `json:"interval"` // e.g. "5s"
+	Timeout  string   `json:"timeout"`
+	Retries  int      `json:"retries"`
+}
+
+// toHealthCheck validates the request and converts it into a health check
+func (req healthCheckRequest) toHealthCheck() (*docker.HealthCheck, error) {
+	if len(req.Test) == 0 {
+		return nil, errors.New("Health check test command is required")
+	}
+	hc := &docker.HealthCheck{Test: req.Test, Retries: req.Retries}
+	for _, d := range []struct {
+		value string
+		dst   *time.Duration
+	}{{req.Interval, &hc.Interval}, {req.Timeout, &hc.Timeout}} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("Invalid health check duration %q", d.value)
+		}
+		*d.dst = v
+	}
+	return hc, nil
+}
+
+// probeRequest configures a liveness probe run by the node's manager
+type probeRequest struct {
+	Type             string   `json:"type"` // http, tcp or exec
+	Port             int      `json:"port"`
+	Path             string   `json:"path"`
+	Command          []string `json:"command"`
+	Interval         string   `json:"interval"` // e.g. "10s"
+	Timeout          string   `json:"timeout"`
+	FailureThreshold int      `json:"failureThreshold"`
+	Action           string   `json:"action"` // restart or replace; empty only marks the container unhealthy
+}
+
+// toProbe validates the request and converts it into a probe
+func (req probeRequest) toProbe() (*docker.Probe, error) {
+	p := &docker.Probe{
+		Type:             req.Type,
+		Port:             req.Port,
+		Path:             req.Path,
+		Command:          req.Command,
+		FailureThreshold: req.FailureThreshold,
+		Action:           req.Action,
+	}
+	for _, d := range []struct {
+		value string
+		dst   *time.Duration
+	}{{req.Interval, &p.Interval}, {req.Timeout, &p.Timeout}} {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("Invalid probe duration %q", d.value)
+		}
+		*d.dst = v
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid probe: %w", err)
+	}
+	return p, nil
+}
+
+// toSpec validates the request and converts it into a container spec
+func (req provisionRequest) toSpec() (docker.ContainerSpec, error) {
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil {
+		return docker.ContainerSpec{}, fmt.Errorf("Invalid TTL format (example: \"10s\", \"5m\"): %w", err)
+	}
+
+	if req.MemorySwap > 0 && req.MemorySwap < req.Memory {
+		return docker.ContainerSpec{}, errors.New("memorySwap must be at least memory, or -1 for unlimited")
+	}
+	if req.CPUShares < 0 || req.CPUQuota < 0 {
+		return docker.ContainerSpec{}, errors.New("cpuShares and cpuQuota must not be negative")
+	}
+	for k := range req.Env {
+		if k == "" || strings.ContainsAny(k, "=\x00") {
+			return docker.ContainerSpec{}, fmt.Errorf("invalid environment variable name %q", k)
+		}
+	}
+	for k := range req.Labels {
+		if strings.HasPrefix(k, "mini-cloud.") {
+			return docker.ContainerSpec{}, fmt.Errorf("label %q uses the reserved mini-cloud. prefix", k)
+		}
+	}
+
+	if !docker.ValidRestartPolicy(req.RestartPolicy) {
+		return docker.ContainerSpec{}, errors.New("Invalid restart policy (expected \"never\", \"on-failure\", \"on-failure:N\" or \"always\")")
+	}
+
+	spec := docker.ContainerSpec{
+		Name:          req.Name,
+		Namespace:     req.Namespace,
+		Image:         req.Image,
+		Command:       req.Command,
+		Entrypoint:    req.Entrypoint,
+		Env:           req.Env,
+		CPU:           req.CPU,
+		Memory:        req.Memory,
+		GPU:           req.GPU,
+		DiskMB:        req.Disk,
+		TTL:           ttl,
+		RestartPolicy: req.RestartPolicy,
+		StopTimeout:   req.StopTimeout,
+		Priority:      req.Priority,
+		Burstable:     req.Burstable,
+		Network:       req.Network,
+		MemorySwapMB:  req.MemorySwap,
+		CPUShares:     req.CPUShares,
+		CPUQuota:      req.CPUQuota,
+
+		NodeSelector:        req.NodeSelector,
+		AntiAffinityKey:     req.AntiAffinityKey,
+		RequireAntiAffinity: req.RequireAntiAffinity,
+		DependsOn:           req.DependsOn,
+		Labels:              req.Labels,
+		AntiAffinity:        req.AntiAffinity,
+	}
+	if req.HealthCheck != nil {
+		if spec.HealthCheck, err = req.HealthCheck.toHealthCheck(); err != nil {
+			return docker.ContainerSpec{}, err
+		}
+	}
+	if req.Probe != nil {
+		if spec.Probe, err = req.Probe.toProbe(); err != nil {
+			return docker.ContainerSpec{}, err
+		}
+	}
+	if len(req.Ports) > 0 {
+		if spec.Ports, err = toPorts(req.Ports); err != nil {
+			return docker.ContainerSpec{}, err
+		}
+	}
+	if len(req.Mounts) > 0 {
+		if spec.Mounts, err = toMounts(req.Mounts); err != nil {
+			return docker.ContainerSpec{}, err
+		}
+	}
+	spec.RegistryAuth = req.RegistryAuth.toRegistryAuth()
+	return spec, nil
+}
+
+// containerResponse is a container's metadata plus values derived at response time
+type containerResponse struct {
+	*manager.ContainerInfo
+	AgeSeconds          int64
+	TTLRemainingSeconds *int64 `json:",omitempty"` // only for containers with a TTL
+}
+
+func newContainerResponse(info *manager.ContainerInfo, now time.Time) containerResponse {
+	resp := containerResponse{ContainerInfo: info, AgeSeconds: int64(now.Sub(info.CreatedAt).Seconds())}
+	if info.TTL > 0 {
+		remaining := int64(max(info.CreatedAt.Add(info.TTL).Sub(now), 0).Seconds())
+		resp.TTLRemainingSeconds = &remaining
+	}
+	return resp
+}
+
+// statusResponse is a container's tracked metadata next to its live Docker state
+type statusResponse struct {
+	containerResponse
+	Live      *liveResponse `json:",omitempty"`
+	LiveError string        `json:",omitempty"` // set instead of Live if Docker couldn't be asked
+}
+
+// liveResponse is the state Docker currently reports for a container
+type liveResponse struct {
+	Status   string
+	Health   string `json:",omitempty"`
+	Healthy  bool   // running and, if it has a health check, reported healthy
+	Mismatch string `json:",omitempty"` // describes a disagreement with the tracked status
+}
+
+func newLiveResponse(tracked string, live manager.LiveState) *liveResponse {
+	resp := &liveResponse{
+		Status:  live.Status,
+		Health:  live.Health,
+		Healthy: live.Status == "running" && (live.Health == "" || live.Health == "healthy"),
+	}
+	// A failing probe marks a running container unhealthy, unknown to Docker
+	if tracked != live.Status && !(tracked == manager.StatusUnhealthy && live.Status == "running") {
+		resp.Mismatch = fmt.Sprintf("tracked as %q but Docker reports %q", tracked, live.Status)
+	}
+	return resp
+}
+
+// provisionResponse is the container created by /provision, plus the IDs of
+// any lower-priority containers preempted to make room for it
+type provisionResponse struct {
+	containerResponse
+	Evicted []string `json:"evicted,omitempty"`
+}
+
+// replicasResponse is returned when more than one replica was requested
+type replicasResponse struct {
+	Containers []*manager.ContainerInfo `json:"containers"`
+	Error      string                   `json:"error,omitempty"`
+}
+
+// batchResult reports the outcome of one item of a batch provision
+type batchResult struct {
+	Index     int                    `json:"index"`
+	Container *manager.ContainerInfo `json:"container,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+// resourcesResponse is the JSON form of a set of node resources
+type resourcesResponse struct {
+	CPU    float64 `json:"cpu"`
+	Memory int     `json:"memory"`
+	GPU    int     `json:"gpu"`
+	Disk   int     `json:"disk"`
+}
+
+func newResourcesResponse(r resourcemanager.ResourceSpec) resourcesResponse {
+	return resourcesResponse{CPU: r.CPU, Memory: r.Memory, GPU: r.GPU, Disk: r.DiskMB}
+}
+
+// dryRunResponse reports where a provision request would be placed
+type dryRunResponse struct {
+	Node     string            `json:"node"`
+	Leftover resourcesResponse `json:"leftover"` // node resources left after the hypothetical placement
+}
+
+// terminateWhereRequest is the body of POST /terminate; at least one field must be set
+type terminateWhereRequest struct {
+	Node      string `json:"node"`
+	Namespace string `json:"namespace"`
+	Image     string `json:"image"` // substring of the image name
+	Status    string `json:"status"`
+	OlderThan string `json:"olderThan"` // e.g. "1h"
+}
+
+// terminateWhereResponse lists what POST /terminate terminated and what failed
+type terminateWhereResponse struct {
+	Terminated []string          `json:"terminated"`
+	Errors     map[string]string `json:"errors,omitempty"` // container ID -> error
+}
+
+// clusterResponse is the cluster-wide capacity and utilization summary
+type clusterResponse struct {
+	Nodes        int                `json:"nodes"`
+	HealthyNodes int                `json:"healthyNodes"`
+	Containers   int                `json:"containers"`
+	Capacity     resourcesResponse  `json:"capacity"`
+	Allocated    resourcesResponse  `json:"allocated"`
+	Utilization  utilizationPercent `json:"utilization"`
+}
+
+// utilizationPercent is the share of each resource allocated, 0-100
+type utilizationPercent struct {
 	CPU    float64 `json:"cpu"`
-	Memory int64   `json:"memory"`
-	TTL    string  `json:"ttl"`
+	Memory float64 `json:"memory"`
+	GPU    float64 `json:"gpu"`
+	Disk   float64 `json:"disk"`
+}
+
+// percent returns used as a percentage of total, 0 if total is 0
+func percent(used, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return math.Round(used/total*10000) / 100
+}
+
+// nodeResponse describes one node in the /nodes listing
+type nodeResponse struct {
+	ID        string            `json:"id"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Status    string            `json:"status"` // Ready, NotReady or Draining
+	Healthy   bool              `json:"healthy"`
+	Draining  bool              `json:"draining,omitempty"`
+	Capacity  resourcesResponse `json:"capacity"`
+	Allocated resourcesResponse `json:"allocated"`
+	Usage     *usageResponse    `json:"usage,omitempty"` // measured, when usage sampling is enabled
+
+	LastHeartbeat    *time.Time `json:"lastHeartbeat,omitempty"` // unset until the first successful ping
+	MissedHeartbeats int        `json:"missedHeartbeats"`
+}
+
+// usageResponse is a node's measured CPU and memory usage
+type usageResponse struct {
+	CPU       float64   `json:"cpu"`
+	Memory    int64     `json:"memory"`
+	SampledAt time.Time `json:"sampledAt"`
+}
+
+// newNodeResponse converts a node status for the API
+func newNodeResponse(node cluster.NodeStatus) nodeResponse {
+	resp := nodeResponse{
+		ID:        node.ID,
+		Labels:    node.Labels,
+		Status:    "Ready",
+		Healthy:   node.Healthy,
+		Draining:  node.Draining,
+		Capacity:  newResourcesResponse(node.Capacity),
+		Allocated: newResourcesResponse(node.Allocated),
+
+		MissedHeartbeats: node.MissedHeartbeats,
+	}
+	switch {
+	case !node.Healthy:
+		resp.Status = "NotReady"
+	case node.Draining:
+		resp.Status = "Draining"
+	}
+	if !node.LastHeartbeat.IsZero() {
+		resp.LastHeartbeat = &node.LastHeartbeat
+	}
+	if u := node.Usage; u != nil {
+		resp.Usage = &usageResponse{CPU: u.CPU, Memory: u.MemoryMB, SampledAt: u.SampledAt}
+	}
+	return resp
+}
+
+// quotaRequest is the body of PUT /quotas/{namespace}; 0 means no limit
+type quotaRequest struct {
+	CPU        float64 `json:"cpu"`
+	Memory     int64   `json:"memory"` // in MB
+	Containers int     `json:"containers"`
+}
+
+// quotaResponse reports a namespace's quota and current usage
+type quotaResponse struct {
+	Namespace string        `json:"namespace"`
+	Quota     *quotaRequest `json:"quota,omitempty"` // nil when the namespace is unlimited
+	Used      quotaRequest  `json:"used"`
+}
+
+// scalePolicyRequest is the body of PUT /autoscale/{workload}
+type scalePolicyRequest struct {
+	Template    provisionRequest `json:"template"` // name is ignored; replicas are named <workload>-<n>. Omitted for deployments.
+	MinReplicas int              `json:"minReplicas"`
+	MaxReplicas int              `json:"maxReplicas"`
+	TargetCPU   float64          `json:"targetCPU"` // percent of each replica's reserved CPU
+	Cooldown    string           `json:"cooldown"`  // e.g. "2m", defaults to 1m
+}
+
+// defaultScaleCooldown is used when a scale policy doesn't set a cooldown
+const defaultScaleCooldown = time.Minute
+
+// workloadResponse describes an autoscaled workload in GET /autoscale
+type workloadResponse struct {
+	Name        string  `json:"name"`
+	Image       string  `json:"image"`
+	Replicas    int     `json:"replicas"`
+	MinReplicas int     `json:"minReplicas"`
+	MaxReplicas int     `json:"maxReplicas"`
+	TargetCPU   float64 `json:"targetCPU"`
+	Cooldown    string  `json:"cooldown"`
+	Deployment  bool    `json:"deployment"` // scales the deployment of the same name
+}
+
+// defaultExecTimeout bounds commands run via /exec when no timeout is given
+const defaultExecTimeout = 30 * time.Second
+
+// execRequest is the body of POST /exec/{id}
+type execRequest struct {
+	Cmd     []string `json:"cmd"`
+	Timeout string   `json:"timeout"` // e.g. "10s", defaults to 30s
+}
+
+// execResponse reports the result of a command run inside a container
+type execResponse struct {
+	ExitCode int    `json:"exitCode"`
+	Output   string `json:"output"`
+}
+
+// statsTimeout bounds sampling a container's usage for /stats
+const statsTimeout = 10 * time.Second
+
+// statsResponse compares a container's actual usage with what it reserved
+type statsResponse struct {
+	ID               string  `json:"id"`
+	NodeID           string  `json:"nodeId"`
+	CPUPercent       float64 `json:"cpuPercent"` // of one core
+	ReservedCPU      float64 `json:"reservedCpu"`
+	MemoryUsageMB    int64   `json:"memoryUsageMB"`
+	MemoryLimitMB    int64   `json:"memoryLimitMB"`
+	ReservedMemoryMB int64   `json:"reservedMemoryMB"`
+	NetworkRxBytes   uint64  `json:"networkRxBytes"`
+	NetworkTxBytes   uint64  `json:"networkTxBytes"`
+	BlockReadBytes   uint64  `json:"blockReadBytes"`
+	BlockWriteBytes  uint64  `json:"blockWriteBytes"`
+}
+
+// errorResponse is the JSON body returned for every failed request
+type errorResponse struct {
+	Error   string   `json:"error"`
+	Status  int      `json:"status"`
+	Reasons []string `json:"reasons,omitempty"` // why each node rejected a provision
+}
+
+// writeJSONError writes msg as a JSON error body with the given status code
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: msg, Status: status})
 }
 
 // ClusterServer exposes HTTP endpoints for a multi-node mini-cloud
 type ClusterServer struct {
-	cluster *cluster.ClusterManager
-	ctx     context.Context
+	cluster  *cluster.ClusterManager
+	mux      *http.ServeMux
+	server   *http.Server
+	tls      *TLSOptions   // if set, Run serves HTTPS
+	redirect *http.Server  // redirects HTTP to HTTPS when TLSOptions.RedirectAddr is set
+	done     chan struct{} // closed on shutdown to end streaming responses
+	stop     sync.Once
+
+	provisionLimiter *rate.Limiter // shared by the provisioning endpoints
+	scheduleTimeout  time.Duration // bounds each provisioning request
+	idempotency      *idempotencyStore
+	nodeFactory      NodeFactory // builds nodes registered through POST /nodes
+	log              *slog.Logger
+	logLevels        *logging.Levels                 // if set, exposed through /loglevels
+	audit            audit.Log                       // if set, mutating requests are recorded here
+	apiKeys          map[[sha256.Size]byte]principal // by hash of the key; with no keys or jwt the API is open
+	jwt              *config.JWTConfig               // if set, signed bearer tokens are accepted
+	ca               *pki.CA                         // if set, agents can join with joinToken
+	joinToken        string
+	joinExpires      time.Time // joinToken is rejected after this
+	bindMountRoots   []string  // host directories bind mounts may use; none disables them
+}
+
+// NodeFactory builds a node from its config, e.g. connecting to its Docker daemon
+type NodeFactory func(nc config.NodeConfig) (*cluster.Node, error)
+
+// SetNodeFactory enables registering nodes at runtime with POST /nodes
+func (s *ClusterServer) SetNodeFactory(f NodeFactory) {
+	s.nodeFactory = f
 }
 
 // NewClusterServer creates and configures the API server using a ClusterManager
 func NewClusterServer(cm *cluster.ClusterManager) *ClusterServer {
-	return &ClusterServer{
+	s := &ClusterServer{
 		cluster: cm,
-		ctx:     context.Background(),
+		mux:     http.NewServeMux(),
+		done:    make(chan struct{}),
+		log:     slog.Default(),
+
+		provisionLimiter: rate.NewLimiter(DefaultProvisionRate, DefaultProvisionBurst),
+		scheduleTimeout:  DefaultScheduleTimeout,
+		idempotency:      newIdempotencyStore(DefaultIdempotencyTTL),
 	}
+	s.routes()
+	s.server = &http.Server{Handler: s.Handler()}
+	return s
+}
+
+// spanName names a request's server span after its method and top-level
+// route, keeping container IDs out of span names
+func spanName(_ string, r *http.Request) string {
+	route, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	return r.Method + " /" + route
+}
+
+// DefaultScheduleTimeout bounds provisioning, including image pulls, unless changed with SetScheduleTimeout
+const DefaultScheduleTimeout = 5 * time.Minute
+
+// SetScheduleTimeout sets how long a provisioning request may take before it
+// is aborted and its reserved resources are released
+func (s *ClusterServer) SetScheduleTimeout(d time.Duration) {
+	s.scheduleTimeout = d
+}
+
+// scheduleContext returns the context for scheduling on behalf of r. It is
+// cancelled when the client goes away or the schedule timeout passes.
+func (s *ClusterServer) scheduleContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), s.scheduleTimeout)
+}
+
+// routes registers all endpoints on the server's own mux
+func (s *ClusterServer) routes() {
+	s.mux.HandleFunc("/provision", s.idempotent(rateLimited(s.provisionLimiter, s.handleProvision)))
+	s.mux.HandleFunc("/provision/batch", s.idempotent(rateLimited(s.provisionLimiter, s.handleProvisionBatch)))
+	s.mux.HandleFunc("/schedule/dryrun", s.handleDryRun)
+	s.mux.HandleFunc("/terminate", s.handleTerminateWhere)
+	s.mux.HandleFunc("/terminate/", s.handleTerminate) // expects /terminate/{id}
+	s.mux.HandleFunc("/status/", s.handleStatus)       // expects /status/{id}
+	s.mux.HandleFunc("/list", s.handleList)
+	s.mux.HandleFunc("/containers/", s.handleContainer) // expects /containers/{id}
+	s.mux.HandleFunc("/metrics", s.handleMetrics)
+	s.mux.HandleFunc("/cluster", s.handleCluster)
+	s.mux.HandleFunc("/nodes", s.handleNodes)
+	s.mux.HandleFunc("/nodes/", s.handleNode) // expects /nodes/{id} or /nodes/{id}/allocations
+	s.mux.HandleFunc("/events", s.handleEvents)
+	s.mux.HandleFunc("/history/", s.handleHistory) // expects /history/{id}
+	s.mux.HandleFunc("/exec/", s.handleExec)       // expects /exec/{id}
+	s.mux.HandleFunc("/logs/", s.handleLogs)       // expects /logs/{id}
+	s.mux.HandleFunc("/stats/", s.handleStats)     // expects /stats/{id}
+	s.mux.HandleFunc("/restart/", s.handleRestart) // expects /restart/{id}
+	s.mux.HandleFunc("/renew/", s.handleRenew)     // expects /renew/{id}
+	s.mux.HandleFunc("/join", s.handleJoin)
+	s.mux.HandleFunc("/audit", s.handleAudit)
+	s.mux.HandleFunc("/loglevels", s.handleLogLevels)
+	s.mux.HandleFunc("/loglevels/", s.handleLogLevel) // expects /loglevels/{component}
+	s.mux.HandleFunc("/quotas", s.handleQuotas)
+	s.mux.HandleFunc("/quotas/", s.handleQuota) // expects /quotas/{namespace}
+	s.mux.HandleFunc("/autoscale", s.handleWorkloads)
+	s.mux.HandleFunc("/autoscale/", s.handleScalePolicy) // expects /autoscale/{workload}
+	s.mux.HandleFunc("/deployments", s.handleDeployments)
+	s.mux.HandleFunc("/deployments/", s.handleDeployment) // expects /deployments/{name} or /deployments/{name}/scale
+	s.mux.HandleFunc("/images", s.handleImages)
+	s.mux.HandleFunc("/images/prepull", s.handlePrepull)
+	s.mux.HandleFunc("/volumes", s.handleVolumes)
+	s.mux.HandleFunc("/volumes/", s.handleVolume)        // expects /volumes/{node}/{name}
+	s.mux.HandleFunc("/namespaces/", s.handleNamespaced) // expects /namespaces/{namespace}/{route}
+}
+
+// Handler returns the HTTP handler serving the API, e.g. for use with httptest
+func (s *ClusterServer) Handler() http.Handler {
+	return otelhttp.NewHandler(s.authenticated(s.audited(s.mux)), "mini-cloud", otelhttp.WithSpanNameFormatter(spanName))
 }
 
-// Run starts the HTTP server
+// Run starts the server, over HTTPS if SetTLS was called, and blocks until
+// it fails or is shut down
 func (s *ClusterServer) Run(addr string) error {
-	http.HandleFunc("/provision", s.handleProvision)
-	http.HandleFunc("/terminate/", s.handleTerminate) // expects /terminate/{id}
-	http.HandleFunc("/status/", s.handleStatus)       // expects /status/{id}
-	http.HandleFunc("/list", s.handleList)
+	s.server.Addr = addr
+	var err error
+	if s.tls != nil {
+		if s.redirect != nil {
+			go s.runRedirect()
+		}
+		s.log.Info("starting cluster server", "addr", addr, "tls", true, "client_certs", s.tls.ClientCAFile != "")
+		err = s.server.ListenAndServeTLS(s.tls.CertFile, s.tls.KeyFile)
+	} else {
+		s.log.Info("starting cluster server", "addr", addr)
+		err = s.server.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
 
-	log.Printf("Starting cluster server on %s...", addr)
-	return http.ListenAndServe(addr, nil)
+// Shutdown stops accepting connections and waits for in-flight requests to finish
+func (s *ClusterServer) Shutdown(ctx context.Context) error {
+	s.stop.Do(func() { close(s.done) })
+	if s.redirect != nil {
+		_ = s.redirect.Shutdown(ctx)
+	}
+	return s.server.Shutdown(ctx)
 }
 
-// handleProvision creates a container across any available node
+// defaultWaitTimeout bounds how long /provision?wait=true waits for a healthy container
+const defaultWaitTimeout = 60 * time.Second
+
+// handleProvision creates a container across any available node. With
+// ?wait=true it responds once the container is healthy, or with 504 if that
+// takes longer than ?timeout= (default 60s).
 func (s *ClusterServer) handleProvision(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	var req provisionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if err := confineNamespace(r, &req.Namespace); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	ttl, err := time.ParseDuration(req.TTL)
+	spec, err := s.specFor(req)
 	if err != nil {
-		http.Error(w, "Invalid TTL format (example: \"10s\", \"5m\"): "+err.Error(), http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	spec := docker.ContainerSpec{
-		Name:   req.Name,
-		Image:  req.Image,
-		CPU:    req.CPU,
-		Memory: req.Memory,
-		TTL:    ttl,
+	if req.Replicas > 1 {
+		s.provisionReplicas(w, r, spec, req.Replicas)
+		return
+	}
+
+	wait := r.URL.Query().Get("wait") == "true"
+	waitTimeout := defaultWaitTimeout
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		waitTimeout, err = time.ParseDuration(t)
+		if err != nil || waitTimeout <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "Invalid timeout (example: \"30s\")")
+			return
+		}
 	}
 
-	info, err := s.cluster.Schedule(s.ctx, spec)
+	ctx, cancel := s.scheduleContext(r)
+	defer cancel()
+	info, evicted, err := s.cluster.ScheduleWithEvictions(ctx, spec)
 	if err != nil {
-		http.Error(w, "Provision failed: "+err.Error(), http.StatusInternalServerError)
+		writeProvisionError(w, err)
 		return
 	}
+	auditTarget(r, info)
+
+	if wait {
+		ctx, cancel := context.WithTimeout(r.Context(), waitTimeout)
+		defer cancel()
+		if err := s.cluster.WaitHealthy(ctx, info.ID); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, context.DeadlineExceeded) {
+				status = http.StatusGatewayTimeout
+			}
+			writeJSONError(w, status, fmt.Sprintf("Container %s did not become healthy: %v", info.ID, err))
+			return
+		}
+	}
 
+	resp := provisionResponse{containerResponse: newContainerResponse(info, time.Now())}
+	for _, e := range evicted {
+		resp.Evicted = append(resp.Evicted, e.ID)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(info)
+	_ = json.NewEncoder(w).Encode(resp)
 }
 
-// handleTerminate deletes a container regardless of which node it's on
-func (s *ClusterServer) handleTerminate(w http.ResponseWriter, r *http.Request) {
+// provisionReplicas schedules n copies of spec and reports partial placement with 207
+func (s *ClusterServer) provisionReplicas(w http.ResponseWriter, r *http.Request, spec docker.ContainerSpec, n int) {
+	ctx, cancel := s.scheduleContext(r)
+	defer cancel()
+	containers, err := s.cluster.ScheduleReplicas(ctx, spec, n)
+	for _, info := range containers {
+		auditTarget(r, info)
+	}
+	if err != nil && len(containers) == 0 {
+		writeProvisionError(w, err)
+		return
+	}
+
+	resp := replicasResponse{Containers: containers}
+	status := http.StatusOK
+	if err != nil {
+		resp.Error = err.Error()
+		status = http.StatusMultiStatus
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// capacityRetryAfter is the Retry-After hint, in seconds, sent when the cluster is full
+const capacityRetryAfter = 30
+
+// writeProvisionError writes a scheduling error with its status code. A full
+// cluster is reported as 503 with a Retry-After hint, and the reasons each
+// node was rejected are listed when known.
+func writeProvisionError(w http.ResponseWriter, err error) {
+	status := provisionErrorStatus(err)
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", strconv.Itoa(capacityRetryAfter))
+	}
+
+	resp := errorResponse{Error: "Provision failed: " + err.Error(), Status: status}
+	var serr *cluster.SchedulingError
+	if errors.As(err, &serr) {
+		for _, r := range serr.Rejections {
+			resp.Reasons = append(resp.Reasons, r.String())
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// provisionErrorStatus maps a scheduling error to an HTTP status code
+func provisionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, manager.ErrNameConflict):
+		return http.StatusConflict
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, cluster.ErrQuotaExceeded), errors.Is(err, cluster.ErrNetworkNotAllowed),
+		errors.Is(err, cluster.ErrImageNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, cluster.ErrInsufficientCapacity):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// handleProvisionBatch schedules a JSON array of provision requests in
+// dependsOn order. Containers created before a failure are kept unless
+// ?atomic=true is given or the failed item was a dependency, in which case
+// the whole batch is rolled back.
+func (s *ClusterServer) handleProvisionBatch(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	id := strings.TrimPrefix(r.URL.Path, "/terminate/")
-	if id == "" {
-		http.Error(w, "Missing container ID", http.StatusBadRequest)
+	var reqs []provisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
 		return
 	}
 
-	if err := s.cluster.TerminateContainer(s.ctx, id); err != nil {
-		http.Error(w, "Terminate failed: "+err.Error(), http.StatusInternalServerError)
+	specs := make([]docker.ContainerSpec, len(reqs))
+	for i, req := range reqs {
+		if err := confineNamespace(r, &req.Namespace); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Item %d: %v", i, err))
+			return
+		}
+		spec, err := s.specFor(req)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Item %d: %v", i, err))
+			return
+		}
+		specs[i] = spec
+	}
+
+	atomic := r.URL.Query().Get("atomic") == "true"
+	ctx, cancel := s.scheduleContext(r)
+	defer cancel()
+	results, err := s.cluster.ScheduleBatch(ctx, specs, atomic)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	fmt.Fprintln(w, "Container terminated")
+	status := http.StatusOK
+	out := make([]batchResult, len(results))
+	for i, res := range results {
+		auditTarget(r, res.Container)
+		out[i] = batchResult{Index: i, Container: res.Container}
+		if res.Err != nil {
+			out[i].Error = res.Err.Error()
+			status = http.StatusMultiStatus
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(out)
 }
 
-func (s *ClusterServer) handleStatus(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// handleDryRun reports which node a provision request would land on without creating anything
+func (s *ClusterServer) handleDryRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	id := strings.TrimPrefix(r.URL.Path, "/status/")
-	if id == "" {
-		http.Error(w, "Missing container ID", http.StatusBadRequest)
+	var req provisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if err := confineNamespace(r, &req.Namespace); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	spec, err := s.specFor(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	info, err := s.cluster.GetContainerStatus(s.ctx, id)
+	nodeID, err := s.cluster.DryRunSchedule(spec)
 	if err != nil {
-		http.Error(w, "Status lookup failed: "+err.Error(), http.StatusNotFound)
+		status := provisionErrorStatus(err)
+		if status == http.StatusInternalServerError || status == http.StatusServiceUnavailable {
+			status = http.StatusUnprocessableEntity // the request can't be placed as is
+		}
+		writeJSONError(w, status, "Would not schedule: "+err.Error())
 		return
 	}
 
+	resp := dryRunResponse{Node: nodeID}
+	for _, node := range s.cluster.NodeStatuses() {
+		if node.ID == nodeID {
+			resp.Leftover = resourcesResponse{
+				CPU:    node.Capacity.CPU - node.Allocated.CPU - spec.CPU,
+				Memory: node.Capacity.Memory - node.Allocated.Memory - int(spec.Memory),
+				GPU:    node.Capacity.GPU - node.Allocated.GPU - spec.GPU,
+				Disk:   node.Capacity.DiskMB - node.Allocated.DiskMB - spec.DiskMB,
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// handleTerminateWhere terminates every container matching a filter
+func (s *ClusterServer) handleTerminateWhere(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req terminateWhereRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if req == (terminateWhereRequest{}) {
+		writeJSONError(w, http.StatusBadRequest, "Refusing to terminate everything: set at least one filter field")
+		return
+	}
+	if err := confineNamespace(r, &req.Namespace); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := cluster.ListFilter{Node: req.Node, Namespace: req.Namespace, Image: req.Image, Status: req.Status}
+	if req.OlderThan != "" {
+		d, err := time.ParseDuration(req.OlderThan)
+		if err != nil || d <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "Invalid olderThan (example: \"1h\")")
+			return
+		}
+		filter.OlderThan = d
+	}
+
+	terminated, errs := s.cluster.TerminateWhere(r.Context(), filter)
+	for _, id := range terminated {
+		auditTargetID(r, id, "")
+	}
+	resp := terminateWhereResponse{Terminated: terminated}
+	if resp.Terminated == nil {
+		resp.Terminated = []string{}
+	}
+	status := http.StatusOK
+	if len(errs) > 0 {
+		resp.Errors = make(map[string]string, len(errs))
+		for id, err := range errs {
+			resp.Errors[id] = err.Error()
+		}
+		status = http.StatusMultiStatus
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(info)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// handleTerminate deletes a container regardless of which node it's on
+func (s *ClusterServer) handleTerminate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id, err := containerIDFromPath(r.URL.Path, "/terminate/")
 	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+
+	s.terminate(w, r, id)
 }
 
-// handleList lists all active containers across all nodes
-func (s *ClusterServer) handleList(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// handleRestart restarts a container in place, keeping its resources. An
+// optional ?timeout=N overrides the stop grace period in seconds.
+func (s *ClusterServer) handleRestart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id, err := containerIDFromPath(r.URL.Path, "/restart/")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	timeout, err := stopTimeoutParam(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	info, err := s.cluster.RestartContainer(r.Context(), id, timeout)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, manager.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		writeJSONError(w, status, "Restart failed: "+err.Error())
 		return
 	}
 
-	containers := s.cluster.ListAllContainers(s.ctx)
 	w.Header().Set("Content-Type", "application/json")
-	err := json.NewEncoder(w).Encode(containers)
+	_ = json.NewEncoder(w).Encode(info)
+}
+
+// renewRequest is the body of POST /renew/{id}
+type renewRequest struct {
+	TTL string `json:"ttl"` // from now, e.g. "30m"; "0" makes the container permanent
+}
+
+// handleRenew resets a container's TTL to expire the given duration from now
+func (s *ClusterServer) handleRenew(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id, err := containerIDFromPath(r.URL.Path, "/renew/")
 	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+
+	var req renewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil || ttl < 0 {
+		writeJSONError(w, http.StatusBadRequest, "Invalid TTL (example: \"30m\", or \"0\" for no expiry)")
+		return
+	}
+
+	info, err := s.cluster.RenewTTL(id, ttl)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, manager.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		writeJSONError(w, status, "Renew failed: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newContainerResponse(info, time.Now()))
+}
+
+// handleContainer serves /containers/{id}: DELETE terminates the container,
+// PATCH updates its CPU and memory in place
+func (s *ClusterServer) handleContainer(w http.ResponseWriter, r *http.Request) {
+	id, err := containerIDFromPath(r.URL.Path, "/containers/")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodDelete:
+		s.terminate(w, r, id)
+	case http.MethodPatch:
+		s.updateResources(w, r, id)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// updateRequest is the body of PATCH /containers/{id}; omitted fields keep their current value
+type updateRequest struct {
+	CPU    *float64 `json:"cpu"`
+	Memory *int64   `json:"memory"`
+}
+
+func (s *ClusterServer) updateResources(w http.ResponseWriter, r *http.Request, id string) {
+	var req updateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+
+	current, err := s.cluster.GetContainerStatus(r.Context(), id)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "Update failed: "+err.Error())
+		return
+	}
+	cpu, memory := current.CPU, current.MemoryMB
+	if req.CPU != nil {
+		cpu = *req.CPU
+	}
+	if req.Memory != nil {
+		memory = *req.Memory
+	}
+	if cpu <= 0 || memory <= 0 {
+		writeJSONError(w, http.StatusBadRequest, "CPU and memory must be positive")
+		return
+	}
+
+	info, err := s.cluster.UpdateResources(r.Context(), id, cpu, memory)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, manager.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, manager.ErrInsufficientResources), errors.Is(err, cluster.ErrResizeInProgress):
+			status = http.StatusConflict
+		case errors.Is(err, cluster.ErrQuotaExceeded):
+			status = http.StatusForbidden
+		}
+		writeJSONError(w, status, "Update failed: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(info)
+}
+
+// stopTimeoutParam parses the optional ?timeout=N stop grace period in seconds
+func stopTimeoutParam(r *http.Request) (int, error) {
+	t := r.URL.Query().Get("timeout")
+	if t == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(t)
+	if err != nil || n < 0 {
+		return 0, errors.New("Invalid timeout (expected seconds)")
+	}
+	return n, nil
+}
+
+// terminate stops and removes a container. An optional ?timeout=N overrides
+// the container's stop grace period in seconds.
+func (s *ClusterServer) terminate(w http.ResponseWriter, r *http.Request, id string) {
+	timeout, err := stopTimeoutParam(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if info, err := s.cluster.GetContainerStatus(r.Context(), id); err == nil {
+		auditTarget(r, info)
+	}
+	if err := s.cluster.TerminateContainerWithTimeout(r.Context(), id, timeout); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, manager.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		writeJSONError(w, status, "Terminate failed: "+err.Error())
+		return
+	}
+
+	fmt.Fprintln(w, "Container terminated")
+}
+
+// containerIDFromPath extracts the container ID following prefix.
+// Empty IDs and IDs containing a slash are rejected.
+func containerIDFromPath(path, prefix string) (string, error) {
+	id := strings.TrimPrefix(path, prefix)
+	if id == "" {
+		return "", errors.New("Missing container ID")
+	}
+	if strings.Contains(id, "/") {
+		return "", errors.New("Invalid container ID")
+	}
+	return id, nil
+}
+
+func (s *ClusterServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id, err := containerIDFromPath(r.URL.Path, "/status/")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	info, err := s.cluster.GetContainerStatus(r.Context(), id)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "Status lookup failed: "+err.Error())
+		return
+	}
+
+	resp := statusResponse{containerResponse: newContainerResponse(info, time.Now())}
+	if live, err := s.cluster.LiveState(r.Context(), id); err != nil {
+		resp.LiveError = err.Error()
+	} else {
+		resp.Live = newLiveResponse(info.Status, live)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		return
+	}
+}
+
+// handleStats samples a container's actual CPU, memory, network and block
+// I/O usage from its node's daemon, next to its reservations
+func (s *ClusterServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id, err := containerIDFromPath(r.URL.Path, "/stats/")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	info, err := s.cluster.GetContainerStatus(r.Context(), id)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "Status lookup failed: "+err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), statsTimeout)
+	defer cancel()
+	stats, err := s.cluster.Stats(ctx, id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, manager.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, context.DeadlineExceeded):
+			status = http.StatusGatewayTimeout
+		}
+		writeJSONError(w, status, "Failed to read stats: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(statsResponse{
+		ID:               info.ID,
+		NodeID:           info.NodeID,
+		CPUPercent:       stats.CPUPercent,
+		ReservedCPU:      info.CPU,
+		MemoryUsageMB:    stats.MemoryUsageMB,
+		MemoryLimitMB:    stats.MemoryLimitMB,
+		ReservedMemoryMB: info.MemoryMB,
+		NetworkRxBytes:   stats.NetworkRxBytes,
+		NetworkTxBytes:   stats.NetworkTxBytes,
+		BlockReadBytes:   stats.BlockReadBytes,
+		BlockWriteBytes:  stats.BlockWriteBytes,
+	})
+}
+
+// handleList lists active containers across all nodes. Supports ?node=, ?namespace=, ?image=
+// (substring), ?status=, ?limit= and ?offset=; X-Total-Count holds the number
+// of matches before pagination.
+func (s *ClusterServer) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+	filter := cluster.ListFilter{
+		Node:      q.Get("node"),
+		Namespace: q.Get("namespace"),
+		Image:     q.Get("image"),
+		Status:    q.Get("status"),
+	}
+	if err := confineNamespace(r, &filter.Namespace); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for name, dst := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				writeJSONError(w, http.StatusBadRequest, "Invalid "+name+" (expected a non-negative integer)")
+				return
+			}
+			*dst = n
+		}
+	}
+
+	containers, total := s.cluster.ListAllContainers(r.Context(), filter)
+	now := time.Now()
+	out := make([]containerResponse, len(containers))
+	for i, info := range containers {
+		out[i] = newContainerResponse(info, now)
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(out)
+	if err != nil {
+		return
+	}
+}
+
+// handleExec runs a command inside a container and returns its exit code
+// and output. A WebSocket upgrade request instead starts an interactive
+// session on a TTY, see handleExecTTY.
+func (s *ClusterServer) handleExec(w http.ResponseWriter, r *http.Request) {
+	ws := isWebSocket(r)
+	if r.Method != http.MethodPost && !ws {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id, err := containerIDFromPath(r.URL.Path, "/exec/")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if ws {
+		s.handleExecTTY(w, r, id)
+		return
+	}
+
+	var req execRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if len(req.Cmd) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "Missing cmd")
+		return
+	}
+
+	timeout := defaultExecTimeout
+	if req.Timeout != "" {
+		timeout, err = time.ParseDuration(req.Timeout)
+		if err != nil || timeout <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "Invalid timeout (example: \"10s\")")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	res, err := s.cluster.Exec(ctx, id, req.Cmd)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, manager.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, context.DeadlineExceeded):
+			status = http.StatusGatewayTimeout
+		}
+		writeJSONError(w, status, "Exec failed: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(execResponse{ExitCode: res.ExitCode, Output: res.Output})
+}
+
+// defaultShell is the command of an interactive exec session without ?cmd=
+var defaultShell = []string{"sh"}
+
+// handleExecTTY runs the ?cmd= command (repeated for each argument,
+// default sh) on a TTY in container id and connects it to a WebSocket:
+// binary frames carry the terminal, text frames resizes and the exit code
+func (s *ClusterServer) handleExecTTY(w http.ResponseWriter, r *http.Request, id string) {
+	cmd := r.URL.Query()["cmd"]
+	if len(cmd) == 0 {
+		cmd = defaultShell
+	}
+
+	sess, err := s.cluster.ExecTTY(r.Context(), id, cmd)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, manager.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		writeJSONError(w, status, "Exec failed: "+err.Error())
+		return
+	}
+	auditTargetID(r, id, "")
+	s.log.Info("interactive exec started", "container_id", id, "cmd", cmd)
+	terminal.Attach(w, r, sess)
+}
+
+// isWebSocket reports whether r asks to upgrade to a WebSocket
+func isWebSocket(r *http.Request) bool {
+	return r.Method == http.MethodGet && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// handleCluster summarizes capacity and utilization across all nodes
+func (s *ClusterServer) handleCluster(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	sum := s.cluster.Summary()
+	resp := clusterResponse{
+		Nodes:        sum.Nodes,
+		HealthyNodes: sum.HealthyNodes,
+		Containers:   sum.Containers,
+		Capacity:     newResourcesResponse(sum.Capacity),
+		Allocated:    newResourcesResponse(sum.Allocated),
+		Utilization: utilizationPercent{
+			CPU:    percent(sum.Allocated.CPU, sum.Capacity.CPU),
+			Memory: percent(float64(sum.Allocated.Memory), float64(sum.Capacity.Memory)),
+			GPU:    percent(float64(sum.Allocated.GPU), float64(sum.Capacity.GPU)),
+			Disk:   percent(float64(sum.Allocated.DiskMB), float64(sum.Capacity.DiskMB)),
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// handleNodes lists every node with its health and capacity, and registers
+// a new node on POST
+func (s *ClusterServer) handleNodes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		s.addNode(w, r)
+		return
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var nodes []nodeResponse
+	for _, node := range s.cluster.NodeStatuses() {
+		nodes = append(nodes, newNodeResponse(node))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(nodes)
+}
+
+// addNode registers a node described by a JSON node config, as in the config file
+func (s *ClusterServer) addNode(w http.ResponseWriter, r *http.Request) {
+	if s.nodeFactory == nil {
+		writeJSONError(w, http.StatusNotImplemented, "Node registration is not enabled")
+		return
+	}
+
+	var nc config.NodeConfig
+	if err := json.NewDecoder(r.Body).Decode(&nc); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if err := nc.Validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	node, err := s.nodeFactory(nc)
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, "Failed to set up node: "+err.Error())
+		return
+	}
+	if err := s.cluster.AddNode(node); err != nil {
+		if node.Stop != nil {
+			node.Stop()
+		}
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handleNode serves /nodes/{id}: DELETE drains and removes the node, and
+// GET /nodes/{id}/allocations lists its reservations
+func (s *ClusterServer) handleNode(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/allocations") {
+		s.handleNodeAllocations(w, r)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	nodeID := strings.TrimPrefix(r.URL.Path, "/nodes/")
+	if nodeID == "" || strings.Contains(nodeID, "/") {
+		writeJSONError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	ctx, cancel := s.scheduleContext(r)
+	defer cancel()
+	if err := s.cluster.RemoveNode(ctx, nodeID); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, cluster.ErrNodeNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, context.DeadlineExceeded):
+			status = http.StatusGatewayTimeout
+		}
+		writeJSONError(w, status, "Remove node: "+err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleNodeAllocations lists what each reservation holds on one node
+func (s *ClusterServer) handleNodeAllocations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	nodeID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/nodes/"), "/allocations")
+	if !ok || nodeID == "" || strings.Contains(nodeID, "/") {
+		writeJSONError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	allocations, err := s.cluster.NodeAllocations(nodeID)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	out := make(map[string]resourcesResponse, len(allocations))
+	for id, spec := range allocations {
+		out[id] = newResourcesResponse(spec)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// handleMetrics exposes lifecycle counters and per-node capacity in the Prometheus text format
+func (s *ClusterServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var cpuAlloc, cpuFree, memAlloc, memFree []metrics.Sample
+	for _, node := range s.cluster.NodeStatuses() {
+		labels := map[string]string{"node": node.ID}
+		cpuAlloc = append(cpuAlloc, metrics.Sample{Labels: labels, Value: node.Allocated.CPU})
+		cpuFree = append(cpuFree, metrics.Sample{Labels: labels, Value: node.Capacity.CPU - node.Allocated.CPU})
+		memAlloc = append(memAlloc, metrics.Sample{Labels: labels, Value: float64(node.Allocated.Memory)})
+		memFree = append(memFree, metrics.Sample{Labels: labels, Value: float64(node.Capacity.Memory - node.Allocated.Memory)})
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics.WriteCounters(w)
+	metrics.WriteGauge(w, "minicloud_node_cpu_allocated_cores", "CPU cores reserved on the node", cpuAlloc)
+	metrics.WriteGauge(w, "minicloud_node_cpu_free_cores", "CPU cores still available on the node", cpuFree)
+	metrics.WriteGauge(w, "minicloud_node_memory_allocated_mb", "Memory in MB reserved on the node", memAlloc)
+	metrics.WriteGauge(w, "minicloud_node_memory_free_mb", "Memory in MB still available on the node", memFree)
+}
+
+// eventKeepAlive is how often an idle event stream gets a comment line so
+// proxies don't close it
+const eventKeepAlive = 15 * time.Second
+
+// handleEvents streams container lifecycle events as Server-Sent Events until
+// the client disconnects or the server shuts down. ?type= (comma-separated)
+// and ?node= restrict the stream to matching events.
+func (s *ClusterServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	types := make(map[events.Type]bool)
+	if t := r.URL.Query().Get("type"); t != "" {
+		for _, name := range strings.Split(t, ",") {
+			types[events.Type(strings.TrimSpace(name))] = true
+		}
+	}
+	node := r.URL.Query().Get("node")
+
+	sub := s.cluster.Subscribe()
+	defer s.cluster.Unsubscribe(sub)
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case ev, ok := <-sub:
+			if !ok {
+				return
+			}
+			if (len(types) > 0 && !types[ev.Type]) || (node != "" && ev.NodeID != node) {
+				continue
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// handleHistory returns the lifecycle events of a container, oldest first,
+// including after it has been terminated
+func (s *ClusterServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id, err := containerIDFromPath(r.URL.Path, "/history/")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	history, ok := s.cluster.History(id)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "No history for container "+id)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(history)
+}
+
+// handleQuotas lists quota and usage for every namespace
+func (s *ClusterServer) handleQuotas(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	out := []quotaResponse{}
+	for _, u := range s.cluster.Quotas() {
+		out = append(out, newQuotaResponse(u))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// newQuotaResponse converts a namespace's quota and usage to its JSON form
+func newQuotaResponse(u cluster.NamespaceUsage) quotaResponse {
+	resp := quotaResponse{
+		Namespace: u.Namespace,
+		Used:      quotaRequest{CPU: u.Used.CPU, Memory: u.Used.MemoryMB, Containers: u.Used.Containers},
+	}
+	if u.HasQuota {
+		resp.Quota = &quotaRequest{CPU: u.Quota.CPU, Memory: u.Quota.MemoryMB, Containers: u.Quota.Containers}
+	}
+	return resp
+}
+
+// handleQuota serves /quotas/{namespace}
+func (s *ClusterServer) handleQuota(w http.ResponseWriter, r *http.Request) {
+	ns := strings.TrimPrefix(r.URL.Path, "/quotas/")
+	if ns == "" || strings.Contains(ns, "/") {
+		writeJSONError(w, http.StatusBadRequest, "Invalid namespace")
+		return
+	}
+	s.namespaceQuota(w, r, ns)
+}
+
+// namespaceQuota reports (GET), sets (PUT) or removes (DELETE) the quota of
+// namespace ns
+func (s *ClusterServer) namespaceQuota(w http.ResponseWriter, r *http.Request, ns string) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(newQuotaResponse(s.cluster.NamespaceQuota(ns)))
+	case http.MethodPut:
+		var req quotaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		if req.CPU < 0 || req.Memory < 0 || req.Containers < 0 {
+			writeJSONError(w, http.StatusBadRequest, "Quota must not be negative")
+			return
+		}
+		s.cluster.SetQuota(ns, cluster.Quota{CPU: req.CPU, MemoryMB: req.Memory, Containers: req.Containers})
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(req)
+	case http.MethodDelete:
+		s.cluster.RemoveQuota(ns)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleWorkloads lists autoscaled workloads and their replica counts
+func (s *ClusterServer) handleWorkloads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	out := []workloadResponse{}
+	for _, wl := range s.cluster.Workloads() {
+		out = append(out, workloadResponse{
+			Name:        wl.Name,
+			Image:       wl.Policy.Template.Image,
+			Replicas:    wl.Replicas,
+			MinReplicas: wl.Policy.MinReplicas,
+			MaxReplicas: wl.Policy.MaxReplicas,
+			TargetCPU:   wl.Policy.TargetCPUPercent,
+			Cooldown:    wl.Policy.Cooldown.String(),
+			Deployment:  wl.Deployment,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// handleScalePolicy sets (PUT) or removes (DELETE) the scale policy of a workload
+func (s *ClusterServer) handleScalePolicy(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/autoscale/")
+	if name == "" || strings.Contains(name, "/") {
+		writeJSONError(w, http.StatusBadRequest, "Invalid workload name")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var req scalePolicyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		// Deployments are scaled from their own template
+		var template docker.ContainerSpec
+		var err error
+		if _, derr := s.cluster.Deployment(name); derr != nil {
+			if template, err = s.specFor(req.Template); err != nil {
+				writeJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		cooldown := defaultScaleCooldown
+		if req.Cooldown != "" {
+			cooldown, err = time.ParseDuration(req.Cooldown)
+			if err != nil || cooldown < 0 {
+				writeJSONError(w, http.StatusBadRequest, "Invalid cooldown (example: \"2m\")")
+				return
+			}
+		}
+
+		policy := cluster.ScalePolicy{
+			Template:         template,
+			MinReplicas:      req.MinReplicas,
+			MaxReplicas:      req.MaxReplicas,
+			TargetCPUPercent: req.TargetCPU,
+			Cooldown:         cooldown,
+		}
+		if err := s.cluster.SetScalePolicy(name, policy); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		s.cluster.RemoveScalePolicy(name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
 }
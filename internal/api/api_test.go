@@ -0,0 +1,1217 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"mini-cloud/internal/cluster"
+	"mini-cloud/internal/config"
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/docker/dockertest"
+	"mini-cloud/internal/events"
+	"mini-cloud/internal/manager"
+	"mini-cloud/internal/metrics"
+	"mini-cloud/internal/resourcemanager"
+	"mini-cloud/internal/retry"
+	"mini-cloud/internal/terminal"
+)
+
+// discard is a logger for tests that drops everything
+var discard = slog.New(slog.DiscardHandler)
+
+// newTestNode returns a node with the given capacity on an in-memory runtime
+func newTestNode(id string, cpu float64, memory int) (*cluster.Node, *dockertest.Runtime) {
+	rt := dockertest.New()
+	rm := resourcemanager.NewResourceManager(cpu, memory)
+	mgr := manager.NewManager(rt, rm)
+	mgr.SetRetryPolicy(retry.Policy{MaxAttempts: 1})
+	mgr.SetLogger(discard)
+	return &cluster.Node{ID: id, Docker: rt, Resources: rm, Manager: mgr}, rt
+}
+
+// newTestServer serves the API of a cluster of nodes; node1 with 4 cores and
+// 4GB is used if none are given. It is closed when the test ends.
+func newTestServer(t *testing.T, nodes ...*cluster.Node) (*ClusterServer, *httptest.Server, *cluster.ClusterManager) {
+	t.Helper()
+	if len(nodes) == 0 {
+		node, _ := newTestNode("node1", 4, 4096)
+		nodes = append(nodes, node)
+	}
+	byID := make(map[string]*cluster.Node, len(nodes))
+	for _, n := range nodes {
+		byID[n.ID] = n
+	}
+	cm := cluster.NewClusterManager(byID)
+	cm.SetLogger(discard)
+	s := NewClusterServer(cm)
+	s.log = discard
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return s, srv, cm
+}
+
+// do sends a request with body encoded as JSON, unless it is nil or a
+// string, and returns the response with its body read
+func do(t *testing.T, srv *httptest.Server, method, path string, body any, header ...string) (*http.Response, []byte) {
+	t.Helper()
+	var r io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		r = bytes.NewBufferString(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, data
+}
+
+// provision provisions req, with a TTL of 1h unless it sets one, through
+// the API and returns the new container
+func provision(t *testing.T, srv *httptest.Server, req map[string]any) containerResponse {
+	t.Helper()
+	if _, ok := req["ttl"]; !ok {
+		req["ttl"] = "1h"
+	}
+	resp, body := do(t, srv, http.MethodPost, "/provision", req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("provision: %d %s", resp.StatusCode, body)
+	}
+	var info containerResponse
+	if err := json.Unmarshal(body, &info); err != nil {
+		t.Fatalf("provision response %s: %v", body, err)
+	}
+	return info
+}
+
+// freeAddr returns a loopback address with a port nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestHistory(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+	info := provision(t, srv, map[string]any{"image": "nginx", "cpu": 1})
+	if resp, body := do(t, srv, http.MethodPost, "/renew/"+info.ID, map[string]any{"ttl": "2h"}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("renew: %d %s", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodPost, "/terminate/"+info.ID, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("terminate: %d %s", resp.StatusCode, body)
+	}
+
+	resp, body := do(t, srv, http.MethodGet, "/history/"+info.ID, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("history: %d %s", resp.StatusCode, body)
+	}
+	var got []events.Event
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("history response %s: %v", body, err)
+	}
+	want := []events.Type{events.Provisioned, events.Renewed, events.Terminated}
+	if len(got) != len(want) {
+		t.Fatalf("history %s, want %v", body, want)
+	}
+	for i, e := range got {
+		if e.Type != want[i] || e.ContainerID != info.ID {
+			t.Errorf("entry %d is %s for %s, want %s for %s", i, e.Type, e.ContainerID, want[i], info.ID)
+		}
+		if i > 0 && e.Time.Before(got[i-1].Time) {
+			t.Errorf("entry %d at %v is older than the one before it", i, e.Time)
+		}
+	}
+
+	if resp, body := do(t, srv, http.MethodGet, "/history/nope", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown container: %d %s, want 404", resp.StatusCode, body)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	s, _, _ := newTestServer(t)
+	addr := freeAddr(t)
+	done := make(chan error, 1)
+	go func() { done <- s.Run(addr) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := http.Get("http://" + addr + "/list")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not come up: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run returned %v after Shutdown, want nil", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("Run did not return after Shutdown")
+	}
+	if resp, err := http.Get("http://" + addr + "/list"); err == nil {
+		resp.Body.Close()
+		t.Error("server still accepts connections after Shutdown")
+	}
+}
+
+func TestServersHaveTheirOwnRoutes(t *testing.T) {
+	_, a, _ := newTestServer(t)
+	_, b, _ := newTestServer(t)
+
+	provision(t, a, map[string]any{"image": "nginx", "cpu": 1})
+
+	for srv, want := range map[*httptest.Server]string{a: "1", b: "0"} {
+		resp, body := do(t, srv, http.MethodGet, "/list", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("list: %d %s", resp.StatusCode, body)
+		}
+		if got := resp.Header.Get("X-Total-Count"); got != want {
+			t.Errorf("listed %s containers, want %s", got, want)
+		}
+	}
+}
+
+func TestErrorsAreJSON(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+
+	for _, tt := range []struct {
+		name       string
+		method     string
+		path       string
+		body       any
+		wantStatus int
+	}{
+		{"malformed provision", http.MethodPost, "/provision", "{", http.StatusBadRequest},
+		{"provision beyond capacity", http.MethodPost, "/provision", map[string]any{"image": "nginx", "cpu": 64, "ttl": "1h"}, http.StatusServiceUnavailable},
+		{"wrong method", http.MethodGet, "/provision", nil, http.StatusMethodNotAllowed},
+		{"unknown container", http.MethodGet, "/status/nope", nil, http.StatusNotFound},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, srv, tt.method, tt.path, tt.body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			var e errorResponse
+			if err := json.Unmarshal(body, &e); err != nil || e.Error == "" || e.Status != resp.StatusCode {
+				t.Errorf("body %s, want a JSON error with the status", body)
+			}
+		})
+	}
+}
+
+func TestTerminatePaths(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+
+	for _, tt := range []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"POST valid ID", http.MethodPost, "/terminate/{id}", http.StatusOK},
+		{"DELETE valid ID", http.MethodDelete, "/containers/{id}", http.StatusOK},
+		{"empty ID", http.MethodPost, "/terminate/", http.StatusBadRequest},
+		{"DELETE empty ID", http.MethodDelete, "/containers/", http.StatusBadRequest},
+		{"embedded slash", http.MethodPost, "/terminate/{id}/x", http.StatusBadRequest},
+		{"DELETE embedded slash", http.MethodDelete, "/containers/a/{id}", http.StatusBadRequest},
+		{"GET", http.MethodGet, "/terminate/{id}", http.StatusMethodNotAllowed},
+		{"unknown ID", http.MethodPost, "/terminate/nope", http.StatusNotFound},
+		{"DELETE unknown ID", http.MethodDelete, "/containers/nope", http.StatusNotFound},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			info := provision(t, srv, map[string]any{"image": "nginx", "cpu": 0.5})
+			path := strings.ReplaceAll(tt.path, "{id}", info.ID)
+			resp, body := do(t, srv, tt.method, path, nil)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("%s %s: status %d (%s), want %d", tt.method, path, resp.StatusCode, body, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestProvisionBatch(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+
+	resp, body := do(t, srv, http.MethodPost, "/provision/batch", []map[string]any{
+		{"name": "a", "image": "nginx", "cpu": 1, "ttl": "1h"},
+		{"name": "b", "image": "nginx", "cpu": 64, "ttl": "1h"},
+	})
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("status %d (%s), want 207 for a partial failure", resp.StatusCode, body)
+	}
+	var results []struct {
+		Index     int
+		Container *containerResponse
+		Error     string
+	}
+	if err := json.Unmarshal(body, &results); err != nil {
+		t.Fatalf("response %s: %v", body, err)
+	}
+	if len(results) != 2 || results[0].Container == nil || results[0].Error != "" || results[1].Error == "" {
+		t.Errorf("results %s, want a created and b failed", body)
+	}
+
+	resp, body = do(t, srv, http.MethodPost, "/provision/batch", []map[string]any{
+		{"name": "x", "image": "nginx", "cpu": 1, "ttl": "1h", "dependsOn": []string{"y"}},
+		{"name": "y", "image": "nginx", "cpu": 1, "ttl": "1h", "dependsOn": []string{"x"}},
+	})
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "dependency cycle") {
+		t.Errorf("cyclic batch: %d %s, want 400 naming the cycle", resp.StatusCode, body)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+	scheduled := metrics.ContainersScheduled.Value()
+	provision(t, srv, map[string]any{"image": "nginx", "cpu": 1.5, "memory": 512})
+
+	resp, body := do(t, srv, http.MethodGet, "/metrics", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("metrics: %d %s", resp.StatusCode, body)
+	}
+	for _, want := range []string{
+		fmt.Sprintf("minicloud_containers_scheduled_total %d\n", scheduled+1),
+		`minicloud_node_cpu_allocated_cores{node="node1"} 1.5` + "\n",
+		`minicloud_node_cpu_free_cores{node="node1"} 2.5` + "\n",
+		`minicloud_node_memory_allocated_mb{node="node1"} 512` + "\n",
+		`minicloud_node_memory_free_mb{node="node1"} 3584` + "\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestTerminateTimeout(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	_, srv, _ := newTestServer(t, node)
+	info := provision(t, srv, map[string]any{"image": "postgres", "cpu": 1, "stopTimeout": 30})
+
+	resp, body := do(t, srv, http.MethodPost, "/terminate/"+info.ID+"?timeout=abc", nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid timeout: status %d (%s), want 400", resp.StatusCode, body)
+	}
+
+	// Keep the stopped container around to look at it
+	rt.Fail("RemoveContainer", dockertest.ErrInjected)
+	do(t, srv, http.MethodDelete, "/containers/"+info.ID+"?timeout=5", nil)
+	if c, _ := rt.Container(info.ID); c.LastStopTimeout != 5 {
+		t.Errorf("stopped with timeout %d, want the requested 5", c.LastStopTimeout)
+	}
+}
+
+func TestNodesReportHealth(t *testing.T) {
+	down, downRT := newTestNode("down", 4, 4096)
+	up, _ := newTestNode("up", 4, 4096)
+	_, srv, cm := newTestServer(t, down, up)
+	cm.SetMaxMissedHeartbeats(1)
+	downRT.SetPingError(dockertest.ErrInjected)
+	cm.CheckHealth(context.Background())
+
+	resp, body := do(t, srv, http.MethodGet, "/nodes", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("nodes: %d %s", resp.StatusCode, body)
+	}
+	var nodes []nodeResponse
+	if err := json.Unmarshal(body, &nodes); err != nil {
+		t.Fatalf("nodes response %s: %v", body, err)
+	}
+	got := make(map[string]string)
+	for _, n := range nodes {
+		got[n.ID] = fmt.Sprintf("%s %v", n.Status, n.Healthy)
+	}
+	if got["down"] != "NotReady false" || got["up"] != "Ready true" {
+		t.Errorf("node health = %v, want down NotReady and up Ready", got)
+	}
+}
+
+func TestRegisterAndRemoveNode(t *testing.T) {
+	s, srv, _ := newTestServer(t)
+	nodeJSON := map[string]any{"id": "node2", "cpu": 2, "memory": 2048}
+	if resp, body := do(t, srv, http.MethodPost, "/nodes", nodeJSON); resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("without a node factory: %d %s, want 501", resp.StatusCode, body)
+	}
+
+	s.SetNodeFactory(func(nc config.NodeConfig) (*cluster.Node, error) {
+		node, _ := newTestNode(nc.ID, nc.CPU, nc.Memory)
+		return node, nil
+	})
+	if resp, body := do(t, srv, http.MethodPost, "/nodes", map[string]any{"id": "node2", "cpu": 0}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid node: %d %s, want 400", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodPost, "/nodes", nodeJSON); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("register: %d %s", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodPost, "/nodes", nodeJSON); resp.StatusCode != http.StatusConflict {
+		t.Errorf("registering node2 again: %d %s, want 409", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodGet, "/nodes/node2/allocations", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("allocations of the registered node: %d %s", resp.StatusCode, body)
+	}
+
+	if resp, body := do(t, srv, http.MethodDelete, "/nodes/node2", nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("remove: %d %s", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodDelete, "/nodes/node2", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("removing it again: %d %s, want 404", resp.StatusCode, body)
+	}
+}
+
+func TestProvisionNameConflict(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+	provision(t, srv, map[string]any{"name": "web", "image": "nginx", "cpu": 1})
+
+	resp, body := do(t, srv, http.MethodPost, "/provision", map[string]any{"name": "web", "image": "nginx", "cpu": 1, "ttl": "1h"})
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("status %d (%s), want 409", resp.StatusCode, body)
+	}
+}
+
+// openEvents connects to the event stream at path, disconnecting when the test ends
+func openEvents(t *testing.T, srv *httptest.Server, path string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// nextEvent reads frames from an event stream until one carries data
+func nextEvent(t *testing.T, r *bufio.Reader) (string, events.Event) {
+	t.Helper()
+	var name string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event stream: %v", err)
+		}
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+		case strings.HasPrefix(line, "data: "):
+			var e events.Event
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+				t.Fatalf("event data %q: %v", line, err)
+			}
+			return name, e
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+	stream := openEvents(t, srv, "/events")
+	terminations := openEvents(t, srv, "/events?type=terminated")
+
+	info := provision(t, srv, map[string]any{"image": "nginx", "cpu": 1})
+	name, e := nextEvent(t, stream)
+	if name != "provisioned" || e.Type != events.Provisioned || e.ContainerID != info.ID || e.NodeID != "node1" {
+		t.Errorf("received %s %+v, want %s provisioned on node1", name, e, info.ID)
+	}
+
+	if resp, body := do(t, srv, http.MethodPost, "/terminate/"+info.ID, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("terminate: %d %s", resp.StatusCode, body)
+	}
+	if _, e := nextEvent(t, terminations); e.Type != events.Terminated || e.ContainerID != info.ID {
+		t.Errorf("filtered stream received %+v, want only the termination of %s", e, info.ID)
+	}
+}
+
+func TestListFilters(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+	web := provision(t, srv, map[string]any{"name": "web", "image": "nginx", "cpu": 1})
+	provision(t, srv, map[string]any{"name": "db", "image": "postgres", "cpu": 1})
+	proxy := provision(t, srv, map[string]any{"name": "proxy", "image": "nginx:alpine", "cpu": 1})
+
+	resp, body := do(t, srv, http.MethodGet, "/list?image=nginx&limit=1&offset=1", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("list: %d %s", resp.StatusCode, body)
+	}
+	var list []containerResponse
+	if err := json.Unmarshal(body, &list); err != nil {
+		t.Fatalf("list response %s: %v", body, err)
+	}
+	if len(list) != 1 || list[0].ID != proxy.ID {
+		t.Errorf("listed %s, want only %s", body, proxy.ID)
+	}
+	if got := resp.Header.Get("X-Total-Count"); got != "2" {
+		t.Errorf("X-Total-Count = %q, want 2 nginx containers (%s and %s)", got, web.ID, proxy.ID)
+	}
+
+	for _, query := range []string{"limit=-1", "offset=x"} {
+		if resp, body := do(t, srv, http.MethodGet, "/list?"+query, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("list?%s: %d %s, want 400", query, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestUpdateContainerResources(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	_, srv, _ := newTestServer(t, node)
+	info := provision(t, srv, map[string]any{"image": "nginx", "cpu": 1, "memory": 256})
+
+	resp, body := do(t, srv, http.MethodPatch, "/containers/"+info.ID, map[string]any{"cpu": 2})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("update: %d %s", resp.StatusCode, body)
+	}
+	if c, _ := rt.Container(info.ID); c.CPU != 2 || c.MemoryMB != 256 {
+		t.Errorf("runtime limits %v CPU, %d MB; want 2 CPU and memory unchanged", c.CPU, c.MemoryMB)
+	}
+	if got := node.Resources.AllocatedCPUSum(); got != 2 {
+		t.Errorf("reserved %v CPU, want 2", got)
+	}
+
+	tests := []struct {
+		id   string
+		body map[string]any
+		want int
+	}{
+		{info.ID, map[string]any{"cpu": 16}, http.StatusConflict},
+		{info.ID, map[string]any{"memory": 0}, http.StatusBadRequest},
+		{"missing", map[string]any{"cpu": 1}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if resp, body := do(t, srv, http.MethodPatch, "/containers/"+tt.id, tt.body); resp.StatusCode != tt.want {
+			t.Errorf("PATCH %s %v: %d %s, want %d", tt.id, tt.body, resp.StatusCode, body, tt.want)
+		}
+	}
+}
+
+func TestExec(t *testing.T) {
+	node1, rt1 := newTestNode("node1", 4, 4096)
+	node2, rt2 := newTestNode("node2", 4, 4096)
+	node2.Labels = map[string]string{"role": "db"}
+	_, srv, _ := newTestServer(t, node1, node2)
+	info := provision(t, srv, map[string]any{"image": "postgres", "cpu": 1, "nodeSelector": map[string]string{"role": "db"}})
+	rt2.SetExecResult(info.ID, docker.ExecResult{ExitCode: 2, Output: "migration failed\n"})
+
+	resp, body := do(t, srv, http.MethodPost, "/exec/"+info.ID, map[string]any{"cmd": []string{"migrate"}})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("exec: %d %s", resp.StatusCode, body)
+	}
+	var res execResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		t.Fatalf("exec response %s: %v", body, err)
+	}
+	if res.ExitCode != 2 || res.Output != "migration failed\n" {
+		t.Errorf("exec = %+v, want the exit code and output from node2", res)
+	}
+	if rt1.Calls("Exec") != 0 {
+		t.Error("exec ran on node1, which does not own the container")
+	}
+
+	// A command outliving its timeout
+	rt2.SetHook(func(ctx context.Context, op, _ string) error {
+		if op == "Exec" {
+			<-ctx.Done()
+		}
+		return nil
+	})
+	resp, body = do(t, srv, http.MethodPost, "/exec/"+info.ID, map[string]any{"cmd": []string{"sleep", "60"}, "timeout": "50ms"})
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("slow exec: %d %s, want 504", resp.StatusCode, body)
+	}
+}
+
+func TestExecTTY(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	_, srv, _ := newTestServer(t, node)
+	info := provision(t, srv, map[string]any{"image": "alpine", "cpu": 1})
+	rt.SetExecResult(info.ID, docker.ExecResult{ExitCode: 3})
+	ctx := context.Background()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/exec/"+info.ID+"?cmd=sh", "", srv.URL)
+	if err != nil {
+		t.Fatalf("dialing exec: %v", err)
+	}
+	sess := terminal.NewSession(ws)
+	defer sess.Close()
+	if err := sess.Resize(ctx, 24, 80); err != nil {
+		t.Fatalf("Resize: %v", err)
+	}
+	for _, line := range []string{"hi\n", "exit\n"} {
+		if _, err := sess.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	out, err := io.ReadAll(sess)
+	if err != nil || string(out) != "hi\nexit\n" {
+		t.Errorf("terminal output %q, %v; want the echoed input", out, err)
+	}
+	if code, err := sess.ExitCode(ctx); err != nil || code != 3 {
+		t.Errorf("exit code %d, %v; want 3", code, err)
+	}
+
+	resp, body := do(t, srv, http.MethodGet, "/exec/missing", nil, "Connection", "Upgrade", "Upgrade", "websocket")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("interactive exec in an unknown container: %d %s, want 404", resp.StatusCode, body)
+	}
+}
+
+func TestStats(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	_, srv, _ := newTestServer(t, node)
+	info := provision(t, srv, map[string]any{"image": "web", "cpu": 1, "memory": 512})
+	rt.SetStats(info.ID, docker.ContainerStats{CPUPercent: 150, MemoryUsageMB: 300, MemoryLimitMB: 512, NetworkRxBytes: 42})
+
+	resp, body := do(t, srv, http.MethodGet, "/stats/"+info.ID, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stats: %d %s", resp.StatusCode, body)
+	}
+	var stats statsResponse
+	if err := json.Unmarshal(body, &stats); err != nil {
+		t.Fatalf("stats response %s: %v", body, err)
+	}
+	want := statsResponse{ID: info.ID, NodeID: "node1", CPUPercent: 150, ReservedCPU: 1,
+		MemoryUsageMB: 300, MemoryLimitMB: 512, ReservedMemoryMB: 512, NetworkRxBytes: 42}
+	if stats != want {
+		t.Errorf("stats %+v, want %+v", stats, want)
+	}
+
+	if resp, body := do(t, srv, http.MethodGet, "/stats/missing", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("stats of an unknown container: %d %s, want 404", resp.StatusCode, body)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	node1, rt1 := newTestNode("node1", 4, 4096)
+	node2, rt2 := newTestNode("node2", 4, 4096)
+	node2.Labels = map[string]string{"role": "web"}
+	_, srv, _ := newTestServer(t, node1, node2)
+	info := provision(t, srv, map[string]any{"image": "nginx", "cpu": 1, "memory": 256, "nodeSelector": map[string]string{"role": "web"}})
+	rt2.SetExited(info.ID, 1)
+
+	resp, body := do(t, srv, http.MethodPost, "/restart/"+info.ID+"?timeout=5", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("restart: %d %s", resp.StatusCode, body)
+	}
+	var got manager.ContainerInfo
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("restart response %s: %v", body, err)
+	}
+	if got.Status != "running" {
+		t.Errorf("status %q after restart, want running", got.Status)
+	}
+	c, _ := rt2.Container(info.ID)
+	if c.Restarts != 1 || c.State != dockertest.StateRunning || c.LastStopTimeout != 5 {
+		t.Errorf("node2 container %+v, want restarted once with a 5s stop timeout", c)
+	}
+	if rt1.Calls("RestartContainer") != 0 {
+		t.Error("restart was sent to node1, which does not own the container")
+	}
+	if cpu, mem := node2.Resources.AllocatedCPUSum(), node2.Resources.AllocatedMemorySum(); cpu != 1 || mem != 256 {
+		t.Errorf("node2 reserves %v CPU, %v MB after restart; want 1 and 256", cpu, mem)
+	}
+
+	if resp, body := do(t, srv, http.MethodPost, "/restart/missing", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("restarting an unknown container: %d %s, want 404", resp.StatusCode, body)
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+	if resp, body := do(t, srv, http.MethodPut, "/quotas/team-a", map[string]any{"cpu": 1}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("set quota: %d %s", resp.StatusCode, body)
+	}
+	provision(t, srv, map[string]any{"image": "nginx", "cpu": 1, "namespace": "team-a"})
+
+	resp, body := do(t, srv, http.MethodPost, "/provision", map[string]any{"image": "nginx", "cpu": 1, "namespace": "team-a", "ttl": "1h"})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("provision over quota: %d %s, want 403", resp.StatusCode, body)
+	}
+
+	resp, body = do(t, srv, http.MethodGet, "/quotas", nil)
+	var quotas []quotaResponse
+	if err := json.Unmarshal(body, &quotas); err != nil {
+		t.Fatalf("quotas response %d %s: %v", resp.StatusCode, body, err)
+	}
+	if len(quotas) != 1 || quotas[0].Quota == nil || quotas[0].Quota.CPU != 1 || quotas[0].Used.CPU != 1 || quotas[0].Used.Containers != 1 {
+		t.Errorf("quotas = %s, want team-a using its 1 CPU", body)
+	}
+}
+
+func TestProvisionReportsEvictions(t *testing.T) {
+	node, _ := newTestNode("node1", 2, 4096)
+	_, srv, _ := newTestServer(t, node)
+	low := provision(t, srv, map[string]any{"image": "worker", "cpu": 2, "priority": 1})
+
+	resp, body := do(t, srv, http.MethodPost, "/provision", map[string]any{"image": "api", "cpu": 1, "priority": 5, "ttl": "1h"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("provision: %d %s", resp.StatusCode, body)
+	}
+	var got provisionResponse
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("provision response %s: %v", body, err)
+	}
+	if len(got.Evicted) != 1 || got.Evicted[0] != low.ID {
+		t.Errorf("evicted %v, want [%s]", got.Evicted, low.ID)
+	}
+}
+
+func TestProvisionWaitsUntilHealthy(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	_, srv, _ := newTestServer(t, node)
+	rt.SetHook(func(_ context.Context, op, id string) error {
+		if op == "InspectContainer" {
+			if c, _ := rt.Container(id); c.Spec.Name == "ready" {
+				rt.SetHealth(id, "healthy")
+			}
+		}
+		return nil
+	})
+	check := map[string]any{"test": []string{"curl", "-f", "http://localhost/"}, "interval": "1s"}
+
+	resp, body := do(t, srv, http.MethodPost, "/provision?wait=true",
+		map[string]any{"name": "ready", "image": "nginx", "cpu": 1, "ttl": "1h", "healthCheck": check})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("healthy container: %d %s, want 200", resp.StatusCode, body)
+	}
+
+	resp, body = do(t, srv, http.MethodPost, "/provision?wait=true&timeout=50ms",
+		map[string]any{"name": "stuck", "image": "nginx", "cpu": 1, "ttl": "1h", "healthCheck": check})
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("container stuck starting: %d %s, want 504", resp.StatusCode, body)
+	}
+}
+
+func TestClusterSummary(t *testing.T) {
+	small, _ := newTestNode("small", 4, 4096)
+	large, _ := newTestNode("large", 8, 8192)
+	_, srv, _ := newTestServer(t, small, large)
+	provision(t, srv, map[string]any{"name": "web", "image": "nginx", "cpu": 2, "memory": 1024})
+	provision(t, srv, map[string]any{"name": "db", "image": "postgres", "cpu": 1, "memory": 2048})
+
+	resp, body := do(t, srv, http.MethodGet, "/cluster", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("cluster: %d %s", resp.StatusCode, body)
+	}
+	var got clusterResponse
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("cluster response %s: %v", body, err)
+	}
+	want := clusterResponse{
+		Nodes:        2,
+		HealthyNodes: 2,
+		Containers:   2,
+		Capacity:     resourcesResponse{CPU: 12, Memory: 12288},
+		Allocated:    resourcesResponse{CPU: 3, Memory: 3072},
+		Utilization:  utilizationPercent{CPU: 25, Memory: 25},
+	}
+	if got != want {
+		t.Errorf("cluster = %+v, want %+v", got, want)
+	}
+}
+
+func TestNodeAllocations(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+	provision(t, srv, map[string]any{"name": "web", "image": "nginx", "cpu": 0.5, "memory": 256})
+	provision(t, srv, map[string]any{"name": "db", "image": "postgres", "cpu": 2, "memory": 1024})
+
+	resp, body := do(t, srv, http.MethodGet, "/nodes/node1/allocations", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("allocations: %d %s", resp.StatusCode, body)
+	}
+	var got map[string]resourcesResponse
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("allocations response %s: %v", body, err)
+	}
+	want := map[string]resourcesResponse{"web": {CPU: 0.5, Memory: 256}, "db": {CPU: 2, Memory: 1024}}
+	if len(got) != len(want) || got["web"] != want["web"] || got["db"] != want["db"] {
+		t.Errorf("allocations %s, want %v", body, want)
+	}
+
+	if resp, body := do(t, srv, http.MethodGet, "/nodes/node9/allocations", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown node: %d %s, want 404", resp.StatusCode, body)
+	}
+}
+
+func TestProvisionBurstLimits(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	_, srv, _ := newTestServer(t, node)
+	info := provision(t, srv, map[string]any{"image": "worker", "cpu": 1, "memory": 256,
+		"memorySwap": -1, "cpuShares": 512, "cpuQuota": 50000})
+
+	c, _ := rt.Container(info.ID)
+	if c.Spec.MemorySwapMB != -1 || c.Spec.CPUShares != 512 || c.Spec.CPUQuota != 50000 {
+		t.Errorf("created with swap %d, shares %d, quota %d; want the request's", c.Spec.MemorySwapMB, c.Spec.CPUShares, c.Spec.CPUQuota)
+	}
+}
+
+func TestProvisionCommand(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	_, srv, _ := newTestServer(t, node)
+	info := provision(t, srv, map[string]any{"image": "alpine", "cpu": 1,
+		"command": []string{"-c", "echo hi"}, "entrypoint": []string{"/bin/sh"}})
+
+	c, ok := rt.Container(info.ID)
+	if !ok {
+		t.Fatal("container not created")
+	}
+	if strings.Join(c.Spec.Command, " ") != "-c echo hi" || strings.Join(c.Spec.Entrypoint, " ") != "/bin/sh" {
+		t.Errorf("created with command %q, entrypoint %q; want the request's", c.Spec.Command, c.Spec.Entrypoint)
+	}
+}
+
+func TestProvisionEnv(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	_, srv, _ := newTestServer(t, node)
+	info := provision(t, srv, map[string]any{"image": "web", "cpu": 1, "env": map[string]string{"PORT": "8080"}})
+
+	if c, _ := rt.Container(info.ID); c.Spec.Env["PORT"] != "8080" {
+		t.Errorf("created with env %v, want PORT=8080", c.Spec.Env)
+	}
+	resp, body := do(t, srv, http.MethodPost, "/provision", map[string]any{"image": "web", "cpu": 1, "env": map[string]string{"A=B": "c"}})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("env name with '=': %d %s, want 400", resp.StatusCode, body)
+	}
+}
+
+func TestProvisionPorts(t *testing.T) {
+	node, _ := newTestNode("node1", 4, 4096)
+	_, srv, _ := newTestServer(t, node)
+	info := provision(t, srv, map[string]any{"image": "web", "cpu": 1, "ports": []map[string]any{
+		{"containerPort": 80, "hostPort": 8080}, {"containerPort": 53, "protocol": "udp"},
+	}})
+	if info.HostPorts["80/tcp"] != 8080 || info.HostPorts["53/udp"] == 0 {
+		t.Errorf("host ports %v, want 80/tcp on 8080 and 53/udp on a picked port", info.HostPorts)
+	}
+
+	tests := []struct {
+		name  string
+		ports []map[string]any
+	}{
+		{"port out of range", []map[string]any{{"containerPort": 70000}}},
+		{"unknown protocol", []map[string]any{{"containerPort": 80, "protocol": "sctp"}}},
+		{"host port twice", []map[string]any{{"containerPort": 80, "hostPort": 9000}, {"containerPort": 81, "hostPort": 9000}}},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, srv, http.MethodPost, "/provision", map[string]any{"image": "web", "cpu": 1, "ports": tt.ports})
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: %d %s, want 400", tt.name, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestProvisionProbe(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	_, srv, _ := newTestServer(t, node)
+	info := provision(t, srv, map[string]any{"image": "web", "cpu": 1, "probe": map[string]any{
+		"type": "http", "port": 8080, "path": "/healthz", "interval": "5s", "failureThreshold": 2, "action": "replace",
+	}})
+	want := docker.Probe{Type: docker.ProbeHTTP, Port: 8080, Path: "/healthz", Interval: 5 * time.Second, FailureThreshold: 2, Action: docker.ProbeActionReplace}
+	if c, _ := rt.Container(info.ID); c.Spec.Probe == nil || !reflect.DeepEqual(*c.Spec.Probe, want) {
+		t.Errorf("created with probe %+v, want %+v", c.Spec.Probe, want)
+	}
+
+	tests := []struct {
+		name  string
+		probe map[string]any
+	}{
+		{"unknown type", map[string]any{"type": "grpc", "port": 80}},
+		{"http without a port", map[string]any{"type": "http"}},
+		{"exec without a command", map[string]any{"type": "exec"}},
+		{"bad interval", map[string]any{"type": "tcp", "port": 80, "interval": "soon"}},
+		{"negative timeout", map[string]any{"type": "tcp", "port": 80, "timeout": "-1s"}},
+		{"unknown action", map[string]any{"type": "tcp", "port": 80, "action": "reboot"}},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, srv, http.MethodPost, "/provision", map[string]any{"image": "web", "cpu": 1, "probe": tt.probe})
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: %d %s, want 400", tt.name, resp.StatusCode, body)
+		}
+	}
+}
+
+// blockPulls makes every image pull on rt hang until its context ends,
+// signalling on the returned channel when one starts
+func blockPulls(rt *dockertest.Runtime) <-chan struct{} {
+	started := make(chan struct{}, 1)
+	rt.SetHook(func(ctx context.Context, op, _ string) error {
+		if op == "PullImage" {
+			started <- struct{}{}
+			<-ctx.Done()
+		}
+		return nil
+	})
+	return started
+}
+
+func TestProvisionTimesOutStuckPull(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	s, srv, _ := newTestServer(t, node)
+	s.SetScheduleTimeout(50 * time.Millisecond)
+	blockPulls(rt)
+
+	resp, body := do(t, srv, http.MethodPost, "/provision", map[string]any{"image": "huge", "cpu": 1, "ttl": "1h"})
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("stuck pull: %d %s, want 504", resp.StatusCode, body)
+	}
+	if got := node.Resources.AllocatedCPUSum(); got != 0 {
+		t.Errorf("allocated CPU = %v after the timeout, want 0", got)
+	}
+	if n := len(rt.Containers()); n != 0 {
+		t.Errorf("%d containers created, want none", n)
+	}
+}
+
+func TestProvisionCancelledByClient(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	_, srv, _ := newTestServer(t, node)
+	started := blockPulls(rt)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/provision",
+		strings.NewReader(`{"image": "huge", "cpu": 1, "ttl": "1h"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		resp, err := srv.Client().Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pull never started")
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("request err = %v, want it cancelled", err)
+	}
+
+	// The server notices the client left and gives the reservation back
+	deadline := time.Now().Add(5 * time.Second)
+	for node.Resources.AllocatedCPUSum() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("resources still reserved after the client cancelled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(rt.Containers()); n != 0 {
+		t.Errorf("%d containers created, want none", n)
+	}
+}
+
+func TestContainerResponseAges(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	info := &manager.ContainerInfo{ID: "c1", CreatedAt: created, TTL: time.Minute}
+
+	var last int64 = math.MaxInt64
+	for _, tt := range []struct {
+		after         time.Duration
+		wantAge       int64
+		wantRemaining int64
+	}{
+		{10 * time.Second, 10, 50},
+		{45 * time.Second, 45, 15},
+		{90 * time.Second, 90, 0}, // overdue until reaped
+	} {
+		resp := newContainerResponse(info, created.Add(tt.after))
+		if resp.AgeSeconds != tt.wantAge || resp.TTLRemainingSeconds == nil || *resp.TTLRemainingSeconds != tt.wantRemaining {
+			t.Errorf("after %v: age %d, remaining %v; want %d and %d", tt.after, resp.AgeSeconds, resp.TTLRemainingSeconds, tt.wantAge, tt.wantRemaining)
+			continue
+		}
+		if *resp.TTLRemainingSeconds > last {
+			t.Errorf("after %v: remaining TTL went up from %d to %d", tt.after, last, *resp.TTLRemainingSeconds)
+		}
+		last = *resp.TTLRemainingSeconds
+	}
+
+	permanent := newContainerResponse(&manager.ContainerInfo{ID: "c2", CreatedAt: created}, created.Add(time.Hour))
+	if permanent.TTLRemainingSeconds != nil {
+		t.Errorf("remaining TTL %d for a permanent container, want none", *permanent.TTLRemainingSeconds)
+	}
+	data, _ := json.Marshal(permanent)
+	if strings.Contains(string(data), "TTLRemainingSeconds") || !strings.Contains(string(data), `"AgeSeconds":3600`) {
+		t.Errorf("permanent container encoded as %s", data)
+	}
+}
+
+func TestStatusReportsRemainingTTL(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+	info := provision(t, srv, map[string]any{"image": "nginx", "cpu": 1, "ttl": "10m"})
+
+	resp, body := do(t, srv, http.MethodGet, "/status/"+info.ID, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status: %d %s", resp.StatusCode, body)
+	}
+	var got containerResponse
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("status response %s: %v", body, err)
+	}
+	if got.TTLRemainingSeconds == nil || *got.TTLRemainingSeconds < 590 || *got.TTLRemainingSeconds > 600 {
+		t.Errorf("remaining TTL %v, want about 600s", got.TTLRemainingSeconds)
+	}
+}
+
+func TestRenewToPermanent(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+	info := provision(t, srv, map[string]any{"image": "nginx", "cpu": 1, "ttl": "10m"})
+
+	if resp, body := do(t, srv, http.MethodPost, "/renew/"+info.ID, map[string]any{"ttl": "-1m"}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("negative TTL: %d %s, want 400", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodPost, "/renew/"+info.ID, map[string]any{"ttl": "0"}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("renew: %d %s", resp.StatusCode, body)
+	}
+
+	resp, body := do(t, srv, http.MethodGet, "/status/"+info.ID, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status: %d %s", resp.StatusCode, body)
+	}
+	var got containerResponse
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("status response %s: %v", body, err)
+	}
+	if got.TTL != 0 || got.TTLRemainingSeconds != nil {
+		t.Errorf("status reports TTL %v with %v remaining, want no expiry", got.TTL, got.TTLRemainingSeconds)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	_, srv, _ := newTestServer(t, node)
+	provision(t, srv, map[string]any{"image": "nginx", "cpu": 1, "memory": 512})
+
+	resp, body := do(t, srv, http.MethodPost, "/schedule/dryrun", map[string]any{"image": "nginx", "cpu": 1, "memory": 256, "ttl": "1h"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("dry run: %d %s", resp.StatusCode, body)
+	}
+	var got dryRunResponse
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("dry run response %s: %v", body, err)
+	}
+	if want := (dryRunResponse{Node: "node1", Leftover: resourcesResponse{CPU: 2, Memory: 3328}}); got != want {
+		t.Errorf("dry run = %+v, want %+v", got, want)
+	}
+	if n := len(rt.Containers()); n != 1 {
+		t.Errorf("%d containers after the dry run, want 1", n)
+	}
+
+	if resp, body := do(t, srv, http.MethodPost, "/schedule/dryrun", map[string]any{"image": "nginx", "cpu": 16, "ttl": "1h"}); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("dry run beyond capacity: %d %s, want 422", resp.StatusCode, body)
+	}
+}
+
+func TestTerminateWhere(t *testing.T) {
+	_, srv, cm := newTestServer(t)
+	web := provision(t, srv, map[string]any{"image": "nginx", "cpu": 1})
+	db := provision(t, srv, map[string]any{"image": "postgres", "cpu": 1})
+
+	resp, body := do(t, srv, http.MethodPost, "/terminate", map[string]any{"image": "nginx"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("terminate: %d %s", resp.StatusCode, body)
+	}
+	var got terminateWhereResponse
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("terminate response %s: %v", body, err)
+	}
+	if len(got.Terminated) != 1 || got.Terminated[0] != web.ID || len(got.Errors) != 0 {
+		t.Errorf("terminated %s, want only %s", body, web.ID)
+	}
+
+	// Nothing is old enough yet
+	resp, body = do(t, srv, http.MethodPost, "/terminate", map[string]any{"olderThan": "1h"})
+	if resp.StatusCode != http.StatusOK || strings.Contains(string(body), db.ID) {
+		t.Errorf("terminate older than 1h: %d %s, want nothing terminated", resp.StatusCode, body)
+	}
+	if _, err := cm.GetContainerStatus(context.Background(), db.ID); err != nil {
+		t.Errorf("%s was terminated: %v", db.ID, err)
+	}
+
+	for _, req := range []map[string]any{{}, {"olderThan": "soon"}} {
+		if resp, body := do(t, srv, http.MethodPost, "/terminate", req); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("terminate %v: %d %s, want 400", req, resp.StatusCode, body)
+		}
+	}
+}
+
+// liveStatus fetches /status/{id}, including the live Docker state
+func liveStatus(t *testing.T, srv *httptest.Server, id string) statusResponse {
+	t.Helper()
+	resp, body := do(t, srv, http.MethodGet, "/status/"+id, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status: %d %s", resp.StatusCode, body)
+	}
+	var got statusResponse
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("status response %s: %v", body, err)
+	}
+	return got
+}
+
+func TestStatusLiveState(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	_, srv, _ := newTestServer(t, node)
+	crashed := provision(t, srv, map[string]any{"image": "nginx", "cpu": 1})
+	checked := provision(t, srv, map[string]any{"image": "nginx", "cpu": 1, "healthCheck": map[string]any{"test": []string{"true"}}})
+
+	// Docker knows better than the tracked state until the next refresh
+	rt.SetExited(crashed.ID, 137)
+	got := liveStatus(t, srv, crashed.ID)
+	if got.Status != "running" || got.Live == nil || got.Live.Status != "exited" || got.Live.Healthy {
+		t.Fatalf("status %+v, live %+v; want tracked running, live exited and unhealthy", got.ContainerInfo, got.Live)
+	}
+	if got.Live.Mismatch != `tracked as "running" but Docker reports "exited"` {
+		t.Errorf("mismatch %q", got.Live.Mismatch)
+	}
+
+	if got := liveStatus(t, srv, checked.ID); got.Live.Health != "starting" || got.Live.Healthy || got.Live.Mismatch != "" {
+		t.Errorf("starting health check: live %+v, want not yet healthy", got.Live)
+	}
+	rt.SetHealth(checked.ID, "healthy")
+	if got := liveStatus(t, srv, checked.ID); !got.Live.Healthy || got.Live.Mismatch != "" {
+		t.Errorf("healthy: live %+v, want healthy without a mismatch", got.Live)
+	}
+
+	rt.Fail("InspectContainer", dockertest.ErrInjected)
+	if got := liveStatus(t, srv, checked.ID); got.Live != nil || got.LiveError == "" {
+		t.Errorf("daemon unreachable: live %+v, error %q; want the error only", got.Live, got.LiveError)
+	}
+}
+
+func TestLiveResponseMismatch(t *testing.T) {
+	tests := []struct {
+		tracked, live string
+		wantMismatch  bool
+	}{
+		{"running", "running", false},
+		{"running", "exited", true},
+		{"exited", "running", true},
+		{manager.StatusUnhealthy, "running", false}, // failing its probe, unknown to Docker
+		{manager.StatusUnhealthy, "exited", true},
+	}
+	for _, tt := range tests {
+		resp := newLiveResponse(tt.tracked, manager.LiveState{Status: tt.live})
+		if got := resp.Mismatch != ""; got != tt.wantMismatch {
+			t.Errorf("tracked %s, live %s: mismatch %q, want one %v", tt.tracked, tt.live, resp.Mismatch, tt.wantMismatch)
+		}
+	}
+}
+
+func TestProvisionFailureStatus(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	_, srv, _ := newTestServer(t, node)
+
+	resp, body := do(t, srv, http.MethodPost, "/provision", map[string]any{"image": "nginx", "cpu": 64, "ttl": "1h"})
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != strconv.Itoa(capacityRetryAfter) {
+		t.Errorf("cluster full: %d with Retry-After %q (%s), want 503 with a hint", resp.StatusCode, resp.Header.Get("Retry-After"), body)
+	}
+
+	rt.Fail("CreateContainer", errors.New("daemon exploded"))
+	resp, body = do(t, srv, http.MethodPost, "/provision", map[string]any{"image": "nginx", "cpu": 1, "ttl": "1h"})
+	if resp.StatusCode != http.StatusInternalServerError || resp.Header.Get("Retry-After") != "" {
+		t.Errorf("daemon failure: %d with Retry-After %q (%s), want 500 without a hint", resp.StatusCode, resp.Header.Get("Retry-After"), body)
+	}
+}
+
+func TestProvisionRejectionReasons(t *testing.T) {
+	small, _ := newTestNode("small", 2, 4096)
+	tiny, _ := newTestNode("tiny", 8, 512)
+	_, srv, _ := newTestServer(t, small, tiny)
+
+	resp, body := do(t, srv, http.MethodPost, "/provision", map[string]any{"image": "nginx", "cpu": 4, "memory": 1024, "ttl": "1h"})
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("provision: %d %s, want 503", resp.StatusCode, body)
+	}
+	var got errorResponse
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("error response %s: %v", body, err)
+	}
+	want := []string{
+		"small: insufficient CPU (need 4, free 2)",
+		"tiny: insufficient memory (need 1024MB, free 512MB)",
+	}
+	if !reflect.DeepEqual(got.Reasons, want) {
+		t.Errorf("reasons %q, want %q", got.Reasons, want)
+	}
+}
+
+func TestProvisionErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("placing web: %w", cluster.ErrInsufficientCapacity), http.StatusServiceUnavailable},
+		{fmt.Errorf("%w: web", manager.ErrNameConflict), http.StatusConflict},
+		{cluster.ErrQuotaExceeded, http.StatusForbidden},
+		{fmt.Errorf("%w: redis resolved to sha256:b", cluster.ErrImageNotAllowed), http.StatusForbidden},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{errors.New("failed to create container: daemon exploded"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := provisionErrorStatus(tt.err); got != tt.want {
+			t.Errorf("provisionErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mini-cloud/internal/audit"
+	"mini-cloud/internal/manager"
+)
+
+// maxAuditBody caps how much of a request body is kept in the audit log
+const maxAuditBody = 64 * 1024
+
+// defaultAuditLimit is how many entries GET /audit returns without ?limit=
+const defaultAuditLimit = 100
+
+// auditKey is the context key of the *auditRecord for a request being audited
+type auditKey struct{}
+
+// callerKey is the context key of the authenticated caller's name
+type callerKey struct{}
+
+// auditRecord collects what a handler acted on while it runs
+type auditRecord struct {
+	mu      sync.Mutex
+	targets []audit.Target
+}
+
+// SetAuditLog records every mutating request in l and serves it on GET /audit
+func (s *ClusterServer) SetAuditLog(l audit.Log) {
+	s.audit = l
+}
+
+// auditTarget notes that the request r acted on the container info
+func auditTarget(r *http.Request, info *manager.ContainerInfo) {
+	if info == nil {
+		return
+	}
+	auditTargetID(r, info.ID, info.NodeID)
+}
+
+// auditTargetID notes that the request r acted on container id on nodeID,
+// which may be empty if unknown
+func auditTargetID(r *http.Request, id, nodeID string) {
+	rec, ok := r.Context().Value(auditKey{}).(*auditRecord)
+	if !ok {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.targets = append(rec.targets, audit.Target{ContainerID: id, NodeID: nodeID})
+}
+
+// callerOf identifies who sent r: the authenticated caller if there is one,
+// otherwise the client's address
+func callerOf(r *http.Request) string {
+	if name, ok := r.Context().Value(callerKey{}).(string); ok {
+		return name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// audited records every request that is not a read in the audit log, with
+// its body, the containers it acted on and its outcome. WebSocket sessions
+// are recorded once they end.
+func (s *ClusterServer) audited(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		read := (r.Method == http.MethodGet && !isWebSocket(r)) || r.Method == http.MethodHead || r.Method == http.MethodOptions
+		if s.audit == nil || read {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		var body []byte
+		if r.Body != nil {
+			body, _ = io.ReadAll(io.LimitReader(r.Body, maxAuditBody))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		}
+
+		rec := &auditRecord{}
+		r = r.WithContext(context.WithValue(r.Context(), auditKey{}, rec))
+		resp := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(resp, r)
+
+		entry := audit.Entry{
+			Time:       start.UTC(),
+			Caller:     callerOf(r),
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			Body:       auditBody(r, body),
+			Targets:    rec.targets,
+			Status:     resp.status,
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		if resp.status >= 400 {
+			entry.Error = errorMessage(resp.body.Bytes())
+		}
+		if err := s.audit.Append(entry); err != nil {
+			s.log.Error("failed to write audit entry", "method", r.Method, "path", r.URL.Path, "error", err)
+		}
+	})
+}
+
+// auditBody returns the body of r as JSON for the audit entry, quoting it if
+// it is not JSON itself. Join requests are left out as they carry the join token.
+func auditBody(r *http.Request, body []byte) json.RawMessage {
+	if r.URL.Path == "/join" || len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	if json.Valid(body) {
+		return body
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
+
+// errorMessage extracts the message from an error response body
+func errorMessage(body []byte) string {
+	var resp errorResponse
+	if json.Unmarshal(body, &resp) == nil && resp.Error != "" {
+		return resp.Error
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// handleAudit returns audit entries, newest first. It accepts ?caller=,
+// ?path= (prefix), ?since= (RFC 3339 time or a duration such as "1h") and
+// ?limit=.
+func (s *ClusterServer) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.audit == nil {
+		writeJSONError(w, http.StatusNotImplemented, "Audit log is not enabled")
+		return
+	}
+
+	q := r.URL.Query()
+	filter := audit.Filter{Caller: q.Get("caller"), Path: q.Get("path"), Limit: defaultAuditLimit}
+	if since := q.Get("since"); since != "" {
+		if t, err := time.Parse(time.RFC3339, since); err == nil {
+			filter.Since = t
+		} else if d, err := time.ParseDuration(since); err == nil && d > 0 {
+			filter.Since = time.Now().Add(-d)
+		} else {
+			writeJSONError(w, http.StatusBadRequest, "Invalid since (example: \"1h\" or \"2024-01-02T15:04:05Z\")")
+			return
+		}
+	}
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		filter.Limit = n
+	}
+
+	entries, err := s.audit.Query(filter)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"mini-cloud/internal/audit"
+)
+
+func TestAuditLog(t *testing.T) {
+	s, srv, _ := newTestServer(t)
+	if resp, body := do(t, srv, http.MethodGet, "/audit", nil); resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("without an audit log: %d %s, want 501", resp.StatusCode, body)
+	}
+
+	l, err := audit.OpenFileLog(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s.SetAuditLog(l)
+
+	info := provision(t, srv, map[string]any{"name": "web", "image": "nginx", "cpu": 1})
+	do(t, srv, http.MethodGet, "/status/"+info.ID, nil)
+	do(t, srv, http.MethodPost, "/terminate/nope", nil)
+
+	resp, body := do(t, srv, http.MethodGet, "/audit", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("audit: %d %s", resp.StatusCode, body)
+	}
+	var entries []audit.Entry
+	if err := json.Unmarshal(body, &entries); err != nil {
+		t.Fatalf("audit response %s: %v", body, err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("audited %s, want the provision and the failed terminate only", body)
+	}
+	failed, provisioned := entries[0], entries[1]
+	if failed.Path != "/terminate/nope" || failed.Status < 400 || failed.Error == "" {
+		t.Errorf("newest entry %+v, want the failed terminate with its error", failed)
+	}
+	if provisioned.Path != "/provision" || provisioned.Status != http.StatusOK || provisioned.Caller != "127.0.0.1" {
+		t.Errorf("oldest entry %+v, want the provision from 127.0.0.1", provisioned)
+	}
+	if len(provisioned.Targets) != 1 || provisioned.Targets[0] != (audit.Target{ContainerID: info.ID, NodeID: "node1"}) {
+		t.Errorf("provision targets %+v, want %s on node1", provisioned.Targets, info.ID)
+	}
+	var req map[string]any
+	if err := json.Unmarshal(provisioned.Body, &req); err != nil || req["name"] != "web" {
+		t.Errorf("provision body %s, want the request", provisioned.Body)
+	}
+
+	if resp, body := do(t, srv, http.MethodGet, "/audit?since=yesterday", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid since: %d %s, want 400", resp.StatusCode, body)
+	}
+}
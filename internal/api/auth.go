@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"mini-cloud/internal/config"
+)
+
+// scopeRank orders scopes so that each allows everything below it
+var scopeRank = map[string]int{
+	config.ScopeRead:      1,
+	config.ScopeProvision: 2,
+	config.ScopeAdmin:     3,
+}
+
+// principal is an authenticated caller and what it may do
+type principal struct {
+	name      string
+	scope     string
+	namespace string // if set, the caller may only use /namespaces/{namespace}/
+}
+
+// SetAPIKeys requires every request to carry one of keys, as
+// "Authorization: Bearer <key>" or "X-API-Key: <key>", with a scope that
+// allows the request. An empty list leaves the API open.
+func (s *ClusterServer) SetAPIKeys(keys []config.APIKey) error {
+	byHash := make(map[[sha256.Size]byte]principal, len(keys))
+	for _, k := range keys {
+		if err := k.Validate(); err != nil {
+			return err
+		}
+		h := sha256.Sum256([]byte(k.Key))
+		if _, ok := byHash[h]; ok {
+			return fmt.Errorf("api key %q: key is already in use", k.Name)
+		}
+		byHash[h] = principal{name: k.Name, scope: k.Scope, namespace: k.Namespace}
+	}
+	s.apiKeys = byHash
+	return nil
+}
+
+// requiredScope returns the scope needed for r
+func requiredScope(r *http.Request) string {
+	route, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch route {
+	case "nodes", "quotas", "autoscale":
+		if r.Method == http.MethodGet {
+			return config.ScopeRead
+		}
+		return config.ScopeAdmin
+	case "audit", "loglevels":
+		return config.ScopeAdmin
+	case "namespaces":
+		_, rest, _ := splitNamespacePath(r.URL.Path)
+		if rest == "quota" && r.Method != http.MethodGet {
+			return config.ScopeAdmin
+		}
+		if rest == "schedule/dryrun" {
+			return config.ScopeRead
+		}
+	case "schedule":
+		return config.ScopeRead // dry runs change nothing
+	}
+	if isWebSocket(r) {
+		return config.ScopeProvision // interactive exec
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return config.ScopeRead
+	}
+	return config.ScopeProvision
+}
+
+// requestKey returns the API key sent with r, if any
+func requestKey(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// authenticate identifies the caller of r from its JWT or API key
+func (s *ClusterServer) authenticate(r *http.Request) (principal, error) {
+	key := requestKey(r)
+	if key == "" {
+		return principal{}, errors.New("Missing API key or token")
+	}
+	if s.jwt != nil && isJWT(key) {
+		p, err := verifyJWT(s.jwt, key, time.Now())
+		if err != nil {
+			return principal{}, fmt.Errorf("Invalid token: %w", err)
+		}
+		return p, nil
+	}
+	p, ok := s.apiKeys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return principal{}, errors.New("Invalid API key")
+	}
+	return p, nil
+}
+
+// authenticated rejects requests without a valid API key or token with 401
+// and those whose scope or namespace does not allow them with 403. The key's
+// name or the token's subject is passed on as the caller.
+func (s *ClusterServer) authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Agents joining authenticate with the join token instead
+		if (len(s.apiKeys) == 0 && s.jwt == nil) || r.URL.Path == "/join" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		p, err := s.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mini-cloud"`)
+			writeJSONError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if need := requiredScope(r); scopeRank[p.scope] < scopeRank[need] {
+			writeJSONError(w, http.StatusForbidden, fmt.Sprintf("%q has scope %s; this request needs %s", p.name, p.scope, need))
+			return
+		}
+		if p.namespace != "" {
+			if ns, _, ok := splitNamespacePath(r.URL.Path); !ok || ns != p.namespace {
+				writeJSONError(w, http.StatusForbidden, fmt.Sprintf("%q may only use /namespaces/%s/", p.name, p.namespace))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, p.name)))
+	})
+}
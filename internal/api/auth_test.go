@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"mini-cloud/internal/config"
+)
+
+func TestAPIKeyScopes(t *testing.T) {
+	s, srv, _ := newTestServer(t)
+	if err := s.SetAPIKeys([]config.APIKey{
+		{Name: "viewer", Key: "read-secret", Scope: config.ScopeRead},
+		{Name: "ci", Key: "provision-secret", Scope: config.ScopeProvision},
+		{Name: "ops", Key: "admin-secret", Scope: config.ScopeAdmin},
+	}); err != nil {
+		t.Fatalf("SetAPIKeys: %v", err)
+	}
+	req := map[string]any{"image": "nginx", "cpu": 0.5, "ttl": "1h"}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		header []string
+		want   int
+	}{
+		{"no key", http.MethodGet, "/list", nil, nil, http.StatusUnauthorized},
+		{"unknown key", http.MethodGet, "/list", nil, []string{"X-API-Key", "guess"}, http.StatusUnauthorized},
+		{"read lists", http.MethodGet, "/list", nil, []string{"X-API-Key", "read-secret"}, http.StatusOK},
+		{"read cannot provision", http.MethodPost, "/provision", req, []string{"X-API-Key", "read-secret"}, http.StatusForbidden},
+		{"provision as bearer token", http.MethodPost, "/provision", req, []string{"Authorization", "Bearer provision-secret"}, http.StatusOK},
+		{"provision cannot read the audit log", http.MethodGet, "/audit", nil, []string{"X-API-Key", "provision-secret"}, http.StatusForbidden},
+		{"read lists nodes", http.MethodGet, "/nodes", nil, []string{"X-API-Key", "read-secret"}, http.StatusOK},
+		{"provision cannot add nodes", http.MethodPost, "/nodes", map[string]any{"id": "n2"}, []string{"X-API-Key", "provision-secret"}, http.StatusForbidden},
+		{"admin provisions", http.MethodPost, "/provision", req, []string{"X-API-Key", "admin-secret"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := do(t, srv, tt.method, tt.path, tt.body, tt.header...)
+			if resp.StatusCode != tt.want {
+				t.Errorf("%s %s: %d %s, want %d", tt.method, tt.path, resp.StatusCode, body, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestSetAPIKeysRejectsInvalidKeys(t *testing.T) {
+	s, _, _ := newTestServer(t)
+	for _, keys := range [][]config.APIKey{
+		{{Name: "ci", Key: "secret", Scope: "root"}},
+		{{Name: "a", Key: "same", Scope: config.ScopeRead}, {Name: "b", Key: "same", Scope: config.ScopeAdmin}},
+	} {
+		if err := s.SetAPIKeys(keys); err == nil {
+			t.Errorf("SetAPIKeys(%+v) accepted", keys)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"mini-cloud/internal/cluster"
+)
+
+// deploymentName restricts deployment names to what Docker accepts in the
+// container names of their replicas
+var deploymentName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// rolloutRequest sets how updates replace a deployment's replicas
+type rolloutRequest struct {
+	MaxUnavailable   int    `json:"maxUnavailable"`
+	MaxSurge         int    `json:"maxSurge"`         // 1 if neither is set
+	ProgressDeadline string `json:"progressDeadline"` // e.g. "5m", defaults to 2m
+}
+
+// toStrategy validates the request and converts it into a rollout strategy,
+// the zero strategy if nothing is set
+func (req rolloutRequest) toStrategy() (cluster.RolloutStrategy, error) {
+	if req == (rolloutRequest{}) {
+		return cluster.RolloutStrategy{}, nil
+	}
+	s := cluster.RolloutStrategy{MaxUnavailable: req.MaxUnavailable, MaxSurge: req.MaxSurge}
+	if s.MaxUnavailable == 0 && s.MaxSurge == 0 {
+		s.MaxSurge = cluster.DefaultRolloutStrategy.MaxSurge
+	}
+	if req.ProgressDeadline != "" {
+		d, err := time.ParseDuration(req.ProgressDeadline)
+		if err != nil || d <= 0 {
+			return cluster.RolloutStrategy{}, errors.New("Invalid progressDeadline (example: \"5m\")")
+		}
+		s.ProgressDeadline = d
+	}
+	return s, s.Validate()
+}
+
+// deploymentRequest is the body of POST /deployments
+type deploymentRequest struct {
+	Name     string           `json:"name"`
+	Template provisionRequest `json:"template"` // name is ignored; replicas are named <deployment>-<n>
+	Replicas int              `json:"replicas"`
+	rolloutRequest
+}
+
+// deploymentUpdateRequest is the body of PUT /deployments/{name}. Strategy
+// fields left unset keep the deployment's.
+type deploymentUpdateRequest struct {
+	Template provisionRequest `json:"template"`
+	rolloutRequest
+}
+
+// scaleRequest is the body of POST /deployments/{name}/scale
+type scaleRequest struct {
+	Replicas int `json:"replicas"`
+}
+
+// deploymentResponse describes a deployment and its current replicas
+type deploymentResponse struct {
+	Name       string              `json:"name"`
+	Image      string              `json:"image"`
+	Replicas   int                 `json:"replicas"` // desired
+	Ready      int                 `json:"ready"`    // running and passing their probe
+	CreatedAt  time.Time           `json:"createdAt"`
+	Revision   int                 `json:"revision"`
+	Strategy   strategyResponse    `json:"strategy"`
+	Rollout    rolloutResponse     `json:"rollout"`
+	Containers []containerResponse `json:"containers"`
+	Errors     []string            `json:"errors,omitempty"` // replicas not placed yet; retried in the background
+}
+
+// strategyResponse is a deployment's rollout strategy
+type strategyResponse struct {
+	MaxUnavailable   int    `json:"maxUnavailable"`
+	MaxSurge         int    `json:"maxSurge"`
+	ProgressDeadline string `json:"progressDeadline"`
+}
+
+// rolloutResponse is the progress of a deployment's latest update
+type rolloutResponse struct {
+	State     string    `json:"state"` // progressing, complete or rolled back
+	Message   string    `json:"message,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func newDeploymentResponse(d cluster.DeploymentStatus, now time.Time) deploymentResponse {
+	resp := deploymentResponse{
+		Name:       d.Name,
+		Image:      d.Template.Image,
+		Replicas:   d.Replicas,
+		Ready:      d.Ready,
+		CreatedAt:  d.CreatedAt,
+		Revision:   d.Revision,
+		Rollout:    rolloutResponse{State: d.Rollout.State, Message: d.Rollout.Message, UpdatedAt: d.Rollout.UpdatedAt},
+		Containers: []containerResponse{},
+	}
+	resp.Strategy = strategyResponse{
+		MaxUnavailable:   d.Strategy.MaxUnavailable,
+		MaxSurge:         d.Strategy.MaxSurge,
+		ProgressDeadline: cmp.Or(d.Strategy.ProgressDeadline, cluster.DefaultProgressDeadline).String(),
+	}
+	for _, info := range d.Containers {
+		resp.Containers = append(resp.Containers, newContainerResponse(info, now))
+	}
+	return resp
+}
+
+// deploymentErrorStatus maps a deployment error to an HTTP status code
+func deploymentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, cluster.ErrDeploymentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, cluster.ErrDeploymentExists), errors.Is(err, cluster.ErrRolloutInProgress):
+		return http.StatusConflict
+	case errors.Is(err, cluster.ErrShuttingDown):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// writeDeployment responds with the current state of deployment name and
+// the scheduling error, if any, of the change just made
+func (s *ClusterServer) writeDeployment(w http.ResponseWriter, name string, status int, schedErr error) {
+	d, err := s.cluster.Deployment(name)
+	if err != nil {
+		writeJSONError(w, deploymentErrorStatus(err), err.Error())
+		return
+	}
+	resp := newDeploymentResponse(d, time.Now())
+	if schedErr != nil {
+		resp.Errors = strings.Split(schedErr.Error(), "\n")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// handleDeployments lists deployments on GET and creates one on POST
+func (s *ClusterServer) handleDeployments(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		now := time.Now()
+		out := []deploymentResponse{}
+		for _, d := range s.cluster.Deployments() {
+			out = append(out, newDeploymentResponse(d, now))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	case http.MethodPost:
+		var req deploymentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		if !deploymentName.MatchString(req.Name) {
+			writeJSONError(w, http.StatusBadRequest, "Invalid deployment name")
+			return
+		}
+		if err := confineNamespace(r, &req.Template.Namespace); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		template, err := s.specFor(req.Template)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		strategy, err := req.toStrategy()
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		d := cluster.Deployment{Name: req.Name, Template: template, Replicas: req.Replicas, Strategy: strategy}
+		if err := d.Validate(); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		err = s.cluster.CreateDeployment(r.Context(), d)
+		if errors.Is(err, cluster.ErrDeploymentExists) {
+			writeJSONError(w, http.StatusConflict, err.Error())
+			return
+		}
+		s.writeDeployment(w, req.Name, http.StatusCreated, err)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleDeployment serves GET, PUT and DELETE /deployments/{name} and
+// POST /deployments/{name}/scale
+func (s *ClusterServer) handleDeployment(w http.ResponseWriter, r *http.Request) {
+	name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/deployments/"), "/")
+	if name == "" || (action != "" && action != "scale") {
+		writeJSONError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	switch {
+	case action == "scale" && r.Method == http.MethodPost:
+		var req scaleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		if req.Replicas < 0 {
+			writeJSONError(w, http.StatusBadRequest, "Replicas must not be negative")
+			return
+		}
+		err := s.cluster.ScaleDeployment(r.Context(), name, req.Replicas)
+		if errors.Is(err, cluster.ErrDeploymentNotFound) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		s.writeDeployment(w, name, http.StatusOK, err)
+	case action == "" && r.Method == http.MethodGet:
+		s.writeDeployment(w, name, http.StatusOK, nil)
+	case action == "" && r.Method == http.MethodPut:
+		s.updateDeployment(w, r, name)
+	case action == "" && r.Method == http.MethodDelete:
+		if err := s.cluster.DeleteDeployment(r.Context(), name); err != nil {
+			writeJSONError(w, deploymentErrorStatus(err), err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// updateDeployment starts a rolling update of deployment name to a new
+// template and responds with 202 while it runs in the background
+func (s *ClusterServer) updateDeployment(w http.ResponseWriter, r *http.Request, name string) {
+	var req deploymentUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if err := confineNamespace(r, &req.Template.Namespace); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	template, err := s.specFor(req.Template)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	strategy, err := req.toStrategy()
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := s.cluster.UpdateDeployment(r.Context(), name, template, strategy); err != nil {
+		status := deploymentErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			status = http.StatusBadRequest
+		}
+		writeJSONError(w, status, err.Error())
+		return
+	}
+	s.writeDeployment(w, name, http.StatusAccepted, nil)
+}
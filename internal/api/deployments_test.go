@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"mini-cloud/internal/cluster"
+)
+
+func TestDeployments(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+
+	req := map[string]any{"name": "web", "replicas": 2, "template": map[string]any{"image": "nginx", "cpu": 1, "ttl": "0"}}
+	resp, body := do(t, srv, http.MethodPost, "/deployments", req)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create: %d %s", resp.StatusCode, body)
+	}
+	var created deploymentResponse
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Replicas != 2 || created.Ready != 2 || len(created.Containers) != 2 || created.Containers[0].Name != "web-0" {
+		t.Errorf("created %s, want web-0 and web-1 ready", body)
+	}
+	for _, tt := range []struct {
+		name string
+		req  map[string]any
+		want int
+	}{
+		{"taken name", req, http.StatusConflict},
+		{"invalid name", map[string]any{"name": "../web", "template": map[string]any{"image": "nginx"}}, http.StatusBadRequest},
+		{"no image", map[string]any{"name": "api", "template": map[string]any{"ttl": "0"}}, http.StatusBadRequest},
+		{"negative replicas", map[string]any{"name": "api", "replicas": -1, "template": map[string]any{"image": "nginx", "ttl": "0"}}, http.StatusBadRequest},
+	} {
+		if resp, body := do(t, srv, http.MethodPost, "/deployments", tt.req); resp.StatusCode != tt.want {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.want)
+		}
+	}
+
+	resp, body = do(t, srv, http.MethodPost, "/deployments/web/scale", map[string]any{"replicas": 3})
+	var scaled deploymentResponse
+	if err := json.Unmarshal(body, &scaled); err != nil || resp.StatusCode != http.StatusOK || len(scaled.Containers) != 3 {
+		t.Errorf("scale: %d %s, want 3 replicas", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodPost, "/deployments/nope/scale", map[string]any{"replicas": 1}); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("scale unknown: %d %s, want 404", resp.StatusCode, body)
+	}
+
+	_, body = do(t, srv, http.MethodGet, "/deployments", nil)
+	var listed []deploymentResponse
+	if err := json.Unmarshal(body, &listed); err != nil || len(listed) != 1 || listed[0].Name != "web" {
+		t.Errorf("listed %s, want web", body)
+	}
+
+	if resp, body := do(t, srv, http.MethodDelete, "/deployments/web", nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("delete: %d %s, want 204", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodGet, "/deployments/web", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("get after delete: %d %s, want 404", resp.StatusCode, body)
+	}
+}
+
+func TestUpdateDeployment(t *testing.T) {
+	_, srv, cm := newTestServer(t)
+	req := map[string]any{"name": "web", "replicas": 2, "maxUnavailable": 1, "template": map[string]any{"image": "nginx:1", "cpu": 1, "ttl": "0"}}
+	if resp, body := do(t, srv, http.MethodPost, "/deployments", req); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create: %d %s", resp.StatusCode, body)
+	}
+
+	update := map[string]any{"template": map[string]any{"image": "nginx:2", "cpu": 1, "ttl": "0"}, "progressDeadline": "30s"}
+	resp, body := do(t, srv, http.MethodPut, "/deployments/web", update)
+	var accepted deploymentResponse
+	if err := json.Unmarshal(body, &accepted); err != nil || resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("update: %d %s, want 202", resp.StatusCode, body)
+	}
+	if accepted.Revision != 2 || accepted.Strategy.ProgressDeadline != "30s" || accepted.Strategy.MaxSurge != 1 {
+		t.Errorf("accepted %s, want revision 2 with the new deadline and the default surge", body)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		d, err := cm.Deployment("web")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Rollout.State != cluster.RolloutProgressing {
+			if d.Rollout.State != cluster.RolloutComplete {
+				t.Errorf("rollout %+v, want complete", d.Rollout)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("rollout did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, tt := range []struct {
+		name string
+		path string
+		req  map[string]any
+		want int
+	}{
+		{"unknown deployment", "/deployments/nope", update, http.StatusNotFound},
+		{"no image", "/deployments/web", map[string]any{"template": map[string]any{"ttl": "0"}}, http.StatusBadRequest},
+		{"bad deadline", "/deployments/web", map[string]any{"template": map[string]any{"image": "nginx:3", "ttl": "0"}, "progressDeadline": "-1s"}, http.StatusBadRequest},
+		{"negative surge", "/deployments/web", map[string]any{"template": map[string]any{"image": "nginx:3", "ttl": "0"}, "maxSurge": -1}, http.StatusBadRequest},
+	} {
+		if resp, body := do(t, srv, http.MethodPut, tt.path, tt.req); resp.StatusCode != tt.want {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.want)
+		}
+	}
+}
+
+func TestAutoscaleDeployment(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+	req := map[string]any{"name": "web", "replicas": 1, "template": map[string]any{"image": "nginx", "cpu": 1, "ttl": "0"}}
+	if resp, body := do(t, srv, http.MethodPost, "/deployments", req); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create: %d %s", resp.StatusCode, body)
+	}
+
+	// The deployment's template is used; none needs to be sent
+	policy := map[string]any{"minReplicas": 1, "maxReplicas": 3, "targetCPU": 50}
+	if resp, body := do(t, srv, http.MethodPut, "/autoscale/web", policy); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("set policy: %d %s", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodPut, "/autoscale/api", policy); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("policy without a template for a plain workload: %d %s, want 400", resp.StatusCode, body)
+	}
+
+	_, body := do(t, srv, http.MethodGet, "/autoscale", nil)
+	var listed []workloadResponse
+	if err := json.Unmarshal(body, &listed); err != nil {
+		t.Fatalf("list response %s: %v", body, err)
+	}
+	if len(listed) != 1 || !listed[0].Deployment || listed[0].Image != "nginx" || listed[0].Replicas != 1 {
+		t.Errorf("listed %s, want web scaling its deployment", body)
+	}
+}
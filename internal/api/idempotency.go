@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultIdempotencyTTL is how long a provision result is kept for replay
+const DefaultIdempotencyTTL = time.Hour
+
+// idempotencyHeader lets clients retry a provision without creating duplicates
+const idempotencyHeader = "Idempotency-Key"
+
+// recordedResponse is a response captured for replay to a repeated request
+type recordedResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+	done    chan struct{} // closed once the response is recorded
+}
+
+// idempotencyStore remembers the responses to recent requests by key
+type idempotencyStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*recordedResponse
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{ttl: ttl, entries: make(map[string]*recordedResponse)}
+}
+
+// SetIdempotencyTTL sets how long provision results are kept for replay to
+// requests carrying the same Idempotency-Key
+func (s *ClusterServer) SetIdempotencyTTL(d time.Duration) {
+	s.idempotency.mu.Lock()
+	defer s.idempotency.mu.Unlock()
+	s.idempotency.ttl = d
+}
+
+// begin returns the entry for key and whether the caller owns it. If another
+// request already claimed the key, its entry is returned so the caller can
+// wait for the result.
+func (st *idempotencyStore) begin(key string) (*recordedResponse, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	now := time.Now()
+	for k, e := range st.entries {
+		if !e.expires.IsZero() && now.After(e.expires) {
+			delete(st.entries, k)
+		}
+	}
+	if e, ok := st.entries[key]; ok {
+		return e, false
+	}
+	e := &recordedResponse{done: make(chan struct{})}
+	st.entries[key] = e
+	return e, true
+}
+
+// finish records the response for key, or forgets the key if the response
+// should not be replayed
+func (st *idempotencyStore) finish(key string, e *recordedResponse, rec *responseRecorder) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	e.status = rec.status
+	e.header = rec.Header().Clone()
+	e.body = rec.body.Bytes()
+	if retryable(rec.status) {
+		delete(st.entries, key)
+	} else {
+		e.expires = time.Now().Add(st.ttl)
+	}
+	close(e.done)
+}
+
+// retryable reports whether a response should not be replayed, letting a
+// retry with the same key try again
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// responseRecorder captures a response while passing it through to the client
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Hijack lets WebSocket handlers take over the connection
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection cannot be hijacked")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// idempotencyKey returns the client's key for r from the Idempotency-Key
+// header or a requestId field in a JSON object body, restoring the body
+func idempotencyKey(r *http.Request) string {
+	if key := r.Header.Get(idempotencyHeader); key != "" {
+		return key
+	}
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	var req struct {
+		RequestID string `json:"requestId"`
+	}
+	_ = json.Unmarshal(body, &req)
+	return req.RequestID
+}
+
+// idempotencyScope qualifies key with the namespace r is confined to, the
+// authenticated caller and the path, so that clients picking the same key
+// never see each other's responses
+func idempotencyScope(r *http.Request, key string) string {
+	caller, _ := r.Context().Value(callerKey{}).(string)
+	return requestNamespace(r) + "\x00" + caller + "\x00" + r.URL.Path + "\x00" + key
+}
+
+// idempotent wraps next so that a POST repeating a recent key from the same
+// caller and namespace gets the original response instead of running again.
+// A repeat arriving while the first request is still running waits for its
+// result.
+func (s *ClusterServer) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := ""
+		if r.Method == http.MethodPost {
+			key = idempotencyKey(r)
+		}
+		if key == "" {
+			next(w, r)
+			return
+		}
+		key = idempotencyScope(r, key)
+
+		e, owner := s.idempotency.begin(key)
+		if !owner {
+			select {
+			case <-e.done:
+			case <-r.Context().Done():
+				writeJSONError(w, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+				return
+			}
+			if retryable(e.status) {
+				// The first attempt failed and was forgotten; run this one instead
+				s.idempotent(next)(w, r)
+				return
+			}
+			for k, v := range e.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(e.status)
+			_, _ = w.Write(e.body)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer s.idempotency.finish(key, e, rec)
+		next(rec, r)
+	}
+}
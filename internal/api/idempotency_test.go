@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"mini-cloud/internal/config"
+)
+
+func TestIdempotentProvision(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+	req := map[string]any{"image": "nginx", "cpu": 1, "ttl": "1h"}
+
+	resp, first := do(t, srv, http.MethodPost, "/provision", req, idempotencyHeader, "k1")
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		t.Fatalf("provision: %d %s", resp.StatusCode, first)
+	}
+	resp, again := do(t, srv, http.MethodPost, "/provision", req, idempotencyHeader, "k1")
+	if resp.Header.Get("Idempotent-Replayed") != "true" || string(again) != string(first) {
+		t.Errorf("repeat was not replayed: %s", again)
+	}
+}
+
+func TestIdempotencyKeyScopedToNamespaceAndCaller(t *testing.T) {
+	s, srv, _ := newTestServer(t)
+	if err := s.SetAPIKeys([]config.APIKey{
+		{Name: "alice", Key: "alice-secret", Scope: config.ScopeProvision},
+		{Name: "bob", Key: "bob-secret", Scope: config.ScopeProvision},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	req := map[string]any{"image": "nginx", "cpu": 0.5, "ttl": "1h"}
+
+	ids := make(map[string]string)
+	for _, c := range []struct{ caller, path string }{
+		{"alice", "/provision"},
+		{"bob", "/provision"},
+		{"alice", "/namespaces/a/provision"},
+		{"alice", "/namespaces/b/provision"},
+	} {
+		resp, body := do(t, srv, http.MethodPost, c.path, req, idempotencyHeader, "same", "X-API-Key", c.caller+"-secret")
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s %s: %d %s", c.caller, c.path, resp.StatusCode, body)
+		}
+		if resp.Header.Get("Idempotent-Replayed") != "" {
+			t.Errorf("%s %s got another caller's response: %s", c.caller, c.path, body)
+		}
+		var info containerResponse
+		if err := json.Unmarshal(body, &info); err != nil {
+			t.Fatal(err)
+		}
+		if prev, ok := ids[info.ID]; ok {
+			t.Errorf("%s %s returned the container of %s", c.caller, c.path, prev)
+		}
+		ids[info.ID] = c.caller + " " + c.path
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"mini-cloud/internal/cluster"
+)
+
+// imageResponse describes an image cached on a node
+type imageResponse struct {
+	Node     string     `json:"node"`
+	Image    string     `json:"image"`
+	ID       string     `json:"id,omitempty"`
+	Size     int64      `json:"size,omitempty"` // in bytes
+	PulledAt *time.Time `json:"pulledAt,omitempty"`
+}
+
+func newImageResponse(img cluster.CachedImage) imageResponse {
+	resp := imageResponse{Node: img.NodeID, Image: img.Image, ID: img.ID, Size: img.SizeBytes}
+	if !img.PulledAt.IsZero() {
+		resp.PulledAt = &img.PulledAt
+	}
+	return resp
+}
+
+// prepullRequest is the body of POST /images/prepull
+type prepullRequest struct {
+	Image        string               `json:"image"`
+	Nodes        []string             `json:"nodes"`        // node IDs, all nodes if empty
+	NodeSelector map[string]string    `json:"nodeSelector"` // only nodes with all these labels
+	RegistryAuth *registryAuthRequest `json:"registryAuth"`
+}
+
+// prepullResponse reports the pull on each node
+type prepullResponse struct {
+	Image string              `json:"image"`
+	Nodes []prepullNodeResult `json:"nodes"`
+}
+
+type prepullNodeResult struct {
+	Node  string `json:"node"`
+	Error string `json:"error,omitempty"`
+}
+
+// handleImages lists the images cached on the nodes, filtered by ?node= and ?image=
+func (s *ClusterServer) handleImages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	filter := cluster.ImageFilter{Node: r.URL.Query().Get("node"), Image: r.URL.Query().Get("image")}
+	out := []imageResponse{}
+	for _, img := range s.cluster.Images(filter) {
+		out = append(out, newImageResponse(img))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// handlePrepull pulls an image on the selected nodes ahead of provisioning.
+// The response is 200 if every pull succeeded and 207 otherwise.
+func (s *ClusterServer) handlePrepull(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var req prepullRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if req.Image == "" {
+		writeJSONError(w, http.StatusBadRequest, "Image is required")
+		return
+	}
+
+	target := cluster.PrepullTarget{Nodes: req.Nodes, Selector: req.NodeSelector}
+	results, err := s.cluster.Prepull(r.Context(), req.Image, req.RegistryAuth.toRegistryAuth(), target)
+	switch {
+	case errors.Is(err, cluster.ErrNodeNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := prepullResponse{Image: req.Image, Nodes: make([]prepullNodeResult, 0, len(results))}
+	status := http.StatusOK
+	for _, res := range results {
+		out := prepullNodeResult{Node: res.NodeID}
+		if res.Err != nil {
+			out.Error = res.Err.Error()
+			status = http.StatusMultiStatus
+		}
+		resp.Nodes = append(resp.Nodes, out)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
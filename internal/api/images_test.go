@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestPrepullAndListImages(t *testing.T) {
+	node1, _ := newTestNode("node1", 4, 4096)
+	node2, _ := newTestNode("node2", 4, 4096)
+	_, srv, _ := newTestServer(t, node1, node2)
+	node2.Healthy = false
+
+	resp, body := do(t, srv, http.MethodPost, "/images/prepull", map[string]any{"image": "nginx", "nodes": []string{"node1"}})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("prepull: %d %s", resp.StatusCode, body)
+	}
+	resp, body = do(t, srv, http.MethodPost, "/images/prepull", map[string]any{"image": "redis"})
+	var pulled prepullResponse
+	if err := json.Unmarshal(body, &pulled); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusMultiStatus || len(pulled.Nodes) != 2 || pulled.Nodes[0].Error != "" || pulled.Nodes[1].Error == "" {
+		t.Errorf("prepull with an unhealthy node: %d %s, want 207 with node2 failed", resp.StatusCode, body)
+	}
+	for _, tt := range []struct {
+		name string
+		req  map[string]any
+		want int
+	}{
+		{"no image", map[string]any{"nodes": []string{"node1"}}, http.StatusBadRequest},
+		{"unknown node", map[string]any{"image": "nginx", "nodes": []string{"nope"}}, http.StatusNotFound},
+		{"no matching node", map[string]any{"image": "nginx", "nodeSelector": map[string]string{"gpu": "a100"}}, http.StatusBadRequest},
+	} {
+		if resp, body := do(t, srv, http.MethodPost, "/images/prepull", tt.req); resp.StatusCode != tt.want {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.want)
+		}
+	}
+
+	_, body = do(t, srv, http.MethodGet, "/images?node=node1", nil)
+	var images []imageResponse
+	if err := json.Unmarshal(body, &images); err != nil {
+		t.Fatalf("list response %s: %v", body, err)
+	}
+	if len(images) != 2 || images[0].Image != "nginx:latest" || images[1].Image != "redis:latest" || images[0].PulledAt == nil {
+		t.Errorf("listed %s, want nginx and redis pulled on node1", body)
+	}
+	_, body = do(t, srv, http.MethodGet, "/images?image=nginx", nil)
+	if err := json.Unmarshal(body, &images); err != nil || len(images) != 1 || images[0].Node != "node1" {
+		t.Errorf("filtered by image: %s, want nginx on node1", body)
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"mini-cloud/internal/pki"
+)
+
+// joinRequest is the body of POST /join, sent by a node agent to obtain its certificate
+type joinRequest struct {
+	Token  string `json:"token"`
+	NodeID string `json:"nodeId"`
+	CSR    string `json:"csr"` // PEM certificate request
+}
+
+// joinResponse returns the node's certificate and the cluster CA, both PEM
+type joinResponse struct {
+	Certificate string `json:"certificate"`
+	CA          string `json:"ca"`
+}
+
+// SetJoin lets node agents holding token exchange a certificate request for
+// a node certificate signed by ca through POST /join, until ttl from now.
+// Each node of the cluster can enroll once.
+func (s *ClusterServer) SetJoin(ca *pki.CA, token string, ttl time.Duration) {
+	s.ca = ca
+	s.joinToken = token
+	s.joinExpires = time.Now().Add(ttl)
+}
+
+// handleJoin signs a node certificate for an agent presenting the join token
+// on behalf of a node of the cluster that has not enrolled yet. It is the one
+// endpoint that does not need an API key.
+func (s *ClusterServer) handleJoin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.ca == nil {
+		writeJSONError(w, http.StatusNotImplemented, "Joining is not enabled")
+		return
+	}
+
+	var req joinRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(s.joinToken)) != 1 {
+		s.log.Warn("rejected join with invalid token", "node_id", req.NodeID, "remote", r.RemoteAddr)
+		writeJSONError(w, http.StatusUnauthorized, "Invalid join token")
+		return
+	}
+	if time.Now().After(s.joinExpires) {
+		s.log.Warn("rejected join with expired token", "node_id", req.NodeID, "remote", r.RemoteAddr)
+		writeJSONError(w, http.StatusUnauthorized, "Join token expired")
+		return
+	}
+	if req.NodeID == "" {
+		writeJSONError(w, http.StatusBadRequest, "Missing nodeId")
+		return
+	}
+	if !s.hasNode(req.NodeID) {
+		s.log.Warn("rejected join for unknown node", "node_id", req.NodeID, "remote", r.RemoteAddr)
+		writeJSONError(w, http.StatusForbidden, fmt.Sprintf("Node %q is not part of the cluster", req.NodeID))
+		return
+	}
+
+	cert, err := s.ca.Enroll([]byte(req.CSR), req.NodeID)
+	if errors.Is(err, pki.ErrEnrolled) {
+		s.log.Warn("rejected join for enrolled node", "node_id", req.NodeID, "remote", r.RemoteAddr)
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.log.Info("issued node certificate", "node_id", req.NodeID, "remote", r.RemoteAddr)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(joinResponse{Certificate: string(cert), CA: string(s.ca.CertPEM)})
+}
+
+// hasNode reports whether the cluster has a node called id
+func (s *ClusterServer) hasNode(id string) bool {
+	for _, n := range s.cluster.Nodes() {
+		if n.ID == id {
+			return true
+		}
+	}
+	return false
+}
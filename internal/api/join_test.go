@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"mini-cloud/internal/pki"
+)
+
+func TestJoin(t *testing.T) {
+	s, srv, _ := newTestServer(t)
+	ca, err := pki.LoadOrCreateCA(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetJoin(ca, "s3cret", time.Hour)
+
+	join := func(token, nodeID string) int {
+		t.Helper()
+		_, csr, err := pki.NewRequest(nodeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, _ := do(t, srv, http.MethodPost, "/join", joinRequest{Token: token, NodeID: nodeID, CSR: string(csr)})
+		return resp.StatusCode
+	}
+
+	if got := join("wrong", "node1"); got != http.StatusUnauthorized {
+		t.Errorf("wrong token: status %d, want 401", got)
+	}
+	if got := join("s3cret", "rogue"); got != http.StatusForbidden {
+		t.Errorf("unknown node: status %d, want 403", got)
+	}
+	if got := join("s3cret", "node1"); got != http.StatusOK {
+		t.Fatalf("join: status %d, want 200", got)
+	}
+	if got := join("s3cret", "node1"); got != http.StatusConflict {
+		t.Errorf("second join of node1: status %d, want 409", got)
+	}
+
+	s.SetJoin(ca, "s3cret", -time.Second)
+	if got := join("s3cret", "node1"); got != http.StatusUnauthorized {
+		t.Errorf("expired token: status %d, want 401", got)
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"mini-cloud/internal/config"
+)
+
+// jwtLeeway tolerates clock skew between the token issuer and this server
+const jwtLeeway = 30 * time.Second
+
+// roleScopes maps each RBAC role to the API key scope it is equivalent to
+var roleScopes = map[string]string{
+	config.RoleViewer:   config.ScopeRead,
+	config.RoleOperator: config.ScopeProvision,
+	config.RoleAdmin:    config.ScopeAdmin,
+}
+
+// jwtClaims are the claims read from a bearer token
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	Role      string   `json:"role"`
+	Namespace string   `json:"namespace"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+}
+
+// audience is the "aud" claim, which may be a string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return errors.New("aud must be a string or an array of strings")
+	}
+	*a = many
+	return nil
+}
+
+// SetJWT accepts HS256-signed bearer tokens verified with cfg.Secret. A
+// token's "sub" claim names the caller and its "role" claim (viewer,
+// operator or admin) decides what it may do.
+func (s *ClusterServer) SetJWT(cfg config.JWTConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	s.jwt = &cfg
+	return nil
+}
+
+// isJWT reports whether token has the three dot-separated parts of a JWT
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// verifyJWT checks token's signature and claims and returns the caller it
+// names, with the scope its role grants and the namespace it is confined to
+func verifyJWT(cfg *config.JWTConfig, token string, now time.Time) (principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return principal{}, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return principal{}, fmt.Errorf("malformed header: %w", err)
+	}
+	if header.Alg != "HS256" {
+		return principal{}, fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return principal{}, errors.New("malformed signature")
+	}
+	mac := hmac.New(sha256.New, []byte(cfg.Secret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return principal{}, errors.New("invalid signature")
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return principal{}, fmt.Errorf("malformed claims: %w", err)
+	}
+	switch {
+	case claims.ExpiresAt == nil:
+		return principal{}, errors.New("token has no expiry")
+	case now.After(unixTime(*claims.ExpiresAt).Add(jwtLeeway)):
+		return principal{}, errors.New("token has expired")
+	case claims.NotBefore != nil && now.Add(jwtLeeway).Before(unixTime(*claims.NotBefore)):
+		return principal{}, errors.New("token is not valid yet")
+	case cfg.Issuer != "" && claims.Issuer != cfg.Issuer:
+		return principal{}, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	case cfg.Audience != "" && !slices.Contains(claims.Audience, cfg.Audience):
+		return principal{}, errors.New("token is not meant for this audience")
+	case claims.Subject == "":
+		return principal{}, errors.New("token has no subject")
+	}
+	scope, ok := roleScopes[claims.Role]
+	if !ok {
+		return principal{}, fmt.Errorf("unknown role %q", claims.Role)
+	}
+	return principal{name: claims.Subject, scope: scope, namespace: claims.Namespace}, nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token into v
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// unixTime converts a JWT NumericDate to a time
+func unixTime(secs float64) time.Time {
+	return time.Unix(0, int64(secs*float64(time.Second)))
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"mini-cloud/internal/config"
+)
+
+// testSecret signs the tokens of these tests
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// signJWT returns an HS256 token with claims, signed with secret
+func signJWT(t *testing.T, secret string, claims map[string]any) string {
+	t.Helper()
+	enc := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	unsigned := enc(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + enc(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyJWT(t *testing.T) {
+	cfg := &config.JWTConfig{Secret: testSecret, Issuer: "auth.example.com", Audience: "mini-cloud"}
+	now := time.Now()
+	valid := func() map[string]any {
+		return map[string]any{"sub": "alice", "role": "operator", "iss": "auth.example.com",
+			"aud": []string{"other", "mini-cloud"}, "exp": now.Add(time.Hour).Unix()}
+	}
+	with := func(k string, v any) map[string]any {
+		c := valid()
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"valid", signJWT(t, testSecret, valid()), ""},
+		{"audience as a string", signJWT(t, testSecret, with("aud", "mini-cloud")), ""},
+		{"expired within leeway", signJWT(t, testSecret, with("exp", now.Add(-10*time.Second).Unix())), ""},
+		{"wrong secret", signJWT(t, strings.Repeat("x", 32), valid()), "invalid signature"},
+		{"expired", signJWT(t, testSecret, with("exp", now.Add(-time.Hour).Unix())), "expired"},
+		{"no expiry", signJWT(t, testSecret, with("exp", nil)), "no expiry"},
+		{"not valid yet", signJWT(t, testSecret, with("nbf", now.Add(time.Hour).Unix())), "not valid yet"},
+		{"other issuer", signJWT(t, testSecret, with("iss", "evil")), "unexpected issuer"},
+		{"other audience", signJWT(t, testSecret, with("aud", "other")), "audience"},
+		{"no subject", signJWT(t, testSecret, with("sub", nil)), "no subject"},
+		{"unknown role", signJWT(t, testSecret, with("role", "root")), "unknown role"},
+		{"unsigned", "eyJhbGciOiJub25lIn0.eyJzdWIiOiJhbGljZSJ9.", "unsupported algorithm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := verifyJWT(cfg, tt.token, now)
+			if tt.wantErr == "" {
+				if err != nil || p != (principal{name: "alice", scope: config.ScopeProvision}) {
+					t.Errorf("verifyJWT = %+v, %v; want alice with the provision scope", p, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWTRoles(t *testing.T) {
+	s, srv, _ := newTestServer(t)
+	if err := s.SetJWT(config.JWTConfig{Secret: "short"}); err == nil {
+		t.Error("short secret accepted")
+	}
+	if err := s.SetJWT(config.JWTConfig{Secret: testSecret}); err != nil {
+		t.Fatalf("SetJWT: %v", err)
+	}
+	token := func(role string) string {
+		return "Bearer " + signJWT(t, testSecret, map[string]any{"sub": role + "-user", "role": role, "exp": time.Now().Add(time.Hour).Unix()})
+	}
+	req := map[string]any{"image": "nginx", "cpu": 0.5, "ttl": "1h"}
+
+	if resp, body := do(t, srv, http.MethodGet, "/list", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("without a token: %d %s, want 401", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodGet, "/list", nil, "Authorization", token("viewer")); resp.StatusCode != http.StatusOK {
+		t.Errorf("viewer listing: %d %s", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodPost, "/provision", req, "Authorization", token("viewer")); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("viewer provisioning: %d %s, want 403", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodPost, "/provision", req, "Authorization", token("operator")); resp.StatusCode != http.StatusOK {
+		t.Errorf("operator provisioning: %d %s", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodGet, "/loglevels", nil, "Authorization", token("operator")); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("operator reading log levels: %d %s, want 403", resp.StatusCode, body)
+	}
+}
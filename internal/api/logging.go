@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"mini-cloud/internal/logging"
+)
+
+// logLevelRequest is the body of PUT /loglevels/{component}
+type logLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// SetLogger replaces the logger used by the API server
+func (s *ClusterServer) SetLogger(l *slog.Logger) {
+	s.log = l
+}
+
+// SetLogLevels enables reading and changing per-component log levels through /loglevels
+func (s *ClusterServer) SetLogLevels(l *logging.Levels) {
+	s.logLevels = l
+}
+
+// handleLogLevels lists the level of every component
+func (s *ClusterServer) handleLogLevels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.logLevels == nil {
+		writeJSONError(w, http.StatusNotImplemented, "Log levels are not configurable")
+		return
+	}
+
+	out := make(map[string]string)
+	for c, level := range s.logLevels.Levels() {
+		out[c] = level.String()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// handleLogLevel changes the level of one component
+func (s *ClusterServer) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.logLevels == nil {
+		writeJSONError(w, http.StatusNotImplemented, "Log levels are not configurable")
+		return
+	}
+	component := strings.TrimPrefix(r.URL.Path, "/loglevels/")
+	if component == "" || strings.Contains(component, "/") {
+		writeJSONError(w, http.StatusBadRequest, "Invalid component")
+		return
+	}
+
+	var req logLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid level: "+err.Error())
+		return
+	}
+
+	s.logLevels.SetLevel(component, level)
+	s.log.Info("log level changed", "for_component", component, "level", level)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(logLevelRequest{Level: level.String()})
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/manager"
+)
+
+// defaultLogTail is how many log lines /logs returns when no tail is given
+const defaultLogTail = 100
+
+// maxLogLine is the longest log line streamed in one piece; longer lines are split
+const maxLogLine = 64 * 1024
+
+// logsResponse carries the recent output of a container
+type logsResponse struct {
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+}
+
+// logLine is one line of output streamed by /logs?follow=true
+type logLine struct {
+	Stream string `json:"stream"` // "stdout" or "stderr"
+	Line   string `json:"line"`   // without the trailing newline
+}
+
+// logEnd is the last event of a followed log stream
+type logEnd struct {
+	Reason string `json:"reason"`
+}
+
+// lineWriter splits what is written to it into lines and sends them on
+// lines until ctx is done
+type lineWriter struct {
+	ctx    context.Context
+	stream string
+	lines  chan<- logLine
+	buf    []byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 && len(lw.buf) < maxLogLine {
+			return len(p), nil
+		}
+		if i < 0 || i > maxLogLine {
+			i = maxLogLine
+		}
+		line := string(lw.buf[:i])
+		if i < len(lw.buf) && lw.buf[i] == '\n' {
+			i++
+		}
+		lw.buf = lw.buf[i:]
+		if err := lw.send(line); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// flush sends what is left of an unterminated last line
+func (lw *lineWriter) flush() error {
+	if len(lw.buf) == 0 {
+		return nil
+	}
+	line := string(lw.buf)
+	lw.buf = nil
+	return lw.send(line)
+}
+
+func (lw *lineWriter) send(line string) error {
+	select {
+	case lw.lines <- logLine{Stream: lw.stream, Line: line}:
+		return nil
+	case <-lw.ctx.Done():
+		return lw.ctx.Err()
+	}
+}
+
+// handleLogs returns the last ?tail= lines (default 100, "all" for every
+// line) a container wrote to stdout and stderr. With ?follow=true the lines
+// are streamed as server-sent events, followed by new output until the
+// client disconnects or the container stops.
+func (s *ClusterServer) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id, err := containerIDFromPath(r.URL.Path, "/logs/")
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	q := r.URL.Query()
+	tail := defaultLogTail
+	switch v := q.Get("tail"); v {
+	case "":
+	case "all":
+		tail = 0
+	default:
+		tail, err = strconv.Atoi(v)
+		if err != nil || tail <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "Invalid tail (a positive number of lines or \"all\")")
+			return
+		}
+	}
+	follow := false
+	if v := q.Get("follow"); v != "" {
+		if follow, err = strconv.ParseBool(v); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid follow (true or false)")
+			return
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if follow && !ok {
+		writeJSONError(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	logs, err := s.cluster.ContainerLogs(ctx, id, docker.LogOptions{Tail: tail, Follow: follow})
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, manager.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		writeJSONError(w, status, "Failed to read logs: "+err.Error())
+		return
+	}
+	defer logs.Close()
+
+	if !follow {
+		var stdout, stderr strings.Builder
+		if _, err := stdcopy.StdCopy(&stdout, &stderr, logs); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to read logs: "+err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(logsResponse{Stdout: stdout.String(), Stderr: stderr.String()})
+		return
+	}
+
+	// Demultiplex in the background so that keep-alives and shutdown are
+	// handled while no output arrives
+	lines := make(chan logLine)
+	copied := make(chan error, 1)
+	go func() {
+		stdout := &lineWriter{ctx: ctx, stream: "stdout", lines: lines}
+		stderr := &lineWriter{ctx: ctx, stream: "stderr", lines: lines}
+		_, err := stdcopy.StdCopy(stdout, stderr, logs)
+		if err == nil {
+			err = errors.Join(stdout.flush(), stderr.flush())
+		}
+		copied <- err
+	}()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case line := <-lines:
+			data, _ := json.Marshal(line) // logLine always encodes
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", line.Stream, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case err := <-copied:
+			// The daemon ends the stream when the container stops or is removed
+			end := logEnd{Reason: "container stopped"}
+			if err != nil {
+				end.Reason = "log stream failed: " + err.Error()
+			}
+			data, _ := json.Marshal(end)
+			fmt.Fprintf(w, "event: end\ndata: %s\n\n", data)
+			flusher.Flush()
+			return
+		}
+	}
+}
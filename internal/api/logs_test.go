@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLogs(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	_, srv, _ := newTestServer(t, node)
+	info := provision(t, srv, map[string]any{"image": "web", "cpu": 1})
+	rt.SetLogs(info.ID, "one\ntwo\nthree\n", "oops\n")
+
+	tests := []struct {
+		query      string
+		wantStdout string
+	}{
+		{"", "one\ntwo\nthree\n"},
+		{"?tail=2", "two\nthree\n"},
+		{"?tail=all", "one\ntwo\nthree\n"},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, srv, http.MethodGet, "/logs/"+info.ID+tt.query, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("logs%s: %d %s", tt.query, resp.StatusCode, body)
+		}
+		var logs logsResponse
+		if err := json.Unmarshal(body, &logs); err != nil {
+			t.Fatalf("logs response %s: %v", body, err)
+		}
+		if logs.Stdout != tt.wantStdout || logs.Stderr != "oops\n" {
+			t.Errorf("logs%s: stdout %q, stderr %q; want %q and the error line", tt.query, logs.Stdout, logs.Stderr, tt.wantStdout)
+		}
+	}
+
+	if resp, body := do(t, srv, http.MethodGet, "/logs/"+info.ID+"?tail=-1", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("negative tail: %d %s, want 400", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodGet, "/logs/missing", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("logs of an unknown container: %d %s, want 404", resp.StatusCode, body)
+	}
+}
+
+// nextFrame reads an event stream until a frame with data and returns its
+// event name and raw data
+func nextFrame(t *testing.T, r *bufio.Reader) (string, string) {
+	t.Helper()
+	var name string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event stream: %v", err)
+		}
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+		case strings.HasPrefix(line, "data: "):
+			return name, strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
+
+func TestFollowLogs(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	_, srv, _ := newTestServer(t, node)
+	info := provision(t, srv, map[string]any{"image": "web", "cpu": 1})
+	rt.SetLogs(info.ID, "one\ntwo\n", "oops") // the last line is unterminated
+
+	stream := openEvents(t, srv, "/logs/"+info.ID+"?follow=true")
+	want := []logLine{{"stdout", "one"}, {"stdout", "two"}, {"stderr", "oops"}}
+	for _, w := range want {
+		name, data := nextFrame(t, stream)
+		var got logLine
+		if err := json.Unmarshal([]byte(data), &got); err != nil {
+			t.Fatalf("log line %q: %v", data, err)
+		}
+		if name != w.Stream || got != w {
+			t.Errorf("received %s %+v, want %+v", name, got, w)
+		}
+	}
+	// The fake runtime's stream ends like Docker's does when the container stops
+	if name, data := nextFrame(t, stream); name != "end" || !strings.Contains(data, "container stopped") {
+		t.Errorf("received %s %s, want the end of the stream", name, data)
+	}
+
+	if resp, body := do(t, srv, http.MethodGet, "/logs/"+info.ID+"?follow=maybe", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid follow: %d %s, want 400", resp.StatusCode, body)
+	}
+}
+
+func TestLineWriterSplitsLongLines(t *testing.T) {
+	lines := make(chan logLine, 4)
+	lw := &lineWriter{ctx: context.Background(), stream: "stdout", lines: lines}
+	long := strings.Repeat("x", maxLogLine+10)
+	if _, err := lw.Write([]byte(long + "\nshort")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := lw.flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	close(lines)
+
+	var got []int
+	for l := range lines {
+		got = append(got, len(l.Line))
+	}
+	if len(got) != 3 || got[0] != maxLogLine || got[1] != 10 || got[2] != len("short") {
+		t.Errorf("line lengths %v, want the long line split at %d and then short", got, maxLogLine)
+	}
+}
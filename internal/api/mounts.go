@@ -0,0 +1,111 @@
+package api
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"mini-cloud/internal/docker"
+)
+
+// mountRequest attaches a host directory or named volume to the container
+type mountRequest struct {
+	Type     string `json:"type"`   // bind or volume (default)
+	Source   string `json:"source"` // host path or volume name
+	Target   string `json:"target"` // path inside the container
+	ReadOnly bool   `json:"readOnly"`
+	// RemoveOnExpiry removes a volume this mount creates once the container expires
+	RemoveOnExpiry bool `json:"removeOnExpiry"`
+}
+
+// volumeName matches the names Docker accepts for named volumes
+var volumeName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+// toMounts validates the requested mounts and converts them
+func toMounts(reqs []mountRequest) ([]docker.Mount, error) {
+	mounts := make([]docker.Mount, 0, len(reqs))
+	targets := make(map[string]bool)
+	for _, m := range reqs {
+		mount := docker.Mount{
+			Type:           cmp.Or(m.Type, docker.MountVolume),
+			Source:         m.Source,
+			Target:         path.Clean(m.Target),
+			ReadOnly:       m.ReadOnly,
+			RemoveOnExpiry: m.RemoveOnExpiry,
+		}
+		switch {
+		case mount.Type != docker.MountVolume && mount.Type != docker.MountBind:
+			return nil, fmt.Errorf("Invalid mount type %q (expected \"bind\" or \"volume\")", m.Type)
+		case !path.IsAbs(m.Target):
+			return nil, fmt.Errorf("Mount target %q must be an absolute path", m.Target)
+		case targets[mount.Target]:
+			return nil, fmt.Errorf("Mount target %s is used twice", mount.Target)
+		case mount.Type == docker.MountVolume && !volumeName.MatchString(m.Source):
+			return nil, fmt.Errorf("Invalid volume name %q", m.Source)
+		case mount.Type == docker.MountBind && m.RemoveOnExpiry:
+			return nil, errors.New("removeOnExpiry only applies to volumes")
+		case mount.Type == docker.MountBind && !filepath.IsAbs(m.Source):
+			return nil, fmt.Errorf("Bind mount source %q must be an absolute path", m.Source)
+		}
+		if mount.Type == docker.MountBind {
+			mount.Source = filepath.Clean(m.Source)
+		}
+		targets[mount.Target] = true
+		mounts = append(mounts, mount)
+	}
+	return mounts, nil
+}
+
+// SetBindMountRoots allows bind mounts of host directories under roots.
+// Without roots, bind mounts are rejected: mounting arbitrary host paths,
+// such as the Docker socket, would hand callers the node.
+func (s *ClusterServer) SetBindMountRoots(roots []string) {
+	s.bindMountRoots = make([]string, len(roots))
+	for i, r := range roots {
+		s.bindMountRoots[i] = filepath.Clean(r)
+	}
+}
+
+// checkBindMounts rejects bind mounts outside the allowed roots
+func (s *ClusterServer) checkBindMounts(mounts []docker.Mount) error {
+	for _, m := range mounts {
+		if m.Type != docker.MountBind {
+			continue
+		}
+		if len(s.bindMountRoots) == 0 {
+			return errors.New("Bind mounts are not enabled")
+		}
+		if !s.bindMountAllowed(m.Source) {
+			return fmt.Errorf("Bind mount source %s is outside the allowed directories (%s)", m.Source, strings.Join(s.bindMountRoots, ", "))
+		}
+	}
+	return nil
+}
+
+// bindMountAllowed reports whether the cleaned host path src is one of the
+// allowed roots or inside one
+func (s *ClusterServer) bindMountAllowed(src string) bool {
+	for _, root := range s.bindMountRoots {
+		if rel, err := filepath.Rel(root, src); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
+
+// specFor validates req, including mounts against the server's settings, and
+// converts it into a container spec
+func (s *ClusterServer) specFor(req provisionRequest) (docker.ContainerSpec, error) {
+	spec, err := req.toSpec()
+	if err != nil {
+		return docker.ContainerSpec{}, err
+	}
+	if err := s.checkBindMounts(spec.Mounts); err != nil {
+		return docker.ContainerSpec{}, err
+	}
+	return spec, nil
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"mini-cloud/internal/docker"
+)
+
+func TestProvisionMounts(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	s, srv, _ := newTestServer(t, node)
+
+	info := provision(t, srv, map[string]any{"image": "postgres", "cpu": 1, "mounts": []map[string]any{
+		{"source": "pgdata", "target": "/var/lib/postgresql/data/"},
+	}})
+	c, _ := rt.Container(info.ID)
+	want := docker.Mount{Type: docker.MountVolume, Source: "pgdata", Target: "/var/lib/postgresql/data"}
+	if len(c.Spec.Mounts) != 1 || c.Spec.Mounts[0] != want {
+		t.Errorf("created with mounts %+v, want %+v", c.Spec.Mounts, want)
+	}
+
+	bind := func(src string) map[string]any {
+		return map[string]any{"image": "web", "cpu": 1, "mounts": []map[string]any{
+			{"type": "bind", "source": src, "target": "/data", "readOnly": true},
+		}}
+	}
+	if resp, body := do(t, srv, http.MethodPost, "/provision", bind("/srv/data")); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bind mount without allowed roots: %d %s, want 400", resp.StatusCode, body)
+	}
+
+	s.SetBindMountRoots([]string{"/srv/data/"})
+	info = provision(t, srv, bind("/srv/data/web"))
+	if c, _ := rt.Container(info.ID); len(c.Spec.Mounts) != 1 || !c.Spec.Mounts[0].ReadOnly || c.Spec.Mounts[0].Source != "/srv/data/web" {
+		t.Errorf("created with mounts %+v, want /srv/data/web read-only", c.Spec.Mounts)
+	}
+
+	tests := []struct {
+		name   string
+		mounts []map[string]any
+	}{
+		{"outside the roots", []map[string]any{{"type": "bind", "source": "/var/run/docker.sock", "target": "/sock"}}},
+		{"escaping a root", []map[string]any{{"type": "bind", "source": "/srv/data/../../etc", "target": "/etc2"}}},
+		{"sharing a root's prefix", []map[string]any{{"type": "bind", "source": "/srv/database", "target": "/db"}}},
+		{"relative bind source", []map[string]any{{"type": "bind", "source": "data", "target": "/data"}}},
+		{"relative target", []map[string]any{{"source": "cache", "target": "cache"}}},
+		{"invalid volume name", []map[string]any{{"source": "../cache", "target": "/cache"}}},
+		{"unknown type", []map[string]any{{"type": "tmpfs", "target": "/tmp"}}},
+		{"target twice", []map[string]any{{"source": "a1", "target": "/data"}, {"source": "b1", "target": "/data/"}}},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, srv, http.MethodPost, "/provision", map[string]any{"image": "web", "cpu": 1, "mounts": tt.mounts})
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: %d %s, want 400", tt.name, resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// namespaceKey is the context key of the namespace a request is confined to
+type namespaceKey struct{}
+
+// namespacedRoutes are the endpoints served under /namespaces/{ns}/, confined
+// to the containers of that namespace. Routes ending in a slash take a
+// container ID.
+var namespacedRoutes = map[string]bool{
+	"provision":       false,
+	"provision/batch": false,
+	"schedule/dryrun": false,
+	"list":            false,
+	"terminate":       false,
+	"terminate/":      true,
+	"status/":         true,
+	"containers/":     true,
+	"restart/":        true,
+	"renew/":          true,
+	"exec/":           true,
+	"logs/":           true,
+	"stats/":          true,
+	"volumes":         false,
+}
+
+// requestNamespace returns the namespace r is confined to, if any
+func requestNamespace(r *http.Request) string {
+	ns, _ := r.Context().Value(namespaceKey{}).(string)
+	return ns
+}
+
+// confineNamespace sets *ns to the namespace r is confined to, rejecting a
+// different namespace the client asked for
+func confineNamespace(r *http.Request, ns *string) error {
+	confined := requestNamespace(r)
+	if confined == "" {
+		return nil
+	}
+	if *ns != "" && *ns != confined {
+		return fmt.Errorf("Namespace %q does not match the path's namespace %q", *ns, confined)
+	}
+	*ns = confined
+	return nil
+}
+
+// splitNamespacePath splits /namespaces/{ns}/{rest} into ns and rest
+func splitNamespacePath(path string) (ns, rest string, ok bool) {
+	ns, rest, ok = strings.Cut(strings.TrimPrefix(path, "/namespaces/"), "/")
+	return ns, rest, ok && ns != ""
+}
+
+// handleNamespaced serves /namespaces/{ns}/quota and, for the other routes,
+// /namespaces/{ns}/{route} by running the usual handler for /{route} confined
+// to namespace ns. Containers of other namespaces are reported as not found.
+func (s *ClusterServer) handleNamespaced(w http.ResponseWriter, r *http.Request) {
+	ns, rest, ok := splitNamespacePath(r.URL.Path)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	if rest == "quota" {
+		s.namespaceQuota(w, r, ns)
+		return
+	}
+	if strings.HasPrefix(rest, "volumes/") {
+		// Volumes are looked up within the namespace by handleVolume itself
+		s.serveConfined(w, r, ns, rest)
+		return
+	}
+
+	route, id := rest, ""
+	if _, ok := namespacedRoutes[route]; !ok {
+		prefix, tail, _ := strings.Cut(rest, "/")
+		route, id = prefix+"/", tail
+		if takesID, ok := namespacedRoutes[route]; !ok || !takesID {
+			writeJSONError(w, http.StatusNotFound, "Not found")
+			return
+		}
+	}
+
+	if id != "" {
+		cid, _, _ := strings.Cut(id, "/")
+		info, err := s.cluster.GetContainerStatus(r.Context(), cid)
+		if err != nil || info.Namespace != ns {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("Container %s not found in namespace %q", cid, ns))
+			return
+		}
+	}
+
+	s.serveConfined(w, r, ns, rest)
+}
+
+// serveConfined runs the handler for /{rest} confined to namespace ns
+func (s *ClusterServer) serveConfined(w http.ResponseWriter, r *http.Request, ns, rest string) {
+	r2 := r.Clone(context.WithValue(r.Context(), namespaceKey{}, ns))
+	r2.URL.Path = "/" + rest
+	r2.URL.RawPath = ""
+	s.mux.ServeHTTP(w, r2)
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"mini-cloud/internal/cluster"
+	"mini-cloud/internal/config"
+)
+
+func TestNamespacedEndpoints(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+	req := map[string]any{"image": "nginx", "cpu": 0.5, "ttl": "1h"}
+
+	resp, body := do(t, srv, http.MethodPost, "/namespaces/a/provision", req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("provision in a: %d %s", resp.StatusCode, body)
+	}
+	var info containerResponse
+	if err := json.Unmarshal(body, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Namespace != "a" {
+		t.Errorf("provisioned in namespace %q, want a", info.Namespace)
+	}
+	other := provision(t, srv, map[string]any{"image": "nginx", "cpu": 0.5, "namespace": "b"})
+
+	if resp, body := do(t, srv, http.MethodPost, "/namespaces/a/provision", map[string]any{"image": "nginx", "namespace": "b"}); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("provision naming another namespace: %d %s, want 400", resp.StatusCode, body)
+	}
+
+	resp, body = do(t, srv, http.MethodGet, "/namespaces/a/list", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("list a: %d %s", resp.StatusCode, body)
+	}
+	var listed []containerResponse
+	if err := json.Unmarshal(body, &listed); err != nil {
+		t.Fatalf("list response %s: %v", body, err)
+	}
+	if len(listed) != 1 || listed[0].ID != info.ID {
+		t.Errorf("listed %s in a, want only %s", body, info.ID)
+	}
+
+	if resp, body := do(t, srv, http.MethodGet, "/namespaces/a/status/"+other.ID, nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status of b's container through a: %d %s, want 404", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodPost, "/namespaces/a/terminate/"+other.ID, nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("terminating b's container through a: %d %s, want 404", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodGet, "/namespaces/a/nodes", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("cluster route under a namespace: %d %s, want 404", resp.StatusCode, body)
+	}
+}
+
+func TestNamespaceConfinedCallers(t *testing.T) {
+	s, srv, _ := newTestServer(t)
+	if err := s.SetAPIKeys([]config.APIKey{{Name: "team-a", Key: "a-secret", Scope: config.ScopeProvision, Namespace: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetJWT(config.JWTConfig{Secret: testSecret}); err != nil {
+		t.Fatal(err)
+	}
+	token := "Bearer " + signJWT(t, testSecret, map[string]any{"sub": "bob", "role": "operator", "namespace": "a", "exp": time.Now().Add(time.Hour).Unix()})
+
+	for _, auth := range [][]string{{"X-API-Key", "a-secret"}, {"Authorization", token}} {
+		if resp, body := do(t, srv, http.MethodGet, "/namespaces/a/list", nil, auth...); resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: own namespace: %d %s", auth[0], resp.StatusCode, body)
+		}
+		for _, path := range []string{"/list", "/namespaces/b/list"} {
+			if resp, body := do(t, srv, http.MethodGet, path, nil, auth...); resp.StatusCode != http.StatusForbidden {
+				t.Errorf("%s: %s: %d %s, want 403", auth[0], path, resp.StatusCode, body)
+			}
+		}
+	}
+}
+
+func TestNamespacedDryRun(t *testing.T) {
+	s, srv, cm := newTestServer(t)
+	cm.SetQuota("a", cluster.Quota{CPU: 1})
+	if err := s.SetAPIKeys([]config.APIKey{{Name: "viewer", Key: "v-secret", Scope: config.ScopeRead, Namespace: "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	key := []string{"X-API-Key", "v-secret"}
+
+	if resp, body := do(t, srv, http.MethodPost, "/namespaces/a/schedule/dryrun", map[string]any{"image": "nginx", "cpu": 1, "ttl": "1h"}, key...); resp.StatusCode != http.StatusOK {
+		t.Errorf("dry run in a with a read key: %d %s", resp.StatusCode, body)
+	}
+	// The dry run is held to a's quota
+	if resp, body := do(t, srv, http.MethodPost, "/namespaces/a/schedule/dryrun", map[string]any{"image": "nginx", "cpu": 2, "ttl": "1h"}, key...); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("dry run over a's quota: %d %s, want 403", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodPost, "/namespaces/a/schedule/dryrun", map[string]any{"image": "nginx", "namespace": "b", "ttl": "1h"}, key...); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("dry run naming another namespace: %d %s, want 400", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodPost, "/schedule/dryrun", map[string]any{"image": "nginx", "ttl": "1h"}, key...); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unconfined dry run with a namespace-bound key: %d %s, want 403", resp.StatusCode, body)
+	}
+}
+
+func TestNamespaceQuota(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+	if resp, body := do(t, srv, http.MethodPut, "/namespaces/a/quota", map[string]any{"containers": 1}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("set quota: %d %s", resp.StatusCode, body)
+	}
+	req := map[string]any{"image": "nginx", "cpu": 0.5, "ttl": "1h"}
+	if resp, body := do(t, srv, http.MethodPost, "/namespaces/a/provision", req); resp.StatusCode != http.StatusOK {
+		t.Fatalf("provision: %d %s", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodPost, "/namespaces/a/provision", req); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("provision past the container quota: %d %s, want 403", resp.StatusCode, body)
+	}
+
+	resp, body := do(t, srv, http.MethodGet, "/namespaces/a/quota", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("get quota: %d %s", resp.StatusCode, body)
+	}
+	var got quotaResponse
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("quota response %s: %v", body, err)
+	}
+	if got.Quota == nil || got.Quota.Containers != 1 || got.Used.Containers != 1 || got.Used.CPU != 0.5 {
+		t.Errorf("quota %s, want a one-container quota that is used up", body)
+	}
+}
+
+func TestNamespaceNetworkForbidden(t *testing.T) {
+	_, srv, cm := newTestServer(t)
+	cm.SetNetworkIsolation(true)
+
+	req := map[string]any{"image": "nginx", "cpu": 0.5, "ttl": "1h", "network": "mini-cloud-ns-a"}
+	if resp, body := do(t, srv, http.MethodPost, "/namespaces/b/provision", req); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("provision in b on a's network: %d %s, want 403", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/time/rate"
+)
+
+// Default limits for the provisioning endpoints
+const (
+	DefaultProvisionRate  = 10 // requests per second
+	DefaultProvisionBurst = 20
+)
+
+// SetProvisionRateLimit limits /provision and /provision/batch to rps requests
+// per second with bursts of up to burst requests, across all clients
+func (s *ClusterServer) SetProvisionRateLimit(rps float64, burst int) {
+	s.provisionLimiter.SetLimit(rate.Limit(rps))
+	s.provisionLimiter.SetBurst(burst)
+}
+
+// rateLimited wraps next so that requests over limiter's rate are rejected
+// with 429 and a Retry-After header
+func rateLimited(limiter *rate.Limiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := limiter.Reserve()
+		if !res.OK() {
+			writeJSONError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+		if delay := res.Delay(); delay > 0 {
+			res.Cancel()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			writeJSONError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+		next(w, r)
+	}
+}
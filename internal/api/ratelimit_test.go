@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestProvisionRateLimit(t *testing.T) {
+	s, srv, _ := newTestServer(t)
+	s.SetProvisionRateLimit(0.5, 2)
+	req := map[string]any{"image": "nginx", "cpu": 0.1, "ttl": "1h"}
+
+	var limited int
+	for i := range 5 {
+		resp, body := do(t, srv, http.MethodPost, "/provision", req)
+		switch {
+		case i < 2 && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated:
+			t.Errorf("request %d within the burst: %d %s", i, resp.StatusCode, body)
+		case resp.StatusCode == http.StatusTooManyRequests:
+			limited++
+			if got := resp.Header.Get("Retry-After"); got != "2" {
+				t.Errorf("Retry-After = %q, want 2 at half a request per second", got)
+			}
+		}
+	}
+	if limited != 3 {
+		t.Errorf("%d requests limited, want the 3 past the burst", limited)
+	}
+
+	// Batches share the limit; reads aren't limited
+	if resp, body := do(t, srv, http.MethodPost, "/provision/batch", []map[string]any{req}); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("batch: %d %s, want 429", resp.StatusCode, body)
+	}
+	for range 5 {
+		if resp, body := do(t, srv, http.MethodGet, "/list", nil); resp.StatusCode != http.StatusOK {
+			t.Fatalf("list: %d %s", resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+// TLSOptions configures serving the API over HTTPS
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile, if set, requires clients to present a certificate signed
+	// by one of the CAs in this PEM file
+	ClientCAFile string
+	// RedirectAddr, if set, serves plain HTTP on this address that redirects
+	// every request to HTTPS
+	RedirectAddr string
+}
+
+// SetTLS makes Run serve HTTPS with opts. The certificate and CA files are
+// checked right away so that mistakes show up before the server starts.
+func (s *ClusterServer) SetTLS(opts TLSOptions) error {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return errors.New("TLS needs both a certificate and a key file")
+	}
+	if _, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile); err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", opts.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	s.server.TLSConfig = cfg
+	s.tls = &opts
+	if opts.RedirectAddr != "" {
+		s.redirect = &http.Server{Addr: opts.RedirectAddr, Handler: http.HandlerFunc(s.redirectToHTTPS)}
+	}
+	return nil
+}
+
+// redirectToHTTPS sends a request to the same URL over HTTPS on the server's
+// port, keeping the method with 308
+func (s *ClusterServer) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	_, port, _ := net.SplitHostPort(s.server.Addr)
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if port != "" && port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+}
+
+// runRedirect serves the HTTP-to-HTTPS redirect until the server shuts down
+func (s *ClusterServer) runRedirect() {
+	s.log.Info("redirecting HTTP to HTTPS", "addr", s.redirect.Addr)
+	if err := s.redirect.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		s.log.Error("HTTP redirect server failed", "addr", s.redirect.Addr, "error", err)
+	}
+}
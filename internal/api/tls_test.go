@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate and key written to PEM files
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCert issues a certificate for 127.0.0.1 named cn, signed by parent
+// or self-signed if parent is nil
+func newTestCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	c := &testCert{cert: cert, key: key, certFile: filepath.Join(dir, "cert.pem"), keyFile: filepath.Join(dir, "key.pem")}
+	if err := os.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// tlsClient returns a client trusting ca and presenting client, if not nil
+func tlsClient(t *testing.T, ca, client *testCert) *http.Client {
+	t.Helper()
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	cfg := &tls.Config{RootCAs: pool}
+	if client != nil {
+		pair, err := tls.LoadX509KeyPair(client.certFile, client.keyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}, Timeout: 2 * time.Second}
+}
+
+func TestServeTLSWithClientCerts(t *testing.T) {
+	ca := newTestCert(t, "test CA", nil, true)
+	server := newTestCert(t, "mini-cloud", ca, false)
+	client := newTestCert(t, "ci", ca, false)
+
+	s, _, _ := newTestServer(t)
+	if err := s.SetTLS(TLSOptions{CertFile: server.certFile}); err == nil {
+		t.Error("SetTLS without a key file accepted")
+	}
+	if err := s.SetTLS(TLSOptions{CertFile: server.certFile, KeyFile: server.keyFile, ClientCAFile: ca.certFile}); err != nil {
+		t.Fatalf("SetTLS: %v", err)
+	}
+	addr := freeAddr(t)
+	done := make(chan error, 1)
+	go func() { done <- s.Run(addr) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = s.Shutdown(ctx)
+		<-done
+	})
+
+	withCert := tlsClient(t, ca, client)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := withCert.Get("https://" + addr + "/list")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("list over HTTPS: %d", resp.StatusCode)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("HTTPS server did not come up: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if resp, err := tlsClient(t, ca, nil).Get("https://" + addr + "/list"); err == nil {
+		resp.Body.Close()
+		t.Error("request without a client certificate accepted")
+	}
+	if resp, err := http.Get("http://" + addr + "/list"); err == nil {
+		if resp.StatusCode == http.StatusOK {
+			t.Error("plain HTTP request served")
+		}
+		resp.Body.Close()
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	s, _, _ := newTestServer(t)
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{":8443", "https://example.com:8443/list?namespace=a"},
+		{":443", "https://example.com/list?namespace=a"},
+	}
+	for _, tt := range tests {
+		s.server.Addr = tt.addr
+		rec := httptest.NewRecorder()
+		s.redirectToHTTPS(rec, httptest.NewRequest(http.MethodPost, "http://example.com:8080/list?namespace=a", nil))
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != tt.want {
+			t.Errorf("server on %s: %d to %q, want 308 to %q", tt.addr, rec.Code, rec.Header().Get("Location"), tt.want)
+		}
+	}
+}
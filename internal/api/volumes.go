@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"mini-cloud/internal/cluster"
+)
+
+// volumeRequest is the body of POST /volumes
+type volumeRequest struct {
+	Name      string `json:"name"`
+	Node      string `json:"node"`
+	Namespace string `json:"namespace"`
+}
+
+// volumeResponse describes a named volume and the containers mounting it
+type volumeResponse struct {
+	Name           string    `json:"name"`
+	Node           string    `json:"node"`
+	Namespace      string    `json:"namespace,omitempty"`
+	Owner          string    `json:"owner,omitempty"` // container whose mount created it
+	RemoveOnExpiry bool      `json:"removeOnExpiry,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UsedBy         []string  `json:"usedBy"`
+}
+
+func newVolumeResponse(v cluster.Volume) volumeResponse {
+	return volumeResponse{
+		Name:           v.Name,
+		Node:           v.NodeID,
+		Namespace:      v.Namespace,
+		Owner:          v.Owner,
+		RemoveOnExpiry: v.RemoveOnExpiry,
+		CreatedAt:      v.CreatedAt,
+		UsedBy:         append([]string{}, v.UsedBy...),
+	}
+}
+
+// volumeErrorStatus maps a volume error to an HTTP status code
+func volumeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, cluster.ErrVolumeNotFound), errors.Is(err, cluster.ErrNodeNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, cluster.ErrVolumeExists), errors.Is(err, cluster.ErrVolumeInUse):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// handleVolumes lists volumes on GET, filtered by ?node= and ?namespace=, and
+// creates one on POST
+func (s *ClusterServer) handleVolumes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		filter := cluster.VolumeFilter{Node: r.URL.Query().Get("node"), Namespace: r.URL.Query().Get("namespace")}
+		if err := confineNamespace(r, &filter.Namespace); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		out := []volumeResponse{}
+		for _, v := range s.cluster.Volumes(filter) {
+			out = append(out, newVolumeResponse(v))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	case http.MethodPost:
+		var req volumeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+		if err := confineNamespace(r, &req.Namespace); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !volumeName.MatchString(req.Name) {
+			writeJSONError(w, http.StatusBadRequest, "Invalid volume name")
+			return
+		}
+		if req.Node == "" {
+			writeJSONError(w, http.StatusBadRequest, "Node is required")
+			return
+		}
+		v, err := s.cluster.CreateVolume(r.Context(), req.Node, req.Namespace, req.Name)
+		if err != nil {
+			writeJSONError(w, volumeErrorStatus(err), err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(newVolumeResponse(*v))
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleVolume deletes the volume at /volumes/{node}/{name}. Volumes still
+// mounted by a container are kept and reported as 409.
+func (s *ClusterServer) handleVolume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	node, name, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/volumes/"), "/")
+	if !ok || node == "" || name == "" || strings.Contains(name, "/") {
+		writeJSONError(w, http.StatusBadRequest, "Expected /volumes/{node}/{name}")
+		return
+	}
+	if err := s.cluster.DeleteVolume(r.Context(), node, requestNamespace(r), name); err != nil {
+		writeJSONError(w, volumeErrorStatus(err), err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestVolumes(t *testing.T) {
+	_, srv, _ := newTestServer(t)
+
+	resp, body := do(t, srv, http.MethodPost, "/namespaces/a/volumes", map[string]any{"name": "pgdata", "node": "node1"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create: %d %s", resp.StatusCode, body)
+	}
+	var created volumeResponse
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Name != "pgdata" || created.Node != "node1" || created.Namespace != "a" {
+		t.Errorf("created %+v, want pgdata on node1 in a", created)
+	}
+	for _, tt := range []struct {
+		name string
+		req  map[string]any
+		want int
+	}{
+		{"taken name", map[string]any{"name": "pgdata", "node": "node1"}, http.StatusConflict},
+		{"unknown node", map[string]any{"name": "cache", "node": "nope"}, http.StatusNotFound},
+		{"invalid name", map[string]any{"name": "../etc", "node": "node1"}, http.StatusBadRequest},
+		{"no node", map[string]any{"name": "cache"}, http.StatusBadRequest},
+	} {
+		if resp, body := do(t, srv, http.MethodPost, "/volumes", tt.req); resp.StatusCode != tt.want {
+			t.Errorf("%s: %d %s, want %d", tt.name, resp.StatusCode, body, tt.want)
+		}
+	}
+
+	info := provision(t, srv, map[string]any{"image": "postgres", "cpu": 1, "namespace": "a",
+		"mounts": []map[string]any{{"source": "pgdata", "target": "/data"}}})
+	resp, body = do(t, srv, http.MethodGet, "/volumes?namespace=a", nil)
+	var listed []volumeResponse
+	if err := json.Unmarshal(body, &listed); err != nil {
+		t.Fatalf("list response %s: %v", body, err)
+	}
+	if len(listed) != 1 || len(listed[0].UsedBy) != 1 || listed[0].UsedBy[0] != info.ID {
+		t.Errorf("listed %s, want pgdata used by %s", body, info.ID)
+	}
+
+	if resp, body := do(t, srv, http.MethodDelete, "/namespaces/b/volumes/node1/pgdata", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("delete through another namespace: %d %s, want 404", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodDelete, "/volumes/node1/pgdata", nil); resp.StatusCode != http.StatusConflict {
+		t.Errorf("delete while mounted: %d %s, want 409", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodPost, "/terminate/"+info.ID, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("terminate: %d %s", resp.StatusCode, body)
+	}
+	if resp, body := do(t, srv, http.MethodDelete, "/namespaces/a/volumes/node1/pgdata", nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("delete: %d %s, want 204", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,136 @@
+// Package audit records who changed what through the API, for review after the fact
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is one audited API request
+type Entry struct {
+	Time       time.Time       `json:"time"`
+	Caller     string          `json:"caller"`
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Targets    []Target        `json:"targets,omitempty"`
+	Status     int             `json:"status"`
+	Error      string          `json:"error,omitempty"`
+	DurationMS int64           `json:"durationMs"`
+}
+
+// Target is a container a request acted on and the node it is on
+type Target struct {
+	ContainerID string `json:"containerId"`
+	NodeID      string `json:"nodeId,omitempty"`
+}
+
+// Filter selects entries from a Log. Zero fields match everything.
+type Filter struct {
+	Caller string
+	Path   string // prefix, e.g. "/provision"
+	Since  time.Time
+	Limit  int // most recent entries to return
+}
+
+// Matches reports whether e passes the filter, ignoring Limit
+func (f Filter) Matches(e Entry) bool {
+	switch {
+	case f.Caller != "" && e.Caller != f.Caller:
+		return false
+	case f.Path != "" && !strings.HasPrefix(e.Path, f.Path):
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	}
+	return true
+}
+
+// Log is an append-only store of audit entries
+type Log interface {
+	Append(e Entry) error
+	// Query returns the entries matching f, newest first
+	Query(f Filter) ([]Entry, error)
+}
+
+// FileLog appends entries to a file as JSON lines. Entries are never
+// rewritten or removed.
+type FileLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// OpenFileLog opens or creates the audit file at path for appending
+func OpenFileLog(path string) (*FileLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &FileLog{path: path, file: f}, nil
+}
+
+// Append writes e and syncs it to disk
+func (l *FileLog) Append(e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(data); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	return l.file.Sync()
+}
+
+// Query scans the file for entries matching f, newest first
+func (l *FileLog) Query(f Filter) ([]Entry, error) {
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer file.Close()
+
+	var out []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// A torn last line from a crash; skip it rather than failing the query
+			continue
+		}
+		if f.Matches(e) {
+			out = append(out, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	slices.Reverse(out)
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+	return out, nil
+}
+
+// Close closes the file
+func (l *FileLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := OpenFileLog(path)
+	if err != nil {
+		t.Fatalf("OpenFileLog: %v", err)
+	}
+	defer l.Close()
+
+	start := time.Now().Add(-time.Hour)
+	for i, e := range []Entry{
+		{Time: start, Caller: "alice", Method: "POST", Path: "/provision", Status: 201},
+		{Time: start.Add(time.Minute), Caller: "bob", Method: "POST", Path: "/terminate/c1", Status: 404, Error: "not found"},
+		{Time: start.Add(2 * time.Minute), Caller: "alice", Method: "POST", Path: "/provision/batch", Status: 201},
+	} {
+		if err := l.Append(e); err != nil {
+			t.Fatalf("Append %d: %v", i, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string // paths, newest first
+	}{
+		{"all", Filter{}, []string{"/provision/batch", "/terminate/c1", "/provision"}},
+		{"caller", Filter{Caller: "alice"}, []string{"/provision/batch", "/provision"}},
+		{"path prefix", Filter{Path: "/provision"}, []string{"/provision/batch", "/provision"}},
+		{"since", Filter{Since: start.Add(30 * time.Second)}, []string{"/provision/batch", "/terminate/c1"}},
+		{"limit", Filter{Limit: 1}, []string{"/provision/batch"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := l.Query(tt.filter)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Path)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("paths %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("paths %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestFileLogSkipsTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := OpenFileLog(path)
+	if err != nil {
+		t.Fatalf("OpenFileLog: %v", err)
+	}
+	defer l.Close()
+	if err := l.Append(Entry{Caller: "alice", Path: "/provision", Status: 201}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	// A crash in the middle of writing the next entry
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"caller":"bob","pa`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	entries, err := l.Query(Filter{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Caller != "alice" {
+		t.Errorf("entries %+v, want only alice's", entries)
+	}
+}
@@ -0,0 +1,51 @@
+package cluster
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// hasLabels reports whether labels include every key and value in selector
+func hasLabels(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if got, ok := labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// formatLabels renders labels as sorted k=v pairs, e.g. "app=web,tier=front"
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// antiAffinityLocked counts, per node, the running and pending containers
+// whose labels match selector. An empty selector matches nothing. Caller
+// must hold the lock.
+func (cm *ClusterManager) antiAffinityLocked(selector map[string]string) map[string]int {
+	if len(selector) == 0 {
+		return nil
+	}
+	conflicts := make(map[string]int)
+	for _, node := range cm.nodes {
+		containers, _ := node.Manager.ListActiveContainers(context.Background())
+		for _, info := range containers {
+			if hasLabels(info.Labels, selector) {
+				conflicts[node.ID]++
+			}
+		}
+	}
+	for _, p := range cm.pending {
+		if hasLabels(p.spec.Labels, selector) {
+			conflicts[p.nodeID]++
+		}
+	}
+	return conflicts
+}
@@ -0,0 +1,87 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"mini-cloud/internal/docker"
+)
+
+func TestAntiAffinity(t *testing.T) {
+	tests := []struct {
+		name    string
+		require bool
+	}{
+		{"preferred", false},
+		{"required", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node1, _ := newTestNode("node1", 4, 4096)
+			node2, _ := newTestNode("node2", 4, 4096)
+			cm := newTestCluster(node1, node2) // binpack would put both on one node
+			spec := docker.ContainerSpec{Image: "redis", CPU: 1, AntiAffinityKey: "cache", RequireAntiAffinity: tt.require}
+
+			spec.Name = "cache-0"
+			first := mustSchedule(t, cm, spec)
+			spec.Name = "cache-1"
+			second := mustSchedule(t, cm, spec)
+			if first.NodeID == second.NodeID {
+				t.Fatalf("both replicas on %s", first.NodeID)
+			}
+
+			spec.Name = "cache-2"
+			third, err := cm.Schedule(context.Background(), spec)
+			if tt.require && err == nil {
+				t.Errorf("a third replica was placed on %s despite the required constraint", third.NodeID)
+			}
+			if !tt.require && err != nil {
+				t.Errorf("preferred anti-affinity rejected a third replica: %v", err)
+			}
+		})
+	}
+}
+
+func TestAntiAffinityOtherKeys(t *testing.T) {
+	node1, _ := newTestNode("node1", 4, 4096)
+	node2, _ := newTestNode("node2", 4, 4096)
+	cm := newTestCluster(node1, node2)
+
+	a := mustSchedule(t, cm, docker.ContainerSpec{Name: "a", Image: "redis", CPU: 1, AntiAffinityKey: "a", RequireAntiAffinity: true})
+	b := mustSchedule(t, cm, docker.ContainerSpec{Name: "b", Image: "redis", CPU: 1, AntiAffinityKey: "b", RequireAntiAffinity: true})
+	if a.NodeID != b.NodeID {
+		t.Errorf("containers with different keys were spread over %s and %s, want them packed", a.NodeID, b.NodeID)
+	}
+}
+
+func TestAntiAffinityLabels(t *testing.T) {
+	node1, _ := newTestNode("node1", 4, 4096)
+	node2, _ := newTestNode("node2", 4, 4096)
+	cm := newTestCluster(node1, node2)
+	spec := docker.ContainerSpec{Image: "nginx", CPU: 1,
+		Labels:       map[string]string{"app": "web", "tier": "front"},
+		AntiAffinity: map[string]string{"app": "web"},
+	}
+
+	spec.Name = "web-0"
+	first := mustSchedule(t, cm, spec)
+	spec.Name = "web-1"
+	second := mustSchedule(t, cm, spec)
+	if first.NodeID == second.NodeID {
+		t.Fatalf("both replicas on %s", first.NodeID)
+	}
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "db", Image: "postgres", CPU: 1, AntiAffinity: map[string]string{"app": "db"}})
+
+	spec.Name = "web-2"
+	_, err := cm.Schedule(context.Background(), spec)
+	var serr *SchedulingError
+	if !errors.As(err, &serr) {
+		t.Fatalf("Schedule error %v, want a SchedulingError", err)
+	}
+	for _, r := range serr.Rejections {
+		if r.Reason != "runs a container labelled app=web" {
+			t.Errorf("%s rejected for %q, want the anti-affinity labels", r.NodeID, r.Reason)
+		}
+	}
+}
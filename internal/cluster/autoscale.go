@@ -0,0 +1,326 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/events"
+	"mini-cloud/internal/manager"
+)
+
+// statsTimeout bounds sampling the stats of a single replica
+const statsTimeout = 5 * time.Second
+
+// WorkloadLabel is set on every replica to the name of the workload it
+// belongs to. Only labelled containers in the workload's namespace count as
+// its replicas.
+const WorkloadLabel = "mini-cloud.workload"
+
+// ScalePolicy keeps the replicas of a workload near a target CPU utilization.
+// Replicas are scheduled from Template, labelled with WorkloadLabel and named
+// <workload>-<n>. A workload named after a deployment scales the deployment
+// instead.
+type ScalePolicy struct {
+	Template         docker.ContainerSpec // the deployment's template for deployments
+	MinReplicas      int
+	MaxReplicas      int
+	TargetCPUPercent float64       // average utilization of each replica's reserved CPU
+	Cooldown         time.Duration // minimum time between two scaling actions
+}
+
+// Validate checks that the policy bounds make sense
+func (p ScalePolicy) Validate() error {
+	switch {
+	case p.MinReplicas < 0:
+		return errors.New("minReplicas must not be negative")
+	case p.MaxReplicas < 1 || p.MaxReplicas < p.MinReplicas:
+		return errors.New("maxReplicas must be at least 1 and at least minReplicas")
+	case p.TargetCPUPercent <= 0:
+		return errors.New("target CPU percent must be positive")
+	case p.Template.CPU <= 0:
+		return errors.New("template must reserve CPU")
+	}
+	return nil
+}
+
+// DesiredReplicas returns how many replicas the policy wants when current
+// replicas average avgCPU percent utilization, bounded by min and max
+func (p ScalePolicy) DesiredReplicas(current int, avgCPU float64) int {
+	desired := current
+	if current > 0 {
+		desired = int(math.Ceil(float64(current) * avgCPU / p.TargetCPUPercent))
+	}
+	return max(p.MinReplicas, min(p.MaxReplicas, desired))
+}
+
+// workload is a named group of replicas managed by a ScalePolicy
+type workload struct {
+	policy    ScalePolicy
+	lastScale time.Time
+}
+
+// WorkloadStatus reports a workload's policy and running replicas
+type WorkloadStatus struct {
+	Name       string
+	Policy     ScalePolicy
+	Replicas   int
+	Deployment bool // the policy scales the deployment of the same name
+}
+
+// replica is a running container of a workload
+type replica struct {
+	index int
+	info  *manager.ContainerInfo
+	node  *Node
+}
+
+// SetScalePolicy attaches p to the workload name, replacing any previous policy.
+// Replicas are created or removed by the autoscale loop. If name is a
+// deployment, p's template is replaced by the deployment's and the loop
+// changes the deployment's replica count.
+func (cm *ClusterManager) SetScalePolicy(name string, p ScalePolicy) error {
+	if name == "" {
+		return errors.New("workload name is required")
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if d, ok := cm.deployments[name]; ok {
+		p.Template = d.Template
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if w, ok := cm.workloads[name]; ok {
+		w.policy = p
+		return nil
+	}
+	cm.workloads[name] = &workload{policy: p}
+	return nil
+}
+
+// RemoveScalePolicy stops autoscaling the workload name; its replicas keep running
+func (cm *ClusterManager) RemoveScalePolicy(name string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	delete(cm.workloads, name)
+}
+
+// Workloads returns every autoscaled workload, sorted by name
+func (cm *ClusterManager) Workloads() []WorkloadStatus {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	var out []WorkloadStatus
+	for name, w := range cm.workloads {
+		status := WorkloadStatus{Name: name, Policy: w.policy}
+		if d, ok := cm.deployments[name]; ok {
+			status.Policy.Template, status.Deployment = d.Template, true
+			status.Replicas = len(cm.deploymentReplicasLocked(d))
+		} else {
+			status.Replicas = len(cm.replicasLocked(WorkloadLabel, name, w.policy.Template.Namespace))
+		}
+		out = append(out, status)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// replicasLocked returns the containers in namespace labelled label=name,
+// ordered by index. Caller must hold the lock.
+func (cm *ClusterManager) replicasLocked(label, name, namespace string) []replica {
+	var out []replica
+	for _, node := range cm.nodes {
+		containers, _ := node.Manager.ListActiveContainers(context.Background())
+		for _, info := range containers {
+			if info.Labels[label] != name || info.Namespace != namespace {
+				continue
+			}
+			suffix, _ := strings.CutPrefix(info.Name, name+"-")
+			if i, err := strconv.Atoi(suffix); err == nil && i >= 0 {
+				out = append(out, replica{index: i, info: info, node: node})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].index < out[j].index })
+	return out
+}
+
+// Autoscale samples the CPU usage of every autoscaled workload and schedules
+// or terminates replicas to keep it near the policy target
+func (cm *ClusterManager) Autoscale(ctx context.Context) {
+	cm.mu.Lock()
+	names := make([]string, 0, len(cm.workloads))
+	for name := range cm.workloads {
+		names = append(names, name)
+	}
+	cm.mu.Unlock()
+
+	for _, name := range names {
+		if err := cm.autoscaleWorkload(ctx, name); err != nil {
+			cm.log.Warn("autoscaling failed", "workload", name, "error", err)
+		}
+	}
+}
+
+func (cm *ClusterManager) autoscaleWorkload(ctx context.Context, name string) error {
+	cm.mu.Lock()
+	w, ok := cm.workloads[name]
+	if !ok {
+		cm.mu.Unlock()
+		return nil
+	}
+	policy, lastScale := w.policy, w.lastScale
+	var replicas []replica
+	var current int
+	d, deployment := cm.deployments[name]
+	if deployment {
+		if d.Rollout.State == RolloutProgressing {
+			cm.mu.Unlock()
+			return nil // surge replicas would skew the count
+		}
+		// Failed replicas are about to be replaced and would drag the average down
+		replicas = slices.DeleteFunc(cm.deploymentReplicasLocked(d), func(r replica) bool { return failedReplica(r.info) })
+		current = d.Replicas
+	} else {
+		replicas = cm.replicasLocked(WorkloadLabel, name, policy.Template.Namespace)
+		current = len(replicas)
+	}
+	cm.mu.Unlock()
+
+	avg, err := averageCPU(ctx, replicas)
+	if err != nil {
+		return err
+	}
+
+	desired := policy.DesiredReplicas(current, avg)
+	if desired == current {
+		return nil
+	}
+	// Outside the bounds scale right away; otherwise wait out the cooldown
+	inBounds := current >= policy.MinReplicas && current <= policy.MaxReplicas
+	if inBounds && time.Since(lastScale) < policy.Cooldown {
+		return nil
+	}
+
+	cm.log.Info("autoscaling workload", "workload", name, "replicas", current, "desired", desired, "avg_cpu_percent", avg)
+	cm.mu.Lock()
+	if w, ok := cm.workloads[name]; ok {
+		w.lastScale = time.Now()
+	}
+	cm.mu.Unlock()
+	cm.events.Publish(events.Event{
+		Type:    events.Scaled,
+		Name:    name,
+		Message: fmt.Sprintf("%d -> %d replicas at %.0f%% average CPU", current, desired, avg),
+	})
+
+	if deployment {
+		return cm.ScaleDeployment(ctx, name, desired)
+	}
+	if desired > current {
+		_, err := cm.scaleUp(ctx, name, policy.Template, replicas, desired-current)
+		return err
+	}
+	return cm.scaleDown(ctx, replicas[desired:])
+}
+
+// averageCPU returns the mean utilization of the replicas' reserved CPU in percent
+func averageCPU(ctx context.Context, replicas []replica) (float64, error) {
+	if len(replicas) == 0 {
+		return 0, nil
+	}
+
+	var total float64
+	for _, r := range replicas {
+		sctx, cancel := context.WithTimeout(ctx, statsTimeout)
+		stats, err := r.node.Docker.Stats(sctx, r.info.ID)
+		cancel()
+		if err != nil {
+			return 0, fmt.Errorf("stats for %s: %w", r.info.Name, err)
+		}
+		if r.info.CPU > 0 {
+			total += stats.CPUPercent / r.info.CPU
+		}
+	}
+	return total / float64(len(replicas)), nil
+}
+
+// scaleUp schedules n more replicas of template for workload name, filling
+// the lowest free indexes, and returns those that were placed. Indexes whose
+// name is taken by a container outside the workload are skipped.
+func (cm *ClusterManager) scaleUp(ctx context.Context, name string, template docker.ContainerSpec, replicas []replica, n int) ([]*manager.ContainerInfo, error) {
+	used := make(map[int]bool, len(replicas))
+	for _, r := range replicas {
+		used[r.index] = true
+	}
+	template = withLabel(template, WorkloadLabel, name)
+
+	var started []*manager.ContainerInfo
+	var errs []error
+	for i := 0; n > 0; i++ {
+		if used[i] {
+			continue
+		}
+		spec := template
+		spec.Name = fmt.Sprintf("%s-%d", name, i)
+		if cm.nameInUse(spec.Name) {
+			continue
+		}
+		if info, err := cm.Schedule(ctx, spec); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", spec.Name, err))
+		} else {
+			started = append(started, info)
+		}
+		n--
+	}
+	return started, errors.Join(errs...)
+}
+
+// withLabel returns spec with label set to value, without modifying the
+// labels of the original
+func withLabel(spec docker.ContainerSpec, label, value string) docker.ContainerSpec {
+	spec.Labels = maps.Clone(spec.Labels)
+	if spec.Labels == nil {
+		spec.Labels = make(map[string]string, 1)
+	}
+	spec.Labels[label] = value
+	return spec
+}
+
+// scaleDown terminates the given replicas
+func (cm *ClusterManager) scaleDown(ctx context.Context, replicas []replica) error {
+	var errs []error
+	for _, r := range replicas {
+		if err := cm.TerminateContainer(ctx, r.info.ID); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.info.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// StartAutoscaleLoop periodically autoscales every workload with a ScalePolicy
+func (cm *ClusterManager) StartAutoscaleLoop(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				cm.Autoscale(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
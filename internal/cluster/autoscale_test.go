@@ -0,0 +1,182 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/events"
+)
+
+func TestScalePolicyDesiredReplicas(t *testing.T) {
+	p := ScalePolicy{MinReplicas: 1, MaxReplicas: 5, TargetCPUPercent: 50}
+	tests := []struct {
+		current int
+		avgCPU  float64
+		want    int
+	}{
+		{0, 0, 1},
+		{2, 50, 2},
+		{2, 100, 4},
+		{2, 10, 1},
+		{4, 100, 5},
+	}
+	for _, tt := range tests {
+		if got := p.DesiredReplicas(tt.current, tt.avgCPU); got != tt.want {
+			t.Errorf("DesiredReplicas(%d, %v) = %d, want %d", tt.current, tt.avgCPU, got, tt.want)
+		}
+	}
+}
+
+func TestAutoscaleCountsOnlyLabelledReplicas(t *testing.T) {
+	node, _ := newTestNode("node1", 8, 8192)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+
+	// Containers that merely look like replicas of "web"
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "web-0", Image: "nginx", CPU: 1})
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "web-1", Image: "nginx", CPU: 1, Namespace: "other",
+		Labels: map[string]string{WorkloadLabel: "web"}})
+
+	template := docker.ContainerSpec{Image: "nginx", CPU: 1}
+	if err := cm.SetScalePolicy("web", ScalePolicy{Template: template, MinReplicas: 2, MaxReplicas: 4, TargetCPUPercent: 50}); err != nil {
+		t.Fatal(err)
+	}
+	cm.Autoscale(ctx)
+
+	cm.mu.Lock()
+	replicas := cm.replicasLocked(WorkloadLabel, "web", "")
+	cm.mu.Unlock()
+	var names []string
+	for _, r := range replicas {
+		names = append(names, r.info.Name)
+	}
+	if len(names) != 2 || names[0] != "web-2" || names[1] != "web-3" {
+		t.Errorf("replicas = %v, want [web-2 web-3]", names)
+	}
+	if status := cm.Workloads(); len(status) != 1 || status[0].Replicas != 2 {
+		t.Errorf("Workloads = %+v, want 2 replicas", status)
+	}
+
+	// Scaling to the minimum must leave the foreign containers alone
+	if err := cm.SetScalePolicy("web", ScalePolicy{Template: template, MinReplicas: 0, MaxReplicas: 1, TargetCPUPercent: 50}); err != nil {
+		t.Fatal(err)
+	}
+	cm.Autoscale(ctx)
+	for _, name := range []string{"web-0", "web-1"} {
+		if _, ok := node.Manager.FindByName(name); !ok {
+			t.Errorf("%s was terminated by the autoscaler", name)
+		}
+	}
+	if _, ok := node.Manager.FindByName("web-3"); ok {
+		t.Error("web-3 survived scaling down to 1 replica")
+	}
+}
+
+func TestAutoscaleScalesOnCPU(t *testing.T) {
+	node, rt := newTestNode("node1", 8, 8192)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+
+	policy := ScalePolicy{Template: docker.ContainerSpec{Image: "nginx", CPU: 1}, MinReplicas: 1, MaxReplicas: 3, TargetCPUPercent: 50, Cooldown: time.Hour}
+	if err := cm.SetScalePolicy("api", policy); err != nil {
+		t.Fatal(err)
+	}
+	cm.Autoscale(ctx)
+	info, ok := node.Manager.FindByName("api-0")
+	if !ok {
+		t.Fatal("minimum replica api-0 was not scheduled")
+	}
+
+	// Let the next pass scale despite the cooldown
+	rt.SetStats(info.ID, docker.ContainerStats{CPUPercent: 100})
+	cm.mu.Lock()
+	cm.workloads["api"].lastScale = time.Time{}
+	cm.mu.Unlock()
+	cm.Autoscale(ctx)
+	if _, ok := node.Manager.FindByName("api-1"); !ok {
+		t.Error("api was not scaled up at twice its target CPU")
+	}
+}
+
+func TestAutoscaleDeployment(t *testing.T) {
+	node, rt := newTestNode("node1", 8, 8192)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+	sub := cm.events.Subscribe()
+	defer cm.events.Unsubscribe(sub)
+
+	if err := cm.CreateDeployment(ctx, Deployment{Name: "web", Template: docker.ContainerSpec{Image: "nginx", CPU: 1}, Replicas: 1}); err != nil {
+		t.Fatalf("CreateDeployment: %v", err)
+	}
+	if err := cm.SetScalePolicy("web", ScalePolicy{MinReplicas: 1, MaxReplicas: 4, TargetCPUPercent: 50}); err != nil {
+		t.Fatalf("SetScalePolicy without a template for a deployment: %v", err)
+	}
+	status, _ := cm.Deployment("web")
+	rt.SetStats(status.Containers[0].ID, docker.ContainerStats{CPUPercent: 100})
+
+	cm.Autoscale(ctx)
+	if status, _ := cm.Deployment("web"); status.Replicas != 2 || len(status.Containers) != 2 {
+		t.Errorf("deployment at %d replicas with %d running, want 2", status.Replicas, len(status.Containers))
+	}
+	if w := cm.Workloads(); len(w) != 1 || !w[0].Deployment || w[0].Policy.Template.Image != "nginx" {
+		t.Errorf("Workloads = %+v, want web scaling its deployment", w)
+	}
+	for scaled := false; !scaled; {
+		select {
+		case e := <-sub:
+			if scaled = e.Type == events.Scaled; scaled && (e.Name != "web" || e.Message != "1 -> 2 replicas at 100% average CPU") {
+				t.Errorf("scaled event %+v", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no scaled event")
+		}
+	}
+
+	if err := cm.DeleteDeployment(ctx, "web"); err != nil {
+		t.Fatal(err)
+	}
+	if w := cm.Workloads(); len(w) != 0 {
+		t.Errorf("Workloads = %+v after the deployment was deleted, want none", w)
+	}
+}
+
+func TestAutoscaleDeploymentAveragesItsReplicas(t *testing.T) {
+	node, rt := newTestNode("node1", 8, 8192)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+
+	d := Deployment{Name: "web", Template: docker.ContainerSpec{Image: "nginx", CPU: 1}, Replicas: 2}
+	if err := cm.CreateDeployment(ctx, d); err != nil {
+		t.Fatalf("CreateDeployment: %v", err)
+	}
+	// Busy, but not one of the deployment's replicas
+	hot := mustSchedule(t, cm, docker.ContainerSpec{Name: "web-7", Image: "nginx", CPU: 1,
+		Labels: map[string]string{WorkloadLabel: "web"}})
+	rt.SetStats(hot.ID, docker.ContainerStats{CPUPercent: 400})
+	if err := cm.SetScalePolicy("web", ScalePolicy{MinReplicas: 2, MaxReplicas: 5, TargetCPUPercent: 50}); err != nil {
+		t.Fatal(err)
+	}
+	setCPU := func(percent float64) {
+		status, _ := cm.Deployment("web")
+		for _, info := range status.Containers {
+			rt.SetStats(info.ID, docker.ContainerStats{CPUPercent: percent})
+		}
+	}
+
+	setCPU(20)
+	cm.Autoscale(ctx)
+	if status, _ := cm.Deployment("web"); status.Replicas != 2 {
+		t.Errorf("replicas = %d at 20%% CPU, want 2", status.Replicas)
+	}
+
+	setCPU(80)
+	cm.Autoscale(ctx)
+	if status, _ := cm.Deployment("web"); status.Replicas != 4 || len(status.Containers) != 4 {
+		t.Errorf("replicas = %d (%d running) at 80%% CPU, want 4", status.Replicas, len(status.Containers))
+	}
+	if w := cm.Workloads(); len(w) != 1 || !w[0].Deployment || w[0].Replicas != 4 {
+		t.Errorf("Workloads = %+v, want the deployment with 4 replicas", w)
+	}
+}
@@ -0,0 +1,186 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/manager"
+)
+
+// ErrRolledBack marks a batch item that was created but terminated again
+// because a later item in an atomic batch failed
+var ErrRolledBack = errors.New("rolled back after batch failure")
+
+// ErrSkipped marks a batch item that was not attempted because an earlier
+// item in an atomic batch failed
+var ErrSkipped = errors.New("skipped after batch failure")
+
+// BatchResult is the outcome of scheduling one spec of a batch
+type BatchResult struct {
+	Container *manager.ContainerInfo
+	Err       error
+}
+
+// ScheduleBatch schedules specs and returns one result per spec, in the order
+// of specs.
+//
+// Specs are scheduled in dependency order: a spec naming others in DependsOn
+// is only scheduled once they are running. If a spec that others depend on
+// fails, the batch stops and every container already created in it is
+// terminated. Otherwise every spec is attempted and containers that were
+// created stay running even if later specs fail, unless atomic is set, in
+// which case the first failure stops the batch the same way.
+//
+// An error is returned without scheduling anything if the dependencies name
+// unknown containers or contain a cycle.
+func (cm *ClusterManager) ScheduleBatch(ctx context.Context, specs []docker.ContainerSpec, atomic bool) ([]BatchResult, error) {
+	order, err := cm.batchOrder(specs)
+	if err != nil {
+		return nil, err
+	}
+
+	needed := make(map[string]bool)
+	for _, spec := range specs {
+		for _, dep := range spec.DependsOn {
+			needed[dep] = true
+		}
+	}
+
+	results := make([]BatchResult, len(specs))
+	for n, i := range order {
+		info, err := cm.Schedule(ctx, specs[i])
+		results[i] = BatchResult{Container: info, Err: err}
+		if err == nil || !(atomic || needed[specs[i].Name]) {
+			continue
+		}
+
+		cm.rollback(ctx, results)
+		for _, j := range order[n+1:] {
+			results[j].Err = ErrSkipped
+		}
+		break
+	}
+	return results, nil
+}
+
+// batchOrder returns the indexes of specs in an order where every spec comes
+// after the batch items it depends on. Specs without dependencies keep their
+// relative order. Dependencies outside the batch must already be running.
+func (cm *ClusterManager) batchOrder(specs []docker.ContainerSpec) ([]int, error) {
+	index := make(map[string]int)
+	for i, spec := range specs {
+		if spec.Name == "" {
+			continue
+		}
+		if _, dup := index[spec.Name]; dup {
+			return nil, fmt.Errorf("duplicate name %q in batch", spec.Name)
+		}
+		index[spec.Name] = i
+	}
+
+	// Kahn's algorithm over the dependencies inside the batch
+	pending := make([]int, len(specs))
+	dependents := make([][]int, len(specs))
+	for i, spec := range specs {
+		for _, dep := range spec.DependsOn {
+			j, ok := index[dep]
+			if !ok {
+				if !cm.nameInUse(dep) {
+					return nil, fmt.Errorf("item %d depends on unknown container %q", i, dep)
+				}
+				continue
+			}
+			if j == i {
+				return nil, fmt.Errorf("dependency cycle: %q depends on itself", dep)
+			}
+			pending[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	var order, ready []int
+	for i := range specs {
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	for len(ready) > 0 {
+		i := ready[0]
+		ready = ready[1:]
+		order = append(order, i)
+		for _, j := range dependents[i] {
+			if pending[j]--; pending[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+
+	if len(order) < len(specs) {
+		var cycle []string
+		for i, n := range pending {
+			if n > 0 {
+				cycle = append(cycle, strconv.Quote(specs[i].Name))
+			}
+		}
+		return nil, fmt.Errorf("dependency cycle between %s", strings.Join(cycle, ", "))
+	}
+	return order, nil
+}
+
+// nameInUse reports whether a container named name runs, or is being placed, on any node
+func (cm *ClusterManager) nameInUse(name string) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.nameTakenLocked(name)
+}
+
+// rollback terminates the containers created for results and marks them
+// rolled back. It runs to completion even if ctx is cancelled.
+func (cm *ClusterManager) rollback(ctx context.Context, results []BatchResult) {
+	ctx = context.WithoutCancel(ctx)
+	for i := range results {
+		if results[i].Container == nil {
+			continue
+		}
+		if err := cm.TerminateContainer(ctx, results[i].Container.ID); err != nil {
+			results[i].Err = errors.Join(ErrRolledBack, err)
+		} else {
+			results[i].Err = ErrRolledBack
+		}
+	}
+}
+
+// ScheduleReplicas schedules n copies of spec, naming them <name>-0 ... <name>-(n-1).
+// If only some replicas can be placed, the ones that succeeded are returned
+// together with an error describing how many could not be placed.
+func (cm *ClusterManager) ScheduleReplicas(ctx context.Context, spec docker.ContainerSpec, n int) ([]*manager.ContainerInfo, error) {
+	base := spec.Name
+	if base == "" {
+		base = uuid.New().String()[:8]
+	}
+
+	var placed []*manager.ContainerInfo
+	var errs []error
+	for i := 0; i < n; i++ {
+		replica := spec
+		replica.Name = fmt.Sprintf("%s-%d", base, i)
+
+		info, err := cm.Schedule(ctx, replica)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", replica.Name, err))
+			continue
+		}
+		placed = append(placed, info)
+	}
+
+	if len(errs) > 0 {
+		return placed, fmt.Errorf("%d of %d replicas could not be placed: %w", len(errs), n, errors.Join(errs...))
+	}
+	return placed, nil
+}
@@ -0,0 +1,187 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"mini-cloud/internal/docker"
+)
+
+// batchSpecs fit a 2-core node except for the middle one
+var batchSpecs = []docker.ContainerSpec{
+	{Name: "a", Image: "nginx", CPU: 1},
+	{Name: "b", Image: "nginx", CPU: 4},
+	{Name: "c", Image: "nginx", CPU: 1},
+}
+
+func TestScheduleBatchKeepsPartialResults(t *testing.T) {
+	node, rt := newTestNode("node1", 2, 4096)
+	cm := newTestCluster(node)
+
+	results, err := cm.ScheduleBatch(context.Background(), batchSpecs, false)
+	if err != nil {
+		t.Fatalf("ScheduleBatch: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("%d results, want 3", len(results))
+	}
+	for i, wantErr := range []bool{false, true, false} {
+		if gotErr := results[i].Err != nil; gotErr != wantErr {
+			t.Errorf("item %d: err = %v, want error %v", i, results[i].Err, wantErr)
+		}
+	}
+	if results[0].Container == nil || results[0].Container.Name != "a" {
+		t.Errorf("item 0 container = %+v, want a", results[0].Container)
+	}
+	if n := rt.Running(); n != 2 {
+		t.Errorf("%d containers running, want a and c", n)
+	}
+}
+
+func TestScheduleBatchAtomicRollsBack(t *testing.T) {
+	node, rt := newTestNode("node1", 2, 4096)
+	cm := newTestCluster(node)
+
+	results, err := cm.ScheduleBatch(context.Background(), batchSpecs, true)
+	if err != nil {
+		t.Fatalf("ScheduleBatch: %v", err)
+	}
+	if !errors.Is(results[0].Err, ErrRolledBack) {
+		t.Errorf("item 0: err = %v, want ErrRolledBack", results[0].Err)
+	}
+	if results[1].Err == nil || errors.Is(results[1].Err, ErrRolledBack) {
+		t.Errorf("item 1: err = %v, want its scheduling error", results[1].Err)
+	}
+	if !errors.Is(results[2].Err, ErrSkipped) {
+		t.Errorf("item 2: err = %v, want ErrSkipped", results[2].Err)
+	}
+	if n := len(rt.Containers()); n != 0 {
+		t.Errorf("%d containers left, want none", n)
+	}
+	if got := node.Resources.AllocatedCPUSum(); got != 0 {
+		t.Errorf("allocated CPU = %v, want 0", got)
+	}
+}
+
+func TestScheduleBatchDependencyOrder(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	var created []string
+	rt.SetHook(func(_ context.Context, op, arg string) error {
+		if op == "CreateContainer" {
+			created = append(created, arg)
+		}
+		return nil
+	})
+
+	results, err := cm.ScheduleBatch(context.Background(), []docker.ContainerSpec{
+		{Name: "app", Image: "app", CPU: 1, DependsOn: []string{"db", "cache"}},
+		{Name: "cache", Image: "redis", CPU: 1, DependsOn: []string{"db"}},
+		{Name: "db", Image: "postgres", CPU: 1},
+	}, false)
+	if err != nil {
+		t.Fatalf("ScheduleBatch: %v", err)
+	}
+	for i, r := range results {
+		if r.Err != nil {
+			t.Errorf("item %d: %v", i, r.Err)
+		}
+	}
+	if got := strings.Join(created, ","); got != "db,cache,app" {
+		t.Errorf("created %s, want db,cache,app", got)
+	}
+	if results[0].Container == nil || results[0].Container.Name != "app" {
+		t.Errorf("item 0 container = %+v, want results in request order", results[0].Container)
+	}
+}
+
+func TestScheduleBatchFailedDependency(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+
+	results, err := cm.ScheduleBatch(context.Background(), []docker.ContainerSpec{
+		{Name: "cache", Image: "redis", CPU: 1},
+		{Name: "db", Image: "postgres", CPU: 8},
+		{Name: "app", Image: "app", CPU: 1, DependsOn: []string{"db", "cache"}},
+	}, false)
+	if err != nil {
+		t.Fatalf("ScheduleBatch: %v", err)
+	}
+	if !errors.Is(results[0].Err, ErrRolledBack) || results[1].Err == nil || !errors.Is(results[2].Err, ErrSkipped) {
+		t.Errorf("errors %v, %v, %v; want rolled back, the scheduling error and skipped",
+			results[0].Err, results[1].Err, results[2].Err)
+	}
+	if n := len(rt.Containers()); n != 0 {
+		t.Errorf("%d containers left, want none", n)
+	}
+}
+
+func TestScheduleBatchRejectsBadDependencies(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []docker.ContainerSpec
+		wantErr string
+	}{
+		{"cycle", []docker.ContainerSpec{
+			{Name: "a", Image: "nginx", DependsOn: []string{"c"}},
+			{Name: "b", Image: "nginx", DependsOn: []string{"a"}},
+			{Name: "c", Image: "nginx", DependsOn: []string{"b"}},
+			{Name: "d", Image: "nginx"},
+		}, `dependency cycle between "a", "b", "c"`},
+		{"self", []docker.ContainerSpec{
+			{Name: "a", Image: "nginx", DependsOn: []string{"a"}},
+		}, `"a" depends on itself`},
+		{"unknown", []docker.ContainerSpec{
+			{Name: "a", Image: "nginx", DependsOn: []string{"db"}},
+		}, `unknown container "db"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, rt := newTestNode("node1", 4, 4096)
+			cm := newTestCluster(node)
+			_, err := cm.ScheduleBatch(context.Background(), tt.specs, false)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %s", err, tt.wantErr)
+			}
+			if rt.Calls("CreateContainer") != 0 {
+				t.Error("containers were created for a rejected batch")
+			}
+		})
+	}
+}
+
+func TestScheduleReplicas(t *testing.T) {
+	node1, _ := newTestNode("node1", 2, 4096)
+	node2, _ := newTestNode("node2", 2, 4096)
+	cm := newTestCluster(node1, node2)
+	cm.SetStrategy(StrategySpread)
+
+	placed, err := cm.ScheduleReplicas(context.Background(), docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1}, 2)
+	if err != nil {
+		t.Fatalf("ScheduleReplicas: %v", err)
+	}
+	if len(placed) != 2 || placed[0].Name != "web-0" || placed[1].Name != "web-1" {
+		t.Fatalf("placed %v, want web-0 and web-1", placed)
+	}
+	if placed[0].NodeID == placed[1].NodeID {
+		t.Errorf("both replicas on %s, want them spread", placed[0].NodeID)
+	}
+}
+
+func TestScheduleReplicasPartial(t *testing.T) {
+	node, rt := newTestNode("node1", 2, 4096)
+	cm := newTestCluster(node)
+
+	placed, err := cm.ScheduleReplicas(context.Background(), docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1}, 3)
+	if err == nil {
+		t.Fatal("no error with a replica that does not fit")
+	}
+	if len(placed) != 2 {
+		t.Errorf("placed %d replicas, want the 2 that fit", len(placed))
+	}
+	if n := rt.Running(); n != 2 {
+		t.Errorf("%d containers running, want 2", n)
+	}
+}
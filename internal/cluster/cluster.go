@@ -1,157 +1,974 @@
 package cluster
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"math"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"mini-cloud/internal/docker"
+	"mini-cloud/internal/events"
 	"mini-cloud/internal/manager"
+	"mini-cloud/internal/metrics"
 	"mini-cloud/internal/resourcemanager"
+	"mini-cloud/internal/retry"
+	"mini-cloud/internal/tracing"
 )
 
+// tracer traces the provisioning pipeline from scheduling to container start
+var tracer = tracing.Tracer("cluster")
+
 // Node represents a physical/virtual host running containers
 type Node struct {
 	ID        string
-	Docker    *docker.DockerClient
+	Docker    docker.ContainerRuntime
 	Resources *resourcemanager.ResourceManager
-	Manager   *manager.Manager // per-node manager to track TTL etc.
+	Manager   *manager.Manager  // per-node manager to track TTL etc.
+	Labels    map[string]string // e.g. "disk": "ssd", matched against node selectors
+
+	// MaxConcurrentCreates bounds container creates and starts running at
+	// once against the node's daemon; 0 means DefaultMaxConcurrentCreates
+	MaxConcurrentCreates int
+	creates              chan struct{} // semaphore of MaxConcurrentCreates slots
+
+	// Healthy is false once the node's Docker daemon or agent has missed too
+	// many heartbeats; unhealthy nodes are skipped by the scheduler. Guarded by
+	// the ClusterManager's lock, like the heartbeat fields below.
+	Healthy          bool
+	LastHeartbeat    time.Time // last successful ping
+	MissedHeartbeats int       // failed pings since then
+	// Draining is set while the node is being removed; draining nodes take no
+	// new containers. Guarded by the ClusterManager's lock.
+	Draining bool
+
+	// Stop, if set, is called once the node has been removed from the cluster,
+	// e.g. to end its background loops
+	Stop func()
+}
+
+// schedulable reports whether the node may take new containers. Caller must
+// hold the ClusterManager's lock.
+func (n *Node) schedulable() bool {
+	return n.Healthy && !n.Draining
+}
+
+// DefaultMaxConcurrentCreates is the per-node create limit unless a node sets its own
+const DefaultMaxConcurrentCreates = 4
+
+// acquireCreate waits for a free create slot on the node or until ctx ends
+func (n *Node) acquireCreate(ctx context.Context) error {
+	select {
+	case n.creates <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseCreate frees a slot taken by acquireCreate
+func (n *Node) releaseCreate() {
+	<-n.creates
+}
+
+// MatchesSelector reports whether the node has every label in selector
+func (n *Node) MatchesSelector(selector map[string]string) bool {
+	return hasLabels(n.Labels, selector)
 }
 
 // ClusterManager handles multi-node container scheduling
 type ClusterManager struct {
-	mu          sync.Mutex
-	nodes       map[string]*Node
-	assignments map[string]string // containerID -> nodeName
+	mu              sync.Mutex
+	deploying       sync.Mutex // serializes reconciling deployments, held without mu
+	nodes           map[string]*Node
+	assignments     map[string]string               // containerID -> nodeName
+	specs           map[string]docker.ContainerSpec // containerID -> spec it was scheduled with
+	affinity        map[string]map[string]int       // anti-affinity key -> nodeID -> containers
+	pending         map[string]pendingPlacement     // name -> container being placed
+	resizes         map[string]pendingResize        // containerID -> limits being updated
+	quotas          map[string]Quota                // namespace -> quota
+	workloads       map[string]*workload            // autoscaled workload name -> policy
+	deployments     map[string]*Deployment          // deployment name -> desired state
+	deploymentStore DeploymentStore                 // see SetDeploymentStore
+	volumes         map[volumeKey]*Volume           // named volumes on each node
+	usage           map[string]NodeUsage            // nodeID -> latest measured usage
+	registries      map[string]docker.RegistryAuth  // registry host -> credentials
+	images          map[imageKey]*CachedImage       // images cached on each node
+	imageGC         ImageGCPolicy                   // see SetImageGCPolicy
+	digests         map[string]bool                 // allowed image digests, nil allows all
+	usageMaxAge     time.Duration                   // see StartUsageLoop
+	overcommit      OvercommitPolicy                // see SetOvercommitPolicy
+	weights         ScoreWeights                    // best-fit scoring
+	strategy        Strategy                        // see SetStrategy
+
+	pullBeforeReserve   bool        // see SetPullBeforeReserve
+	networkIsolation    bool        // see SetNetworkIsolation
+	maxMissedHeartbeats int         // see SetMaxMissedHeartbeats
+	events              *events.Bus // shared by all node managers
+	log                 *slog.Logger
+
+	// Background work such as rollouts runs under ctx, which Shutdown cancels
+	ctx      context.Context
+	cancel   context.CancelFunc
+	rollouts sync.WaitGroup
 }
 
 // NewClusterManager creates a new cluster from a slice of nodes
 func NewClusterManager(nodes map[string]*Node) *ClusterManager {
-	return &ClusterManager{
+	cm := &ClusterManager{
 		nodes:       nodes,
 		assignments: make(map[string]string),
+		specs:       make(map[string]docker.ContainerSpec),
+		affinity:    make(map[string]map[string]int),
+		pending:     make(map[string]pendingPlacement),
+		resizes:     make(map[string]pendingResize),
+		quotas:      make(map[string]Quota),
+		workloads:   make(map[string]*workload),
+		deployments: make(map[string]*Deployment),
+		volumes:     make(map[volumeKey]*Volume),
+		usage:       make(map[string]NodeUsage),
+		images:      make(map[imageKey]*CachedImage),
+		usageMaxAge: DefaultUsageMaxAge,
+		weights:     DefaultScoreWeights,
+		strategy:    StrategyBinPack,
+		events:      events.NewBus(),
+		log:         slog.Default(),
+
+		maxMissedHeartbeats: DefaultMaxMissedHeartbeats,
+	}
+	cm.ctx, cm.cancel = context.WithCancel(context.Background())
+
+	for _, node := range nodes {
+		cm.initNodeLocked(node)
+	}
+	return cm
+}
+
+// ErrShuttingDown is returned when starting background work after Shutdown
+var ErrShuttingDown = errors.New("cluster is shutting down")
+
+// Shutdown cancels the cluster's background work, such as rollouts, and
+// waits for it to stop or for ctx to be done
+func (cm *ClusterManager) Shutdown(ctx context.Context) error {
+	cm.mu.Lock()
+	cm.cancel()
+	cm.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		cm.rollouts.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// initNodeLocked prepares node for scheduling and picks up the containers
+// restored from its persisted state. Caller must hold the lock.
+func (cm *ClusterManager) initNodeLocked(node *Node) {
+	node.Healthy = true
+	node.creates = make(chan struct{}, cmp.Or(max(node.MaxConcurrentCreates, 0), DefaultMaxConcurrentCreates))
+	node.Manager.SetNodeID(node.ID)
+	node.Manager.SetEventBus(cm.events)
+	node.Manager.SetExpireHook(cm.forget)
+	containers, _ := node.Manager.ListActiveContainers(context.Background())
+	for _, info := range containers {
+		cm.trackLocked(info.ID, node.ID, info.Spec())
+	}
+}
+
+// forget untracks a container that its node removed on its own, e.g.
+// because its TTL expired
+func (cm *ClusterManager) forget(id string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.untrackLocked(id)
+}
+
+// Nodes returns all nodes sorted by ID
+func (cm *ClusterManager) Nodes() []*Node {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	nodes := make([]*Node, 0, len(cm.nodes))
+	for _, node := range cm.nodes {
+		nodes = append(nodes, node)
 	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
 }
 
 // Schedule schedules a container on a node with enough resources
 func (cm *ClusterManager) Schedule(ctx context.Context, spec docker.ContainerSpec) (*manager.ContainerInfo, error) {
+	info, _, err := cm.ScheduleWithEvictions(ctx, spec)
+	return info, err
+}
+
+// ScheduleWithEvictions schedules a container like Schedule and also returns
+// the lower-priority containers that were preempted to make room for it
+func (cm *ClusterManager) ScheduleWithEvictions(ctx context.Context, spec docker.ContainerSpec) (_ *manager.ContainerInfo, _ []*manager.ContainerInfo, err error) {
+	ctx, span := tracer.Start(ctx, "Schedule", trace.WithAttributes(
+		attribute.String("container.name", spec.Name),
+		attribute.String("container.image", spec.Image),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	start := time.Now()
+	info, evicted, err := cm.schedule(ctx, spec)
+	if err != nil {
+		metrics.SchedulingFailures.Inc()
+		cm.log.Warn("scheduling failed", "name", spec.Name, "image", spec.Image, "duration", time.Since(start), "error", err)
+		cm.events.Publish(events.Event{Type: events.ScheduleFailed, Name: spec.Name, Message: err.Error()})
+		return nil, evicted, err
+	}
+	nodeID := cm.assignmentOf(info.ID)
+	span.SetAttributes(attribute.String("node.id", nodeID), attribute.String("container.id", info.ID))
+	metrics.ContainersScheduled.Inc()
+	cm.log.Info("container scheduled", "container_id", info.ID, "name", info.Name, "image", info.Image,
+		"node_id", nodeID, "duration", time.Since(start))
+	cm.events.Publish(events.Event{Type: events.Provisioned, ContainerID: info.ID, Name: info.Name, NodeID: nodeID})
+	return info, evicted, nil
+}
+
+// Subscribe returns a channel receiving lifecycle events from every node.
+// Events are dropped for subscribers that fall behind; call Unsubscribe when done.
+func (cm *ClusterManager) Subscribe() <-chan events.Event {
+	return cm.events.Subscribe()
+}
+
+// History returns the lifecycle events of container id, oldest first. It is
+// kept after the container is gone.
+func (cm *ClusterManager) History(id string) ([]events.Event, bool) {
+	return cm.events.History(id)
+}
+
+// Unsubscribe stops delivery to a channel returned by Subscribe and closes it
+func (cm *ClusterManager) Unsubscribe(ch <-chan events.Event) {
+	cm.events.Unsubscribe(ch)
+}
+
+// assignmentOf returns the node a container is assigned to, or "" if unknown
+func (cm *ClusterManager) assignmentOf(id string) string {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
+	return cm.assignments[id]
+}
 
-	var selectedNode *Node
-	var minLeftover float64 = math.MaxFloat64
+// schedule places spec on a node in three steps: reserve (under the lock),
+// place (Docker calls, without the lock) and commit (under the lock), so slow
+// pulls and creates on one node don't hold up scheduling elsewhere
+func (cm *ClusterManager) schedule(ctx context.Context, spec docker.ContainerSpec) (*manager.ContainerInfo, []*manager.ContainerInfo, error) {
+	cm.mu.Lock()
+	pullFirst := cm.pullBeforeReserve
+	cm.mu.Unlock()
 
-	for _, node := range cm.nodes {
-		if node.Resources.CanAllocate(resourcemanager.ResourceSpec{
-			CPU:    spec.CPU,
-			Memory: int(spec.Memory),
-		}) {
-			// Calculate leftover resources after allocation
-			leftoverCPU := node.Resources.TotalCPU - (node.Resources.AllocatedCPUSum() + spec.CPU)
-			leftoverMem := float64(node.Resources.TotalMemory - (node.Resources.AllocatedMemorySum() + int(spec.Memory)))
-
-			// Combine leftover CPU and Memory into a single metric (weighted sum)
-			leftover := leftoverCPU + leftoverMem/1024.0 // normalize memory to cores roughly
-
-			if leftover < minLeftover {
-				minLeftover = leftover
-				selectedNode = node
+	// In pull-before-reserve mode the image is pulled on the likely node
+	// before any capacity is reserved for it
+	pulledOn := ""
+	if pullFirst {
+		nodeID, err := cm.DryRunSchedule(spec)
+		if errors.Is(err, ErrInsufficientCapacity) {
+			nodeID = "" // reserveLocked may still make room by preempting
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if node := cm.node(nodeID); node != nil {
+			if err := cm.pullImage(ctx, node, spec); err != nil {
+				return nil, nil, err
 			}
+			pulledOn = nodeID
 		}
 	}
 
-	if selectedNode == nil {
-		return nil, errors.New("no node has enough resources")
+	_, span := tracer.Start(ctx, "Reserve")
+	cm.mu.Lock()
+	node, spec, evicted, err := cm.reserveLocked(ctx, spec)
+	cm.mu.Unlock()
+	tracing.End(span, err)
+	if err != nil {
+		return nil, evicted, err
 	}
 
-	containerID := uuid.New().String()
-	ok := selectedNode.Resources.Allocate(containerID, resourcemanager.ResourceSpec{
-		CPU:    spec.CPU,
-		Memory: int(spec.Memory),
-	})
-	if !ok {
-		return nil, errors.New("failed to allocate resources")
+	info, err := cm.place(ctx, node, spec, pulledOn == node.ID)
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	delete(cm.pending, spec.Name)
+	if err != nil {
+		node.Resources.Release(spec.Name)
+		return nil, evicted, err
 	}
+	node.Manager.AddContainer(info.ID, info)
+	spec.ImageDigest = info.ImageDigest
+	cm.trackLocked(info.ID, node.ID, spec)
+	return info, evicted, nil
+}
+
+// SetPullBeforeReserve selects whether images are pulled before resources
+// are reserved. By default resources are reserved first, so a slow pull holds
+// capacity; pulling first keeps that capacity free for other containers but
+// the chosen node may fill up during the pull, in which case the container
+// goes to another node and its image is pulled there.
+func (cm *ClusterManager) SetPullBeforeReserve(enabled bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.pullBeforeReserve = enabled
+}
+
+// node returns the node with the given ID, or nil
+func (cm *ClusterManager) node(id string) *Node {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.nodes[id]
+}
+
+// pendingPlacement is a container that has resources reserved on a node but
+// is still being pulled, created or started
+type pendingPlacement struct {
+	nodeID string
+	spec   docker.ContainerSpec
+}
+
+// pendingResize is the change in a container's limits counted against its
+// namespace's quota while the node applies it
+type pendingResize struct {
+	namespace string
+	cpu       float64
+	memoryMB  int64
+}
 
-	spec.Name = containerID
+// reserveLocked picks a node for spec, preempting lower-priority containers
+// if needed, and reserves resources there. It returns spec with its name
+// and, under network isolation, its network filled in. Caller must hold the lock.
+func (cm *ClusterManager) reserveLocked(ctx context.Context, spec docker.ContainerSpec) (*Node, docker.ContainerSpec, []*manager.ContainerInfo, error) {
+	// The name doubles as the resource reservation key, so it must be unique
+	if spec.Name == "" {
+		spec.Name = uuid.New().String()
+	}
+	if cm.nameTakenLocked(spec.Name) {
+		return nil, spec, nil, fmt.Errorf("%w: %q", manager.ErrNameConflict, spec.Name)
+	}
 
-	id, err := selectedNode.Docker.CreateContainer(ctx, spec)
+	if err := cm.checkQuotaLocked(spec.Namespace, spec.CPU, spec.Memory, 1); err != nil {
+		return nil, spec, nil, err
+	}
+	spec, err := cm.isolateLocked(spec)
 	if err != nil {
-		selectedNode.Resources.Release(containerID)
-		return nil, err
+		return nil, spec, nil, err
+	}
+	if err := cm.checkDigestLocked(spec); err != nil {
+		return nil, spec, nil, err
 	}
 
-	err = selectedNode.Docker.StartContainer(ctx, id)
+	var evicted []*manager.ContainerInfo
+	node, err := cm.selectNodeLocked(spec)
+	if errors.Is(err, ErrInsufficientCapacity) {
+		var perr error
+		if evicted, perr = cm.preemptLocked(ctx, spec); perr == nil {
+			node, err = cm.selectNodeLocked(spec)
+		} else if !errors.Is(perr, ErrInsufficientCapacity) {
+			// Keep the per-node reasons unless preemption itself went wrong
+			err = perr
+		}
+	}
 	if err != nil {
-		err := selectedNode.Docker.RemoveContainer(ctx, id)
-		if err != nil {
+		return nil, spec, evicted, err
+	}
+
+	if !cm.allocateLocked(node, spec) {
+		return nil, spec, evicted, fmt.Errorf("%w: failed to allocate resources on %s", ErrInsufficientCapacity, node.ID)
+	}
+	cm.pending[spec.Name] = pendingPlacement{nodeID: node.ID, spec: spec}
+	return node, spec, evicted, nil
+}
+
+// nameTakenLocked reports whether a tracked or pending container is called
+// name. Caller must hold the lock.
+func (cm *ClusterManager) nameTakenLocked(name string) bool {
+	if _, ok := cm.pending[name]; ok {
+		return true
+	}
+	for _, node := range cm.nodes {
+		if _, taken := node.Manager.FindByName(name); taken {
+			return true
+		}
+	}
+	return false
+}
+
+// place pulls (unless pulled is set), creates and starts spec on node, whose
+// resources are already reserved. Creates and starts are limited per node by
+// MaxConcurrentCreates.
+func (cm *ClusterManager) place(ctx context.Context, node *Node, spec docker.ContainerSpec, pulled bool) (*manager.ContainerInfo, error) {
+	policy := node.Manager.RetryPolicy()
+	if !pulled {
+		if err := cm.pullImage(ctx, node, spec); err != nil {
 			return nil, err
 		}
-		selectedNode.Resources.Release(containerID)
+	}
+
+	spec, err := cm.pinImage(ctx, node, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cm.ensureVolumes(ctx, node, spec); err != nil {
+		return nil, err
+	}
+
+	_, span := tracer.Start(ctx, "WaitCreateSlot")
+	err = node.acquireCreate(ctx)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+	defer node.releaseCreate()
+
+	var id string
+	spanCtx, span := tracer.Start(ctx, "CreateContainer")
+	err = retry.Do(spanCtx, policy, func() error {
+		var err error
+		id, err = node.Docker.CreateContainer(spanCtx, manager.LabelSpec(spec, node.ID))
+		return err
+	})
+	tracing.End(span, err)
+	if err != nil {
 		return nil, err
 	}
 
-	info := &manager.ContainerInfo{
-		ID:        id,
-		Name:      spec.Name,
-		Image:     spec.Image,
-		CPU:       spec.CPU,
-		MemoryMB:  spec.Memory,
-		CreatedAt: time.Now(),
-		Status:    "Running",
-		TTL:       spec.TTL,
+	spanCtx, span = tracer.Start(ctx, "StartContainer", trace.WithAttributes(attribute.String("container.id", id)))
+	err = retry.Do(spanCtx, policy, func() error {
+		return node.Docker.StartContainer(spanCtx, id)
+	})
+	tracing.End(span, err)
+	if err != nil {
+		// Clean up the created container even if ctx was cancelled; the start
+		// error is what the caller needs
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+		defer cancel()
+		if rmErr := node.Docker.RemoveContainer(cleanupCtx, id); rmErr != nil {
+			cm.log.Warn("failed to remove container after start failure", "container_id", id, "node_id", node.ID, "error", rmErr)
+		}
+		return nil, fmt.Errorf("failed to start container: %w", err)
 	}
 
-	selectedNode.Manager.AddContainer(id, info)
+	info := manager.NewContainerInfo(id, node.ID, spec)
+	if len(spec.Ports) > 0 {
+		if info.HostPorts, err = docker.HostPorts(ctx, node.Docker, id); err != nil {
+			cm.log.Warn("failed to read published ports", "container_id", id, "node_id", node.ID, "error", err)
+		}
+	}
 	return info, nil
 }
 
-// ListAllContainers lists all containers across all nodes
-func (cm *ClusterManager) ListAllContainers(ctx context.Context) []*manager.ContainerInfo {
+// DryRunSchedule returns the node Schedule would place spec on, running the
+// same name, quota and node selection checks without reserving resources or
+// creating a container. Preemption is not simulated.
+func (cm *ClusterManager) DryRunSchedule(spec docker.ContainerSpec) (string, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if spec.Name != "" && cm.nameTakenLocked(spec.Name) {
+		return "", fmt.Errorf("%w: %q", manager.ErrNameConflict, spec.Name)
+	}
+	if err := cm.checkQuotaLocked(spec.Namespace, spec.CPU, spec.Memory, 1); err != nil {
+		return "", err
+	}
+	if _, err := cm.isolateLocked(spec); err != nil {
+		return "", err
+	}
+	if err := cm.checkDigestLocked(spec); err != nil {
+		return "", err
+	}
+
+	node, err := cm.selectNodeLocked(spec)
+	if err != nil {
+		return "", err
+	}
+	return node.ID, nil
+}
+
+// cleanupTimeout bounds removing a container that failed to start
+const cleanupTimeout = 10 * time.Second
+
+// pullImage pulls spec's image on node, retrying transient errors
+func (cm *ClusterManager) pullImage(ctx context.Context, node *Node, spec docker.ContainerSpec) (err error) {
+	ctx, span := tracer.Start(ctx, "PullImage", trace.WithAttributes(
+		attribute.String("container.image", spec.Image),
+		attribute.String("node.id", node.ID),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	if err := retry.Do(ctx, node.Manager.RetryPolicy(), func() error {
+		return node.Docker.PullImage(ctx, spec.PinnedImage(), cm.pullOptions(spec))
+	}); err != nil {
+		return fmt.Errorf("failed to pull image: %w", err)
+	}
+	cm.recordPull(node.ID, spec.PinnedImage())
+	return nil
+}
+
+// ErrInsufficientCapacity is returned when no eligible node has room for a container
+var ErrInsufficientCapacity = errors.New("no node has enough resources")
+
+// selectNodeLocked picks the node for spec. Caller must hold the lock.
+//
+// Only nodes whose labels match spec.NodeSelector are considered. Containers
+// sharing an AntiAffinityKey are spread across nodes: nodes already running
+// one are avoided, and with RequireAntiAffinity they are ruled out. Nodes
+// running a container whose labels match spec.AntiAffinity are ruled out, as
+// are nodes where a host port spec binds is already taken. Named volumes tie
+// a container to the node holding them. Burstable containers that fit nowhere
+// may overcommit an idle node under the OvercommitPolicy.
+// Failures are reported as a SchedulingError listing why each node was rejected.
+func (cm *ClusterManager) selectNodeLocked(spec docker.ContainerSpec) (*Node, error) {
+	selected := func(n *Node) bool { return n.MatchesSelector(spec.NodeSelector) }
+	if len(spec.NodeSelector) > 0 && !cm.anyNodeLocked(selected) {
+		return nil, cm.unschedulableLocked(spec, nil, errors.New("no node matches selector"))
+	}
+
+	conflicts := cm.antiAffinityLocked(spec.AntiAffinity)
+	affine := func(n *Node) bool { return selected(n) && conflicts[n.ID] == 0 }
+	if len(spec.AntiAffinity) > 0 && !cm.anyNodeLocked(affine) {
+		return nil, cm.unschedulableLocked(spec, nil,
+			fmt.Errorf("anti-affinity: every eligible node runs a container labelled %s", formatLabels(spec.AntiAffinity)))
+	}
+
+	matches := func(n *Node) bool {
+		return affine(n) && cm.hostPortInUseLocked(n, spec) == "" && cm.volumeConflictLocked(n, spec) == ""
+	}
+	if len(fixedHostPorts(spec)) > 0 && !cm.anyNodeLocked(matches) {
+		return nil, cm.unschedulableLocked(spec, nil,
+			fmt.Errorf("%w: host ports %s are in use on every eligible node", ErrInsufficientCapacity, formatHostPorts(spec)))
+	}
+	if hasVolumeMounts(spec) && !cm.anyNodeLocked(matches) {
+		return nil, cm.unschedulableLocked(spec, nil, errors.New("no eligible node holds the container's volumes"))
+	}
+
+	if spec.AntiAffinityKey == "" {
+		if node := cm.bestFitLocked(spec, matches); node != nil {
+			return node, nil
+		}
+		return nil, cm.unschedulableLocked(spec, nil, ErrInsufficientCapacity)
+	}
+
+	used := cm.affinityLocked(spec.AntiAffinityKey)
+	spread := func(n *Node) bool { return matches(n) && used[n.ID] == 0 }
+	if node := cm.bestFitLocked(spec, spread); node != nil {
+		return node, nil
+	}
+
+	node := cm.bestFitLocked(spec, matches)
+	if node == nil {
+		return nil, cm.unschedulableLocked(spec, nil, ErrInsufficientCapacity)
+	}
+	if spec.RequireAntiAffinity {
+		return nil, cm.unschedulableLocked(spec, used,
+			fmt.Errorf("anti-affinity: every node with enough resources already runs a container with key %q", spec.AntiAffinityKey))
+	}
+	return node, nil
+}
+
+// anyNodeLocked reports whether any schedulable node satisfies pred. Caller must hold the lock.
+func (cm *ClusterManager) anyNodeLocked(pred func(*Node) bool) bool {
+	for _, node := range cm.nodes {
+		if node.schedulable() && pred(node) {
+			return true
+		}
+	}
+	return false
+}
+
+// ScoreWeights converts a node's leftover resources into the single score
+// best-fit scheduling minimizes: leftover = CPU*cores + Memory*MB + GPU*gpus +
+// Disk*MB. A weight says how many "cores" one unit of that resource is worth.
+type ScoreWeights struct {
+	CPU    float64
+	Memory float64
+	GPU    float64
+	Disk   float64
+}
+
+// DefaultScoreWeights counts 1GB of memory and 10GB of disk as much as a core,
+// and a GPU as a core. Counting GPUs keeps GPU nodes free for workloads that need them.
+var DefaultScoreWeights = ScoreWeights{CPU: 1, Memory: 1.0 / 1024, GPU: 1, Disk: 1.0 / 10240}
+
+// Strategy decides which of the nodes that fit a container is picked
+type Strategy string
+
+const (
+	// StrategyBinPack picks the node left with the least weighted headroom,
+	// packing containers tightly and keeping whole nodes free for big ones
+	StrategyBinPack Strategy = "binpack"
+	// StrategySpread picks the node left with the most weighted headroom,
+	// spreading load evenly across nodes
+	StrategySpread Strategy = "spread"
+)
+
+// ParseStrategy validates a strategy name; empty means StrategyBinPack
+func ParseStrategy(s string) (Strategy, error) {
+	switch Strategy(s) {
+	case "", StrategyBinPack:
+		return StrategyBinPack, nil
+	case StrategySpread:
+		return StrategySpread, nil
+	}
+	return "", fmt.Errorf("unknown scheduling strategy %q (expected binpack or spread)", s)
+}
+
+// SetStrategy changes how a node is picked among those that fit
+func (cm *ClusterManager) SetStrategy(s Strategy) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.strategy = s
+}
+
+// SetLogger replaces the logger used for scheduling and node events. Call it
+// before starting the background loops.
+func (cm *ClusterManager) SetLogger(l *slog.Logger) {
+	cm.log = l
+}
+
+// SetScoreWeights changes how leftover resources are weighed when picking a node
+func (cm *ClusterManager) SetScoreWeights(w ScoreWeights) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.weights = w
+}
+
+// bestFitLocked returns the schedulable node accepted by filter (nil accepts all)
+// with the lowest weighted leftover score after placing spec (the highest
+// under StrategySpread). Burstable specs that fit nowhere fall back to
+// burstFitLocked. Returns nil if no node fits. Caller must hold the lock.
+func (cm *ClusterManager) bestFitLocked(spec docker.ContainerSpec, filter func(*Node) bool) *Node {
+	var selectedNode *Node
+	var minLeftover float64 = math.MaxFloat64
+
+	for _, node := range cm.nodes {
+		if !node.schedulable() || (filter != nil && !filter(node)) {
+			continue
+		}
+		if !node.Resources.CanAllocate(manager.ResourceSpecFor(spec)) {
+			continue
+		}
+
+		leftoverCPU := node.Resources.SchedulableCPU() - (node.Resources.AllocatedCPUSum() + spec.CPU)
+		leftoverMem := float64(node.Resources.SchedulableMemory() - (node.Resources.AllocatedMemorySum() + int(spec.Memory)))
+		leftoverGPU := float64(node.Resources.TotalGPU - (node.Resources.AllocatedGPUSum() + spec.GPU))
+		leftoverDisk := float64(node.Resources.TotalDisk - (node.Resources.AllocatedDiskSum() + spec.DiskMB))
+
+		// Never trade a shortfall in one resource for headroom in another
+		if leftoverCPU < 0 || leftoverMem < 0 || leftoverGPU < 0 || leftoverDisk < 0 {
+			continue
+		}
+
+		w := cm.weights
+		leftover := w.CPU*leftoverCPU + w.Memory*leftoverMem + w.GPU*leftoverGPU + w.Disk*leftoverDisk
+		if cm.strategy == StrategySpread {
+			leftover = -leftover
+		}
+		if leftover < minLeftover {
+			minLeftover = leftover
+			selectedNode = node
+		}
+	}
+	if selectedNode == nil && spec.Burstable {
+		return cm.burstFitLocked(spec, filter)
+	}
+	return selectedNode
+}
+
+// trackLocked records that container id was scheduled on nodeID from spec. Caller must hold the lock.
+func (cm *ClusterManager) trackLocked(id, nodeID string, spec docker.ContainerSpec) {
+	cm.assignments[id] = nodeID
+	cm.specs[id] = spec
+	if key := spec.AntiAffinityKey; key != "" {
+		if cm.affinity[key] == nil {
+			cm.affinity[key] = make(map[string]int)
+		}
+		cm.affinity[key][nodeID]++
+	}
+}
+
+// affinityLocked returns how many tracked or pending containers with the
+// anti-affinity key run on each node. Caller must hold the lock.
+func (cm *ClusterManager) affinityLocked(key string) map[string]int {
+	used := make(map[string]int, len(cm.affinity[key]))
+	for nodeID, n := range cm.affinity[key] {
+		used[nodeID] = n
+	}
+	for _, p := range cm.pending {
+		if p.spec.AntiAffinityKey == key {
+			used[p.nodeID]++
+		}
+	}
+	return used
+}
+
+// untrackLocked forgets everything recorded by trackLocked. Caller must hold the lock.
+func (cm *ClusterManager) untrackLocked(id string) {
+	nodeID := cm.assignments[id]
+	if key := cm.specs[id].AntiAffinityKey; key != "" {
+		if cm.affinity[key][nodeID]--; cm.affinity[key][nodeID] <= 0 {
+			delete(cm.affinity[key], nodeID)
+		}
+		if len(cm.affinity[key]) == 0 {
+			delete(cm.affinity, key)
+		}
+	}
+	delete(cm.assignments, id)
+	delete(cm.specs, id)
+}
+
+// ListFilter selects containers in ListAllContainers. Zero values match everything.
+type ListFilter struct {
+	Node      string // node ID
+	Namespace string
+	Image     string        // substring of the image name
+	Status    string        // e.g. "running", "exited"
+	OlderThan time.Duration // only containers created at least this long ago
+	Limit     int           // maximum number of containers returned, 0 for no limit
+	Offset    int           // number of matching containers to skip
+}
+
+func (f ListFilter) matches(nodeID string, info *manager.ContainerInfo) bool {
+	return (f.Node == "" || f.Node == nodeID) &&
+		(f.Namespace == "" || f.Namespace == info.Namespace) &&
+		(f.Image == "" || strings.Contains(info.Image, f.Image)) &&
+		(f.Status == "" || f.Status == info.Status) &&
+		(f.OlderThan <= 0 || time.Since(info.CreatedAt) >= f.OlderThan)
+}
+
+// ListAllContainers lists containers across all nodes matching filter, oldest
+// first. It also returns the number of matching containers before pagination.
+func (cm *ClusterManager) ListAllContainers(ctx context.Context, filter ListFilter) ([]*manager.ContainerInfo, int) {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
 	var all []*manager.ContainerInfo
 	for _, node := range cm.nodes {
 		containers, _ := node.Manager.ListActiveContainers(ctx)
-		all = append(all, containers...)
+		for _, info := range containers {
+			if filter.matches(node.ID, info) {
+				all = append(all, info)
+			}
+		}
 	}
-	return all
+
+	sort.Slice(all, func(i, j int) bool {
+		if !all[i].CreatedAt.Equal(all[j].CreatedAt) {
+			return all[i].CreatedAt.Before(all[j].CreatedAt)
+		}
+		return all[i].ID < all[j].ID
+	})
+
+	total := len(all)
+	all = all[min(filter.Offset, total):]
+	if filter.Limit > 0 && filter.Limit < len(all) {
+		all = all[:filter.Limit]
+	}
+	return all, total
 }
 
-func (cm *ClusterManager) GetContainerStatus(ctx context.Context, id string) (*manager.ContainerInfo, error) {
+// nodeFor returns the node a container is assigned to
+func (cm *ClusterManager) nodeFor(id string) (*Node, error) {
 	cm.mu.Lock()
-	nodeName, ok := cm.assignments[id]
-	cm.mu.Unlock()
+	defer cm.mu.Unlock()
 
+	nodeName, ok := cm.assignments[id]
 	if !ok {
-		return nil, fmt.Errorf("container %s not found", id)
+		return nil, fmt.Errorf("%w: %s", manager.ErrNotFound, id)
 	}
 
 	node, exists := cm.nodes[nodeName]
 	if !exists {
 		return nil, fmt.Errorf("node %s not found for container %s", nodeName, id)
 	}
+	return node, nil
+}
 
+func (cm *ClusterManager) GetContainerStatus(ctx context.Context, id string) (*manager.ContainerInfo, error) {
+	node, err := cm.nodeFor(id)
+	if err != nil {
+		return nil, err
+	}
 	return node.Manager.GetContainerStatus(ctx, id)
 }
 
-// TerminateContainer finds and terminates container on any node
-func (cm *ClusterManager) TerminateContainer(ctx context.Context, id string) error {
+// RenewTTL makes a container expire ttl from now, or never if ttl is 0
+func (cm *ClusterManager) RenewTTL(id string, ttl time.Duration) (*manager.ContainerInfo, error) {
+	node, err := cm.nodeFor(id)
+	if err != nil {
+		return nil, err
+	}
+	return node.Manager.RenewTTL(id, ttl)
+}
+
+// LiveState inspects a container on the node that owns it
+func (cm *ClusterManager) LiveState(ctx context.Context, id string) (manager.LiveState, error) {
+	node, err := cm.nodeFor(id)
+	if err != nil {
+		return manager.LiveState{}, err
+	}
+	return node.Manager.LiveState(ctx, id)
+}
+
+// ErrResizeInProgress is returned when updating the limits of a container
+// whose previous update has not finished
+var ErrResizeInProgress = errors.New("resize already in progress")
+
+// UpdateResources changes the CPU and memory of a running container on its
+// node. The change is reserved against the namespace's quota while the node
+// applies it, without holding the lock.
+func (cm *ClusterManager) UpdateResources(ctx context.Context, id string, cpu float64, memoryMB int64) (*manager.ContainerInfo, error) {
+	node, err := cm.nodeFor(id)
+	if err != nil {
+		return nil, err
+	}
+
 	cm.mu.Lock()
-	defer cm.mu.Unlock()
+	if _, ok := cm.resizes[id]; ok {
+		cm.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrResizeInProgress, id)
+	}
+	current, err := node.Manager.GetContainerStatus(ctx, id)
+	if err != nil {
+		cm.mu.Unlock()
+		return nil, err
+	}
+	delta := pendingResize{namespace: current.Namespace, cpu: cpu - current.CPU, memoryMB: memoryMB - current.MemoryMB}
+	if err := cm.checkQuotaLocked(delta.namespace, delta.cpu, delta.memoryMB, 0); err != nil {
+		cm.mu.Unlock()
+		return nil, err
+	}
+	cm.resizes[id] = delta
+	cm.mu.Unlock()
 
-	for _, node := range cm.nodes {
-		err := node.Manager.TerminateContainer(ctx, id)
-		if err == nil {
-			node.Resources.Release(id)
-			return nil
+	info, err := node.Manager.UpdateResources(ctx, id, cpu, memoryMB)
+
+	// Either the node now reports the new limits or they were rolled back;
+	// in both cases the reservation has served its purpose
+	cm.mu.Lock()
+	delete(cm.resizes, id)
+	cm.mu.Unlock()
+	return info, err
+}
+
+// RestartContainer restarts a container in place on the node that owns it
+func (cm *ClusterManager) RestartContainer(ctx context.Context, id string, stopTimeout int) (*manager.ContainerInfo, error) {
+	node, err := cm.nodeFor(id)
+	if err != nil {
+		return nil, err
+	}
+	return node.Manager.RestartContainer(ctx, id, stopTimeout)
+}
+
+// WaitHealthy waits until a container is healthy on the node that owns it
+func (cm *ClusterManager) WaitHealthy(ctx context.Context, id string) error {
+	node, err := cm.nodeFor(id)
+	if err != nil {
+		return err
+	}
+	return node.Manager.WaitHealthy(ctx, id)
+}
+
+// Exec runs cmd inside a container on the node that owns it
+func (cm *ClusterManager) Exec(ctx context.Context, id string, cmd []string) (docker.ExecResult, error) {
+	node, err := cm.nodeFor(id)
+	if err != nil {
+		return docker.ExecResult{}, err
+	}
+	return node.Manager.Exec(ctx, id, cmd)
+}
+
+// Stats samples the actual resource usage of a container on the node that owns it
+func (cm *ClusterManager) Stats(ctx context.Context, id string) (docker.ContainerStats, error) {
+	node, err := cm.nodeFor(id)
+	if err != nil {
+		return docker.ContainerStats{}, err
+	}
+	return node.Manager.Stats(ctx, id)
+}
+
+// ExecTTY starts cmd on a TTY inside a container on the node that owns it.
+// The caller must close the session.
+func (cm *ClusterManager) ExecTTY(ctx context.Context, id string, cmd []string) (docker.ExecSession, error) {
+	node, err := cm.nodeFor(id)
+	if err != nil {
+		return nil, err
+	}
+	return node.Manager.ExecTTY(ctx, id, cmd)
+}
+
+// ContainerLogs returns the logs of a container from the node that owns it.
+// The caller must close the stream.
+func (cm *ClusterManager) ContainerLogs(ctx context.Context, id string, opts docker.LogOptions) (io.ReadCloser, error) {
+	node, err := cm.nodeFor(id)
+	if err != nil {
+		return nil, err
+	}
+	return node.Manager.Logs(ctx, id, opts)
+}
+
+// TerminateWhere terminates every container matching filter, ignoring its
+// pagination. It returns the IDs terminated and the errors for those that
+// could not be, keyed by container ID.
+func (cm *ClusterManager) TerminateWhere(ctx context.Context, filter ListFilter) ([]string, map[string]error) {
+	filter.Limit, filter.Offset = 0, 0
+	containers, _ := cm.ListAllContainers(ctx, filter)
+
+	var terminated []string
+	errs := make(map[string]error)
+	for _, info := range containers {
+		if err := cm.TerminateContainer(ctx, info.ID); err != nil {
+			errs[info.ID] = err
+			continue
 		}
+		terminated = append(terminated, info.ID)
+	}
+	return terminated, errs
+}
+
+// TerminateContainer finds and terminates container on any node
+func (cm *ClusterManager) TerminateContainer(ctx context.Context, id string) error {
+	return cm.TerminateContainerWithTimeout(ctx, id, 0)
+}
+
+// TerminateContainerWithTimeout terminates a container on the node that owns
+// it, overriding its stop timeout with stopTimeout seconds when stopTimeout > 0.
+// The lock is not held while the container stops, which may take that long.
+func (cm *ClusterManager) TerminateContainerWithTimeout(ctx context.Context, id string, stopTimeout int) error {
+	node, err := cm.nodeFor(id)
+	if err != nil {
+		return err
+	}
+
+	err = node.Manager.TerminateContainerWithTimeout(ctx, id, stopTimeout)
+	if err != nil && !errors.Is(err, manager.ErrNotFound) {
+		return fmt.Errorf("terminate %s on %s: %w", id, node.ID, err)
+	}
+
+	// A container the node no longer tracks, e.g. because it just expired, is untracked too
+	cm.mu.Lock()
+	cm.untrackLocked(id)
+	cm.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("%w: %s", manager.ErrNotFound, id)
 	}
-	return errors.New("container not found")
+	cm.log.Info("container terminated", "container_id", id, "node_id", node.ID)
+	return nil
 }
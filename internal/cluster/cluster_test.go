@@ -0,0 +1,562 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/docker/dockertest"
+	"mini-cloud/internal/events"
+	"mini-cloud/internal/manager"
+	"mini-cloud/internal/resourcemanager"
+	"mini-cloud/internal/retry"
+)
+
+// discard is a logger for tests that drops everything
+var discard = slog.New(slog.DiscardHandler)
+
+// newTestNode returns a node with the given capacity on an in-memory runtime
+func newTestNode(id string, cpu float64, memory int) (*Node, *dockertest.Runtime) {
+	rt := dockertest.New()
+	rm := resourcemanager.NewResourceManager(cpu, memory)
+	mgr := manager.NewManager(rt, rm)
+	mgr.SetRetryPolicy(retry.Policy{MaxAttempts: 1})
+	mgr.SetLogger(discard)
+	return &Node{ID: id, Docker: rt, Resources: rm, Manager: mgr}, rt
+}
+
+// newTestCluster returns a cluster of nodes, logging nowhere
+func newTestCluster(nodes ...*Node) *ClusterManager {
+	byID := make(map[string]*Node, len(nodes))
+	for _, n := range nodes {
+		byID[n.ID] = n
+	}
+	cm := NewClusterManager(byID)
+	cm.SetLogger(discard)
+	return cm
+}
+
+// mustSchedule schedules spec or fails the test
+func mustSchedule(t *testing.T, cm *ClusterManager, spec docker.ContainerSpec) *manager.ContainerInfo {
+	t.Helper()
+	info, err := cm.Schedule(context.Background(), spec)
+	if err != nil {
+		t.Fatalf("Schedule(%s): %v", spec.Name, err)
+	}
+	return info
+}
+
+func TestScheduleGPU(t *testing.T) {
+	cpuNode, _ := newTestNode("cpu", 8, 8192)
+	gpuNode, _ := newTestNode("gpu", 4, 8192)
+	gpuNode.Resources.TotalGPU = 2
+	cm := newTestCluster(cpuNode, gpuNode)
+
+	info := mustSchedule(t, cm, docker.ContainerSpec{Name: "train", Image: "pytorch", CPU: 1, GPU: 2})
+	if info.NodeID != "gpu" {
+		t.Errorf("scheduled on %s, want the GPU node", info.NodeID)
+	}
+	if _, err := cm.Schedule(context.Background(), docker.ContainerSpec{Name: "train2", Image: "pytorch", CPU: 1, GPU: 1}); err == nil {
+		t.Error("scheduled a GPU container with every GPU taken")
+	}
+}
+
+func TestScheduleDisk(t *testing.T) {
+	small, _ := newTestNode("small", 16, 16384)
+	small.Resources.TotalDisk = 1024
+	large, _ := newTestNode("large", 2, 2048)
+	large.Resources.TotalDisk = 102400
+	cm := newTestCluster(small, large)
+
+	info := mustSchedule(t, cm, docker.ContainerSpec{Name: "db", Image: "postgres", CPU: 1, Memory: 512, DiskMB: 20480})
+	if info.NodeID != "large" {
+		t.Errorf("scheduled on %s, want the node with disk to spare", info.NodeID)
+	}
+	if _, err := cm.Schedule(context.Background(), docker.ContainerSpec{Name: "db2", Image: "postgres", CPU: 1, DiskMB: 102400}); err == nil {
+		t.Error("scheduled beyond every node's disk")
+	}
+}
+
+func TestScheduleNodeSelector(t *testing.T) {
+	ssd, _ := newTestNode("ssd", 4, 4096)
+	ssd.Labels = map[string]string{"disk": "ssd", "region": "us"}
+	hdd, _ := newTestNode("hdd", 8, 8192)
+	hdd.Labels = map[string]string{"disk": "hdd", "region": "us"}
+	cm := newTestCluster(ssd, hdd)
+
+	info := mustSchedule(t, cm, docker.ContainerSpec{Name: "db", Image: "postgres", CPU: 1,
+		NodeSelector: map[string]string{"disk": "ssd", "region": "us"}})
+	if info.NodeID != "ssd" {
+		t.Errorf("scheduled on %s, want the only node matching the selector", info.NodeID)
+	}
+
+	_, err := cm.Schedule(context.Background(), docker.ContainerSpec{Name: "gpu", Image: "pytorch", CPU: 1,
+		NodeSelector: map[string]string{"gpu": "true"}})
+	if err == nil || !strings.Contains(err.Error(), "no node matches selector") {
+		t.Errorf("err = %v, want no node matches selector", err)
+	}
+}
+
+func TestListAllContainers(t *testing.T) {
+	node1, rt1 := newTestNode("node1", 4, 4096)
+	node1.Labels = map[string]string{"zone": "a"}
+	node2, _ := newTestNode("node2", 4, 4096)
+	node2.Labels = map[string]string{"zone": "b"}
+	cm := newTestCluster(node1, node2)
+	on := func(zone string) map[string]string { return map[string]string{"zone": zone} }
+
+	web := mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1, NodeSelector: on("a")})
+	cache := mustSchedule(t, cm, docker.ContainerSpec{Name: "cache", Image: "redis", CPU: 1, NodeSelector: on("b"), Namespace: "team-a"})
+	proxy := mustSchedule(t, cm, docker.ContainerSpec{Name: "proxy", Image: "nginx:alpine", CPU: 1, NodeSelector: on("b")})
+	db := mustSchedule(t, cm, docker.ContainerSpec{Name: "db", Image: "postgres", CPU: 1, NodeSelector: on("a"), Namespace: "team-a"})
+	rt1.SetExited(db.ID, 1)
+	node1.Manager.RefreshStatuses(context.Background())
+
+	tests := []struct {
+		name      string
+		filter    ListFilter
+		want      []*manager.ContainerInfo
+		wantTotal int
+	}{
+		{"all", ListFilter{}, []*manager.ContainerInfo{web, cache, proxy, db}, 4},
+		{"node", ListFilter{Node: "node2"}, []*manager.ContainerInfo{cache, proxy}, 2},
+		{"namespace", ListFilter{Namespace: "team-a"}, []*manager.ContainerInfo{cache, db}, 2},
+		{"image substring", ListFilter{Image: "nginx"}, []*manager.ContainerInfo{web, proxy}, 2},
+		{"status", ListFilter{Status: "exited"}, []*manager.ContainerInfo{db}, 1},
+		{"combined", ListFilter{Node: "node1", Status: "running"}, []*manager.ContainerInfo{web}, 1},
+		{"limit", ListFilter{Limit: 2}, []*manager.ContainerInfo{web, cache}, 4},
+		{"offset", ListFilter{Offset: 3}, []*manager.ContainerInfo{db}, 4},
+		{"page", ListFilter{Limit: 1, Offset: 1}, []*manager.ContainerInfo{cache}, 4},
+		{"offset past the end", ListFilter{Offset: 10}, nil, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total := cm.ListAllContainers(context.Background(), tt.filter)
+			var ids, want []string
+			for _, info := range got {
+				ids = append(ids, info.ID)
+			}
+			for _, info := range tt.want {
+				want = append(want, info.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(want, ",") || total != tt.wantTotal {
+				t.Errorf("listed %v of %d, want %v of %d", ids, total, want, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestTerminateWhere(t *testing.T) {
+	node1, rt1 := newTestNode("node1", 4, 4096)
+	node2, _ := newTestNode("node2", 4, 4096)
+	cm := newTestCluster(node1, node2)
+	ctx := context.Background()
+
+	web := mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+	proxy := mustSchedule(t, cm, docker.ContainerSpec{Name: "proxy", Image: "nginx:alpine", CPU: 1})
+	db := mustSchedule(t, cm, docker.ContainerSpec{Name: "db", Image: "postgres", CPU: 1})
+	old := mustSchedule(t, cm, docker.ContainerSpec{Name: "old", Image: "redis", CPU: 1})
+	old.CreatedAt = time.Now().Add(-2 * time.Hour)
+	cm.nodes[cm.assignmentOf(old.ID)].Manager.AddContainer(old.ID, old) // Schedule returned a copy
+
+	terminated, errs := cm.TerminateWhere(ctx, ListFilter{Image: "nginx", Limit: 1})
+	if len(errs) != 0 || strings.Join(terminated, ",") != web.ID+","+proxy.ID {
+		t.Errorf("terminated %v (errors %v), want both nginx containers despite the limit", terminated, errs)
+	}
+
+	terminated, errs = cm.TerminateWhere(ctx, ListFilter{OlderThan: time.Hour})
+	if len(errs) != 0 || len(terminated) != 1 || terminated[0] != old.ID {
+		t.Errorf("terminated %v (errors %v), want only %s", terminated, errs, old.ID)
+	}
+
+	// Failures are reported per container
+	rt1.Fail("StopContainer", dockertest.ErrInjected)
+	node2.Docker.(*dockertest.Runtime).Fail("StopContainer", dockertest.ErrInjected)
+	terminated, errs = cm.TerminateWhere(ctx, ListFilter{Image: "postgres"})
+	if len(terminated) != 0 || !errors.Is(errs[db.ID], dockertest.ErrInjected) {
+		t.Errorf("terminated %v, errors %v; want an error for %s", terminated, errs, db.ID)
+	}
+	if infos, _ := cm.ListAllContainers(ctx, ListFilter{}); len(infos) != 1 || infos[0].ID != db.ID {
+		t.Errorf("left %v, want only %s", infos, db.ID)
+	}
+}
+
+func TestTerminateContainerNotFound(t *testing.T) {
+	node, _ := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+
+	if err := cm.TerminateContainer(context.Background(), "nope"); !errors.Is(err, manager.ErrNotFound) {
+		t.Errorf("err = %v, want manager.ErrNotFound", err)
+	}
+}
+
+func TestTerminateContainerKeepsDockerErrors(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	info := mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+
+	rt.Fail("StopContainer", dockertest.ErrInjected)
+	err := cm.TerminateContainer(context.Background(), info.ID)
+	if !errors.Is(err, dockertest.ErrInjected) || errors.Is(err, manager.ErrNotFound) {
+		t.Fatalf("err = %v, want the stop error", err)
+	}
+	if got := cm.assignmentOf(info.ID); got != "node1" {
+		t.Errorf("container untracked after a failed stop; assignment = %q", got)
+	}
+}
+
+func TestTerminateContainerDoesNotBlockCluster(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+	info := mustSchedule(t, cm, docker.ContainerSpec{Name: "db", Image: "postgres", CPU: 1})
+
+	stopping, release := make(chan struct{}), make(chan struct{})
+	rt.SetHook(func(ctx context.Context, op, _ string) error {
+		if op == "StopContainer" {
+			close(stopping)
+			<-release
+		}
+		return nil
+	})
+	done := make(chan error, 1)
+	go func() { done <- cm.TerminateContainer(ctx, info.ID) }()
+	<-stopping
+
+	// A slow graceful stop must not hold up scheduling or listing
+	scheduled := make(chan error, 1)
+	go func() {
+		_, err := cm.Schedule(ctx, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+		scheduled <- err
+	}()
+	select {
+	case err := <-scheduled:
+		if err != nil {
+			t.Errorf("Schedule during a stop: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Schedule blocked while a container was stopping")
+	}
+	if _, total := cm.ListAllContainers(ctx, ListFilter{}); total != 2 {
+		t.Errorf("listed %d containers, want 2", total)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("TerminateContainer: %v", err)
+	}
+}
+
+func TestScoreWeights(t *testing.T) {
+	cpuHeavy := docker.ContainerSpec{Name: "encoder", Image: "ffmpeg", CPU: 2, Memory: 512}
+	memHeavy := docker.ContainerSpec{Name: "cache", Image: "redis", CPU: 0.5, Memory: 2048}
+	tests := []struct {
+		name     string
+		strategy Strategy
+		weights  ScoreWeights
+		spec     docker.ContainerSpec
+		want     string
+	}{
+		// 1GB per core: the memory node's 16GB outweighs the CPU node's cores
+		{"default weights", StrategySpread, DefaultScoreWeights, cpuHeavy, "mem"},
+		{"cores count most", StrategySpread, ScoreWeights{CPU: 1, Memory: 1.0 / 8192}, cpuHeavy, "cpu"},
+		{"cores count most, memory-heavy", StrategySpread, ScoreWeights{CPU: 1, Memory: 1.0 / 8192}, memHeavy, "cpu"},
+		{"memory counts most", StrategySpread, ScoreWeights{CPU: 0.1, Memory: 1.0 / 1024}, memHeavy, "mem"},
+		{"bin packing cores", StrategyBinPack, ScoreWeights{CPU: 1, Memory: 1.0 / 8192}, cpuHeavy, "mem"},
+		{"bin packing memory", StrategyBinPack, ScoreWeights{CPU: 0.1, Memory: 1.0 / 1024}, memHeavy, "cpu"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cpuNode, _ := newTestNode("cpu", 8, 4096)
+			memNode, _ := newTestNode("mem", 4, 16384)
+			cm := newTestCluster(cpuNode, memNode)
+			cm.SetStrategy(tt.strategy)
+			cm.SetScoreWeights(tt.weights)
+
+			if info := mustSchedule(t, cm, tt.spec); info.NodeID != tt.want {
+				t.Errorf("placed on %s, want %s", info.NodeID, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreNeverTradesShortfall(t *testing.T) {
+	// Plenty of cores make up for the missing memory in the combined score,
+	// but the container doesn't fit there
+	roomy, _ := newTestNode("roomy", 64, 1024)
+	tight, _ := newTestNode("tight", 2, 4096)
+	cm := newTestCluster(roomy, tight)
+	cm.SetStrategy(StrategySpread)
+
+	if info := mustSchedule(t, cm, docker.ContainerSpec{Name: "db", Image: "postgres", CPU: 1, Memory: 2048}); info.NodeID != "tight" {
+		t.Errorf("placed on %s, want the only node with the memory", info.NodeID)
+	}
+}
+
+func TestScheduleLimitsConcurrentCreates(t *testing.T) {
+	node, rt := newTestNode("node1", 16, 16384)
+	node.MaxConcurrentCreates = 2
+	cm := newTestCluster(node)
+
+	var inFlight, peak atomic.Int32
+	rt.SetHook(func(_ context.Context, op, _ string) error {
+		if op == "CreateContainer" || op == "StartContainer" {
+			n := inFlight.Add(1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			time.Sleep(10 * time.Millisecond)
+			inFlight.Add(-1)
+		}
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cm.Schedule(context.Background(), docker.ContainerSpec{Name: fmt.Sprintf("web-%d", i), Image: "nginx", CPU: 0.5}); err != nil {
+				t.Errorf("Schedule: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got != 2 {
+		t.Errorf("at most %d creates ran at once, want the limit of 2", got)
+	}
+	if n := rt.Running(); n != 8 {
+		t.Errorf("%d containers running, want 8", n)
+	}
+}
+
+func TestScheduleNameConflict(t *testing.T) {
+	node1, rt1 := newTestNode("node1", 4, 4096)
+	node2, rt2 := newTestNode("node2", 4, 4096)
+	cm := newTestCluster(node1, node2)
+	first := mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+
+	_, err := cm.Schedule(context.Background(), docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+	if !errors.Is(err, manager.ErrNameConflict) {
+		t.Fatalf("err = %v, want ErrNameConflict", err)
+	}
+	if n := len(rt1.Containers()) + len(rt2.Containers()); n != 1 {
+		t.Errorf("%d containers created, want only the first web", n)
+	}
+
+	if err := cm.TerminateContainer(context.Background(), first.ID); err != nil {
+		t.Fatalf("TerminateContainer: %v", err)
+	}
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+}
+
+func TestScheduleIsLogged(t *testing.T) {
+	node, _ := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	var buf bytes.Buffer
+	cm.SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	info := mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+
+	var rec struct {
+		Msg         string `json:"msg"`
+		ContainerID string `json:"container_id"`
+		NodeID      string `json:"node_id"`
+		Image       string `json:"image"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("log output %q is not a JSON record: %v", buf.String(), err)
+	}
+	if rec.Msg != "container scheduled" || rec.ContainerID != info.ID || rec.NodeID != "node1" || rec.Image != "nginx" {
+		t.Errorf("logged %+v, want container %s scheduled on node1", rec, info.ID)
+	}
+}
+
+func TestSubscribeReceivesProvision(t *testing.T) {
+	node, _ := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	sub := cm.Subscribe()
+	defer cm.Unsubscribe(sub)
+
+	info := mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case e := <-sub:
+			if e.Type != events.Provisioned {
+				continue
+			}
+			if e.ContainerID != info.ID || e.NodeID != "node1" || e.Time.IsZero() {
+				t.Errorf("received %+v, want %s provisioned on node1", e, info.ID)
+			}
+			return
+		case <-timeout:
+			t.Fatal("no provision event received")
+		}
+	}
+}
+
+func TestScheduleIsTraced(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	node, _ := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	info := mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range rec.Ended() {
+		spans[s.Name()] = s
+	}
+	root, ok := spans["Schedule"]
+	if !ok {
+		t.Fatalf("no Schedule span in %v", slices.Collect(maps.Keys(spans)))
+	}
+	attrs := make(map[attribute.Key]string)
+	for _, kv := range root.Attributes() {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+	if attrs["node.id"] != "node1" || attrs["container.id"] != info.ID {
+		t.Errorf("Schedule span attributes %v, want node1 and %s", attrs, info.ID)
+	}
+	for _, name := range []string{"PullImage", "Reserve", "CreateContainer", "StartContainer"} {
+		s, ok := spans[name]
+		if !ok {
+			t.Errorf("no %s span", name)
+			continue
+		}
+		if s.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("%s span is not a child of Schedule", name)
+		}
+	}
+}
+
+func TestScheduleCleansUpOnStartFailure(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	rt.Fail("StartContainer", dockertest.ErrInjected)
+
+	_, err := cm.Schedule(context.Background(), docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+	if !errors.Is(err, dockertest.ErrInjected) {
+		t.Fatalf("err = %v, want the start error", err)
+	}
+	if n := len(rt.Containers()); n != 0 {
+		t.Errorf("%d containers left after failed start, want none", n)
+	}
+	if got := node.Resources.AllocatedCPUSum(); got != 0 {
+		t.Errorf("allocated CPU = %v after failed start, want 0", got)
+	}
+
+	// The name is free again
+	rt.Fail("StartContainer", nil)
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+}
+
+func TestPullBeforeReserve(t *testing.T) {
+	tests := []struct {
+		name         string
+		pullFirst    bool
+		wantReserved bool
+	}{
+		{"reserve first by default", false, true},
+		{"pull first", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, rt := newTestNode("node1", 4, 4096)
+			cm := newTestCluster(node)
+			cm.SetPullBeforeReserve(tt.pullFirst)
+
+			// Whether web held a reservation while its image was pulled
+			var reserved bool
+			rt.SetHook(func(_ context.Context, op, _ string) error {
+				if op == "PullImage" {
+					_, reserved = node.Resources.Allocations()["web"]
+				}
+				return nil
+			})
+			mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1, Memory: 256})
+
+			if reserved != tt.wantReserved {
+				t.Errorf("reserved during pull = %v, want %v", reserved, tt.wantReserved)
+			}
+			if n := rt.Calls("PullImage"); n != 1 {
+				t.Errorf("image pulled %d times, want once", n)
+			}
+			if _, ok := node.Resources.Allocations()["web"]; !ok {
+				t.Error("web has no reservation after scheduling")
+			}
+		})
+	}
+}
+
+func TestExpiredContainerIsUntracked(t *testing.T) {
+	node, _ := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	spec := docker.ContainerSpec{Name: "job", Image: "busybox", CPU: 1, TTL: time.Millisecond,
+		AntiAffinityKey: "batch", RequireAntiAffinity: true}
+	info := mustSchedule(t, cm, spec)
+	node.Manager.StartExpirationLoop(ctx, 10*time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for cm.assignmentOf(info.ID) != "" {
+		if time.Now().After(deadline) {
+			t.Fatal("expired container is still assigned")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The node no longer runs a container with the key
+	spec.Name, spec.TTL = "job2", 0
+	mustSchedule(t, cm, spec)
+}
+
+func TestNewClusterRestoresTracking(t *testing.T) {
+	node, _ := newTestNode("node1", 4, 4096)
+	info, err := node.Manager.ProvisionContainer(context.Background(), docker.ContainerSpec{
+		Name: "db-0", Image: "postgres", CPU: 1, AntiAffinityKey: "db", RequireAntiAffinity: true,
+	})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+
+	cm := newTestCluster(node)
+	if got := cm.assignmentOf(info.ID); got != "node1" {
+		t.Errorf("assignment = %q, want node1", got)
+	}
+	cm.mu.Lock()
+	spec, ok := cm.specs[info.ID]
+	cm.mu.Unlock()
+	if !ok || spec.AntiAffinityKey != "db" || !spec.RequireAntiAffinity {
+		t.Errorf("restored spec = %+v, %v; want the anti-affinity key", spec, ok)
+	}
+
+	_, err = cm.Schedule(context.Background(), docker.ContainerSpec{
+		Name: "db-1", Image: "postgres", CPU: 1, AntiAffinityKey: "db", RequireAntiAffinity: true,
+	})
+	if err == nil {
+		t.Error("scheduled a second container with a required anti-affinity key on the only node")
+	}
+}
@@ -0,0 +1,298 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/manager"
+)
+
+var (
+	// ErrDeploymentNotFound is returned for deployments the cluster does not know
+	ErrDeploymentNotFound = errors.New("deployment not found")
+	// ErrDeploymentExists is returned when creating a deployment whose name is taken
+	ErrDeploymentExists = errors.New("deployment already exists")
+	// ErrRolloutInProgress is returned when updating a deployment that is still rolling out
+	ErrRolloutInProgress = errors.New("rollout in progress")
+)
+
+// Labels set on every replica of a deployment
+const (
+	DeploymentLabel         = "mini-cloud.deployment"          // the deployment's name
+	DeploymentRevisionLabel = "mini-cloud.deployment-revision" // the revision of the template it was created from
+)
+
+// Deployment keeps Replicas healthy copies of Template running, named
+// <name>-<n>. Replicas that stop, fail their probe, expire or vanish with
+// their node are replaced. Only containers in the template's namespace
+// labelled with the deployment's name count as its replicas.
+type Deployment struct {
+	Name      string
+	Template  docker.ContainerSpec // Name is ignored
+	Replicas  int
+	CreatedAt time.Time
+
+	Revision int             // of Template; increases with every update
+	Strategy RolloutStrategy // how updates replace the replicas
+	Rollout  RolloutStatus   // progress of the latest update
+
+	previous     *revision // being rolled away from, for rollback
+	lastRevision int       // highest revision handed out, never reused
+	stopRollout  func()    // cancels the latest rollout and waits for it
+}
+
+// Validate checks that the deployment can be scheduled
+func (d Deployment) Validate() error {
+	switch {
+	case d.Name == "":
+		return errors.New("deployment name is required")
+	case d.Replicas < 0:
+		return errors.New("replicas must not be negative")
+	case d.Template.Image == "":
+		return errors.New("template image is required")
+	}
+	if d.Strategy != (RolloutStrategy{}) {
+		return d.Strategy.Validate()
+	}
+	return nil
+}
+
+// replicaTemplate returns the spec of d's replicas, labelled with its name
+// and revision
+func (d *Deployment) replicaTemplate() docker.ContainerSpec {
+	spec := withLabel(d.Template, DeploymentLabel, d.Name)
+	spec.Labels[DeploymentRevisionLabel] = strconv.Itoa(d.Revision)
+	return spec
+}
+
+// deploymentReplicasLocked returns the replicas of d, ordered by index.
+// Caller must hold the lock.
+func (cm *ClusterManager) deploymentReplicasLocked(d *Deployment) []replica {
+	return cm.replicasLocked(DeploymentLabel, d.Name, d.Template.Namespace)
+}
+
+// replicaRevision returns the deployment revision a replica was created from,
+// 0 if unknown
+func replicaRevision(info *manager.ContainerInfo) int {
+	rev, _ := strconv.Atoi(info.Labels[DeploymentRevisionLabel])
+	return rev
+}
+
+// DeploymentStatus reports a deployment and its current replicas
+type DeploymentStatus struct {
+	Deployment
+	Containers []*manager.ContainerInfo // sorted by replica index
+	Ready      int                      // replicas running and not failing their probe
+}
+
+// CreateDeployment adds d and schedules its replicas. Replicas that can't be
+// placed yet are retried by the deployment loop; their errors are returned.
+func (cm *ClusterManager) CreateDeployment(ctx context.Context, d Deployment) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+
+	cm.mu.Lock()
+	if _, ok := cm.deployments[d.Name]; ok {
+		cm.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrDeploymentExists, d.Name)
+	}
+	d.Template.Name = ""
+	d.CreatedAt = time.Now()
+	d.Revision, d.lastRevision = 1, 1
+	if d.Strategy == (RolloutStrategy{}) {
+		d.Strategy = DefaultRolloutStrategy
+	}
+	d.Rollout = RolloutStatus{State: RolloutComplete, UpdatedAt: d.CreatedAt}
+	cm.deployments[d.Name] = &d
+	cm.persistDeploymentsLocked()
+	cm.mu.Unlock()
+
+	cm.log.Info("deployment created", "deployment", d.Name, "image", d.Template.Image, "replicas", d.Replicas)
+	return cm.reconcileDeployment(ctx, d.Name)
+}
+
+// ScaleDeployment changes the number of replicas of deployment name and
+// schedules or terminates replicas to match
+func (cm *ClusterManager) ScaleDeployment(ctx context.Context, name string, replicas int) error {
+	if replicas < 0 {
+		return errors.New("replicas must not be negative")
+	}
+
+	cm.mu.Lock()
+	d, ok := cm.deployments[name]
+	if !ok {
+		cm.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrDeploymentNotFound, name)
+	}
+	d.Replicas = replicas
+	cm.persistDeploymentsLocked()
+	cm.mu.Unlock()
+
+	cm.log.Info("deployment scaled", "deployment", name, "replicas", replicas)
+	return cm.reconcileDeployment(ctx, name)
+}
+
+// DeleteDeployment removes deployment name and its scale policy, stops its
+// rollout and terminates its replicas
+func (cm *ClusterManager) DeleteDeployment(ctx context.Context, name string) error {
+	cm.mu.Lock()
+	d, ok := cm.deployments[name]
+	if !ok {
+		cm.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrDeploymentNotFound, name)
+	}
+	delete(cm.deployments, name)
+	delete(cm.workloads, name)
+	cm.persistDeploymentsLocked()
+	stopRollout := d.stopRollout
+	cm.mu.Unlock()
+
+	// A rollout still running would start replicas after they were collected.
+	// Wait for it before taking deploying, which it may be holding.
+	if stopRollout != nil {
+		stopRollout()
+	}
+
+	cm.deploying.Lock()
+	defer cm.deploying.Unlock()
+	cm.mu.Lock()
+	replicas := cm.deploymentReplicasLocked(d)
+	cm.mu.Unlock()
+
+	cm.log.Info("deployment deleted", "deployment", name, "replicas", len(replicas))
+	return cm.scaleDown(ctx, replicas)
+}
+
+// Deployment returns the status of deployment name
+func (cm *ClusterManager) Deployment(name string) (DeploymentStatus, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	d, ok := cm.deployments[name]
+	if !ok {
+		return DeploymentStatus{}, fmt.Errorf("%w: %s", ErrDeploymentNotFound, name)
+	}
+	return cm.deploymentStatusLocked(d), nil
+}
+
+// Deployments returns the status of every deployment, sorted by name
+func (cm *ClusterManager) Deployments() []DeploymentStatus {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	out := make([]DeploymentStatus, 0, len(cm.deployments))
+	for _, d := range cm.deployments {
+		out = append(out, cm.deploymentStatusLocked(d))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// deploymentStatusLocked reports d with its replicas. Caller must hold the lock.
+func (cm *ClusterManager) deploymentStatusLocked(d *Deployment) DeploymentStatus {
+	status := DeploymentStatus{Deployment: *d}
+	for _, r := range cm.deploymentReplicasLocked(d) {
+		status.Containers = append(status.Containers, r.info)
+		if r.info.Status == "running" {
+			status.Ready++
+		}
+	}
+	return status
+}
+
+// failedReplica reports whether a replica stopped or fails its probe and
+// should be replaced. Replicas whose probe restarts them are left to their
+// node's manager.
+func failedReplica(info *manager.ContainerInfo) bool {
+	switch info.Status {
+	case "exited", "dead":
+		return true
+	case manager.StatusUnhealthy:
+		return info.Probe == nil || info.Probe.Action != docker.ProbeActionRestart
+	}
+	return false
+}
+
+// ReconcileDeployments schedules or terminates replicas so that every
+// deployment has as many healthy ones as it asks for
+func (cm *ClusterManager) ReconcileDeployments(ctx context.Context) {
+	cm.mu.Lock()
+	names := make([]string, 0, len(cm.deployments))
+	for name := range cm.deployments {
+		names = append(names, name)
+	}
+	cm.mu.Unlock()
+
+	for _, name := range names {
+		if err := cm.reconcileDeployment(ctx, name); err != nil {
+			cm.log.Warn("failed to reconcile deployment", "deployment", name, "error", err)
+		}
+	}
+}
+
+// reconcileDeployment replaces the failed replicas of deployment name and
+// schedules or terminates replicas to reach its count. Failed replicas are
+// replaced before new ones are added, keeping their index. Deployments
+// rolling out are left to the rollout.
+func (cm *ClusterManager) reconcileDeployment(ctx context.Context, name string) error {
+	cm.deploying.Lock()
+	defer cm.deploying.Unlock()
+
+	cm.mu.Lock()
+	d, ok := cm.deployments[name]
+	if !ok || d.Rollout.State == RolloutProgressing {
+		cm.mu.Unlock()
+		return nil
+	}
+	want, template := d.Replicas, d.replicaTemplate()
+	var live, failed []replica
+	for _, r := range cm.deploymentReplicasLocked(d) {
+		if failedReplica(r.info) {
+			failed = append(failed, r)
+		} else {
+			live = append(live, r)
+		}
+	}
+	cm.mu.Unlock()
+
+	var errs []error
+	if len(failed) > 0 {
+		cm.log.Info("removing failed replicas", "deployment", name, "replicas", len(failed))
+		if err := cm.scaleDown(ctx, failed); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	switch {
+	case len(live) < want:
+		cm.log.Info("scheduling replicas", "deployment", name, "running", len(live), "desired", want)
+		_, err := cm.scaleUp(ctx, name, template, live, want-len(live))
+		errs = append(errs, err)
+	case len(live) > want:
+		cm.log.Info("terminating surplus replicas", "deployment", name, "running", len(live), "desired", want)
+		errs = append(errs, cm.scaleDown(ctx, live[want:]))
+	}
+	return errors.Join(errs...)
+}
+
+// StartDeploymentLoop reconciles every deployment each interval
+func (cm *ClusterManager) StartDeploymentLoop(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				cm.ReconcileDeployments(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
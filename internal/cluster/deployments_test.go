@@ -0,0 +1,167 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/manager"
+)
+
+// deploymentNames returns the names of deployment name's replicas, by index
+func deploymentNames(t *testing.T, cm *ClusterManager, name string) []string {
+	t.Helper()
+	status, err := cm.Deployment(name)
+	if err != nil {
+		t.Fatalf("Deployment(%s): %v", name, err)
+	}
+	var names []string
+	for _, info := range status.Containers {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+func TestDeploymentLifecycle(t *testing.T) {
+	node, rt := newTestNode("node1", 8, 8192)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+
+	d := Deployment{Name: "web", Template: docker.ContainerSpec{Name: "ignored", Image: "nginx", CPU: 1}, Replicas: 3}
+	if err := cm.CreateDeployment(ctx, d); err != nil {
+		t.Fatalf("CreateDeployment: %v", err)
+	}
+	if err := cm.CreateDeployment(ctx, d); !errors.Is(err, ErrDeploymentExists) {
+		t.Errorf("creating it again: err = %v, want ErrDeploymentExists", err)
+	}
+	if got := deploymentNames(t, cm, "web"); !slices.Equal(got, []string{"web-0", "web-1", "web-2"}) {
+		t.Errorf("replicas = %v, want web-0 to web-2", got)
+	}
+
+	// A stopped replica is replaced under its index
+	status, _ := cm.Deployment("web")
+	stopped := status.Containers[1]
+	rt.SetExited(stopped.ID, 1)
+	node.Manager.RefreshStatuses(ctx)
+	cm.ReconcileDeployments(ctx)
+	status, _ = cm.Deployment("web")
+	if len(status.Containers) != 3 || status.Ready != 3 || status.Containers[1].ID == stopped.ID {
+		t.Errorf("after reconciling: %d replicas, %d ready; want 3 ready with web-1 replaced", len(status.Containers), status.Ready)
+	}
+
+	if err := cm.ScaleDeployment(ctx, "web", 1); err != nil {
+		t.Fatalf("ScaleDeployment: %v", err)
+	}
+	if got := deploymentNames(t, cm, "web"); !slices.Equal(got, []string{"web-0"}) {
+		t.Errorf("replicas = %v after scaling to 1, want [web-0]", got)
+	}
+	if err := cm.ScaleDeployment(ctx, "nope", 1); !errors.Is(err, ErrDeploymentNotFound) {
+		t.Errorf("scaling an unknown deployment: err = %v, want ErrDeploymentNotFound", err)
+	}
+
+	if err := cm.DeleteDeployment(ctx, "web"); err != nil {
+		t.Fatalf("DeleteDeployment: %v", err)
+	}
+	if rt.Running() != 0 {
+		t.Errorf("%d containers running after the deployment was deleted", rt.Running())
+	}
+	if _, err := cm.Deployment("web"); !errors.Is(err, ErrDeploymentNotFound) {
+		t.Errorf("Deployment after delete: err = %v, want ErrDeploymentNotFound", err)
+	}
+}
+
+func TestDeploymentRetriesUnplacedReplicas(t *testing.T) {
+	node, _ := newTestNode("node1", 2, 2048)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+
+	d := Deployment{Name: "api", Template: docker.ContainerSpec{Image: "nginx", CPU: 1}, Replicas: 3}
+	if err := cm.CreateDeployment(ctx, d); !errors.Is(err, ErrInsufficientCapacity) {
+		t.Errorf("CreateDeployment beyond capacity: err = %v, want ErrInsufficientCapacity", err)
+	}
+	if got := deploymentNames(t, cm, "api"); len(got) != 2 {
+		t.Fatalf("replicas = %v, want the 2 that fit", got)
+	}
+
+	bigger, _ := newTestNode("node2", 2, 2048)
+	if err := cm.AddNode(bigger); err != nil {
+		t.Fatal(err)
+	}
+	cm.ReconcileDeployments(ctx)
+	if status, _ := cm.Deployment("api"); status.Ready != 3 {
+		t.Errorf("ready = %d after a node was added, want 3", status.Ready)
+	}
+}
+
+func TestDeploymentIgnoresForeignContainers(t *testing.T) {
+	node, _ := newTestNode("node1", 8, 8192)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+	foreign := []*manager.ContainerInfo{
+		mustSchedule(t, cm, docker.ContainerSpec{Name: "web-0", Image: "nginx", CPU: 1}),
+		mustSchedule(t, cm, docker.ContainerSpec{Name: "web-1", Image: "nginx", CPU: 1, Namespace: "other",
+			Labels: map[string]string{DeploymentLabel: "web"}}),
+	}
+
+	d := Deployment{Name: "web", Template: docker.ContainerSpec{Image: "nginx", CPU: 1}, Replicas: 2}
+	if err := cm.CreateDeployment(ctx, d); err != nil {
+		t.Fatalf("CreateDeployment: %v", err)
+	}
+	if got := deploymentNames(t, cm, "web"); len(got) != 2 || got[0] != "web-2" || got[1] != "web-3" {
+		t.Errorf("replicas = %v, want [web-2 web-3]", got)
+	}
+
+	if err := cm.ScaleDeployment(ctx, "web", 0); err != nil {
+		t.Fatalf("ScaleDeployment: %v", err)
+	}
+	if got := deploymentNames(t, cm, "web"); len(got) != 0 {
+		t.Errorf("replicas = %v after scaling to 0", got)
+	}
+	for _, info := range foreign {
+		if _, err := node.Manager.GetContainerStatus(ctx, info.ID); err != nil {
+			t.Errorf("%s was terminated with the deployment: %v", info.Name, err)
+		}
+	}
+}
+
+func TestDeploymentReplacesFailedReplicas(t *testing.T) {
+	node, rt := newTestNode("node1", 8, 8192)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+
+	template := docker.ContainerSpec{Image: "nginx", CPU: 1,
+		Probe: &docker.Probe{Type: docker.ProbeTCP, Port: 80, FailureThreshold: 1}}
+	if err := cm.CreateDeployment(ctx, Deployment{Name: "web", Template: template, Replicas: 3}); err != nil {
+		t.Fatalf("CreateDeployment: %v", err)
+	}
+	status, _ := cm.Deployment("web")
+	if status.Ready != 3 {
+		t.Fatalf("ready = %d, want 3", status.Ready)
+	}
+	exited, unhealthy, healthy := status.Containers[0], status.Containers[1], status.Containers[2]
+
+	rt.SetExited(exited.ID, 1)
+	node.Manager.RefreshStatuses(ctx)
+	rt.SetProbeResult(unhealthy.ID, docker.ProbeResult{Message: "connection refused"})
+	node.Manager.RunProbes(ctx)
+	if info, _ := node.Manager.GetContainerStatus(ctx, unhealthy.ID); info.Status != manager.StatusUnhealthy {
+		t.Fatalf("status = %q, want unhealthy", info.Status)
+	}
+
+	cm.ReconcileDeployments(ctx)
+
+	status, _ = cm.Deployment("web")
+	if len(status.Containers) != 3 || status.Ready != 3 {
+		t.Fatalf("%d replicas, %d ready; want 3 ready", len(status.Containers), status.Ready)
+	}
+	for _, info := range status.Containers {
+		if info.ID == exited.ID || info.ID == unhealthy.ID {
+			t.Errorf("failed replica %s was kept", info.Name)
+		}
+	}
+	if status.Containers[2].ID != healthy.ID {
+		t.Error("healthy replica was replaced")
+	}
+}
@@ -0,0 +1,160 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"mini-cloud/internal/docker"
+)
+
+// DeploymentStore persists deployments so they survive a restart of the
+// control plane. Save is called with every deployment after each change;
+// implementations must not keep a reference to them.
+type DeploymentStore interface {
+	Load() ([]Deployment, error)
+	Save(deployments []Deployment) error
+}
+
+// FileDeploymentStore keeps deployments as a JSON file
+type FileDeploymentStore struct {
+	Path string
+}
+
+// NewFileDeploymentStore returns a DeploymentStore backed by the JSON file
+// at path
+func NewFileDeploymentStore(path string) *FileDeploymentStore {
+	return &FileDeploymentStore{Path: path}
+}
+
+// Load reads the deployments file. A missing file means no deployments.
+func (s *FileDeploymentStore) Load() ([]Deployment, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deployments: %w", err)
+	}
+
+	var loaded []Deployment
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("failed to parse deployments: %w", err)
+	}
+	return loaded, nil
+}
+
+// Save writes deployments to the file
+func (s *FileDeploymentStore) Save(deployments []Deployment) error {
+	data, err := json.MarshalIndent(deployments, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename so a crash never leaves a truncated file
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// storedDeployment is a Deployment as written to a DeploymentStore. It keeps
+// the revision an interrupted rollout would roll back to.
+type storedDeployment struct {
+	deploymentFields
+	Previous     *storedRevision `json:",omitempty"`
+	LastRevision int
+}
+
+// deploymentFields has the fields of Deployment but not its JSON methods
+type deploymentFields Deployment
+
+type storedRevision struct {
+	Number   int
+	Template docker.ContainerSpec
+}
+
+// MarshalJSON includes the state a restored deployment needs to finish or
+// roll back its rollout
+func (d Deployment) MarshalJSON() ([]byte, error) {
+	stored := storedDeployment{deploymentFields: deploymentFields(d), LastRevision: d.lastRevision}
+	if d.previous != nil {
+		stored.Previous = &storedRevision{Number: d.previous.number, Template: d.previous.template}
+	}
+	return json.Marshal(stored)
+}
+
+// UnmarshalJSON reads a deployment written by MarshalJSON
+func (d *Deployment) UnmarshalJSON(data []byte) error {
+	var stored storedDeployment
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+	*d = Deployment(stored.deploymentFields)
+	d.lastRevision = stored.LastRevision
+	if stored.Previous != nil {
+		d.previous = &revision{number: stored.Previous.Number, template: stored.Previous.Template}
+	}
+	return nil
+}
+
+// SetDeploymentStore persists deployments in store from now on
+func (cm *ClusterManager) SetDeploymentStore(store DeploymentStore) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.deploymentStore = store
+	cm.persistDeploymentsLocked()
+}
+
+// RestoreDeployments adds the deployments saved in store. Their replicas are
+// found again by label; rollouts that were interrupted are resumed.
+func (cm *ClusterManager) RestoreDeployments(store DeploymentStore) error {
+	loaded, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	for i := range loaded {
+		d := &loaded[i]
+		if _, ok := cm.deployments[d.Name]; ok {
+			return fmt.Errorf("%w: %s", ErrDeploymentExists, d.Name)
+		}
+		cm.deployments[d.Name] = d
+		if d.Rollout.State == RolloutProgressing {
+			cm.log.Info("resuming deployment rollout", "deployment", d.Name, "revision", d.Revision)
+			cm.startRolloutLocked(d)
+		}
+	}
+	return nil
+}
+
+// persistDeploymentsLocked saves every deployment to the store, if any.
+// Caller must hold the lock.
+func (cm *ClusterManager) persistDeploymentsLocked() {
+	if cm.deploymentStore == nil {
+		return
+	}
+	out := make([]Deployment, 0, len(cm.deployments))
+	for _, d := range cm.deployments {
+		out = append(out, *d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	if err := cm.deploymentStore.Save(out); err != nil {
+		cm.log.Error("failed to save deployments", "error", err)
+	}
+}
@@ -0,0 +1,69 @@
+package cluster
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mini-cloud/internal/docker"
+)
+
+func TestDeploymentsSurviveRestart(t *testing.T) {
+	node, rt := newTestNode("node1", 8, 8192)
+	store := NewFileDeploymentStore(filepath.Join(t.TempDir(), "deployments.json"))
+	cm := newTestCluster(node)
+	cm.SetDeploymentStore(store)
+	ctx := context.Background()
+	if err := cm.CreateDeployment(ctx, Deployment{Name: "web", Template: docker.ContainerSpec{Image: "nginx:1", CPU: 1}, Replicas: 2}); err != nil {
+		t.Fatalf("CreateDeployment: %v", err)
+	}
+
+	// Interrupt a rollout by shutting down while its new replica is pulled
+	pulling := make(chan struct{}, 1)
+	rt.SetHook(func(ctx context.Context, op, arg string) error {
+		if op == "PullImage" && arg == "nginx:2" {
+			pulling <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+	if _, err := cm.UpdateDeployment(ctx, "web", docker.ContainerSpec{Image: "nginx:2", CPU: 1}, RolloutStrategy{}); err != nil {
+		t.Fatalf("UpdateDeployment: %v", err)
+	}
+	<-pulling
+	sctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err := cm.Shutdown(sctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	rt.SetHook(nil)
+
+	restarted := newTestCluster(node)
+	if err := restarted.RestoreDeployments(store); err != nil {
+		t.Fatalf("RestoreDeployments: %v", err)
+	}
+	if got := waitRollout(t, restarted, "web"); got.State != RolloutComplete {
+		t.Fatalf("resumed rollout = %+v, want complete", got)
+	}
+	status, _ := restarted.Deployment("web")
+	if len(status.Containers) != 2 || status.Revision != 2 {
+		t.Fatalf("%d replicas at revision %d, want 2 at revision 2", len(status.Containers), status.Revision)
+	}
+	for _, info := range status.Containers {
+		if info.Image != "nginx:2" {
+			t.Errorf("%s runs %s after the resumed rollout", info.Name, info.Image)
+		}
+	}
+
+	// The revision counter is restored too, so revisions are not reused
+	restarted.SetDeploymentStore(store)
+	if rev, err := restarted.UpdateDeployment(ctx, "web", docker.ContainerSpec{Image: "nginx:3", CPU: 1}, RolloutStrategy{}); err != nil || rev != 3 {
+		t.Errorf("UpdateDeployment after restart = %d, %v; want revision 3", rev, err)
+	}
+	waitRollout(t, restarted, "web")
+	if loaded, err := store.Load(); err != nil || len(loaded) != 1 || loaded[0].Template.Image != "nginx:3" {
+		t.Errorf("stored deployments %+v, %v; want web at nginx:3", loaded, err)
+	}
+}
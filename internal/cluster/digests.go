@@ -0,0 +1,71 @@
+package cluster
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mini-cloud/internal/docker"
+)
+
+// ErrImageNotAllowed is returned for images whose digest is not allowlisted
+var ErrImageNotAllowed = errors.New("image digest not allowed")
+
+// digestTimeout bounds looking up the digest of a pulled image
+const digestTimeout = 10 * time.Second
+
+// SetImageDigestAllowlist only lets containers run images with one of the
+// given digests, e.g. "sha256:...". An empty list allows every image.
+func (cm *ClusterManager) SetImageDigestAllowlist(digests []string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cm.digests = nil
+	if len(digests) == 0 {
+		return
+	}
+	cm.digests = make(map[string]bool, len(digests))
+	for _, d := range digests {
+		cm.digests[d] = true
+	}
+}
+
+// pinImage fills in the digest of spec's image, as pulled on node, so that
+// the container and any replacement for it run exactly that image
+func (cm *ClusterManager) pinImage(ctx context.Context, node *Node, spec docker.ContainerSpec) (docker.ContainerSpec, error) {
+	if spec.ImageDigest == "" {
+		spec.ImageDigest = docker.RefDigest(spec.Image)
+	}
+	if spec.ImageDigest == "" {
+		dctx, cancel := context.WithTimeout(ctx, digestTimeout)
+		digest, err := node.Docker.ImageDigest(dctx, spec.Image)
+		cancel()
+		if err != nil {
+			return spec, fmt.Errorf("failed to resolve image digest: %w", err)
+		}
+		spec.ImageDigest = digest
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.digests != nil && !cm.digests[spec.ImageDigest] {
+		if spec.ImageDigest == "" {
+			return spec, fmt.Errorf("%w: %s has no registry digest", ErrImageNotAllowed, spec.Image)
+		}
+		return spec, fmt.Errorf("%w: %s resolved to %s", ErrImageNotAllowed, spec.Image, spec.ImageDigest)
+	}
+	return spec, nil
+}
+
+// checkDigestLocked rejects specs pinned to a digest that isn't allowlisted
+// before anything is reserved for them. Digests only known once the image is
+// pulled are checked by pinImage. Caller must hold the lock.
+func (cm *ClusterManager) checkDigestLocked(spec docker.ContainerSpec) error {
+	digest := cmp.Or(spec.ImageDigest, docker.RefDigest(spec.Image))
+	if cm.digests == nil || digest == "" || cm.digests[digest] {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrImageNotAllowed, digest)
+}
@@ -0,0 +1,64 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"mini-cloud/internal/docker"
+)
+
+const (
+	digestA = "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	digestB = "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+)
+
+func TestPinImageDigest(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	rt.SetImageDigest("nginx", digestA)
+
+	info := mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 0.5})
+	if info.ImageDigest != digestA {
+		t.Errorf("container pinned to %q, want %s", info.ImageDigest, digestA)
+	}
+	c, _ := rt.Container(info.ID)
+	if want := "nginx@" + digestA; c.Spec.PinnedImage() != want {
+		t.Errorf("container created from %q, want %q", c.Spec.PinnedImage(), want)
+	}
+
+	// Images without a registry digest run unpinned
+	info = mustSchedule(t, cm, docker.ContainerSpec{Name: "local", Image: "dev/app", CPU: 0.5})
+	if info.ImageDigest != "" {
+		t.Errorf("local image pinned to %q", info.ImageDigest)
+	}
+}
+
+func TestImageDigestAllowlist(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+	cm.SetImageDigestAllowlist([]string{digestA})
+	rt.SetImageDigest("nginx", digestA)
+	rt.SetImageDigest("redis", digestB)
+
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 0.5})
+	if _, err := cm.Schedule(ctx, docker.ContainerSpec{Name: "cache", Image: "redis", CPU: 0.5}); !errors.Is(err, ErrImageNotAllowed) {
+		t.Errorf("image resolving to another digest: err = %v, want ErrImageNotAllowed", err)
+	}
+	if _, err := cm.Schedule(ctx, docker.ContainerSpec{Name: "pinned", Image: "redis@" + digestB, CPU: 0.5}); !errors.Is(err, ErrImageNotAllowed) {
+		t.Errorf("image pinned to another digest: err = %v, want ErrImageNotAllowed", err)
+	}
+	if _, err := cm.Schedule(ctx, docker.ContainerSpec{Name: "local", Image: "dev/app", CPU: 0.5}); !errors.Is(err, ErrImageNotAllowed) {
+		t.Errorf("image without a digest: err = %v, want ErrImageNotAllowed", err)
+	}
+	if used := node.Resources.Usage().CPU; used != 0.5 {
+		t.Errorf("%g cores reserved, want only web's", used)
+	}
+	if got := rt.Calls("PullImage"); got != 3 {
+		t.Errorf("%d pulls, want 3 with the pinned image rejected before pulling", got)
+	}
+
+	cm.SetImageDigestAllowlist(nil)
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "cache", Image: "redis", CPU: 0.5})
+}
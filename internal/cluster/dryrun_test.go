@@ -0,0 +1,60 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/manager"
+)
+
+func TestDryRunMatchesSchedule(t *testing.T) {
+	small, rtSmall := newTestNode("small", 2, 2048)
+	large, rtLarge := newTestNode("large", 8, 8192)
+	cm := newTestCluster(small, large)
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1, Memory: 512})
+
+	for _, spec := range []docker.ContainerSpec{
+		{Name: "a", Image: "nginx", CPU: 0.5, Memory: 256},
+		{Name: "b", Image: "nginx", CPU: 4, Memory: 1024},
+		{Name: "c", Image: "nginx", CPU: 1, Memory: 1024},
+	} {
+		created := rtSmall.Calls("CreateContainer") + rtLarge.Calls("CreateContainer")
+		cpu := small.Resources.AllocatedCPUSum() + large.Resources.AllocatedCPUSum()
+
+		nodeID, err := cm.DryRunSchedule(spec)
+		if err != nil {
+			t.Fatalf("DryRunSchedule(%s): %v", spec.Name, err)
+		}
+		if n := rtSmall.Calls("CreateContainer") + rtLarge.Calls("CreateContainer"); n != created {
+			t.Errorf("%s: dry run created a container", spec.Name)
+		}
+		if got := small.Resources.AllocatedCPUSum() + large.Resources.AllocatedCPUSum(); got != cpu {
+			t.Errorf("%s: dry run changed reserved CPU from %v to %v", spec.Name, cpu, got)
+		}
+		if _, taken := cm.pending[spec.Name]; taken || cm.nameInUse(spec.Name) {
+			t.Errorf("%s: dry run left the name taken", spec.Name)
+		}
+
+		if info := mustSchedule(t, cm, spec); info.NodeID != nodeID {
+			t.Errorf("%s: dry run picked %s, Schedule placed it on %s", spec.Name, nodeID, info.NodeID)
+		}
+	}
+}
+
+func TestDryRunRejects(t *testing.T) {
+	node, _ := newTestNode("node1", 2, 2048)
+	cm := newTestCluster(node)
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+
+	if _, err := cm.DryRunSchedule(docker.ContainerSpec{Name: "big", Image: "nginx", CPU: 4}); !errors.Is(err, ErrInsufficientCapacity) {
+		t.Errorf("too big: err = %v, want ErrInsufficientCapacity", err)
+	}
+	if _, err := cm.DryRunSchedule(docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 0.5}); !errors.Is(err, manager.ErrNameConflict) {
+		t.Errorf("name taken: err = %v, want ErrNameConflict", err)
+	}
+	if _, err := cm.Schedule(context.Background(), docker.ContainerSpec{Name: "big", Image: "nginx", CPU: 4}); !errors.Is(err, ErrInsufficientCapacity) {
+		t.Errorf("Schedule disagrees with the dry run: err = %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// failedRemoveTimeout bounds the best-effort removal of containers left on a failed node
+const failedRemoveTimeout = 5 * time.Second
+
+// HandleNodeFailure marks nodeID unhealthy and reschedules every container
+// assigned to it onto the remaining healthy nodes. Containers whose TTL has
+// already elapsed are dropped instead. Rescheduled containers keep their name
+// and remaining TTL but get a new container ID.
+func (cm *ClusterManager) HandleNodeFailure(ctx context.Context, nodeID string) error {
+	cm.mu.Lock()
+	node, ok := cm.nodes[nodeID]
+	if !ok {
+		cm.mu.Unlock()
+		return fmt.Errorf("node %s not found", nodeID)
+	}
+	node.Healthy = false
+	ids := cm.assignedLocked(nodeID)
+	cm.mu.Unlock()
+
+	var errs []error
+	for _, id := range ids {
+		info, ok := node.Manager.Forget(id)
+
+		cm.mu.Lock()
+		spec, hasSpec := cm.specs[id]
+		cm.untrackLocked(id)
+		cm.mu.Unlock()
+
+		if !ok {
+			continue // already gone, e.g. expired
+		}
+		if !hasSpec {
+			spec = info.Spec()
+		}
+
+		// The daemon is probably down, but if it comes back the old copy must not linger
+		removeCtx, cancel := context.WithTimeout(ctx, failedRemoveTimeout)
+		_ = node.Docker.RemoveContainer(removeCtx, id)
+		cancel()
+
+		if info.TTL > 0 {
+			remaining := time.Until(info.CreatedAt.Add(info.TTL))
+			if remaining <= 0 {
+				continue
+			}
+			spec.TTL = remaining
+		}
+
+		moved, err := cm.Schedule(ctx, spec)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reschedule %s (%s): %w", info.Name, id, err))
+			continue
+		}
+		cm.log.Info("rescheduled container off failed node", "name", info.Name, "old_container_id", id, "container_id", moved.ID, "from_node_id", nodeID, "node_id", cm.assignmentOf(moved.ID))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,54 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mini-cloud/internal/docker"
+)
+
+func TestHandleNodeFailure(t *testing.T) {
+	failed, failedRT := newTestNode("failed", 4, 4096)
+	survivor, survivorRT := newTestNode("survivor", 4, 4096)
+	cm := newTestCluster(failed, survivor)
+	ctx := context.Background()
+	survivor.Healthy = false // make sure the containers start on the other node
+	web := mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1, TTL: time.Hour})
+	survivor.Healthy = true
+	if web.NodeID != "failed" {
+		t.Fatalf("web scheduled on %s", web.NodeID)
+	}
+
+	if err := cm.HandleNodeFailure(ctx, "failed"); err != nil {
+		t.Fatalf("HandleNodeFailure: %v", err)
+	}
+
+	if cm.assignmentOf(web.ID) != "" {
+		t.Error("the old container is still tracked")
+	}
+	if _, ok := failedRT.Container(web.ID); ok {
+		t.Error("the old container was not removed from the failed node")
+	}
+	moved, ok := survivor.Manager.FindByName("web")
+	if !ok {
+		t.Fatal("web did not reappear on the surviving node")
+	}
+	if cm.assignmentOf(moved.ID) != "survivor" || survivorRT.Running() != 1 {
+		t.Errorf("web assigned to %q with %d running on survivor", cm.assignmentOf(moved.ID), survivorRT.Running())
+	}
+	if moved.TTL <= 0 || moved.TTL > time.Hour {
+		t.Errorf("rescheduled TTL = %v, want what was left of 1h", moved.TTL)
+	}
+	if got := failed.Resources.AllocatedCPUSum(); got != 0 {
+		t.Errorf("failed node still reserves %v CPU", got)
+	}
+}
+
+func TestHandleNodeFailureUnknownNode(t *testing.T) {
+	node, _ := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	if err := cm.HandleNodeFailure(context.Background(), "nope"); err == nil {
+		t.Error("no error for an unknown node")
+	}
+}
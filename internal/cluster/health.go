@@ -0,0 +1,181 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mini-cloud/internal/events"
+	"mini-cloud/internal/resourcemanager"
+)
+
+// healthCheckTimeout bounds a single ping of a node's Docker daemon
+const healthCheckTimeout = 5 * time.Second
+
+// NodeStatus is a point-in-time view of a node's health and capacity
+type NodeStatus struct {
+	ID       string
+	Labels   map[string]string
+	Healthy  bool
+	Draining bool
+
+	LastHeartbeat    time.Time
+	MissedHeartbeats int
+
+	Capacity  resourcemanager.ResourceSpec
+	Allocated resourcemanager.ResourceSpec
+	Usage     *NodeUsage // measured usage, nil until sampled
+}
+
+// NodeStatuses returns the status of every node sorted by ID
+func (cm *ClusterManager) NodeStatuses() []NodeStatus {
+	nodes := cm.Nodes()
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	statuses := make([]NodeStatus, 0, len(nodes))
+	for _, node := range nodes {
+		statuses = append(statuses, NodeStatus{
+			ID:       node.ID,
+			Labels:   node.Labels,
+			Healthy:  node.Healthy,
+			Draining: node.Draining,
+
+			LastHeartbeat:    node.LastHeartbeat,
+			MissedHeartbeats: node.MissedHeartbeats,
+			Capacity: resourcemanager.ResourceSpec{
+				CPU:    node.Resources.SchedulableCPU(),
+				Memory: node.Resources.SchedulableMemory(),
+				GPU:    node.Resources.TotalGPU,
+				DiskMB: node.Resources.TotalDisk,
+			},
+			Allocated: node.Resources.Usage(),
+		})
+		if u, ok := cm.usage[node.ID]; ok {
+			statuses[len(statuses)-1].Usage = &u
+		}
+	}
+	return statuses
+}
+
+// ClusterSummary aggregates capacity and usage across every node
+type ClusterSummary struct {
+	Nodes        int
+	HealthyNodes int
+	Containers   int
+	Capacity     resourcemanager.ResourceSpec
+	Allocated    resourcemanager.ResourceSpec
+}
+
+// Summary sums capacity, allocations and containers over all nodes
+func (cm *ClusterManager) Summary() ClusterSummary {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	var s ClusterSummary
+	for _, node := range cm.nodes {
+		s.Nodes++
+		if node.Healthy {
+			s.HealthyNodes++
+		}
+		s.Capacity.CPU += node.Resources.SchedulableCPU()
+		s.Capacity.Memory += node.Resources.SchedulableMemory()
+		s.Capacity.GPU += node.Resources.TotalGPU
+		s.Capacity.DiskMB += node.Resources.TotalDisk
+
+		used := node.Resources.Usage()
+		s.Allocated.CPU += used.CPU
+		s.Allocated.Memory += used.Memory
+		s.Allocated.GPU += used.GPU
+		s.Allocated.DiskMB += used.DiskMB
+
+		containers, _ := node.Manager.ListActiveContainers(context.Background())
+		s.Containers += len(containers)
+	}
+	return s
+}
+
+// ErrNodeNotFound is returned for node IDs that are not part of the cluster
+var ErrNodeNotFound = errors.New("node not found")
+
+// NodeAllocations returns the resources reserved on a node, keyed by reservation ID
+func (cm *ClusterManager) NodeAllocations(nodeID string) (map[string]resourcemanager.ResourceSpec, error) {
+	cm.mu.Lock()
+	node, ok := cm.nodes[nodeID]
+	cm.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
+	}
+	return node.Resources.Allocations(), nil
+}
+
+// DefaultMaxMissedHeartbeats is how many heartbeats in a row a node may miss
+// before it is marked NotReady
+const DefaultMaxMissedHeartbeats = 3
+
+// SetMaxMissedHeartbeats sets how many heartbeats in a row a node may miss
+// before it is marked unhealthy; values below 1 are treated as 1
+func (cm *ClusterManager) SetMaxMissedHeartbeats(n int) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.maxMissedHeartbeats = max(n, 1)
+}
+
+// CheckHealth pings every node's Docker daemon or agent. A node that misses
+// too many heartbeats in a row is marked unhealthy (NotReady) so the scheduler
+// skips it, and its containers are rescheduled elsewhere. One successful ping
+// makes it healthy again.
+func (cm *ClusterManager) CheckHealth(ctx context.Context) {
+	for _, node := range cm.Nodes() {
+		pingCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		err := node.Docker.Ping(pingCtx)
+		cancel()
+
+		cm.mu.Lock()
+		failed := false
+		if err == nil {
+			if !node.Healthy {
+				cm.log.Info("node is healthy again", "node_id", node.ID)
+				cm.events.Publish(events.Event{Type: events.NodeUp, NodeID: node.ID})
+			}
+			node.Healthy = true
+			node.LastHeartbeat = time.Now()
+			node.MissedHeartbeats = 0
+		} else {
+			node.MissedHeartbeats++
+			cm.log.Debug("node missed heartbeat", "node_id", node.ID, "missed", node.MissedHeartbeats, "error", err)
+			if node.Healthy && node.MissedHeartbeats >= cm.maxMissedHeartbeats {
+				node.Healthy = false
+				failed = true
+			}
+		}
+		cm.mu.Unlock()
+
+		if failed {
+			cm.log.Warn("node is unhealthy", "node_id", node.ID, "error", err)
+			cm.events.Publish(events.Event{Type: events.NodeDown, NodeID: node.ID, Message: err.Error()})
+			if err := cm.HandleNodeFailure(ctx, node.ID); err != nil {
+				cm.log.Error("failed to reschedule containers off failed node", "node_id", node.ID, "error", err)
+			}
+		}
+	}
+}
+
+// StartHealthCheckLoop sends a heartbeat to every node each interval
+func (cm *ClusterManager) StartHealthCheckLoop(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				cm.CheckHealth(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
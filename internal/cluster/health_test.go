@@ -0,0 +1,101 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/docker/dockertest"
+	"mini-cloud/internal/events"
+)
+
+// healthOf returns whether node id is healthy according to NodeStatuses
+func healthOf(t *testing.T, cm *ClusterManager, id string) bool {
+	t.Helper()
+	for _, s := range cm.NodeStatuses() {
+		if s.ID == id {
+			return s.Healthy
+		}
+	}
+	t.Fatalf("node %s not listed", id)
+	return false
+}
+
+func TestCheckHealthExcludesFailedNode(t *testing.T) {
+	down, downRT := newTestNode("down", 8, 8192)
+	up, _ := newTestNode("up", 4, 4096)
+	cm := newTestCluster(down, up)
+	ctx := context.Background()
+
+	downRT.SetPingError(dockertest.ErrInjected)
+	cm.CheckHealth(ctx)
+	if !healthOf(t, cm, "down") {
+		t.Fatal("node marked unhealthy after one missed heartbeat")
+	}
+	cm.CheckHealth(ctx)
+	cm.CheckHealth(ctx)
+	if healthOf(t, cm, "down") {
+		t.Fatalf("node healthy after %d missed heartbeats", DefaultMaxMissedHeartbeats)
+	}
+	if !healthOf(t, cm, "up") {
+		t.Error("the reachable node was marked unhealthy")
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		if info := mustSchedule(t, cm, docker.ContainerSpec{Name: name, Image: "nginx", CPU: 1}); info.NodeID != "up" {
+			t.Errorf("%s scheduled on %s, want up", name, info.NodeID)
+		}
+	}
+
+	downRT.SetPingError(nil)
+	cm.CheckHealth(ctx)
+	if !healthOf(t, cm, "down") {
+		t.Error("node still unhealthy after a successful ping")
+	}
+}
+
+func TestSummary(t *testing.T) {
+	small, _ := newTestNode("small", 4, 4096)
+	large, _ := newTestNode("large", 8, 8192)
+	cm := newTestCluster(small, large)
+
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 2, Memory: 1024})
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "db", Image: "postgres", CPU: 1, Memory: 2048})
+
+	sum := cm.Summary()
+	if sum.Nodes != 2 || sum.HealthyNodes != 2 || sum.Containers != 2 {
+		t.Errorf("%d nodes, %d healthy, %d containers; want 2, 2, 2", sum.Nodes, sum.HealthyNodes, sum.Containers)
+	}
+	if sum.Capacity.CPU != 12 || sum.Capacity.Memory != 12288 {
+		t.Errorf("capacity %v CPU, %v MB; want 12 and 12288", sum.Capacity.CPU, sum.Capacity.Memory)
+	}
+	if sum.Allocated.CPU != 3 || sum.Allocated.Memory != 3072 {
+		t.Errorf("allocated %v CPU, %v MB; want 3 and 3072", sum.Allocated.CPU, sum.Allocated.Memory)
+	}
+}
+
+func TestCheckHealthPublishesNodeEvents(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	cm.SetMaxMissedHeartbeats(1)
+	sub := cm.Subscribe()
+	defer cm.Unsubscribe(sub)
+	ctx := context.Background()
+
+	rt.SetPingError(dockertest.ErrInjected)
+	cm.CheckHealth(ctx)
+	rt.SetPingError(nil)
+	cm.CheckHealth(ctx)
+
+	for _, want := range []events.Type{events.NodeDown, events.NodeUp} {
+		select {
+		case e := <-sub:
+			if e.Type != want || e.NodeID != "node1" {
+				t.Errorf("received %+v, want %s for node1", e, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %s event received", want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package cluster
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"path"
+	"slices"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+
+	"mini-cloud/internal/docker"
+)
+
+// ImageGCPolicy decides which unused images are removed from the nodes.
+// Images a tracked or pending container refers to are always kept.
+type ImageGCPolicy struct {
+	// IdlePeriod removes images unused for this long; 0 keeps idle images
+	IdlePeriod time.Duration
+	// DiskThreshold removes the least recently used images while the images
+	// on a node take up more than this fraction of its disk; 0 disables it
+	DiskThreshold float64
+	// Keep lists images never removed, e.g. "nginx:1.27", "nginx" for every
+	// tag or "registry.example.com/base/*"
+	Keep []string
+}
+
+// Validate checks the period and threshold are in range
+func (p ImageGCPolicy) Validate() error {
+	switch {
+	case p.IdlePeriod < 0:
+		return errors.New("image GC idle period must not be negative")
+	case p.DiskThreshold < 0 || p.DiskThreshold > 1:
+		return errors.New("image GC disk threshold must be between 0 and 1")
+	}
+	for _, pattern := range p.Keep {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.New("image GC keep pattern " + pattern + " is malformed")
+		}
+	}
+	return nil
+}
+
+// keeps reports whether ref matches one of the Keep patterns. Patterns
+// without a tag match every tag.
+func (p ImageGCPolicy) keeps(ref string) bool {
+	for _, pattern := range p.Keep {
+		if ok, _ := path.Match(docker.NormalizeImage(pattern), ref); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern+":*", ref); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SetImageGCPolicy sets which images CollectImages removes
+func (cm *ClusterManager) SetImageGCPolicy(p ImageGCPolicy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.imageGC = p
+	return nil
+}
+
+// imageGroup is the references of one image on a node, removed together
+type imageGroup struct {
+	id        string
+	refs      []string
+	sizeBytes int64
+	lastUsed  time.Time
+}
+
+// imageRemoveTimeout bounds removing one image reference
+const imageRemoveTimeout = 30 * time.Second
+
+// CollectImages removes the images no container on a node uses that have
+// been idle longer than the policy allows, then the least recently used ones
+// while the node's images exceed the disk threshold. The cached image list
+// should be synced first.
+func (cm *ClusterManager) CollectImages(ctx context.Context) {
+	for _, node := range cm.Nodes() {
+		groups, excess := cm.imageCandidates(ctx, node)
+		cm.mu.Lock()
+		idle := cm.imageGC.IdlePeriod
+		cm.mu.Unlock()
+
+		for _, g := range groups {
+			expired := idle > 0 && time.Since(g.lastUsed) > idle
+			if !expired && excess <= 0 {
+				break
+			}
+			if err := cm.removeImage(ctx, node, g); err != nil {
+				cm.log.Warn("failed to remove unused image", "node_id", node.ID, "image", g.refs[0], "error", err)
+				continue
+			}
+			excess -= g.sizeBytes
+			reason := "idle"
+			if !expired {
+				reason = "disk threshold"
+			}
+			cm.log.Info("removed unused image", "node_id", node.ID, "image", g.refs[0], "reason", reason)
+		}
+	}
+}
+
+// imageCandidates returns the images on node that may be removed, least
+// recently used first, and how many bytes the node's images exceed the disk
+// threshold by
+func (cm *ClusterManager) imageCandidates(ctx context.Context, node *Node) ([]imageGroup, int64) {
+	containers, _ := node.Manager.ListActiveContainers(ctx)
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if !node.Healthy {
+		return nil, 0
+	}
+
+	inUse := make(map[string]bool)
+	for _, info := range containers {
+		inUse[docker.NormalizeImage(info.Image)] = true
+		inUse[docker.NormalizeImage(docker.PinImage(info.Image, info.ImageDigest))] = true
+	}
+	for _, p := range cm.pending {
+		if p.nodeID == node.ID {
+			inUse[docker.NormalizeImage(p.spec.Image)] = true
+		}
+	}
+
+	now := time.Now()
+	byID := make(map[string]*imageGroup)
+	keep := make(map[string]bool)
+	for key, img := range cm.images {
+		if key.node != node.ID || img.ID == "" {
+			continue
+		}
+		if inUse[key.image] {
+			img.LastUsed = now
+		}
+		if inUse[key.image] || cm.imageGC.keeps(key.image) {
+			keep[img.ID] = true
+		}
+		g, ok := byID[img.ID]
+		if !ok {
+			g = &imageGroup{id: img.ID, sizeBytes: img.SizeBytes}
+			byID[img.ID] = g
+		}
+		g.refs = append(g.refs, key.image)
+		if img.LastUsed.After(g.lastUsed) {
+			g.lastUsed = img.LastUsed
+		}
+	}
+
+	var total int64
+	var groups []imageGroup
+	for id, g := range byID {
+		total += g.sizeBytes
+		if !keep[id] {
+			slices.Sort(g.refs)
+			groups = append(groups, *g)
+		}
+	}
+	slices.SortFunc(groups, func(a, b imageGroup) int {
+		return cmp.Or(a.lastUsed.Compare(b.lastUsed), cmp.Compare(a.id, b.id))
+	})
+
+	var excess int64
+	if t := cm.imageGC.DiskThreshold; t > 0 && node.Resources.TotalDisk > 0 {
+		excess = total - int64(t*float64(node.Resources.TotalDisk)*1024*1024)
+	}
+	return groups, excess
+}
+
+// removeImage removes every reference of an image from node and forgets them
+func (cm *ClusterManager) removeImage(ctx context.Context, node *Node, g imageGroup) error {
+	for _, ref := range g.refs {
+		rctx, cancel := context.WithTimeout(ctx, imageRemoveTimeout)
+		err := node.Docker.RemoveImage(rctx, ref)
+		cancel()
+		if cerrdefs.IsConflict(err) {
+			return errors.New("in use by a container the cluster doesn't track")
+		}
+		if err != nil {
+			return err
+		}
+		cm.mu.Lock()
+		delete(cm.images, imageKey{node.ID, ref})
+		cm.mu.Unlock()
+	}
+	return nil
+}
+
+// StartImageGCLoop syncs the nodes' images and collects unused ones every interval
+func (cm *ClusterManager) StartImageGCLoop(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				cm.SyncImages(ctx)
+				cm.CollectImages(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
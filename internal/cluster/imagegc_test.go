@@ -0,0 +1,95 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mini-cloud/internal/docker"
+)
+
+func TestImageGCPolicyKeeps(t *testing.T) {
+	p := ImageGCPolicy{Keep: []string{"nginx", "redis:7", "registry.example.com/base/*"}}
+	tests := map[string]bool{
+		"nginx:latest":                      true,
+		"nginx:1.27":                        true,
+		"redis:7":                           true,
+		"redis:6":                           false,
+		"registry.example.com/base/go:1.24": true,
+		"registry.example.com/apps/web:1":   false,
+	}
+	for ref, want := range tests {
+		if got := p.keeps(ref); got != want {
+			t.Errorf("keeps(%q) = %v, want %v", ref, got, want)
+		}
+	}
+	if err := (ImageGCPolicy{Keep: []string{"["}}).Validate(); err == nil {
+		t.Error("malformed keep pattern accepted")
+	}
+	if err := (ImageGCPolicy{DiskThreshold: 1.5}).Validate(); err == nil {
+		t.Error("disk threshold above 1 accepted")
+	}
+}
+
+func TestCollectImages(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+	if err := cm.SetImageGCPolicy(ImageGCPolicy{IdlePeriod: time.Hour, Keep: []string{"busybox"}}); err != nil {
+		t.Fatalf("SetImageGCPolicy: %v", err)
+	}
+
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 0.5})
+	rt.AddImage(docker.Image{ID: "sha256:pg", Tags: []string{"postgres:16", "postgres:latest"}})
+	rt.AddImage(docker.Image{ID: "sha256:bb", Tags: []string{"busybox:latest"}})
+	rt.AddImage(docker.Image{ID: "sha256:rd", Tags: []string{"redis:7"}})
+	cm.SyncImages(ctx)
+
+	// Everything but redis has been idle for a day
+	cm.mu.Lock()
+	for key, img := range cm.images {
+		if key.image != "redis:7" {
+			img.LastUsed = time.Now().Add(-24 * time.Hour)
+		}
+	}
+	cm.mu.Unlock()
+
+	cm.CollectImages(ctx)
+	for image, want := range map[string]bool{
+		"nginx":           true, // used by web
+		"busybox":         true, // kept by the policy
+		"redis:7":         true, // recently used
+		"postgres:16":     false,
+		"postgres:latest": false,
+	} {
+		if got := rt.HasImage(image); got != want {
+			t.Errorf("%s present = %v after collection, want %v", image, got, want)
+		}
+	}
+	if imgs := cm.Images(ImageFilter{Image: "postgres:16"}); len(imgs) != 0 {
+		t.Errorf("removed image still cached: %+v", imgs)
+	}
+}
+
+func TestCollectImagesOverDiskThreshold(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	node.Resources.TotalDisk = 1 // MB
+	cm := newTestCluster(node)
+	ctx := context.Background()
+	if err := cm.SetImageGCPolicy(ImageGCPolicy{DiskThreshold: 0.5}); err != nil {
+		t.Fatalf("SetImageGCPolicy: %v", err)
+	}
+
+	rt.AddImage(docker.Image{ID: "sha256:old", Tags: []string{"old:1"}, SizeBytes: 400_000})
+	rt.AddImage(docker.Image{ID: "sha256:new", Tags: []string{"new:1"}, SizeBytes: 300_000})
+	cm.SyncImages(ctx)
+	cm.mu.Lock()
+	cm.images[imageKey{"node1", "old:1"}].LastUsed = time.Now().Add(-time.Minute)
+	cm.mu.Unlock()
+
+	// Removing the least recently used image brings the node under 512KiB
+	cm.CollectImages(ctx)
+	if rt.HasImage("old:1") || !rt.HasImage("new:1") {
+		t.Errorf("old present = %v, new present = %v; want only the older image removed", rt.HasImage("old:1"), rt.HasImage("new:1"))
+	}
+}
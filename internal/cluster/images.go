@@ -0,0 +1,208 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"mini-cloud/internal/docker"
+)
+
+// CachedImage is an image present on a node
+type CachedImage struct {
+	NodeID    string
+	Image     string // as listed by Docker, e.g. "nginx:latest"
+	ID        string // empty until the node's images are synced
+	SizeBytes int64
+	PulledAt  time.Time // last pull through the cluster, zero if only found on the node
+	LastUsed  time.Time // last pulled or seen in use by a container, or first seen
+}
+
+// imageKey identifies an image reference on a node
+type imageKey struct {
+	node  string
+	image string
+}
+
+// ImageFilter selects images in Images. Zero values match everything.
+type ImageFilter struct {
+	Node  string
+	Image string
+}
+
+// PrepullTarget selects the nodes Prepull pulls on. Zero values match every node.
+type PrepullTarget struct {
+	Nodes    []string          // node IDs
+	Selector map[string]string // only nodes carrying all these labels
+}
+
+// ErrNoMatchingNode is returned when a pre-pull's target matches no node
+var ErrNoMatchingNode = errors.New("no node matches the selector")
+
+// PrepullResult is the outcome of a pre-pull on one node
+type PrepullResult struct {
+	NodeID string
+	Err    error
+}
+
+// Prepull pulls image on every node matching target at once, so containers
+// later scheduled there don't wait for the pull. Unhealthy or draining nodes
+// are reported as failed without being asked.
+func (cm *ClusterManager) Prepull(ctx context.Context, image string, auth *docker.RegistryAuth, target PrepullTarget) ([]PrepullResult, error) {
+	cm.mu.Lock()
+	var nodes []*Node
+	if len(target.Nodes) > 0 {
+		for _, id := range target.Nodes {
+			node, ok := cm.nodes[id]
+			if !ok {
+				cm.mu.Unlock()
+				return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, id)
+			}
+			nodes = append(nodes, node)
+		}
+	} else {
+		for _, node := range cm.nodes {
+			nodes = append(nodes, node)
+		}
+	}
+	results := make([]PrepullResult, 0, len(nodes))
+	var pull []*Node
+	for _, node := range nodes {
+		switch {
+		case !node.MatchesSelector(target.Selector):
+			continue
+		case !node.schedulable():
+			results = append(results, PrepullResult{NodeID: node.ID, Err: fmt.Errorf("node %s is not schedulable", node.ID)})
+		default:
+			pull = append(pull, node)
+		}
+	}
+	cm.mu.Unlock()
+	if len(results) == 0 && len(pull) == 0 {
+		return nil, ErrNoMatchingNode
+	}
+
+	spec := docker.ContainerSpec{Image: image, RegistryAuth: auth}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, node := range pull {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := cm.pullImage(ctx, node, spec)
+			mu.Lock()
+			results = append(results, PrepullResult{NodeID: node.ID, Err: err})
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].NodeID < results[j].NodeID })
+	cm.log.Info("image pre-pulled", "image", image, "nodes", len(results))
+	return results, nil
+}
+
+// recordPull notes that image was just pulled on nodeID
+func (cm *ClusterManager) recordPull(nodeID, image string) {
+	key := imageKey{nodeID, docker.NormalizeImage(image)}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	img, ok := cm.images[key]
+	if !ok {
+		img = &CachedImage{NodeID: nodeID, Image: key.image}
+		cm.images[key] = img
+	}
+	img.PulledAt = time.Now()
+	img.LastUsed = img.PulledAt
+}
+
+// Images lists the images cached on the nodes matching filter, sorted by
+// node and image
+func (cm *ClusterManager) Images(filter ImageFilter) []CachedImage {
+	want := ""
+	if filter.Image != "" {
+		want = docker.NormalizeImage(filter.Image)
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	var out []CachedImage
+	for key, img := range cm.images {
+		if (filter.Node != "" && filter.Node != key.node) || (want != "" && want != key.image) {
+			continue
+		}
+		out = append(out, *img)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].NodeID != out[j].NodeID {
+			return out[i].NodeID < out[j].NodeID
+		}
+		return out[i].Image < out[j].Image
+	})
+	return out
+}
+
+// imageSyncTimeout bounds listing one node's images
+const imageSyncTimeout = 10 * time.Second
+
+// SyncImages reloads the images cached on every node from its runtime.
+// Nodes that can't be asked keep what is known.
+func (cm *ClusterManager) SyncImages(ctx context.Context) {
+	for _, node := range cm.Nodes() {
+		listCtx, cancel := context.WithTimeout(ctx, imageSyncTimeout)
+		images, err := node.Docker.ListImages(listCtx)
+		cancel()
+		if err != nil {
+			cm.log.Warn("failed to list images", "node_id", node.ID, "error", err)
+			continue
+		}
+
+		cm.mu.Lock()
+		seen := make(map[string]bool)
+		for _, di := range images {
+			for _, ref := range slices.Concat(di.Tags, di.Digests) {
+				if ref == "<none>:<none>" || ref == "<none>@<none>" {
+					continue
+				}
+				seen[ref] = true
+				key := imageKey{node.ID, ref}
+				img, ok := cm.images[key]
+				if !ok {
+					img = &CachedImage{NodeID: node.ID, Image: ref, LastUsed: time.Now()}
+					cm.images[key] = img
+				}
+				img.ID, img.SizeBytes = di.ID, di.SizeBytes
+			}
+		}
+		for key := range cm.images {
+			if key.node == node.ID && !seen[key.image] {
+				delete(cm.images, key)
+			}
+		}
+		cm.mu.Unlock()
+	}
+}
+
+// StartImageLoop loads the nodes' cached images and resyncs them every interval
+func (cm *ClusterManager) StartImageLoop(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		cm.SyncImages(ctx)
+		for {
+			select {
+			case <-ticker.C:
+				cm.SyncImages(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,77 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/docker/dockertest"
+)
+
+func TestPrepull(t *testing.T) {
+	ssd, ssdRT := newTestNode("ssd", 4, 4096)
+	ssd.Labels = map[string]string{"disk": "ssd"}
+	hdd, hddRT := newTestNode("hdd", 4, 4096)
+	down, _ := newTestNode("down", 4, 4096)
+	down.Labels = map[string]string{"disk": "ssd"}
+	cm := newTestCluster(ssd, hdd, down)
+	down.Healthy = false
+	ctx := context.Background()
+
+	results, err := cm.Prepull(ctx, "nginx", nil, PrepullTarget{Selector: map[string]string{"disk": "ssd"}})
+	if err != nil {
+		t.Fatalf("Prepull: %v", err)
+	}
+	if len(results) != 2 || results[0].NodeID != "down" || results[0].Err == nil || results[1].NodeID != "ssd" || results[1].Err != nil {
+		t.Errorf("results %+v, want down failed and ssd pulled", results)
+	}
+	if !ssdRT.HasImage("nginx") || hddRT.HasImage("nginx") {
+		t.Error("image not pulled on exactly the selected node")
+	}
+	imgs := cm.Images(ImageFilter{Image: "docker.io/library/nginx"})
+	if len(imgs) != 1 || imgs[0].NodeID != "ssd" || imgs[0].Image != "nginx:latest" || imgs[0].PulledAt.IsZero() {
+		t.Errorf("cached images %+v, want nginx:latest pulled on ssd", imgs)
+	}
+
+	if _, err := cm.Prepull(ctx, "nginx", nil, PrepullTarget{Nodes: []string{"nope"}}); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("unknown node: err = %v, want ErrNodeNotFound", err)
+	}
+	if _, err := cm.Prepull(ctx, "nginx", nil, PrepullTarget{Selector: map[string]string{"disk": "nvme"}}); !errors.Is(err, ErrNoMatchingNode) {
+		t.Errorf("selector matching nothing: err = %v, want ErrNoMatchingNode", err)
+	}
+
+	hddRT.Fail("PullImage", dockertest.ErrInjected)
+	results, err = cm.Prepull(ctx, "redis", nil, PrepullTarget{Nodes: []string{"hdd"}})
+	if err != nil || len(results) != 1 || !errors.Is(results[0].Err, dockertest.ErrInjected) {
+		t.Errorf("failed pull: %+v, %v; want the node's error in its result", results, err)
+	}
+}
+
+func TestSyncImages(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 0.5})
+	rt.AddImage(docker.Image{ID: "sha256:pg", Tags: []string{"postgres:16"}, SizeBytes: 400})
+	cm.SyncImages(ctx)
+
+	imgs := cm.Images(ImageFilter{Node: "node1"})
+	if len(imgs) != 2 || imgs[0].Image != "nginx:latest" || imgs[1].Image != "postgres:16" {
+		t.Fatalf("cached images %+v, want nginx:latest and postgres:16", imgs)
+	}
+	if imgs[0].ID == "" || imgs[0].PulledAt.IsZero() {
+		t.Errorf("nginx %+v, want its ID synced and pull time kept", imgs[0])
+	}
+	if imgs[1].SizeBytes != 400 || !imgs[1].PulledAt.IsZero() {
+		t.Errorf("postgres %+v, want its size and no pull time", imgs[1])
+	}
+
+	// Nodes that can't be asked keep what is known
+	rt.Fail("ListImages", dockertest.ErrInjected)
+	cm.SyncImages(ctx)
+	if got := len(cm.Images(ImageFilter{})); got != 2 {
+		t.Errorf("%d images cached after a failed sync, want the 2 known", got)
+	}
+}
@@ -0,0 +1,151 @@
+package cluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/events"
+)
+
+// NamespaceNetworkPrefix starts the name of every namespace's network
+const NamespaceNetworkPrefix = "mini-cloud-ns-"
+
+// ErrNetworkNotAllowed is returned when network isolation is on and a
+// container asks for a network other than its namespace's
+var ErrNetworkNotAllowed = errors.New("network not allowed")
+
+// networkUnsafe matches the characters Docker doesn't accept in network names
+var networkUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// NamespaceNetwork returns the name of the bridge network isolating
+// namespace. Namespaces that aren't valid network names are sanitised and
+// suffixed with a hash so that they stay distinct.
+func NamespaceNetwork(namespace string) string {
+	name := networkUnsafe.ReplaceAllString(namespace, "-")
+	if name != namespace {
+		sum := sha256.Sum256([]byte(namespace))
+		name += "-" + hex.EncodeToString(sum[:4])
+	}
+	return NamespaceNetworkPrefix + name
+}
+
+// SetNetworkIsolation selects whether each namespace's containers are
+// attached to a bridge network of their own. Docker doesn't route between
+// bridge networks, so tenants can't reach each other's containers.
+// Containers without a namespace stay on the default bridge.
+func (cm *ClusterManager) SetNetworkIsolation(enabled bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.networkIsolation = enabled
+}
+
+// isolateLocked attaches spec to its namespace's network when isolation is
+// on, refusing any other network. Caller must hold the lock.
+func (cm *ClusterManager) isolateLocked(spec docker.ContainerSpec) (docker.ContainerSpec, error) {
+	if !cm.networkIsolation {
+		return spec, nil
+	}
+	if spec.Namespace == "" {
+		if strings.HasPrefix(spec.Network, NamespaceNetworkPrefix) {
+			return spec, fmt.Errorf("%w: %s belongs to a namespace", ErrNetworkNotAllowed, spec.Network)
+		}
+		return spec, nil
+	}
+	network := NamespaceNetwork(spec.Namespace)
+	if spec.Network != "" && spec.Network != network {
+		return spec, fmt.Errorf("%w: containers in namespace %q are attached to %s", ErrNetworkNotAllowed, spec.Namespace, network)
+	}
+	spec.Network = network
+	return spec, nil
+}
+
+// namespaceNetworksLocked returns the networks of the namespaces with
+// running or pending containers on nodeID. Caller must hold the lock.
+func (cm *ClusterManager) namespaceNetworksLocked(nodeID string) map[string]bool {
+	used := make(map[string]bool)
+	if node, ok := cm.nodes[nodeID]; ok {
+		containers, _ := node.Manager.ListActiveContainers(context.Background())
+		for _, info := range containers {
+			if info.Namespace != "" {
+				used[NamespaceNetwork(info.Namespace)] = true
+			}
+		}
+	}
+	for _, p := range cm.pending {
+		if p.nodeID == nodeID && p.spec.Namespace != "" {
+			used[NamespaceNetwork(p.spec.Namespace)] = true
+		}
+	}
+	return used
+}
+
+// networkTimeout bounds listing or removing one node's networks
+const networkTimeout = 10 * time.Second
+
+// pruneNetworks removes the namespace networks on node that no container
+// of their namespace uses any more
+func (cm *ClusterManager) pruneNetworks(ctx context.Context, node *Node) {
+	listCtx, cancel := context.WithTimeout(ctx, networkTimeout)
+	networks, err := node.Docker.ListNetworks(listCtx)
+	cancel()
+	if err != nil {
+		cm.log.Warn("failed to list networks", "node_id", node.ID, "error", err)
+		return
+	}
+
+	for _, name := range networks {
+		if !strings.HasPrefix(name, NamespaceNetworkPrefix) {
+			continue
+		}
+		// Hold the lock while removing so that no container of the
+		// namespace is placed on the node meanwhile
+		cm.mu.Lock()
+		if !cm.namespaceNetworksLocked(node.ID)[name] {
+			rmCtx, cancel := context.WithTimeout(ctx, networkTimeout)
+			err := node.Docker.RemoveNetwork(rmCtx, name)
+			cancel()
+			if err != nil {
+				cm.log.Warn("failed to remove namespace network", "node_id", node.ID, "network", name, "error", err)
+			} else {
+				cm.log.Info("namespace network removed", "node_id", node.ID, "network", name)
+			}
+		}
+		cm.mu.Unlock()
+	}
+}
+
+// StartNetworkLoop removes a namespace's network from a node once its last
+// container there is gone, checking after every termination and every interval
+func (cm *ClusterManager) StartNetworkLoop(ctx context.Context, interval time.Duration) {
+	sub := cm.events.Subscribe()
+	go func() {
+		defer cm.events.Unsubscribe(sub)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				for _, node := range cm.Nodes() {
+					cm.pruneNetworks(ctx, node)
+				}
+			case e := <-sub:
+				switch e.Type {
+				case events.Terminated, events.Expired, events.Preempted:
+					if node := cm.node(e.NodeID); node != nil {
+						cm.pruneNetworks(ctx, node)
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
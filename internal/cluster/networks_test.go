@@ -0,0 +1,65 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"mini-cloud/internal/docker"
+)
+
+func TestNamespaceNetwork(t *testing.T) {
+	if got := NamespaceNetwork("team-a"); got != "mini-cloud-ns-team-a" {
+		t.Errorf("network of team-a = %q", got)
+	}
+	// Sanitised names keep a hash so that they can't collide
+	a, b := NamespaceNetwork("team a"), NamespaceNetwork("team/a")
+	if a == b || !strings.HasPrefix(a, "mini-cloud-ns-team-a-") {
+		t.Errorf("networks of \"team a\" and \"team/a\": %q and %q, want distinct sanitised names", a, b)
+	}
+}
+
+func TestNetworkIsolation(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	cm.SetNetworkIsolation(true)
+	ctx := context.Background()
+
+	info := mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Namespace: "a", Image: "nginx", CPU: 0.5})
+	if c, _ := rt.Container(info.ID); c.Spec.Network != "mini-cloud-ns-a" {
+		t.Errorf("attached to %q, want namespace a's network", c.Spec.Network)
+	}
+	if c, _ := rt.Container(mustSchedule(t, cm, docker.ContainerSpec{Name: "shared", Image: "nginx", CPU: 0.5}).ID); c.Spec.Network != "" {
+		t.Errorf("container without a namespace attached to %q, want the default bridge", c.Spec.Network)
+	}
+
+	for _, spec := range []docker.ContainerSpec{
+		{Name: "peek", Namespace: "b", Image: "nginx", Network: "mini-cloud-ns-a"},
+		{Name: "host", Namespace: "b", Image: "nginx", Network: "host"},
+		{Name: "sneak", Image: "nginx", Network: "mini-cloud-ns-a"},
+	} {
+		if _, err := cm.Schedule(ctx, spec); !errors.Is(err, ErrNetworkNotAllowed) {
+			t.Errorf("%s on %s: err = %v, want ErrNetworkNotAllowed", spec.Name, spec.Network, err)
+		}
+	}
+}
+
+func TestPruneNetworks(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	cm.SetNetworkIsolation(true)
+	ctx := context.Background()
+
+	a := mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Namespace: "a", Image: "nginx", CPU: 0.5})
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "api", Namespace: "b", Image: "nginx", CPU: 0.5})
+	if err := cm.TerminateContainer(ctx, a.ID); err != nil {
+		t.Fatalf("TerminateContainer: %v", err)
+	}
+
+	cm.pruneNetworks(ctx, node)
+	networks, _ := rt.ListNetworks(ctx)
+	if len(networks) != 1 || networks[0] != "mini-cloud-ns-b" {
+		t.Errorf("networks left %v, want only b's, which is still in use", networks)
+	}
+}
@@ -0,0 +1,144 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mini-cloud/internal/events"
+	"mini-cloud/internal/manager"
+)
+
+// ErrNodeExists is returned when adding a node whose ID is already in the cluster
+var ErrNodeExists = errors.New("node already exists")
+
+// drainPollInterval is how often RemoveNode checks for placements still in progress
+const drainPollInterval = 100 * time.Millisecond
+
+// AddNode adds node to the cluster at runtime. Containers restored from its
+// persisted state are tracked right away.
+func (cm *ClusterManager) AddNode(node *Node) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if _, ok := cm.nodes[node.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrNodeExists, node.ID)
+	}
+	cm.initNodeLocked(node)
+	cm.nodes[node.ID] = node
+	cm.log.Info("node added", "node_id", node.ID)
+	cm.events.Publish(events.Event{Type: events.NodeAdded, NodeID: node.ID})
+	return nil
+}
+
+// RemoveNode drains nodeID and removes it from the cluster. The node stops
+// taking new containers at once; its containers are stopped and rescheduled
+// on the remaining nodes with their name and remaining TTL, and placements in
+// progress are waited for. The node is removed even if some containers could
+// not be rescheduled; those errors are returned.
+func (cm *ClusterManager) RemoveNode(ctx context.Context, nodeID string) error {
+	cm.mu.Lock()
+	node, ok := cm.nodes[nodeID]
+	if !ok {
+		cm.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
+	}
+	node.Draining = true
+	cm.mu.Unlock()
+	cm.log.Info("draining node", "node_id", nodeID)
+
+	var errs []error
+	for {
+		cm.mu.Lock()
+		ids := cm.assignedLocked(nodeID)
+		busy := false
+		for _, p := range cm.pending {
+			busy = busy || p.nodeID == nodeID
+		}
+		if len(ids) == 0 && !busy {
+			delete(cm.nodes, nodeID)
+			cm.mu.Unlock()
+			break
+		}
+		cm.mu.Unlock()
+
+		if len(ids) == 0 {
+			select {
+			case <-time.After(drainPollInterval):
+				continue
+			case <-ctx.Done():
+				return errors.Join(append(errs, ctx.Err())...)
+			}
+		}
+		for _, id := range ids {
+			if err := cm.moveOff(ctx, node, id); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if node.Stop != nil {
+		node.Stop()
+	}
+	cm.log.Info("node removed", "node_id", nodeID)
+	cm.events.Publish(events.Event{Type: events.NodeRemoved, NodeID: nodeID})
+	return errors.Join(errs...)
+}
+
+// assignedLocked returns the IDs of containers tracked on nodeID. Caller must hold the lock.
+func (cm *ClusterManager) assignedLocked(nodeID string) []string {
+	var ids []string
+	for id, assigned := range cm.assignments {
+		if assigned == nodeID {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// moveOff gracefully terminates container id on a draining node and
+// schedules a replacement elsewhere. The container is untracked either way.
+func (cm *ClusterManager) moveOff(ctx context.Context, node *Node, id string) error {
+	moved, err := cm.replace(ctx, node, id)
+	if err != nil || moved == nil {
+		return err
+	}
+	cm.log.Info("moved container off draining node", "name", moved.Name, "old_container_id", id, "container_id", moved.ID, "from_node_id", node.ID, "node_id", cm.assignmentOf(moved.ID))
+	return nil
+}
+
+// replace gracefully terminates container id on node and schedules it again
+// with its name and remaining TTL. It returns nil without error if the
+// container is already gone or expired. The old container is untracked either way.
+func (cm *ClusterManager) replace(ctx context.Context, node *Node, id string) (*manager.ContainerInfo, error) {
+	info, statusErr := node.Manager.GetContainerStatus(ctx, id)
+
+	cm.mu.Lock()
+	spec, hasSpec := cm.specs[id]
+	cm.untrackLocked(id)
+	cm.mu.Unlock()
+
+	if statusErr != nil {
+		return nil, nil // already gone, e.g. expired
+	}
+	if err := node.Manager.TerminateContainer(ctx, id); err != nil && !errors.Is(err, manager.ErrNotFound) {
+		return nil, fmt.Errorf("stop %s (%s): %w", info.Name, id, err)
+	}
+	if !hasSpec {
+		spec = info.Spec()
+	}
+	if info.TTL > 0 {
+		remaining := time.Until(info.CreatedAt.Add(info.TTL))
+		if remaining <= 0 {
+			return nil, nil
+		}
+		spec.TTL = remaining
+	}
+
+	moved, err := cm.Schedule(ctx, spec)
+	if err != nil {
+		return nil, fmt.Errorf("reschedule %s (%s): %w", info.Name, id, err)
+	}
+	return moved, nil
+}
@@ -0,0 +1,64 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/docker/dockertest"
+)
+
+func TestAddNode(t *testing.T) {
+	node1, _ := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node1)
+
+	dup, _ := newTestNode("node1", 8, 8192)
+	if err := cm.AddNode(dup); !errors.Is(err, ErrNodeExists) {
+		t.Errorf("adding a duplicate ID: err = %v, want ErrNodeExists", err)
+	}
+
+	node2, _ := newTestNode("node2", 8, 8192)
+	if err := cm.AddNode(node2); err != nil {
+		t.Fatalf("AddNode: %v", err)
+	}
+	info := mustSchedule(t, cm, docker.ContainerSpec{Name: "big", Image: "nginx", CPU: 6})
+	if got := cm.assignmentOf(info.ID); got != "node2" {
+		t.Errorf("big scheduled on %q, want the added node2", got)
+	}
+}
+
+func TestRemoveNodeMovesContainers(t *testing.T) {
+	old, oldRT := newTestNode("old", 4, 4096)
+	spare, spareRT := newTestNode("spare", 2, 2048)
+	spare.Healthy = false // keep the first placement on old
+	cm := newTestCluster(old, spare)
+	ctx := context.Background()
+
+	web := mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1, Memory: 256, TTL: time.Hour})
+	spare.Healthy = true
+
+	if err := cm.RemoveNode(ctx, "old"); err != nil {
+		t.Fatalf("RemoveNode: %v", err)
+	}
+	if _, ok := oldRT.Container(web.ID); ok {
+		t.Error("container left running on the removed node")
+	}
+	moved := spareRT.Containers()
+	if len(moved) != 1 || moved[0].Spec.Name != "web" || moved[0].State != dockertest.StateRunning {
+		t.Fatalf("running on spare: %+v, want web", moved)
+	}
+	if ttl := moved[0].Spec.TTL; ttl <= 0 || ttl > time.Hour {
+		t.Errorf("moved with TTL %v, want what was left of 1h", ttl)
+	}
+	for _, n := range cm.NodeStatuses() {
+		if n.ID == "old" {
+			t.Error("removed node still listed")
+		}
+	}
+
+	if err := cm.RemoveNode(ctx, "old"); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("removing it again: err = %v, want ErrNodeNotFound", err)
+	}
+}
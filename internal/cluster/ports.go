@@ -0,0 +1,55 @@
+package cluster
+
+import (
+	"context"
+	"strings"
+
+	"mini-cloud/internal/docker"
+)
+
+// fixedHostPorts returns the host ports spec binds explicitly, e.g. "8080/tcp"
+func fixedHostPorts(spec docker.ContainerSpec) []string {
+	var keys []string
+	for _, p := range spec.Ports {
+		if key := p.HostKey(); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// hostPortInUseLocked returns a fixed host port of spec that a running or
+// pending container already binds on node, or "" if all are free. Caller
+// must hold the lock.
+func (cm *ClusterManager) hostPortInUseLocked(node *Node, spec docker.ContainerSpec) string {
+	want := fixedHostPorts(spec)
+	if len(want) == 0 {
+		return ""
+	}
+	taken := make(map[string]bool)
+	containers, _ := node.Manager.ListActiveContainers(context.Background())
+	for _, info := range containers {
+		for _, p := range info.Ports {
+			taken[p.HostKey()] = true
+		}
+	}
+	for _, p := range cm.pending {
+		if p.nodeID != node.ID {
+			continue
+		}
+		for _, port := range p.spec.Ports {
+			taken[port.HostKey()] = true
+		}
+	}
+	for _, key := range want {
+		if taken[key] {
+			return key
+		}
+	}
+	return ""
+}
+
+// formatHostPorts lists spec's fixed host ports for error messages
+func formatHostPorts(spec docker.ContainerSpec) string {
+	return strings.Join(fixedHostPorts(spec), ",")
+}
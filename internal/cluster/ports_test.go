@@ -0,0 +1,46 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"mini-cloud/internal/docker"
+)
+
+func TestHostPortsSpreadContainers(t *testing.T) {
+	node1, _ := newTestNode("node1", 4, 4096)
+	node2, _ := newTestNode("node2", 4, 4096)
+	cm := newTestCluster(node1, node2)
+	spec := func(name string) docker.ContainerSpec {
+		return docker.ContainerSpec{Name: name, Image: "nginx", CPU: 0.5,
+			Ports: []docker.PortMapping{{ContainerPort: 80, HostPort: 8080}}}
+	}
+
+	first := mustSchedule(t, cm, spec("web-0"))
+	second := mustSchedule(t, cm, spec("web-1"))
+	if first.NodeID == second.NodeID {
+		t.Errorf("both containers binding host port 8080 on %s", first.NodeID)
+	}
+	if first.HostPorts["80/tcp"] != 8080 {
+		t.Errorf("host ports %v, want 80/tcp on 8080", first.HostPorts)
+	}
+
+	_, err := cm.Schedule(context.Background(), spec("web-2"))
+	var serr *SchedulingError
+	if !errors.Is(err, ErrInsufficientCapacity) || !errors.As(err, &serr) {
+		t.Fatalf("third container: err = %v, want a SchedulingError for capacity", err)
+	}
+	if len(serr.Rejections) != 2 {
+		t.Errorf("rejections %v, want both nodes", serr.Rejections)
+	}
+	for _, r := range serr.Rejections {
+		if r.Reason != "host port 8080/tcp in use" {
+			t.Errorf("%s rejected with %q, want the host port in use", r.NodeID, r.Reason)
+		}
+	}
+
+	// Ports Docker picks never conflict
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "api", Image: "nginx", CPU: 0.5,
+		Ports: []docker.PortMapping{{ContainerPort: 80}}})
+}
@@ -0,0 +1,72 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/manager"
+)
+
+// preemptLocked terminates lower-priority containers on a single node so
+// that spec fits there. The node needing the fewest evictions is chosen,
+// evicting the lowest priorities first and the newest containers among equal
+// priorities. Containers of equal or higher priority are never preempted.
+// Caller must hold the lock.
+func (cm *ClusterManager) preemptLocked(ctx context.Context, spec docker.ContainerSpec) ([]*manager.ContainerInfo, error) {
+	need := manager.ResourceSpecFor(spec)
+
+	conflicts := cm.antiAffinityLocked(spec.AntiAffinity)
+	var target *Node
+	var victims []*manager.ContainerInfo
+	for _, node := range cm.nodes {
+		if !node.schedulable() || !node.MatchesSelector(spec.NodeSelector) || conflicts[node.ID] > 0 {
+			continue
+		}
+		if spec.RequireAntiAffinity && cm.affinityLocked(spec.AntiAffinityKey)[node.ID] > 0 {
+			continue
+		}
+
+		containers, _ := node.Manager.ListActiveContainers(ctx)
+		var candidates []*manager.ContainerInfo
+		for _, info := range containers {
+			if info.Priority < spec.Priority {
+				candidates = append(candidates, info)
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			if candidates[i].Priority != candidates[j].Priority {
+				return candidates[i].Priority < candidates[j].Priority
+			}
+			return candidates[i].CreatedAt.After(candidates[j].CreatedAt)
+		})
+
+		var names []string
+		for n, info := range candidates {
+			names = append(names, info.Name)
+			if !node.Resources.CanAllocateWithout(need, names...) {
+				continue
+			}
+			if target == nil || n+1 < len(victims) {
+				target, victims = node, candidates[:n+1]
+			}
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%w and no lower-priority containers can be preempted", ErrInsufficientCapacity)
+	}
+
+	var evicted []*manager.ContainerInfo
+	for _, info := range victims {
+		if err := target.Manager.Preempt(ctx, info.ID); err != nil {
+			return evicted, fmt.Errorf("failed to preempt %s: %w", info.Name, err)
+		}
+		cm.untrackLocked(info.ID)
+		evicted = append(evicted, info)
+		cm.log.Info("container preempted", "container_id", info.ID, "name", info.Name, "node_id", target.ID,
+			"priority", info.Priority, "for", spec.Name)
+	}
+	return evicted, nil
+}
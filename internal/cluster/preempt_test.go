@@ -0,0 +1,55 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/docker/dockertest"
+)
+
+func TestPreemption(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	batch := mustSchedule(t, cm, docker.ContainerSpec{Name: "batch", Image: "worker", CPU: 2, Priority: 1})
+	time.Sleep(time.Millisecond) // keep creation times apart
+	report := mustSchedule(t, cm, docker.ContainerSpec{Name: "report", Image: "worker", CPU: 1, Priority: 1})
+	web := mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1, Priority: 10})
+
+	info, evicted, err := cm.ScheduleWithEvictions(context.Background(), docker.ContainerSpec{Name: "api", Image: "api", CPU: 1, Priority: 5})
+	if err != nil {
+		t.Fatalf("ScheduleWithEvictions: %v", err)
+	}
+	// The newest of the lowest priority goes first, and is enough
+	if len(evicted) != 1 || evicted[0].ID != report.ID {
+		t.Errorf("evicted %v, want only %s", evicted, report.ID)
+	}
+	if _, ok := rt.Container(report.ID); ok {
+		t.Error("preempted container still exists")
+	}
+	if _, err := cm.GetContainerStatus(context.Background(), report.ID); err == nil {
+		t.Error("preempted container is still tracked")
+	}
+	for _, id := range []string{batch.ID, web.ID, info.ID} {
+		if c, ok := rt.Container(id); !ok || c.State != dockertest.StateRunning {
+			t.Errorf("%s is not running", id)
+		}
+	}
+}
+
+func TestPreemptionWithoutVictims(t *testing.T) {
+	node, rt := newTestNode("node1", 2, 4096)
+	cm := newTestCluster(node)
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1, Priority: 5})
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "db", Image: "postgres", CPU: 1, Priority: 10})
+
+	_, evicted, err := cm.ScheduleWithEvictions(context.Background(), docker.ContainerSpec{Name: "api", Image: "api", CPU: 1, Priority: 5})
+	if !errors.Is(err, ErrInsufficientCapacity) {
+		t.Errorf("err = %v, want ErrInsufficientCapacity", err)
+	}
+	if len(evicted) != 0 || rt.Running() != 2 {
+		t.Errorf("evicted %v with %d running, want equal and higher priorities left alone", evicted, rt.Running())
+	}
+}
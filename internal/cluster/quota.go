@@ -0,0 +1,121 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrQuotaExceeded is returned when a container would push its namespace over quota
+var ErrQuotaExceeded = errors.New("namespace quota exceeded")
+
+// Quota caps the total resources a namespace may reserve cluster-wide.
+// Zero values mean no limit.
+type Quota struct {
+	CPU        float64
+	MemoryMB   int64
+	Containers int
+}
+
+// NamespaceUsage reports a namespace's quota and the resources its containers reserve
+type NamespaceUsage struct {
+	Namespace string
+	Quota     Quota
+	HasQuota  bool
+	Used      Quota
+}
+
+// SetQuota sets the quota for namespace, replacing any previous one
+func (cm *ClusterManager) SetQuota(namespace string, q Quota) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.quotas[namespace] = q
+}
+
+// RemoveQuota lifts the quota for namespace
+func (cm *ClusterManager) RemoveQuota(namespace string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	delete(cm.quotas, namespace)
+}
+
+// NamespaceQuota returns the quota and usage of namespace
+func (cm *ClusterManager) NamespaceQuota(namespace string) NamespaceUsage {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	q, ok := cm.quotas[namespace]
+	return NamespaceUsage{Namespace: namespace, Quota: q, HasQuota: ok, Used: cm.namespaceUsageLocked()[namespace]}
+}
+
+// Quotas returns usage for every namespace that has a quota or running
+// containers, sorted by namespace
+func (cm *ClusterManager) Quotas() []NamespaceUsage {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	used := cm.namespaceUsageLocked()
+	var out []NamespaceUsage
+	for ns, q := range cm.quotas {
+		out = append(out, NamespaceUsage{Namespace: ns, Quota: q, HasQuota: true, Used: used[ns]})
+	}
+	for ns, u := range used {
+		if _, ok := cm.quotas[ns]; !ok {
+			out = append(out, NamespaceUsage{Namespace: ns, Used: u})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Namespace < out[j].Namespace })
+	return out
+}
+
+// namespaceUsageLocked sums the resources reserved by each namespace's
+// containers across all nodes, including those still being placed or
+// resized. Caller must hold the lock.
+func (cm *ClusterManager) namespaceUsageLocked() map[string]Quota {
+	used := make(map[string]Quota)
+	for _, node := range cm.nodes {
+		containers, _ := node.Manager.ListActiveContainers(context.Background())
+		for _, info := range containers {
+			u := used[info.Namespace]
+			u.CPU += info.CPU
+			u.MemoryMB += info.MemoryMB
+			u.Containers++
+			used[info.Namespace] = u
+		}
+	}
+	for _, p := range cm.pending {
+		u := used[p.spec.Namespace]
+		u.CPU += p.spec.CPU
+		u.MemoryMB += p.spec.Memory
+		u.Containers++
+		used[p.spec.Namespace] = u
+	}
+	for _, r := range cm.resizes {
+		u := used[r.namespace]
+		u.CPU += r.cpu
+		u.MemoryMB += r.memoryMB
+		used[r.namespace] = u
+	}
+	return used
+}
+
+// checkQuotaLocked returns ErrQuotaExceeded if adding cpu, memoryMB and
+// containers to namespace would exceed its quota. Caller must hold the lock.
+func (cm *ClusterManager) checkQuotaLocked(namespace string, cpu float64, memoryMB int64, containers int) error {
+	q, ok := cm.quotas[namespace]
+	if !ok {
+		return nil
+	}
+	used := cm.namespaceUsageLocked()[namespace]
+	if q.CPU > 0 && used.CPU+cpu > q.CPU {
+		return fmt.Errorf("%w: %q would use %.2f of %.2f CPU", ErrQuotaExceeded, namespace, used.CPU+cpu, q.CPU)
+	}
+	if q.MemoryMB > 0 && used.MemoryMB+memoryMB > q.MemoryMB {
+		return fmt.Errorf("%w: %q would use %dMB of %dMB memory", ErrQuotaExceeded, namespace, used.MemoryMB+memoryMB, q.MemoryMB)
+	}
+	if q.Containers > 0 && used.Containers+containers > q.Containers {
+		return fmt.Errorf("%w: %q would run %d of %d containers", ErrQuotaExceeded, namespace, used.Containers+containers, q.Containers)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/docker/dockertest"
+)
+
+func TestQuotaCapsNamespace(t *testing.T) {
+	node1, _ := newTestNode("node1", 8, 8192)
+	node2, _ := newTestNode("node2", 8, 8192)
+	cm := newTestCluster(node1, node2)
+	cm.SetQuota("team-a", Quota{CPU: 3, MemoryMB: 4096})
+	ctx := context.Background()
+
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "a1", Image: "nginx", CPU: 2, Memory: 1024, Namespace: "team-a"})
+
+	// Plenty of room on either node, but not within the quota
+	_, err := cm.Schedule(ctx, docker.ContainerSpec{Name: "a2", Image: "nginx", CPU: 2, Memory: 1024, Namespace: "team-a"})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("err = %v, want ErrQuotaExceeded", err)
+	}
+	if _, err := cm.Schedule(ctx, docker.ContainerSpec{Name: "a3", Image: "nginx", CPU: 1, Memory: 4096, Namespace: "team-a"}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("over the memory quota: err = %v, want ErrQuotaExceeded", err)
+	}
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "a4", Image: "nginx", CPU: 1, Memory: 1024, Namespace: "team-a"})
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "b1", Image: "nginx", CPU: 4, Memory: 4096, Namespace: "team-b"})
+
+	usage := cm.NamespaceQuota("team-a")
+	if !usage.HasQuota || usage.Used != (Quota{CPU: 3, MemoryMB: 2048, Containers: 2}) {
+		t.Errorf("team-a usage %+v, want 3 CPU, 2048 MB in 2 containers", usage)
+	}
+
+	cm.RemoveQuota("team-a")
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "a5", Image: "nginx", CPU: 2, Memory: 1024, Namespace: "team-a"})
+}
+
+func TestQuotaContainerCount(t *testing.T) {
+	node, _ := newTestNode("node1", 8, 8192)
+	cm := newTestCluster(node)
+	cm.SetQuota("team-a", Quota{Containers: 1})
+
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "a1", Image: "nginx", CPU: 0.5, Namespace: "team-a"})
+	_, err := cm.Schedule(context.Background(), docker.ContainerSpec{Name: "a2", Image: "nginx", CPU: 0.5, Namespace: "team-a"})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("err = %v, want ErrQuotaExceeded", err)
+	}
+
+	quotas := cm.Quotas()
+	if len(quotas) != 1 || quotas[0].Namespace != "team-a" || quotas[0].Used.Containers != 1 {
+		t.Errorf("Quotas() = %+v, want team-a with one container", quotas)
+	}
+}
+
+func TestQuotaReservesResize(t *testing.T) {
+	node, rt := newTestNode("node1", 8, 8192)
+	cm := newTestCluster(node)
+	cm.SetQuota("team-a", Quota{CPU: 4})
+	ctx := context.Background()
+	a1 := mustSchedule(t, cm, docker.ContainerSpec{Name: "a1", Image: "nginx", CPU: 1, Memory: 256, Namespace: "team-a"})
+
+	// A failed update gives back what it reserved
+	rt.Fail("UpdateContainer", dockertest.ErrInjected)
+	if _, err := cm.UpdateResources(ctx, a1.ID, 3, 256); !errors.Is(err, dockertest.ErrInjected) {
+		t.Fatalf("err = %v, want the update error", err)
+	}
+	rt.Fail("UpdateContainer", nil)
+	if used := cm.NamespaceQuota("team-a").Used; used.CPU != 1 {
+		t.Errorf("team-a uses %v CPU after a failed resize, want 1", used.CPU)
+	}
+
+	updating, release := make(chan struct{}), make(chan struct{})
+	rt.SetHook(func(ctx context.Context, op, _ string) error {
+		if op == "UpdateContainer" {
+			close(updating)
+			<-release
+		}
+		return nil
+	})
+	done := make(chan error, 1)
+	go func() {
+		_, err := cm.UpdateResources(ctx, a1.ID, 3, 256)
+		done <- err
+	}()
+	<-updating
+
+	// The cluster is not locked while the node applies the new limits, but
+	// the extra 2 CPU count against the quota
+	scheduled := make(chan error, 1)
+	go func() {
+		_, err := cm.Schedule(ctx, docker.ContainerSpec{Name: "a2", Image: "nginx", CPU: 2, Namespace: "team-a"})
+		scheduled <- err
+	}()
+	select {
+	case err := <-scheduled:
+		if !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("Schedule during a resize: err = %v, want ErrQuotaExceeded", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Schedule blocked while a container was being resized")
+	}
+	if _, err := cm.UpdateResources(ctx, a1.ID, 2, 256); !errors.Is(err, ErrResizeInProgress) {
+		t.Errorf("second resize: err = %v, want ErrResizeInProgress", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("UpdateResources: %v", err)
+	}
+	if used := cm.NamespaceQuota("team-a").Used; used.CPU != 3 {
+		t.Errorf("team-a uses %v CPU after the resize, want 3", used.CPU)
+	}
+}
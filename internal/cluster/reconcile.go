@@ -0,0 +1,67 @@
+package cluster
+
+import (
+	"context"
+	"time"
+
+	"mini-cloud/internal/resourcemanager"
+)
+
+// OrphanedReservation is a resource reservation released because no tracked
+// container owned it
+type OrphanedReservation struct {
+	NodeID    string
+	ID        string
+	Resources resourcemanager.ResourceSpec
+}
+
+// ReconcileResources releases reservations on every node that don't belong to
+// a container tracked by that node's manager, so leaked reservations stop
+// taking up capacity. It returns what was released.
+func (cm *ClusterManager) ReconcileResources(ctx context.Context) []OrphanedReservation {
+	// Containers being placed are pending until tracked; holding the lock
+	// keeps that set consistent while we look
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	var freed []OrphanedReservation
+	for _, node := range cm.nodes {
+		containers, err := node.Manager.ListActiveContainers(ctx)
+		if err != nil {
+			cm.log.Warn("failed to list containers", "node_id", node.ID, "error", err)
+			continue
+		}
+		live := make(map[string]bool, len(containers))
+		for _, info := range containers {
+			live[info.Name] = true
+		}
+
+		for id, spec := range node.Resources.Allocations() {
+			if _, placing := cm.pending[id]; live[id] || placing {
+				continue
+			}
+			node.Resources.Release(id)
+			freed = append(freed, OrphanedReservation{NodeID: node.ID, ID: id, Resources: spec})
+			cm.log.Warn("released orphaned reservation", "node_id", node.ID, "reservation", id,
+				"cpu", spec.CPU, "memory_mb", spec.Memory, "gpu", spec.GPU, "disk_mb", spec.DiskMB)
+		}
+	}
+	return freed
+}
+
+// StartResourceReconcileLoop periodically releases orphaned reservations
+func (cm *ClusterManager) StartResourceReconcileLoop(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				cm.ReconcileResources(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,36 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/resourcemanager"
+)
+
+func TestReconcileResources(t *testing.T) {
+	node, _ := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+	mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1, Memory: 256})
+
+	// A reservation whose container is gone, and one still being placed
+	node.Resources.Allocate("ghost", resourcemanager.ResourceSpec{CPU: 2, Memory: 1024})
+	placing := docker.ContainerSpec{Name: "placing", Image: "nginx", CPU: 0.5}
+	node.Resources.Allocate("placing", resourcemanager.ResourceSpec{CPU: 0.5})
+	cm.mu.Lock()
+	cm.pending["placing"] = pendingPlacement{nodeID: "node1", spec: placing}
+	cm.mu.Unlock()
+
+	freed := cm.ReconcileResources(ctx)
+	want := OrphanedReservation{NodeID: "node1", ID: "ghost", Resources: resourcemanager.ResourceSpec{CPU: 2, Memory: 1024}}
+	if len(freed) != 1 || freed[0] != want {
+		t.Errorf("freed %+v, want only %+v", freed, want)
+	}
+	if got := node.Resources.AllocatedCPUSum(); got != 1.5 {
+		t.Errorf("allocated CPU = %v, want 1.5 for web and the pending placement", got)
+	}
+	if freed := cm.ReconcileResources(ctx); len(freed) != 0 {
+		t.Errorf("second pass freed %+v, want nothing", freed)
+	}
+}
@@ -0,0 +1,38 @@
+package cluster
+
+import "mini-cloud/internal/docker"
+
+// SetRegistryCredentials replaces the credentials used to pull images that
+// carry none of their own, keyed by registry address. It may be called at
+// any time, e.g. to rotate credentials without a restart.
+func (cm *ClusterManager) SetRegistryCredentials(creds map[string]docker.RegistryAuth) {
+	registries := make(map[string]docker.RegistryAuth, len(creds))
+	for server, auth := range creds {
+		registries[docker.NormalizeRegistryHost(server)] = auth
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.registries = registries
+}
+
+// pullOptions returns the options for pulling spec's image, with the
+// configured credentials for its registry unless spec brings its own
+func (cm *ClusterManager) pullOptions(spec docker.ContainerSpec) docker.PullOptions {
+	opts := spec.PullOptions()
+	if opts.Auth != nil {
+		return opts
+	}
+	host, err := docker.RegistryHost(spec.Image)
+	if err != nil {
+		return opts // the pull reports the invalid reference
+	}
+
+	cm.mu.Lock()
+	auth, ok := cm.registries[host]
+	cm.mu.Unlock()
+	if ok {
+		opts.Auth = &auth
+	}
+	return opts
+}
@@ -0,0 +1,41 @@
+package cluster
+
+import (
+	"testing"
+
+	"mini-cloud/internal/docker"
+)
+
+func TestRegistryCredentials(t *testing.T) {
+	node, _ := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	cm.SetRegistryCredentials(map[string]docker.RegistryAuth{
+		"https://index.docker.io/v1/": {Username: "hub"},
+		"ghcr.io":                     {Username: "gh"},
+	})
+
+	tests := []struct {
+		spec docker.ContainerSpec
+		want string // username of the credentials used, "" for none
+	}{
+		{docker.ContainerSpec{Image: "nginx"}, "hub"},
+		{docker.ContainerSpec{Image: "ghcr.io/org/app:v1"}, "gh"},
+		{docker.ContainerSpec{Image: "registry.example.com/app"}, ""},
+		{docker.ContainerSpec{Image: "ghcr.io/org/app", RegistryAuth: &docker.RegistryAuth{Username: "own"}}, "own"},
+	}
+	for _, tt := range tests {
+		got := ""
+		if auth := cm.pullOptions(tt.spec).Auth; auth != nil {
+			got = auth.Username
+		}
+		if got != tt.want {
+			t.Errorf("pulling %s as %q, want %q", tt.spec.Image, got, tt.want)
+		}
+	}
+
+	// Replacing the credentials drops the old ones
+	cm.SetRegistryCredentials(nil)
+	if auth := cm.pullOptions(docker.ContainerSpec{Image: "nginx"}).Auth; auth != nil {
+		t.Errorf("pulling with %+v after the credentials were removed", auth)
+	}
+}
@@ -0,0 +1,88 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/manager"
+)
+
+// NodeRejection explains why a node could not take a container
+type NodeRejection struct {
+	NodeID string
+	Reason string
+}
+
+func (r NodeRejection) String() string {
+	return r.NodeID + ": " + r.Reason
+}
+
+// SchedulingError is returned when no node can take a container. It wraps
+// the underlying cause, usually ErrInsufficientCapacity, and lists why each
+// node was rejected.
+type SchedulingError struct {
+	Err        error
+	Rejections []NodeRejection
+}
+
+func (e *SchedulingError) Error() string {
+	if len(e.Rejections) == 0 {
+		return e.Err.Error()
+	}
+	reasons := make([]string, len(e.Rejections))
+	for i, r := range e.Rejections {
+		reasons[i] = r.String()
+	}
+	return fmt.Sprintf("%v (%s)", e.Err, strings.Join(reasons, "; "))
+}
+
+func (e *SchedulingError) Unwrap() error {
+	return e.Err
+}
+
+// unschedulableLocked returns a SchedulingError wrapping err that explains why
+// every node rejected spec. used holds the anti-affinity counts for spec's
+// key, if any. Caller must hold the lock.
+func (cm *ClusterManager) unschedulableLocked(spec docker.ContainerSpec, used map[string]int, err error) error {
+	conflicts := cm.antiAffinityLocked(spec.AntiAffinity)
+	var rejections []NodeRejection
+	for _, node := range cm.nodes {
+		rejections = append(rejections, NodeRejection{NodeID: node.ID, Reason: cm.rejectReasonLocked(node, spec, used, conflicts)})
+	}
+	sort.Slice(rejections, func(i, j int) bool { return rejections[i].NodeID < rejections[j].NodeID })
+	return &SchedulingError{Err: err, Rejections: rejections}
+}
+
+// rejectReasonLocked explains why node can't take spec. used and conflicts
+// count containers sharing spec's anti-affinity key and matching its
+// anti-affinity labels. Caller must hold the lock.
+func (cm *ClusterManager) rejectReasonLocked(node *Node, spec docker.ContainerSpec, used, conflicts map[string]int) string {
+	switch {
+	case !node.Healthy:
+		return "node unhealthy"
+	case node.Draining:
+		return "node draining"
+	case !node.MatchesSelector(spec.NodeSelector):
+		return "label mismatch"
+	case conflicts[node.ID] > 0:
+		return "runs a container labelled " + formatLabels(spec.AntiAffinity)
+	}
+	if port := cm.hostPortInUseLocked(node, spec); port != "" {
+		return "host port " + port + " in use"
+	}
+	if reason := cm.volumeConflictLocked(node, spec); reason != "" {
+		return reason
+	}
+	if reason := node.Resources.Shortfall(manager.ResourceSpecFor(spec)); reason != "" {
+		if burst := cm.burstReasonLocked(node, spec); spec.Burstable && burst != "" {
+			reason += "; " + burst
+		}
+		return reason
+	}
+	if used[node.ID] > 0 {
+		return fmt.Sprintf("already runs a container with anti-affinity key %q", spec.AntiAffinityKey)
+	}
+	return "not selected"
+}
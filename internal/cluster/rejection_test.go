@@ -0,0 +1,47 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"mini-cloud/internal/docker"
+)
+
+func TestScheduleExplainsRejections(t *testing.T) {
+	cpu, _ := newTestNode("cpu", 2, 4096)
+	mem, _ := newTestNode("mem", 8, 512)
+	hdd, _ := newTestNode("hdd", 16, 16384)
+	sick, _ := newTestNode("sick", 16, 16384)
+	drain, _ := newTestNode("drain", 16, 16384)
+	for _, n := range []*Node{cpu, mem, sick, drain} {
+		n.Labels = map[string]string{"disk": "ssd"}
+	}
+	hdd.Labels = map[string]string{"disk": "hdd"}
+	cm := newTestCluster(cpu, mem, hdd, sick, drain)
+	sick.Healthy = false
+	drain.Draining = true
+
+	_, err := cm.Schedule(context.Background(), docker.ContainerSpec{
+		Name: "web", Image: "nginx", CPU: 4, Memory: 1024,
+		NodeSelector: map[string]string{"disk": "ssd"},
+	})
+	var serr *SchedulingError
+	if !errors.As(err, &serr) {
+		t.Fatalf("Schedule error %v, want a SchedulingError", err)
+	}
+	if !errors.Is(err, ErrInsufficientCapacity) {
+		t.Errorf("error %v does not wrap ErrInsufficientCapacity", err)
+	}
+	want := []NodeRejection{
+		{"cpu", "insufficient CPU (need 4, free 2)"},
+		{"drain", "node draining"},
+		{"hdd", "label mismatch"},
+		{"mem", "insufficient memory (need 1024MB, free 512MB)"},
+		{"sick", "node unhealthy"},
+	}
+	if !reflect.DeepEqual(serr.Rejections, want) {
+		t.Errorf("rejections %v, want %v", serr.Rejections, want)
+	}
+}
@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	"context"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/events"
+)
+
+// StartRemediationLoop replaces containers whose probe action is "replace"
+// whenever their node's manager reports them unhealthy
+func (cm *ClusterManager) StartRemediationLoop(ctx context.Context) {
+	sub := cm.events.Subscribe()
+	go func() {
+		defer cm.events.Unsubscribe(sub)
+		for {
+			select {
+			case e := <-sub:
+				if e.Type == events.Unhealthy {
+					go cm.replaceUnhealthy(ctx, e.NodeID, e.ContainerID)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// replaceUnhealthy schedules a new copy of an unhealthy container, possibly
+// on another node, and removes the old one
+func (cm *ClusterManager) replaceUnhealthy(ctx context.Context, nodeID, id string) {
+	cm.mu.Lock()
+	node, ok := cm.nodes[nodeID]
+	cm.mu.Unlock()
+	if !ok {
+		return
+	}
+	info, err := node.Manager.GetContainerStatus(ctx, id)
+	if err != nil || info.Probe == nil || info.Probe.Action != docker.ProbeActionReplace {
+		return
+	}
+
+	moved, err := cm.replace(ctx, node, id)
+	switch {
+	case err != nil:
+		cm.log.Error("failed to replace unhealthy container", "name", info.Name, "container_id", id, "node_id", nodeID, "error", err)
+	case moved != nil:
+		cm.log.Info("replaced unhealthy container", "name", info.Name, "old_container_id", id, "container_id", moved.ID, "from_node_id", nodeID, "node_id", cm.assignmentOf(moved.ID))
+	}
+}
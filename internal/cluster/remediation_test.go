@@ -0,0 +1,44 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/manager"
+)
+
+func TestReplaceUnhealthy(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+
+	probe := &docker.Probe{Type: docker.ProbeTCP, Port: 80, Interval: time.Nanosecond, FailureThreshold: 1, Action: docker.ProbeActionReplace}
+	old := mustSchedule(t, cm, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1, Probe: probe})
+	keep := mustSchedule(t, cm, docker.ContainerSpec{Name: "api", Image: "nginx", CPU: 1,
+		Probe: &docker.Probe{Type: docker.ProbeTCP, Port: 80, Interval: time.Nanosecond, FailureThreshold: 1}})
+	rt.SetProbeResult(old.ID, docker.ProbeResult{Message: "connection refused"})
+	rt.SetProbeResult(keep.ID, docker.ProbeResult{Message: "connection refused"})
+	node.Manager.RunProbes(ctx)
+
+	cm.replaceUnhealthy(ctx, "node1", old.ID)
+	cm.replaceUnhealthy(ctx, "node1", keep.ID)
+
+	if _, ok := rt.Container(old.ID); ok {
+		t.Error("unhealthy container left on the node")
+	}
+	list, _ := cm.ListAllContainers(ctx, ListFilter{})
+	var web *manager.ContainerInfo
+	for _, info := range list {
+		if info.Name == "web" {
+			web = info
+		}
+	}
+	if web == nil || web.ID == old.ID || web.Status != "running" || web.Probe == nil {
+		t.Errorf("replacement %+v, want a new running web keeping its probe", web)
+	}
+	if info, _ := node.Manager.GetContainerStatus(ctx, keep.ID); info == nil || info.Status != manager.StatusUnhealthy {
+		t.Error("container without the replace action was replaced")
+	}
+}
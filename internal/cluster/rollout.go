@@ -0,0 +1,246 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/manager"
+)
+
+// Rollout states
+const (
+	RolloutProgressing = "progressing"
+	RolloutComplete    = "complete"
+	RolloutRolledBack  = "rolled back" // the update failed and the previous revision was restored
+)
+
+// DefaultProgressDeadline bounds how long a new replica may take to become healthy
+const DefaultProgressDeadline = 2 * time.Minute
+
+// RolloutStrategy bounds how far a rolling update strays from the desired
+// replica count
+type RolloutStrategy struct {
+	MaxUnavailable   int           // replicas that may be missing below the desired count
+	MaxSurge         int           // replicas that may run above the desired count
+	ProgressDeadline time.Duration // 0 for DefaultProgressDeadline
+}
+
+// DefaultRolloutStrategy starts one new replica before retiring an old one
+var DefaultRolloutStrategy = RolloutStrategy{MaxSurge: 1}
+
+// Validate checks that the strategy lets a rollout make progress
+func (s RolloutStrategy) Validate() error {
+	switch {
+	case s.MaxUnavailable < 0 || s.MaxSurge < 0 || s.ProgressDeadline < 0:
+		return errors.New("maxUnavailable, maxSurge and progressDeadline must not be negative")
+	case s.MaxUnavailable == 0 && s.MaxSurge == 0:
+		return errors.New("maxUnavailable and maxSurge must not both be 0")
+	}
+	return nil
+}
+
+func (s RolloutStrategy) deadline() time.Duration {
+	if s.ProgressDeadline > 0 {
+		return s.ProgressDeadline
+	}
+	return DefaultProgressDeadline
+}
+
+// revision is a template a deployment ran before an update
+type revision struct {
+	number   int
+	template docker.ContainerSpec
+}
+
+// RolloutStatus reports the progress of a deployment's latest update
+type RolloutStatus struct {
+	State     string // one of the Rollout* constants
+	Message   string // why the update was rolled back
+	UpdatedAt time.Time
+}
+
+// UpdateDeployment replaces the template of deployment name, e.g. to change
+// its image or resources, and rolls the replicas over to it in the
+// background within strategy's bounds. If a new replica can't be placed or
+// doesn't become healthy, the replicas of the new revision are removed and
+// the previous template is restored. A zero strategy keeps the deployment's.
+// The rollout outlives ctx and is stopped by Shutdown.
+func (cm *ClusterManager) UpdateDeployment(ctx context.Context, name string, template docker.ContainerSpec, strategy RolloutStrategy) (int, error) {
+	if template.Image == "" {
+		return 0, errors.New("template image is required")
+	}
+	if strategy != (RolloutStrategy{}) {
+		if err := strategy.Validate(); err != nil {
+			return 0, err
+		}
+	}
+
+	cm.mu.Lock()
+	d, ok := cm.deployments[name]
+	if !ok {
+		cm.mu.Unlock()
+		return 0, fmt.Errorf("%w: %s", ErrDeploymentNotFound, name)
+	}
+	if cm.ctx.Err() != nil {
+		cm.mu.Unlock()
+		return 0, ErrShuttingDown
+	}
+	if d.Rollout.State == RolloutProgressing {
+		cm.mu.Unlock()
+		return 0, fmt.Errorf("%w: %s", ErrRolloutInProgress, name)
+	}
+	if template.Namespace != d.Template.Namespace {
+		cm.mu.Unlock()
+		return 0, errors.New("the namespace of a deployment cannot change")
+	}
+	template.Name = ""
+	d.previous = &revision{number: d.Revision, template: d.Template}
+	d.Template = template
+	d.lastRevision++
+	d.Revision = d.lastRevision
+	if strategy != (RolloutStrategy{}) {
+		d.Strategy = strategy
+	}
+	d.Rollout = RolloutStatus{State: RolloutProgressing, UpdatedAt: time.Now()}
+	rev := d.Revision
+	cm.persistDeploymentsLocked()
+	cm.log.Info("rolling out deployment", "deployment", name, "revision", rev, "image", template.Image)
+	cm.startRolloutLocked(d)
+	cm.mu.Unlock()
+	return rev, nil
+}
+
+// startRolloutLocked runs the rollout of d in the background until it ends,
+// Shutdown is called or d.stopRollout cancels it. Caller must hold the lock.
+func (cm *ClusterManager) startRolloutLocked(d *Deployment) {
+	ctx, cancel := context.WithCancel(cm.ctx)
+	done := make(chan struct{})
+	d.stopRollout = func() {
+		cancel()
+		<-done
+	}
+	cm.rollouts.Add(1) // under the lock, so that Shutdown waits for it
+	go func() {
+		defer cm.rollouts.Done()
+		defer close(done)
+		defer cancel()
+		cm.rollout(ctx, d.Name)
+	}()
+}
+
+// rollout rolls the replicas of deployment name over to its current
+// revision, or back to the previous one if that fails
+func (cm *ClusterManager) rollout(ctx context.Context, name string) {
+	err := cm.rollForward(ctx, name)
+	if ctx.Err() != nil {
+		// Shutting down or deleted; a persisted deployment resumes the rollout
+		// when it is restored
+		cm.log.Warn("deployment rollout interrupted", "deployment", name, "error", err)
+		return
+	}
+
+	cm.mu.Lock()
+	d, ok := cm.deployments[name]
+	if !ok {
+		cm.mu.Unlock()
+		return // deleted meanwhile
+	}
+	failed := d.Revision
+	if err == nil {
+		d.previous = nil
+		d.Rollout = RolloutStatus{State: RolloutComplete, UpdatedAt: time.Now()}
+		cm.persistDeploymentsLocked()
+		cm.mu.Unlock()
+		cm.log.Info("deployment rolled out", "deployment", name, "revision", failed)
+		_ = cm.reconcileDeployment(ctx, name)
+		return
+	}
+
+	d.Template, d.Revision = d.previous.template, d.previous.number
+	d.previous = nil
+	var doomed []replica
+	for _, r := range cm.deploymentReplicasLocked(d) {
+		if replicaRevision(r.info) == failed {
+			doomed = append(doomed, r)
+		}
+	}
+	d.Rollout = RolloutStatus{State: RolloutRolledBack, Message: err.Error(), UpdatedAt: time.Now()}
+	cm.persistDeploymentsLocked()
+	cm.mu.Unlock()
+
+	cm.log.Error("deployment rollout failed, rolling back", "deployment", name, "revision", failed, "error", err)
+	if err := cm.scaleDown(ctx, doomed); err != nil {
+		cm.log.Warn("failed to remove replicas of failed revision", "deployment", name, "error", err)
+	}
+	if err := cm.reconcileDeployment(ctx, name); err != nil {
+		cm.log.Warn("failed to restore deployment replicas", "deployment", name, "error", err)
+	}
+}
+
+// rollForward starts replicas of the current revision of deployment name and
+// retires the others, never running more than MaxSurge replicas over the
+// desired count nor fewer than MaxUnavailable under it. Each new replica must
+// become healthy within the progress deadline.
+func (cm *ClusterManager) rollForward(ctx context.Context, name string) error {
+	for {
+		cm.mu.Lock()
+		d, ok := cm.deployments[name]
+		if !ok {
+			cm.mu.Unlock()
+			return fmt.Errorf("%w: %s", ErrDeploymentNotFound, name)
+		}
+		want, strategy, rev, template := d.Replicas, d.Strategy, d.Revision, d.replicaTemplate()
+		var old, current, all []replica
+		for _, r := range cm.deploymentReplicasLocked(d) {
+			all = append(all, r)
+			switch {
+			case failedReplica(r.info):
+				// Left for the deployment loop to replace once the rollout is over
+			case replicaRevision(r.info) == rev:
+				current = append(current, r)
+			default:
+				old = append(old, r)
+			}
+		}
+		cm.mu.Unlock()
+
+		if len(old) == 0 && len(current) >= want {
+			return nil
+		}
+		if start := min(want-len(current), want+strategy.MaxSurge-len(old)-len(current)); start > 0 {
+			// Replicas placed before an error are removed by the rollback
+			started, err := cm.scaleUp(ctx, name, template, all, start)
+			if err != nil {
+				return err
+			}
+			if err := cm.waitReplicasHealthy(ctx, started, strategy.deadline()); err != nil {
+				return err
+			}
+			continue
+		}
+		if retire := min(len(old), len(old)+len(current)-(want-strategy.MaxUnavailable)); retire > 0 {
+			// Highest indexes first, like scaling down
+			if err := cm.scaleDown(ctx, old[len(old)-retire:]); err != nil {
+				return err
+			}
+			continue
+		}
+		return errors.New("rollout cannot make progress")
+	}
+}
+
+// waitReplicasHealthy waits up to deadline for every replica in infos to be
+// healthy
+func (cm *ClusterManager) waitReplicasHealthy(ctx context.Context, infos []*manager.ContainerInfo, deadline time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, deadline)
+	defer cancel()
+	for _, info := range infos {
+		if err := cm.WaitHealthy(ctx, info.ID); err != nil {
+			return fmt.Errorf("%s did not become healthy: %w", info.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/docker/dockertest"
+)
+
+// waitRollout waits for the rollout of deployment name to finish and returns its state
+func waitRollout(t *testing.T, cm *ClusterManager, name string) RolloutStatus {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status, err := cm.Deployment(name)
+		if err != nil {
+			t.Fatalf("Deployment(%s): %v", name, err)
+		}
+		if status.Rollout.State != RolloutProgressing {
+			return status.Rollout
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("rollout did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRolloutStrategyValidate(t *testing.T) {
+	tests := []struct {
+		s     RolloutStrategy
+		valid bool
+	}{
+		{RolloutStrategy{MaxSurge: 1}, true},
+		{RolloutStrategy{MaxUnavailable: 1}, true},
+		{RolloutStrategy{}, false},
+		{RolloutStrategy{MaxSurge: -1, MaxUnavailable: 2}, false},
+		{RolloutStrategy{MaxSurge: 1, ProgressDeadline: -time.Second}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.s.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%+v) = %v, want valid %v", tt.s, err, tt.valid)
+		}
+	}
+}
+
+func TestRolloutOutlivesRequest(t *testing.T) {
+	node, _ := newTestNode("node1", 8, 8192)
+	cm := newTestCluster(node)
+	if err := cm.CreateDeployment(context.Background(), Deployment{Name: "web", Template: docker.ContainerSpec{Image: "nginx:1", CPU: 1}, Replicas: 2}); err != nil {
+		t.Fatalf("CreateDeployment: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rev, err := cm.UpdateDeployment(ctx, "web", docker.ContainerSpec{Image: "nginx:2", CPU: 1}, RolloutStrategy{})
+	if err != nil {
+		t.Fatalf("UpdateDeployment: %v", err)
+	}
+	cancel() // the request is over
+	if rev != 2 {
+		t.Errorf("revision %d, want 2", rev)
+	}
+
+	if got := waitRollout(t, cm, "web"); got.State != RolloutComplete {
+		t.Fatalf("rollout = %+v, want complete", got)
+	}
+	status, _ := cm.Deployment("web")
+	if len(status.Containers) != 2 || status.Revision != 2 {
+		t.Fatalf("%d replicas at revision %d, want 2 at revision 2", len(status.Containers), status.Revision)
+	}
+	for _, info := range status.Containers {
+		if info.Image != "nginx:2" || replicaRevision(info) != 2 {
+			t.Errorf("%s runs %s at revision %d after the rollout", info.Name, info.Image, replicaRevision(info))
+		}
+	}
+}
+
+func TestRolloutRollsBack(t *testing.T) {
+	node, rt := newTestNode("node1", 8, 8192)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+	if err := cm.CreateDeployment(ctx, Deployment{Name: "web", Template: docker.ContainerSpec{Image: "nginx:1", CPU: 1}, Replicas: 3}); err != nil {
+		t.Fatalf("CreateDeployment: %v", err)
+	}
+
+	// The first new replica starts, the second can't be pulled once released
+	pulls := 0
+	release := make(chan struct{})
+	rt.SetHook(func(ctx context.Context, op, arg string) error {
+		if op == "PullImage" && arg == "nginx:bad" {
+			if pulls++; pulls > 1 {
+				<-release
+				return dockertest.ErrInjected
+			}
+		}
+		return nil
+	})
+	if _, err := cm.UpdateDeployment(ctx, "web", docker.ContainerSpec{Image: "nginx:bad", CPU: 1}, RolloutStrategy{MaxSurge: 1, MaxUnavailable: 1}); err != nil {
+		t.Fatalf("UpdateDeployment: %v", err)
+	}
+	if _, err := cm.UpdateDeployment(ctx, "web", docker.ContainerSpec{Image: "nginx:3", CPU: 1}, RolloutStrategy{}); !errors.Is(err, ErrRolloutInProgress) {
+		t.Errorf("updating during a rollout: err = %v, want ErrRolloutInProgress", err)
+	}
+	close(release)
+
+	got := waitRollout(t, cm, "web")
+	if got.State != RolloutRolledBack || got.Message == "" {
+		t.Fatalf("rollout = %+v, want rolled back with the error", got)
+	}
+	status, _ := cm.Deployment("web")
+	if status.Revision != 1 || status.Template.Image != "nginx:1" {
+		t.Errorf("deployment at revision %d running %s, want revision 1 restored", status.Revision, status.Template.Image)
+	}
+	if len(status.Containers) != 3 || status.Ready != 3 {
+		t.Fatalf("%d replicas, %d ready after the rollback; want 3", len(status.Containers), status.Ready)
+	}
+	for _, info := range status.Containers {
+		if info.Image != "nginx:1" {
+			t.Errorf("%s runs %s after the rollback", info.Name, info.Image)
+		}
+	}
+
+	// Revision numbers are not reused
+	rt.SetHook(nil)
+	if rev, err := cm.UpdateDeployment(ctx, "web", docker.ContainerSpec{Image: "nginx:3", CPU: 1}, RolloutStrategy{}); err != nil || rev != 3 {
+		t.Errorf("next update: revision %d, %v; want 3", rev, err)
+	}
+	waitRollout(t, cm, "web")
+}
+
+func TestShutdownStopsRollouts(t *testing.T) {
+	node, rt := newTestNode("node1", 8, 8192)
+	cm := newTestCluster(node)
+	if err := cm.CreateDeployment(context.Background(), Deployment{Name: "web", Template: docker.ContainerSpec{Image: "nginx:1", CPU: 1}, Replicas: 1}); err != nil {
+		t.Fatalf("CreateDeployment: %v", err)
+	}
+
+	// New replicas hang in the pull until their context is cancelled
+	pulling := make(chan struct{}, 1)
+	rt.SetHook(func(ctx context.Context, op, arg string) error {
+		if op == "PullImage" && arg == "nginx:2" {
+			pulling <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+	if _, err := cm.UpdateDeployment(context.Background(), "web", docker.ContainerSpec{Image: "nginx:2", CPU: 1}, RolloutStrategy{}); err != nil {
+		t.Fatalf("UpdateDeployment: %v", err)
+	}
+	<-pulling
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := cm.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := cm.UpdateDeployment(context.Background(), "web", docker.ContainerSpec{Image: "nginx:3", CPU: 1}, RolloutStrategy{}); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("UpdateDeployment after Shutdown: err = %v, want ErrShuttingDown", err)
+	}
+}
+
+func TestDeleteDeploymentStopsRollout(t *testing.T) {
+	node, rt := newTestNode("node1", 8, 8192)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+	if err := cm.CreateDeployment(ctx, Deployment{Name: "web", Template: docker.ContainerSpec{Image: "nginx:1", CPU: 1}, Replicas: 2}); err != nil {
+		t.Fatalf("CreateDeployment: %v", err)
+	}
+
+	// The new replica hangs in the pull until the rollout is cancelled
+	pulling, cancelled := make(chan struct{}, 1), make(chan struct{})
+	rt.SetHook(func(ctx context.Context, op, arg string) error {
+		if op == "PullImage" && arg == "nginx:2" {
+			pulling <- struct{}{}
+			<-ctx.Done()
+			close(cancelled)
+			return ctx.Err()
+		}
+		return nil
+	})
+	if _, err := cm.UpdateDeployment(ctx, "web", docker.ContainerSpec{Image: "nginx:2", CPU: 1}, RolloutStrategy{}); err != nil {
+		t.Fatalf("UpdateDeployment: %v", err)
+	}
+	<-pulling
+
+	if err := cm.DeleteDeployment(ctx, "web"); err != nil {
+		t.Fatalf("DeleteDeployment: %v", err)
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Error("rollout still running after the deployment was deleted")
+	}
+	if left := rt.Containers(); len(left) != 0 {
+		t.Errorf("%d containers left after the deployment was deleted", len(left))
+	}
+}
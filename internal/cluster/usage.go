@@ -0,0 +1,228 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/manager"
+)
+
+// OvercommitPolicy lets burstable containers onto nodes whose reservations
+// are full but whose measured usage leaves room. The zero value disables it.
+type OvercommitPolicy struct {
+	// CPU and Memory multiply each node's schedulable capacity for burstable
+	// containers, e.g. 2 lets reservations reach twice the cores; 0 means 1
+	CPU    float64
+	Memory float64
+	// MaxUtilization is the fraction of a node's schedulable CPU and memory
+	// it may be measured using, counting the new container's request
+	MaxUtilization float64
+}
+
+// Validate checks that the factors are at least 1 and MaxUtilization is a
+// fraction when the policy is enabled
+func (p OvercommitPolicy) Validate() error {
+	switch {
+	case p.CPU != 0 && p.CPU < 1, p.Memory != 0 && p.Memory < 1:
+		return errors.New("overcommit factors must be at least 1")
+	case p.enabled() && (p.MaxUtilization <= 0 || p.MaxUtilization > 1):
+		return errors.New("maxUtilization must be in (0, 1]")
+	}
+	return nil
+}
+
+func (p OvercommitPolicy) enabled() bool {
+	return p.CPU > 1 || p.Memory > 1
+}
+
+func (p OvercommitPolicy) cpuFactor() float64    { return max(p.CPU, 1) }
+func (p OvercommitPolicy) memoryFactor() float64 { return max(p.Memory, 1) }
+
+// NodeUsage is what a node's containers were measured using
+type NodeUsage struct {
+	CPU       float64 // in cores
+	MemoryMB  int64
+	SampledAt time.Time
+}
+
+// DefaultUsageMaxAge is how old a usage sample may be before burstable
+// containers stop being placed on the node, unless StartUsageLoop sets it
+const DefaultUsageMaxAge = 2 * time.Minute
+
+// usageConcurrency bounds the stats requests in flight to one node
+const usageConcurrency = 8
+
+// SetOvercommitPolicy sets how far burstable containers may overcommit nodes
+func (cm *ClusterManager) SetOvercommitPolicy(p OvercommitPolicy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.overcommit = p
+	return nil
+}
+
+// NodeUsage returns the latest usage sample of a node, if any
+func (cm *ClusterManager) NodeUsage(nodeID string) (NodeUsage, bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	u, ok := cm.usage[nodeID]
+	return u, ok
+}
+
+// SampleUsage measures the CPU and memory used by every node's containers.
+// Nodes that can't be measured keep their previous sample until it ages out.
+func (cm *ClusterManager) SampleUsage(ctx context.Context) {
+	for _, node := range cm.Nodes() {
+		usage, err := sampleNode(ctx, node)
+		if err != nil {
+			cm.log.Warn("failed to sample node usage", "node_id", node.ID, "error", err)
+			continue
+		}
+		cm.mu.Lock()
+		cm.usage[node.ID] = usage
+		cm.mu.Unlock()
+	}
+}
+
+// sampleNode sums the stats of the containers on node
+func sampleNode(ctx context.Context, node *Node) (NodeUsage, error) {
+	containers, err := node.Manager.ListActiveContainers(ctx)
+	if err != nil {
+		return NodeUsage{}, err
+	}
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		usage NodeUsage
+		errs  []error
+	)
+	sem := make(chan struct{}, usageConcurrency)
+	for _, info := range containers {
+		if info.Status != "running" {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(info *manager.ContainerInfo) {
+			defer func() { <-sem; wg.Done() }()
+
+			sctx, cancel := context.WithTimeout(ctx, statsTimeout)
+			stats, err := node.Docker.Stats(sctx, info.ID)
+			cancel()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("stats for %s: %w", info.Name, err))
+				return
+			}
+			usage.CPU += stats.CPUPercent / 100
+			usage.MemoryMB += stats.MemoryUsageMB
+		}(info)
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return NodeUsage{}, err
+	}
+	usage.SampledAt = time.Now()
+	return usage, nil
+}
+
+// StartUsageLoop samples node usage every interval. Samples older than three
+// intervals no longer let burstable containers onto a node.
+func (cm *ClusterManager) StartUsageLoop(ctx context.Context, interval time.Duration) {
+	cm.mu.Lock()
+	cm.usageMaxAge = 3 * interval
+	cm.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		cm.SampleUsage(ctx)
+		for {
+			select {
+			case <-ticker.C:
+				cm.SampleUsage(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// burstReasonLocked explains why a burstable spec can't overcommit node, or
+// returns "". Caller must hold the lock.
+func (cm *ClusterManager) burstReasonLocked(node *Node, spec docker.ContainerSpec) string {
+	p := cm.overcommit
+	if !p.enabled() {
+		return "overcommit disabled"
+	}
+	need := manager.ResourceSpecFor(spec)
+	if !node.Resources.CanOvercommit(need, p.cpuFactor(), p.memoryFactor()) {
+		return "overcommit limit reached"
+	}
+
+	u, ok := cm.usage[node.ID]
+	if !ok || time.Since(u.SampledAt) > cm.usageMaxAge {
+		return "no recent usage sample"
+	}
+	cpu, memory := node.Resources.SchedulableCPU(), node.Resources.SchedulableMemory()
+	if u.CPU+need.CPU > p.MaxUtilization*cpu {
+		return fmt.Sprintf("too busy to burst (using %.2f of %g cores)", u.CPU, cpu)
+	}
+	if float64(u.MemoryMB)+float64(need.Memory) > p.MaxUtilization*float64(memory) {
+		return fmt.Sprintf("too busy to burst (using %dMB of %dMB)", u.MemoryMB, memory)
+	}
+	return ""
+}
+
+// burstFitLocked picks the least utilized node passing filter that a
+// burstable spec may overcommit, or nil. Caller must hold the lock.
+func (cm *ClusterManager) burstFitLocked(spec docker.ContainerSpec, filter func(*Node) bool) *Node {
+	var best *Node
+	var bestUtil float64
+	for _, node := range cm.nodes {
+		if !node.schedulable() || (filter != nil && !filter(node)) || cm.burstReasonLocked(node, spec) != "" {
+			continue
+		}
+		u := cm.usage[node.ID]
+		util := max(u.CPU/node.Resources.SchedulableCPU(), float64(u.MemoryMB)/float64(node.Resources.SchedulableMemory()))
+		if best == nil || util < bestUtil || (util == bestUtil && node.ID < best.ID) {
+			best, bestUtil = node, util
+		}
+	}
+	return best
+}
+
+// allocateLocked reserves spec's resources on node, overcommitting it if spec
+// is burstable and the policy allows. Caller must hold the lock.
+func (cm *ClusterManager) allocateLocked(node *Node, spec docker.ContainerSpec) bool {
+	need := manager.ResourceSpecFor(spec)
+	if node.Resources.Allocate(spec.Name, need) {
+		return true
+	}
+	if !spec.Burstable || cm.burstReasonLocked(node, spec) != "" {
+		return false
+	}
+	p := cm.overcommit
+	if !node.Resources.AllocateOvercommitted(spec.Name, need, p.cpuFactor(), p.memoryFactor()) {
+		return false
+	}
+
+	// Count the container as busy until the next sample measures it
+	u := cm.usage[node.ID]
+	u.CPU += need.CPU
+	u.MemoryMB += int64(need.Memory)
+	cm.usage[node.ID] = u
+	cm.log.Info("overcommitting node for burstable container", "node_id", node.ID, "name", spec.Name)
+	return true
+}
@@ -0,0 +1,58 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"mini-cloud/internal/docker"
+)
+
+func TestBurstableOvercommit(t *testing.T) {
+	node, rt := newTestNode("node1", 2, 2048)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+
+	if err := cm.SetOvercommitPolicy(OvercommitPolicy{CPU: 2}); err == nil {
+		t.Error("policy without a utilization limit accepted")
+	}
+	if err := cm.SetOvercommitPolicy(OvercommitPolicy{CPU: 2, MaxUtilization: 0.8}); err != nil {
+		t.Fatalf("SetOvercommitPolicy: %v", err)
+	}
+	base := mustSchedule(t, cm, docker.ContainerSpec{Name: "base", Image: "nginx", CPU: 2, Memory: 1024})
+	burst := func(name string) docker.ContainerSpec {
+		return docker.ContainerSpec{Name: name, Image: "nginx", CPU: 1, Memory: 256, Burstable: true}
+	}
+
+	_, err := cm.Schedule(ctx, burst("early"))
+	var serr *SchedulingError
+	if !errors.As(err, &serr) || len(serr.Rejections) != 1 {
+		t.Fatalf("before any sample: err = %v, want a SchedulingError", err)
+	}
+	if want := "insufficient CPU (need 1, free 0); no recent usage sample"; serr.Rejections[0].Reason != want {
+		t.Errorf("rejected with %q, want %q", serr.Rejections[0].Reason, want)
+	}
+
+	rt.SetStats(base.ID, docker.ContainerStats{CPUPercent: 20, MemoryUsageMB: 200})
+	cm.SampleUsage(ctx)
+	if u, ok := cm.NodeUsage("node1"); !ok || u.CPU != 0.2 || u.MemoryMB != 200 {
+		t.Errorf("sampled usage %+v, want 0.2 cores and 200MB", u)
+	}
+
+	if _, err := cm.Schedule(ctx, docker.ContainerSpec{Name: "guaranteed", Image: "nginx", CPU: 1, Memory: 256}); !errors.Is(err, ErrInsufficientCapacity) {
+		t.Errorf("non-burstable container on a full node: err = %v, want ErrInsufficientCapacity", err)
+	}
+	mustSchedule(t, cm, burst("worker-0"))
+	if used := node.Resources.Usage().CPU; used != 3 {
+		t.Errorf("reserved %g cores, want 3 with the burstable container", used)
+	}
+
+	// The placed container counts as busy until the next sample
+	_, err = cm.Schedule(ctx, burst("worker-1"))
+	if !errors.As(err, &serr) {
+		t.Fatalf("second burstable container: err = %v, want a SchedulingError", err)
+	}
+	if want := "insufficient CPU (need 1, free 0); too busy to burst (using 1.20 of 2 cores)"; serr.Rejections[0].Reason != want {
+		t.Errorf("rejected with %q, want %q", serr.Rejections[0].Reason, want)
+	}
+}
@@ -0,0 +1,351 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/events"
+)
+
+// Labels on the volumes mini-cloud creates, from which the cluster rebuilds
+// its view of them
+const (
+	VolumeNamespaceLabel = "mini-cloud.namespace"
+	VolumeOwnerLabel     = "mini-cloud.owner"            // container whose mount created the volume
+	VolumeExpiryLabel    = "mini-cloud.remove-on-expiry" // "true" to remove it when the owner expires
+)
+
+var (
+	// ErrVolumeNotFound is returned for volumes the cluster does not know
+	ErrVolumeNotFound = errors.New("volume not found")
+	// ErrVolumeExists is returned when creating a volume whose name is taken on the node
+	ErrVolumeExists = errors.New("volume already exists")
+	// ErrVolumeInUse is returned when deleting a volume a container still mounts
+	ErrVolumeInUse = errors.New("volume is in use")
+)
+
+// Volume is a named volume on one node, owned by a namespace
+type Volume struct {
+	Name           string
+	NodeID         string
+	Namespace      string
+	Owner          string // name of the container whose mount created it; empty if created through the API
+	RemoveOnExpiry bool   // removed once Owner expires and nothing else mounts it
+	CreatedAt      time.Time
+	UsedBy         []string // IDs of the containers mounting it
+
+	created bool // false while CreateVolume waits for Docker
+}
+
+// volumeKey identifies a volume: Docker volume names are unique per node
+type volumeKey struct {
+	node string
+	name string
+}
+
+// VolumeFilter selects volumes in Volumes. Zero values match everything.
+type VolumeFilter struct {
+	Node      string
+	Namespace string
+}
+
+// volumeLabels returns the Docker labels recording v's owner and policy
+func volumeLabels(v *Volume) map[string]string {
+	labels := map[string]string{VolumeNamespaceLabel: v.Namespace}
+	if v.Owner != "" {
+		labels[VolumeOwnerLabel] = v.Owner
+	}
+	if v.RemoveOnExpiry {
+		labels[VolumeExpiryLabel] = "true"
+	}
+	return labels
+}
+
+// volumeFromDocker rebuilds a volume's metadata from its labels
+func volumeFromDocker(nodeID string, v docker.Volume) *Volume {
+	expiry, _ := strconv.ParseBool(v.Labels[VolumeExpiryLabel])
+	return &Volume{
+		Name:           v.Name,
+		NodeID:         nodeID,
+		Namespace:      v.Labels[VolumeNamespaceLabel],
+		Owner:          v.Labels[VolumeOwnerLabel],
+		RemoveOnExpiry: expiry,
+		CreatedAt:      v.CreatedAt,
+		created:        true,
+	}
+}
+
+// CreateVolume creates a named volume on nodeID for namespace
+func (cm *ClusterManager) CreateVolume(ctx context.Context, nodeID, namespace, name string) (*Volume, error) {
+	cm.mu.Lock()
+	node, ok := cm.nodes[nodeID]
+	if !ok {
+		cm.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, nodeID)
+	}
+	key := volumeKey{nodeID, name}
+	if _, taken := cm.volumes[key]; taken {
+		cm.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s on %s", ErrVolumeExists, name, nodeID)
+	}
+	// Claim the name while Docker creates the volume
+	v := &Volume{Name: name, NodeID: nodeID, Namespace: namespace, CreatedAt: time.Now()}
+	cm.volumes[key] = v
+	cm.mu.Unlock()
+
+	if err := node.Docker.CreateVolume(ctx, name, volumeLabels(v)); err != nil {
+		cm.mu.Lock()
+		delete(cm.volumes, key)
+		cm.mu.Unlock()
+		return nil, fmt.Errorf("failed to create volume: %w", err)
+	}
+	cm.mu.Lock()
+	v.created = true
+	out := *v
+	cm.mu.Unlock()
+	cm.log.Info("volume created", "node_id", nodeID, "volume", name, "namespace", namespace)
+	return &out, nil
+}
+
+// Volumes lists the volumes matching filter with the containers using them,
+// sorted by node and name
+func (cm *ClusterManager) Volumes(filter VolumeFilter) []Volume {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	var out []Volume
+	for key, v := range cm.volumes {
+		if (filter.Node != "" && filter.Node != v.NodeID) || (filter.Namespace != "" && filter.Namespace != v.Namespace) {
+			continue
+		}
+		vol := *v
+		vol.UsedBy = cm.volumeUsersLocked(key)
+		out = append(out, vol)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].NodeID != out[j].NodeID {
+			return out[i].NodeID < out[j].NodeID
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// DeleteVolume removes a volume no container mounts. A non-empty namespace
+// only finds volumes of that namespace.
+func (cm *ClusterManager) DeleteVolume(ctx context.Context, nodeID, namespace, name string) error {
+	cm.mu.Lock()
+	key := volumeKey{nodeID, name}
+	v, ok := cm.volumes[key]
+	if !ok || (namespace != "" && v.Namespace != namespace) {
+		cm.mu.Unlock()
+		return fmt.Errorf("%w: %s on %s", ErrVolumeNotFound, name, nodeID)
+	}
+	if users := cm.volumeUsersLocked(key); len(users) > 0 {
+		cm.mu.Unlock()
+		return fmt.Errorf("%w by %d container(s)", ErrVolumeInUse, len(users))
+	}
+	node := cm.nodes[nodeID]
+	// Untrack first so that nothing is scheduled onto the volume meanwhile
+	delete(cm.volumes, key)
+	cm.mu.Unlock()
+
+	if err := node.Docker.RemoveVolume(ctx, name); err != nil {
+		cm.mu.Lock()
+		cm.volumes[key] = v
+		cm.mu.Unlock()
+		return fmt.Errorf("failed to remove volume: %w", err)
+	}
+	cm.log.Info("volume removed", "node_id", nodeID, "volume", name)
+	return nil
+}
+
+// volumeUsersLocked returns the IDs of running containers mounting the
+// volume, plus the names of containers being placed with it. Caller must
+// hold the lock.
+func (cm *ClusterManager) volumeUsersLocked(key volumeKey) []string {
+	var users []string
+	if node, ok := cm.nodes[key.node]; ok {
+		containers, _ := node.Manager.ListActiveContainers(context.Background())
+		for _, info := range containers {
+			if mountsVolume(info.Mounts, key.name) {
+				users = append(users, info.ID)
+			}
+		}
+	}
+	for name, p := range cm.pending {
+		if p.nodeID == key.node && mountsVolume(p.spec.Mounts, key.name) {
+			users = append(users, name)
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+// hasVolumeMounts reports whether spec mounts any named volume
+func hasVolumeMounts(spec docker.ContainerSpec) bool {
+	for _, m := range spec.Mounts {
+		if m.Type == docker.MountVolume {
+			return true
+		}
+	}
+	return false
+}
+
+// mountsVolume reports whether mounts include the named volume
+func mountsVolume(mounts []docker.Mount, name string) bool {
+	for _, m := range mounts {
+		if m.Type == docker.MountVolume && m.Source == name {
+			return true
+		}
+	}
+	return false
+}
+
+// volumeConflictLocked explains why spec's named volumes rule out node, or
+// returns "". A volume must belong to spec's namespace, and a container whose
+// namespace already has the volume on another node must follow it there.
+// Caller must hold the lock.
+func (cm *ClusterManager) volumeConflictLocked(node *Node, spec docker.ContainerSpec) string {
+	for _, m := range spec.Mounts {
+		if m.Type != docker.MountVolume {
+			continue
+		}
+		if v, ok := cm.volumes[volumeKey{node.ID, m.Source}]; ok {
+			if v.Namespace != spec.Namespace {
+				return fmt.Sprintf("volume %s belongs to another namespace", m.Source)
+			}
+			continue
+		}
+		for key, v := range cm.volumes {
+			if key.name == m.Source && v.Namespace == spec.Namespace {
+				return fmt.Sprintf("volume %s is on %s", m.Source, key.node)
+			}
+		}
+	}
+	return ""
+}
+
+// ensureVolumes creates the named volumes spec mounts that node doesn't have
+// yet, owned by spec's container
+func (cm *ClusterManager) ensureVolumes(ctx context.Context, node *Node, spec docker.ContainerSpec) error {
+	for _, m := range spec.Mounts {
+		if m.Type != docker.MountVolume {
+			continue
+		}
+		key := volumeKey{node.ID, m.Source}
+		cm.mu.Lock()
+		_, exists := cm.volumes[key]
+		cm.mu.Unlock()
+		if exists {
+			continue
+		}
+
+		v := &Volume{
+			Name:           m.Source,
+			NodeID:         node.ID,
+			Namespace:      spec.Namespace,
+			Owner:          spec.Name,
+			RemoveOnExpiry: m.RemoveOnExpiry,
+			CreatedAt:      time.Now(),
+			created:        true,
+		}
+		if err := node.Docker.CreateVolume(ctx, m.Source, volumeLabels(v)); err != nil {
+			return fmt.Errorf("failed to create volume %s: %w", m.Source, err)
+		}
+		cm.mu.Lock()
+		if _, exists := cm.volumes[key]; !exists {
+			cm.volumes[key] = v
+		}
+		cm.mu.Unlock()
+	}
+	return nil
+}
+
+// volumeSyncTimeout bounds listing one node's volumes
+const volumeSyncTimeout = 10 * time.Second
+
+// SyncVolumes reloads every node's volumes from its runtime, picking up
+// volumes created before a restart. Nodes that can't be asked keep what is known.
+func (cm *ClusterManager) SyncVolumes(ctx context.Context) {
+	for _, node := range cm.Nodes() {
+		listCtx, cancel := context.WithTimeout(ctx, volumeSyncTimeout)
+		volumes, err := node.Docker.ListVolumes(listCtx)
+		cancel()
+		if err != nil {
+			cm.log.Warn("failed to list volumes", "node_id", node.ID, "error", err)
+			continue
+		}
+
+		cm.mu.Lock()
+		seen := make(map[string]bool, len(volumes))
+		for _, dv := range volumes {
+			seen[dv.Name] = true
+			key := volumeKey{node.ID, dv.Name}
+			if _, ok := cm.volumes[key]; !ok {
+				cm.volumes[key] = volumeFromDocker(node.ID, dv)
+			}
+		}
+		for key := range cm.volumes {
+			if v := cm.volumes[key]; key.node == node.ID && !seen[key.name] && v.created {
+				delete(cm.volumes, key)
+			}
+		}
+		cm.mu.Unlock()
+	}
+}
+
+// removeExpiredVolumes removes the volumes on nodeID created by the expired
+// container owner with RemoveOnExpiry set, unless something else mounts them
+func (cm *ClusterManager) removeExpiredVolumes(ctx context.Context, nodeID, owner string) {
+	cm.mu.Lock()
+	var names []string
+	for key, v := range cm.volumes {
+		if key.node == nodeID && v.Owner == owner && v.RemoveOnExpiry {
+			names = append(names, key.name)
+		}
+	}
+	cm.mu.Unlock()
+
+	for _, name := range names {
+		err := cm.DeleteVolume(ctx, nodeID, "", name)
+		switch {
+		case errors.Is(err, ErrVolumeInUse):
+			cm.log.Info("keeping volume of expired container, still in use", "node_id", nodeID, "volume", name)
+		case err != nil:
+			cm.log.Warn("failed to remove volume of expired container", "node_id", nodeID, "volume", name, "error", err)
+		default:
+			cm.log.Info("removed volume of expired container", "node_id", nodeID, "volume", name, "owner", owner)
+		}
+	}
+}
+
+// StartVolumeLoop loads the nodes' volumes, resyncs them every interval and
+// removes volumes marked RemoveOnExpiry once their owner expires
+func (cm *ClusterManager) StartVolumeLoop(ctx context.Context, interval time.Duration) {
+	sub := cm.events.Subscribe()
+	cm.SyncVolumes(ctx)
+	go func() {
+		defer cm.events.Unsubscribe(sub)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				cm.SyncVolumes(ctx)
+			case e := <-sub:
+				if e.Type == events.Expired {
+					cm.removeExpiredVolumes(ctx, e.NodeID, e.Name)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,139 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"mini-cloud/internal/docker"
+)
+
+// withVolume returns a spec in namespace ns mounting the named volume
+func withVolume(name, ns, volume string) docker.ContainerSpec {
+	return docker.ContainerSpec{Name: name, Namespace: ns, Image: "postgres", CPU: 0.5,
+		Mounts: []docker.Mount{{Type: docker.MountVolume, Source: volume, Target: "/data"}}}
+}
+
+func TestVolumesTieContainersToNode(t *testing.T) {
+	node1, rt1 := newTestNode("node1", 4, 4096)
+	node2, _ := newTestNode("node2", 4, 4096)
+	cm := newTestCluster(node1, node2)
+	cm.SetStrategy(StrategySpread)
+	ctx := context.Background()
+
+	first := mustSchedule(t, cm, withVolume("db-0", "a", "pgdata"))
+	second := mustSchedule(t, cm, withVolume("db-1", "a", "pgdata"))
+	if first.NodeID != second.NodeID {
+		t.Errorf("containers sharing pgdata on %s and %s, want the node holding it", first.NodeID, second.NodeID)
+	}
+	if vols, _ := rt1.ListVolumes(ctx); first.NodeID == "node1" && len(vols) != 1 {
+		t.Errorf("volumes on node1's runtime: %+v, want pgdata", vols)
+	}
+
+	// Another namespace gets its own volume of the same name elsewhere
+	other := mustSchedule(t, cm, withVolume("db", "b", "pgdata"))
+	if other.NodeID == first.NodeID {
+		t.Errorf("namespace b mounted namespace a's pgdata on %s", other.NodeID)
+	}
+
+	vols := cm.Volumes(VolumeFilter{Namespace: "a"})
+	if len(vols) != 1 || vols[0].Owner != "db-0" || !reflect.DeepEqual(vols[0].UsedBy, sortedIDs(first.ID, second.ID)) {
+		t.Fatalf("volumes of a: %+v, want pgdata owned by db-0 and used by both", vols)
+	}
+	if err := cm.DeleteVolume(ctx, first.NodeID, "a", "pgdata"); !errors.Is(err, ErrVolumeInUse) {
+		t.Errorf("deleting a mounted volume: err = %v, want ErrVolumeInUse", err)
+	}
+	for _, id := range []string{first.ID, second.ID} {
+		if err := cm.TerminateContainer(ctx, id); err != nil {
+			t.Fatalf("TerminateContainer: %v", err)
+		}
+	}
+	if err := cm.DeleteVolume(ctx, first.NodeID, "b", "pgdata"); !errors.Is(err, ErrVolumeNotFound) {
+		t.Errorf("deleting from another namespace: err = %v, want ErrVolumeNotFound", err)
+	}
+	if err := cm.DeleteVolume(ctx, first.NodeID, "a", "pgdata"); err != nil {
+		t.Fatalf("DeleteVolume: %v", err)
+	}
+	if vols := cm.Volumes(VolumeFilter{Namespace: "a"}); len(vols) != 0 {
+		t.Errorf("volumes of a after delete: %+v", vols)
+	}
+}
+
+// sortedIDs returns ids in the order Volume.UsedBy lists them
+func sortedIDs(a, b string) []string {
+	if a > b {
+		a, b = b, a
+	}
+	return []string{a, b}
+}
+
+func TestCreateVolume(t *testing.T) {
+	node, _ := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+
+	v, err := cm.CreateVolume(ctx, "node1", "a", "cache")
+	if err != nil {
+		t.Fatalf("CreateVolume: %v", err)
+	}
+	if v.Name != "cache" || v.NodeID != "node1" || v.Namespace != "a" || v.Owner != "" {
+		t.Errorf("created %+v, want cache on node1 in namespace a", v)
+	}
+	if _, err := cm.CreateVolume(ctx, "node1", "b", "cache"); !errors.Is(err, ErrVolumeExists) {
+		t.Errorf("creating a taken name: err = %v, want ErrVolumeExists", err)
+	}
+	if _, err := cm.CreateVolume(ctx, "nope", "a", "cache"); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("creating on an unknown node: err = %v, want ErrNodeNotFound", err)
+	}
+
+	// The container follows the volume created through the API
+	info := mustSchedule(t, cm, withVolume("db", "a", "cache"))
+	if vols := cm.Volumes(VolumeFilter{}); len(vols) != 1 || len(vols[0].UsedBy) != 1 || vols[0].UsedBy[0] != info.ID {
+		t.Errorf("volumes %+v, want cache used by %s", vols, info.ID)
+	}
+}
+
+func TestSyncVolumes(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+
+	labels := map[string]string{VolumeNamespaceLabel: "a", VolumeOwnerLabel: "db", VolumeExpiryLabel: "true"}
+	if err := rt.CreateVolume(ctx, "pgdata", labels); err != nil {
+		t.Fatal(err)
+	}
+	cm.SyncVolumes(ctx)
+	vols := cm.Volumes(VolumeFilter{})
+	if len(vols) != 1 || vols[0].Namespace != "a" || vols[0].Owner != "db" || !vols[0].RemoveOnExpiry {
+		t.Fatalf("volumes after sync: %+v, want pgdata rebuilt from its labels", vols)
+	}
+
+	if err := rt.RemoveVolume(ctx, "pgdata"); err != nil {
+		t.Fatal(err)
+	}
+	cm.SyncVolumes(ctx)
+	if vols := cm.Volumes(VolumeFilter{}); len(vols) != 0 {
+		t.Errorf("volumes after removal on the node: %+v, want none", vols)
+	}
+}
+
+func TestRemoveExpiredVolumes(t *testing.T) {
+	node, rt := newTestNode("node1", 4, 4096)
+	cm := newTestCluster(node)
+	ctx := context.Background()
+
+	spec := withVolume("job", "", "scratch")
+	spec.Mounts = append(spec.Mounts, docker.Mount{Type: docker.MountVolume, Source: "results", Target: "/out"})
+	spec.Mounts[0].RemoveOnExpiry = true
+	info := mustSchedule(t, cm, spec)
+	if err := cm.TerminateContainer(ctx, info.ID); err != nil {
+		t.Fatalf("TerminateContainer: %v", err)
+	}
+
+	cm.removeExpiredVolumes(ctx, "node1", "job")
+	vols, _ := rt.ListVolumes(ctx)
+	if len(vols) != 1 || vols[0].Name != "results" {
+		t.Errorf("volumes left: %+v, want only results, which is kept on expiry", vols)
+	}
+}
@@ -0,0 +1,524 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NodeConfig describes one node of the cluster
+type NodeConfig struct {
+	ID     string            `json:"id"`
+	CPU    float64           `json:"cpu"`    // cores
+	Memory int               `json:"memory"` // MB
+	GPU    int               `json:"gpu"`
+	Disk   int               `json:"disk"` // MB
+	Labels map[string]string `json:"labels"`
+
+	// DockerHost is the node's Docker daemon, e.g. "tcp://10.0.0.5:2376";
+	// empty uses DOCKER_HOST or the local daemon
+	DockerHost string `json:"dockerHost"`
+	// Agent is the URL of a node agent serving the node's host, e.g.
+	// "http://10.0.0.5:9090"; cpu, memory, gpu and disk default to what it offers
+	Agent string `json:"agent"`
+
+	// MaxConcurrentCreates bounds simultaneous container creates on the node's
+	// daemon; 0 uses the cluster default
+	MaxConcurrentCreates int `json:"maxConcurrentCreates"`
+}
+
+// API key scopes, each allowing everything the previous one does
+const (
+	ScopeRead      = "read"      // list and inspect
+	ScopeProvision = "provision" // create, change and terminate containers
+	ScopeAdmin     = "admin"     // nodes, quotas, autoscaling, logging and the audit log
+)
+
+// RBAC roles carried in JWTs, equivalent to the read, provision and admin scopes
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// MinJWTSecret is the shortest HS256 secret accepted, in bytes
+const MinJWTSecret = 32
+
+// JWTConfig enables bearer tokens signed with HS256
+type JWTConfig struct {
+	Secret   string `json:"secret"`
+	Issuer   string `json:"issuer"`   // if set, tokens must carry this "iss"
+	Audience string `json:"audience"` // if set, tokens must list this "aud"
+}
+
+// Validate checks the secret is long enough to resist guessing
+func (j JWTConfig) Validate() error {
+	if len(j.Secret) < MinJWTSecret {
+		return fmt.Errorf("jwt: secret must be at least %d bytes", MinJWTSecret)
+	}
+	return nil
+}
+
+// APIKey lets a caller use the API with the given scope
+type APIKey struct {
+	Name  string `json:"name"` // identifies the caller in the audit log
+	Key   string `json:"key"`
+	Scope string `json:"scope"` // read, provision or admin
+	// Namespace, if set, confines the key to /namespaces/{namespace}/
+	Namespace string `json:"namespace"`
+}
+
+// Validate checks the key has a name, a secret and a known scope
+func (k APIKey) Validate() error {
+	switch {
+	case k.Name == "":
+		return errors.New("api key: missing name")
+	case k.Key == "":
+		return fmt.Errorf("api key %q: missing key", k.Name)
+	case k.Scope != ScopeRead && k.Scope != ScopeProvision && k.Scope != ScopeAdmin:
+		return fmt.Errorf("api key %q: scope must be read, provision or admin", k.Name)
+	}
+	return nil
+}
+
+// LoadAPIKeys reads an array of API keys from a JSON or YAML file
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []APIKey
+	if err := unmarshal(path, data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, k := range keys {
+		if err := k.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid keys file %s: %w", path, err)
+		}
+	}
+	return keys, nil
+}
+
+// RegistryCredential authenticates pulls from one private registry
+type RegistryCredential struct {
+	Server   string `json:"server"` // e.g. "registry.example.com:5000" or "docker.io"
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Token    string `json:"token"` // base64-encoded auth config, instead of username and password
+}
+
+// Validate checks the credential names a registry and carries a secret
+func (r RegistryCredential) Validate() error {
+	switch {
+	case r.Server == "":
+		return errors.New("registry credential: missing server")
+	case r.Token == "" && (r.Username == "" || r.Password == ""):
+		return fmt.Errorf("registry credential %q: set username and password, or token", r.Server)
+	}
+	return nil
+}
+
+// LoadRegistryCredentials reads an array of registry credentials from a JSON
+// or YAML file
+func LoadRegistryCredentials(path string) ([]RegistryCredential, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds []RegistryCredential
+	if err := unmarshal(path, data, &creds); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, r := range creds {
+		if err := r.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid registries file %s: %w", path, err)
+		}
+	}
+	return creds, nil
+}
+
+// ScoreWeights sets how many CPU cores one unit of each resource is worth
+// when the scheduler compares nodes' leftover resources
+type ScoreWeights struct {
+	CPU    float64 `json:"cpu"`
+	Memory float64 `json:"memory"` // per MB
+	GPU    float64 `json:"gpu"`
+	Disk   float64 `json:"disk"` // per MB
+}
+
+// DefaultExpirationInterval is how often expired containers are reaped unless configured
+const DefaultExpirationInterval = 15 * time.Second
+
+// State stores a node's containers can be saved to
+const (
+	StateStoreBolt = "bolt" // <node>.state.db, written one container at a time
+	StateStoreFile = "file" // <node>.state.json, rewritten on every change
+)
+
+// DefaultJoinTokenTTL is how long after the control plane starts the join
+// token is accepted unless configured
+const DefaultJoinTokenTTL = time.Hour
+
+// Defaults for OvercommitConfig fields left unset
+const (
+	DefaultMaxUtilization      = 0.8
+	DefaultUsageSampleInterval = 30 * time.Second
+)
+
+// OvercommitConfig lets burstable containers use the idle capacity of nodes
+// whose reservations are full
+type OvercommitConfig struct {
+	CPU            float64   `json:"cpu"`            // factor on each node's schedulable CPU, e.g. 2
+	Memory         float64   `json:"memory"`         // factor on each node's schedulable memory
+	MaxUtilization float64   `json:"maxUtilization"` // fraction of capacity a node may be measured using
+	SampleInterval *Duration `json:"sampleInterval"` // how often node usage is sampled
+}
+
+// Utilization returns MaxUtilization or its default
+func (o *OvercommitConfig) Utilization() float64 {
+	if o.MaxUtilization == 0 {
+		return DefaultMaxUtilization
+	}
+	return o.MaxUtilization
+}
+
+// Interval returns SampleInterval or its default
+func (o *OvercommitConfig) Interval() time.Duration {
+	if o.SampleInterval == nil {
+		return DefaultUsageSampleInterval
+	}
+	return o.SampleInterval.Duration
+}
+
+// Validate checks the factors and utilization are in range
+func (o *OvercommitConfig) Validate() error {
+	switch {
+	case o.CPU < 1 && o.CPU != 0, o.Memory < 1 && o.Memory != 0:
+		return errors.New("overcommit: cpu and memory factors must be at least 1")
+	case o.MaxUtilization < 0 || o.MaxUtilization > 1:
+		return errors.New("overcommit: maxUtilization must be between 0 and 1")
+	case o.SampleInterval != nil && o.SampleInterval.Duration <= 0:
+		return errors.New("overcommit: sampleInterval must be positive")
+	}
+	return nil
+}
+
+// imageDigest matches a content digest such as "sha256:<64 hex digits>"
+var imageDigest = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-fA-F0-9]{32,}$`)
+
+// DefaultImageGCInterval is how often unused images are collected unless configured
+const DefaultImageGCInterval = 5 * time.Minute
+
+// ImageGCConfig removes images no container uses from the nodes
+type ImageGCConfig struct {
+	IdlePeriod    *Duration `json:"idlePeriod"`    // remove images unused for this long
+	DiskThreshold float64   `json:"diskThreshold"` // remove least recently used images while they fill more of a node's disk than this fraction
+	Keep          []string  `json:"keep"`          // images never removed, e.g. "nginx" or "registry.example.com/base/*"
+	Interval      *Duration `json:"interval"`      // how often to collect
+}
+
+// Idle returns IdlePeriod, 0 if unset
+func (g *ImageGCConfig) Idle() time.Duration {
+	if g.IdlePeriod == nil {
+		return 0
+	}
+	return g.IdlePeriod.Duration
+}
+
+// Every returns Interval or its default
+func (g *ImageGCConfig) Every() time.Duration {
+	if g.Interval == nil {
+		return DefaultImageGCInterval
+	}
+	return g.Interval.Duration
+}
+
+// Validate checks the durations and threshold are in range
+func (g *ImageGCConfig) Validate() error {
+	switch {
+	case g.IdlePeriod != nil && g.IdlePeriod.Duration < 0:
+		return errors.New("imageGC: idlePeriod must not be negative")
+	case g.DiskThreshold < 0 || g.DiskThreshold > 1:
+		return errors.New("imageGC: diskThreshold must be between 0 and 1")
+	case g.Interval != nil && g.Interval.Duration <= 0:
+		return errors.New("imageGC: interval must be positive")
+	}
+	return nil
+}
+
+// Duration is a time.Duration written as a string such as "15s" in JSON
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"15s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Config is the cluster topology and control plane settings
+type Config struct {
+	Nodes []NodeConfig `json:"nodes"`
+
+	// Addr is the address the API listens on, e.g. ":8080"; the -addr flag overrides it
+	Addr string `json:"addr"`
+	// Strategy is how the scheduler picks among nodes that fit: "binpack"
+	// (the default) or "spread"
+	Strategy string `json:"strategy"`
+
+	// ExpirationInterval is how often each node reaps containers past their
+	// TTL; "0s" disables reaping. Defaults to DefaultExpirationInterval.
+	ExpirationInterval *Duration `json:"expirationInterval"`
+
+	// StateStore is where each node's containers are saved: StateStoreBolt
+	// (the default) or StateStoreFile
+	StateStore string `json:"stateStore"`
+
+	// PullBeforeReserve pulls images before reserving resources for them
+	PullBeforeReserve bool `json:"pullBeforeReserve"`
+
+	// NetworkIsolation attaches each namespace's containers to a bridge
+	// network of their own, removed from a node when the namespace leaves it
+	NetworkIsolation bool `json:"networkIsolation"`
+
+	// Overcommit, if set, lets containers marked burstable onto nodes whose
+	// reservations are full while their sampled usage is low
+	Overcommit *OvercommitConfig `json:"overcommit"`
+
+	// ImageDigestAllowlist, if set, only lets containers run images whose
+	// registry digest (e.g. "sha256:...") is listed
+	ImageDigestAllowlist []string `json:"imageDigestAllowlist"`
+
+	// ImageGC, if set, periodically removes images no container uses
+	ImageGC *ImageGCConfig `json:"imageGC"`
+
+	// ScoreWeights overrides the scheduler's default weights when set
+	ScoreWeights *ScoreWeights `json:"scoreWeights"`
+
+	// APIKeys and the keys in APIKeysFile are required to call the API,
+	// unless a token signed as set in JWT is sent instead. With none of them
+	// set the API is open.
+	APIKeys     []APIKey   `json:"apiKeys"`
+	APIKeysFile string     `json:"apiKeysFile"`
+	JWT         *JWTConfig `json:"jwt"`
+
+	// Registries and the credentials in RegistriesFile are used to pull
+	// images from private registries when a provision request brings none.
+	// RegistriesFile is reread when it changes, so secrets can be rotated
+	// without a restart.
+	Registries     []RegistryCredential `json:"registries"`
+	RegistriesFile string               `json:"registriesFile"`
+
+	// BindMountRoots are the host directories containers may bind mount, or
+	// directories inside them; with none, only named volumes can be mounted
+	BindMountRoots []string `json:"bindMountRoots"`
+
+	// JoinToken, if set, lets node agents obtain a certificate through
+	// POST /join, and agents are then reached over mutual TLS only. The token
+	// is accepted for JoinTokenTTL after the control plane starts.
+	JoinToken    string    `json:"joinToken"`
+	JoinTokenTTL *Duration `json:"joinTokenTTL"`
+}
+
+// Keys returns the API keys from the config and its keys file
+func (c *Config) Keys() ([]APIKey, error) {
+	keys := c.APIKeys
+	if c.APIKeysFile != "" {
+		more, err := LoadAPIKeys(c.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(slices.Clip(keys), more...)
+	}
+	return keys, nil
+}
+
+// RegistryCredentials returns the registry credentials from the config and
+// its registries file; a later entry for the same server wins
+func (c *Config) RegistryCredentials() ([]RegistryCredential, error) {
+	creds := c.Registries
+	if c.RegistriesFile != "" {
+		more, err := LoadRegistryCredentials(c.RegistriesFile)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(slices.Clip(creds), more...)
+	}
+	return creds, nil
+}
+
+// Expiration returns the configured TTL reaping interval, 0 if disabled
+func (c *Config) Expiration() time.Duration {
+	if c.ExpirationInterval == nil {
+		return DefaultExpirationInterval
+	}
+	return c.ExpirationInterval.Duration
+}
+
+// JoinTTL returns how long the join token is accepted
+func (c *Config) JoinTTL() time.Duration {
+	if c.JoinTokenTTL == nil {
+		return DefaultJoinTokenTTL
+	}
+	return c.JoinTokenTTL.Duration
+}
+
+// Default returns the built-in two-node topology used without a config file
+func Default() *Config {
+	return &Config{Nodes: []NodeConfig{
+		{ID: "node1", CPU: 4, Memory: 8192, Disk: 51200, Labels: map[string]string{"size": "small"}},
+		{ID: "node2", CPU: 8, Memory: 16384, Disk: 102400, Labels: map[string]string{"size": "large"}},
+	}}
+}
+
+// Load reads and validates a config file, YAML if its name ends in .yaml or
+// .yml and JSON otherwise
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := unmarshal(path, data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// unmarshal decodes data into v as YAML or JSON depending on path's extension.
+// YAML is converted to JSON first so both formats share the JSON field names
+// and Duration parsing.
+func unmarshal(path string, data []byte, v any) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var doc any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Validate checks a single node's settings
+func (n NodeConfig) Validate() error {
+	switch {
+	case n.ID == "":
+		return errors.New("node: missing id")
+	case n.Agent != "" && n.DockerHost != "":
+		return fmt.Errorf("node %q: set either agent or dockerHost", n.ID)
+	case n.Agent != "" && (n.CPU < 0 || n.Memory < 0):
+		return fmt.Errorf("node %q: cpu and memory must not be negative", n.ID)
+	case n.Agent == "" && n.CPU <= 0:
+		return fmt.Errorf("node %q: cpu must be positive", n.ID)
+	case n.Agent == "" && n.Memory <= 0:
+		return fmt.Errorf("node %q: memory must be positive", n.ID)
+	case n.GPU < 0 || n.Disk < 0:
+		return fmt.Errorf("node %q: gpu and disk must not be negative", n.ID)
+	case n.MaxConcurrentCreates < 0:
+		return fmt.Errorf("node %q: maxConcurrentCreates must not be negative", n.ID)
+	}
+	return nil
+}
+
+// Validate checks that there is at least one node, node IDs are unique and
+// every node has positive CPU and memory
+func (c *Config) Validate() error {
+	if len(c.Nodes) == 0 {
+		return errors.New("no nodes configured")
+	}
+
+	seen := make(map[string]bool, len(c.Nodes))
+	for i, n := range c.Nodes {
+		if n.ID == "" {
+			return fmt.Errorf("node %d: missing id", i)
+		}
+		if seen[n.ID] {
+			return fmt.Errorf("node %d: duplicate id %q", i, n.ID)
+		}
+		if err := n.Validate(); err != nil {
+			return err
+		}
+		seen[n.ID] = true
+	}
+
+	if c.ExpirationInterval != nil && c.ExpirationInterval.Duration < 0 {
+		return errors.New("expirationInterval must not be negative")
+	}
+	switch c.StateStore {
+	case "", StateStoreBolt, StateStoreFile:
+	default:
+		return fmt.Errorf("unknown stateStore %q", c.StateStore)
+	}
+	if c.JoinTokenTTL != nil && c.JoinTokenTTL.Duration <= 0 {
+		return errors.New("joinTokenTTL must be positive")
+	}
+	if w := c.ScoreWeights; w != nil && (w.CPU < 0 || w.Memory < 0 || w.GPU < 0 || w.Disk < 0) {
+		return errors.New("score weights must not be negative")
+	}
+	if c.Overcommit != nil {
+		if err := c.Overcommit.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, d := range c.ImageDigestAllowlist {
+		if !imageDigest.MatchString(d) {
+			return fmt.Errorf("imageDigestAllowlist: %q is not a digest like sha256:<hex>", d)
+		}
+	}
+	if c.ImageGC != nil {
+		if err := c.ImageGC.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, k := range c.APIKeys {
+		if err := k.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, r := range c.Registries {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, root := range c.BindMountRoots {
+		if !filepath.IsAbs(root) {
+			return fmt.Errorf("bindMountRoots: %q is not an absolute path", root)
+		}
+	}
+	if c.JWT != nil {
+		return c.JWT.Validate()
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes data to a file called name in a temp dir and returns its path
+func writeConfig(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	want := []NodeConfig{
+		{ID: "edge", CPU: 2, Memory: 2048, Labels: map[string]string{"zone": "a"}},
+		{ID: "big", CPU: 16, Memory: 65536, GPU: 2, DockerHost: "tcp://10.0.0.5:2376"},
+	}
+	files := map[string]string{
+		"cluster.yaml": `
+nodes:
+  - id: edge
+    cpu: 2
+    memory: 2048
+    labels:
+      zone: a
+  - id: big
+    cpu: 16
+    memory: 65536
+    gpu: 2
+    dockerHost: tcp://10.0.0.5:2376
+addr: ":9000"
+strategy: spread
+expirationInterval: 30s
+`,
+		"cluster.json": `{
+  "nodes": [
+    {"id": "edge", "cpu": 2, "memory": 2048, "labels": {"zone": "a"}},
+    {"id": "big", "cpu": 16, "memory": 65536, "gpu": 2, "dockerHost": "tcp://10.0.0.5:2376"}
+  ],
+  "addr": ":9000",
+  "strategy": "spread",
+  "expirationInterval": "30s"
+}`,
+	}
+	for name, data := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, name, data))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !reflect.DeepEqual(cfg.Nodes, want) {
+				t.Errorf("nodes %+v, want %+v", cfg.Nodes, want)
+			}
+			if cfg.Expiration() != 30*time.Second {
+				t.Errorf("expiration %v, want 30s", cfg.Expiration())
+			}
+			if cfg.Addr != ":9000" || cfg.Strategy != "spread" {
+				t.Errorf("addr %q, strategy %q; want :9000 and spread", cfg.Addr, cfg.Strategy)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsInvalidNodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodes   string
+		wantErr string
+	}{
+		{"none", `[]`, "no nodes configured"},
+		{"duplicate id", `[{"id": "n1", "cpu": 1, "memory": 512}, {"id": "n1", "cpu": 2, "memory": 512}]`, `duplicate id "n1"`},
+		{"missing id", `[{"cpu": 1, "memory": 512}]`, "missing id"},
+		{"no cpu", `[{"id": "n1", "cpu": 0, "memory": 512}]`, "cpu must be positive"},
+		{"negative memory", `[{"id": "n1", "cpu": 1, "memory": -1}]`, "memory must be positive"},
+		{"agent and docker host", `[{"id": "n1", "agent": "http://h:9090", "dockerHost": "tcp://h:2376"}]`, "either agent or dockerHost"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, "cluster.json", `{"nodes": `+tt.nodes+`}`))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := Default()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("default config is invalid: %v", err)
+	}
+	if len(cfg.Nodes) != 2 || cfg.Nodes[0].ID != "node1" || cfg.Nodes[1].ID != "node2" {
+		t.Errorf("default nodes %+v, want node1 and node2", cfg.Nodes)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	tests := []struct {
+		setting string
+		want    time.Duration
+	}{
+		{``, DefaultExpirationInterval},
+		{`, "expirationInterval": "1m"`, time.Minute},
+		{`, "expirationInterval": "0s"`, 0}, // reaping disabled
+	}
+	for _, tt := range tests {
+		cfg, err := Load(writeConfig(t, "cluster.json", `{"nodes": [{"id": "n1", "cpu": 1, "memory": 512}]`+tt.setting+`}`))
+		if err != nil {
+			t.Fatalf("Load with %q: %v", tt.setting, err)
+		}
+		if got := cfg.Expiration(); got != tt.want {
+			t.Errorf("Expiration() with %q = %v, want %v", tt.setting, got, tt.want)
+		}
+	}
+
+	_, err := Load(writeConfig(t, "cluster.json", `{"nodes": [{"id": "n1", "cpu": 1, "memory": 512}], "expirationInterval": "-1s"}`))
+	if err == nil {
+		t.Error("negative expirationInterval accepted")
+	}
+}
+
+func TestStateStore(t *testing.T) {
+	node := `{"nodes": [{"id": "n1", "cpu": 1, "memory": 512}]`
+	for _, store := range []string{"", StateStoreBolt, StateStoreFile} {
+		if _, err := Load(writeConfig(t, "cluster.json", node+`, "stateStore": "`+store+`"}`)); err != nil {
+			t.Errorf("stateStore %q: %v", store, err)
+		}
+	}
+	if _, err := Load(writeConfig(t, "cluster.json", node+`, "stateStore": "sqlite"}`)); err == nil {
+		t.Error("unknown stateStore accepted")
+	}
+}
+
+func TestBindMountRoots(t *testing.T) {
+	node := `{"nodes": [{"id": "n1", "cpu": 1, "memory": 512}], `
+	cfg, err := Load(writeConfig(t, "cluster.json", node+`"bindMountRoots": ["/srv/data"]}`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(cfg.BindMountRoots) != 1 || cfg.BindMountRoots[0] != "/srv/data" {
+		t.Errorf("bindMountRoots %q, want /srv/data", cfg.BindMountRoots)
+	}
+	if _, err := Load(writeConfig(t, "cluster.json", node+`"bindMountRoots": ["data"]}`)); err == nil {
+		t.Error("relative bindMountRoots accepted")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	file := writeConfig(t, "keys.json", `[{"name": "ci", "key": "s3cret", "scope": "provision"}]`)
+	cfg := Config{
+		APIKeys:     []APIKey{{Name: "ops", Key: "admin-secret", Scope: ScopeAdmin}},
+		APIKeysFile: file,
+	}
+	keys, err := cfg.Keys()
+	if err != nil {
+		t.Fatalf("Keys: %v", err)
+	}
+	want := []APIKey{{Name: "ops", Key: "admin-secret", Scope: ScopeAdmin}, {Name: "ci", Key: "s3cret", Scope: ScopeProvision}}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys %+v, want %+v", keys, want)
+	}
+
+	bad := writeConfig(t, "bad.json", `[{"name": "ci", "key": "s3cret", "scope": "root"}]`)
+	if _, err := LoadAPIKeys(bad); err == nil || !strings.Contains(err.Error(), "scope must be") {
+		t.Errorf("LoadAPIKeys with an unknown scope: err = %v", err)
+	}
+}
+
+func TestRegistryCredentials(t *testing.T) {
+	file := writeConfig(t, "registries.yaml", `
+- server: registry.example.com
+  username: ci
+  password: rotated
+- server: ghcr.io
+  token: dG9rZW4=
+`)
+	cfg, err := Load(writeConfig(t, "cluster.json", `{"nodes": [{"id": "n1", "cpu": 1, "memory": 512}],
+  "registries": [{"server": "registry.example.com", "username": "ci", "password": "old"}],
+  "registriesFile": "`+file+`"}`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	creds, err := cfg.RegistryCredentials()
+	if err != nil {
+		t.Fatalf("RegistryCredentials: %v", err)
+	}
+	want := []RegistryCredential{
+		{Server: "registry.example.com", Username: "ci", Password: "old"},
+		{Server: "registry.example.com", Username: "ci", Password: "rotated"},
+		{Server: "ghcr.io", Token: "dG9rZW4="},
+	}
+	if !reflect.DeepEqual(creds, want) {
+		t.Errorf("credentials %+v, want %+v", creds, want)
+	}
+
+	if _, err := Load(writeConfig(t, "cluster.json", `{"nodes": [{"id": "n1", "cpu": 1, "memory": 512}],
+  "registries": [{"server": "ghcr.io", "username": "ci"}]}`)); err == nil {
+		t.Error("credential without a password or token accepted")
+	}
+	if _, err := LoadRegistryCredentials(writeConfig(t, "registries.json", `[{"username": "ci", "password": "p"}]`)); err == nil {
+		t.Error("registries file entry without a server accepted")
+	}
+}
+
+func TestImageDigestAllowlist(t *testing.T) {
+	node := `{"nodes": [{"id": "n1", "cpu": 1, "memory": 512}], `
+	cfg, err := Load(writeConfig(t, "cluster.json", node+`"imageDigestAllowlist": ["sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"]}`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(cfg.ImageDigestAllowlist) != 1 {
+		t.Errorf("allowlist %q, want the one digest", cfg.ImageDigestAllowlist)
+	}
+	if _, err := Load(writeConfig(t, "cluster.json", node+`"imageDigestAllowlist": ["nginx:1.27"]}`)); err == nil {
+		t.Error("allowlist entry that isn't a digest accepted")
+	}
+}
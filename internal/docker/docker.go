@@ -1,16 +1,33 @@
 package docker
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	cerrdefs "github.com/containerd/errdefs"
 	containerTypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	imageTypes "github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
 	networkTypes "github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
 	"io"
-	"os"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// ManagedLabel marks containers created by mini-cloud
+const ManagedLabel = "mini-cloud.managed"
+
 // DockerClient wraps the Docker SDK client
 type DockerClient struct {
 	cli *client.Client
@@ -25,42 +42,374 @@ func NewDockerClient() (*DockerClient, error) {
 	return &DockerClient{cli: cli}, nil
 }
 
+// NewDockerClientWithHost creates a Docker client for the daemon at host,
+// e.g. "tcp://10.0.0.5:2376" or "unix:///var/run/docker.sock". Other settings
+// such as DOCKER_TLS_VERIFY and DOCKER_CERT_PATH still come from the environment.
+func NewDockerClientWithHost(host string) (*DockerClient, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithHost(host), client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+	return &DockerClient{cli: cli}, nil
+}
+
+// RegistryAuth holds credentials for pulling from a private registry.
+// Either Username/Password or a pre-encoded Token should be set.
+type RegistryAuth struct {
+	Username      string
+	Password      string
+	ServerAddress string
+	Token         string // base64-encoded auth config, used as-is
+}
+
+// Encode returns the base64-encoded auth config expected by the Docker API
+func (a *RegistryAuth) Encode() (string, error) {
+	if a.Token != "" {
+		return a.Token, nil
+	}
+	return registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      a.Username,
+		Password:      a.Password,
+		ServerAddress: a.ServerAddress,
+	})
+}
+
+// Ping checks that the Docker daemon is reachable
+func (dc *DockerClient) Ping(ctx context.Context) error {
+	_, err := dc.cli.Ping(ctx)
+	return err
+}
+
+// PullProgress is one progress update for a layer of an image pull
+type PullProgress struct {
+	ID      string // layer ID, empty for image-level messages
+	Status  string // e.g. "Downloading", "Pull complete"
+	Current int64
+	Total   int64
+}
+
+// PullOptions controls an image pull
+type PullOptions struct {
+	Auth       *RegistryAuth      // nil for anonymous pulls
+	OnProgress func(PullProgress) // called for every progress message, may be nil
+}
+
+// pullMessage is a single message of the JSON stream returned by ImagePull
+type pullMessage struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+	Error string `json:"error"`
+}
+
 // PullImage ensures the image is present locally
-func (dc *DockerClient) PullImage(ctx context.Context, image string) error {
-	out, err := dc.cli.ImagePull(ctx, image, imageTypes.PullOptions{})
+func (dc *DockerClient) PullImage(ctx context.Context, image string, opts PullOptions) error {
+	pullOpts := imageTypes.PullOptions{}
+	if opts.Auth != nil {
+		encoded, err := opts.Auth.Encode()
+		if err != nil {
+			return err
+		}
+		pullOpts.RegistryAuth = encoded
+	}
+
+	out, err := dc.cli.ImagePull(ctx, image, pullOpts)
 	if err != nil {
 		return err
 	}
 	defer out.Close()
-	_, err = io.Copy(os.Stdout, out)
-	return err
+	return readPullProgress(out, opts.OnProgress)
+}
+
+// readPullProgress consumes a pull progress stream, reporting each message to
+// onProgress. Errors reported inside the stream are returned.
+func readPullProgress(r io.Reader, onProgress func(PullProgress)) error {
+	dec := json.NewDecoder(r)
+	for {
+		var msg pullMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read pull progress: %w", err)
+		}
+
+		if msg.Error != "" {
+			return errors.New(msg.Error)
+		}
+		if onProgress != nil {
+			onProgress(PullProgress{
+				ID:      msg.ID,
+				Status:  msg.Status,
+				Current: msg.ProgressDetail.Current,
+				Total:   msg.ProgressDetail.Total,
+			})
+		}
+	}
+}
+
+// Restart policies understood by the manager
+const (
+	RestartNever     = "never"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+// ValidRestartPolicy reports whether p is a known restart policy (empty means never)
+func ValidRestartPolicy(p string) bool {
+	_, _, ok := ParseRestartPolicy(p)
+	return ok
+}
+
+// ParseRestartPolicy splits a restart policy such as "on-failure:5" into its
+// name and the maximum number of restarts, 0 if not given. Only on-failure
+// takes a maximum.
+func ParseRestartPolicy(p string) (name string, maxRestarts int, ok bool) {
+	name, count, hasMax := strings.Cut(p, ":")
+	switch {
+	case !hasMax:
+		return name, 0, name == "" || name == RestartNever || name == RestartOnFailure || name == RestartAlways
+	case name != RestartOnFailure:
+		return name, 0, false
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 {
+		return name, 0, false
+	}
+	return name, n, true
 }
 
 // ContainerSpec defines parameters to create a container
 type ContainerSpec struct {
-	Image   string
-	Name    string
-	CPU     float64 // in cores
-	Memory  int64   // in MB
-	Command []string
-	TTL     time.Duration
+	Image         string
+	ImageDigest   string // registry digest Image is pinned to, resolved at provision time if not given
+	Name          string
+	CPU           float64  // in cores
+	Memory        int64    // in MB
+	GPU           int      // number of GPUs requested via device requests
+	DiskMB        int      // disk reserved on the node; scheduling only, not enforced by Docker
+	Command       []string // overrides the image's CMD when set
+	Entrypoint    []string // overrides the image's ENTRYPOINT when set
+	Env           map[string]string
+	Ports         []PortMapping // container ports published on the node
+	Mounts        []Mount       // host directories and named volumes
+	TTL           time.Duration
+	RestartPolicy string        // one of the Restart* constants, on-failure optionally as "on-failure:max"
+	StopTimeout   int           // seconds to wait for a graceful stop, 0 for the daemon default
+	RegistryAuth  *RegistryAuth // optional credentials for pulling Image
+	Namespace     string        // tenant owning the container, for quota accounting
+	Priority      int           // when the cluster is full, lower-priority containers are preempted
+	Network       string        // user-defined bridge network to attach to, created if missing
+	HealthCheck   *HealthCheck  // optional readiness probe run by the daemon
+	Probe         *Probe        // optional liveness probe run by the manager
+	Burstable     bool          // may be placed on a reserved-full node that is idle, under the overcommit policy
+
+	// Optional tuning, left to the Docker defaults when zero
+	MemorySwapMB int64 // memory plus swap limit in MB, -1 for unlimited swap
+	CPUShares    int64 // relative CPU weight under contention (default 1024)
+	CPUQuota     int64 // microseconds of CPU time per 100ms period; replaces the CPU limit when set
+
+	OnPullProgress func(PullProgress) `json:"-"` // optional callback for image pull progress, not sent to remote agents
+
+	// NodeSelector restricts scheduling to nodes carrying all of these labels
+	NodeSelector map[string]string
+
+	// Containers with the same AntiAffinityKey are spread across nodes.
+	// If RequireAntiAffinity is set, scheduling fails rather than co-locating them.
+	AntiAffinityKey     string
+	RequireAntiAffinity bool
+	// DependsOn names containers that must be running before this one is
+	// scheduled; used to order batch provisioning
+	DependsOn []string
+	// Labels are set on the container in addition to ManagedLabel
+	Labels map[string]string
+	// AntiAffinity keeps the container off nodes running a container whose
+	// labels include all of these, e.g. {"app": "web"}
+	AntiAffinity map[string]string
+}
+
+// PortMapping publishes a container port on the node's host
+type PortMapping struct {
+	ContainerPort int
+	HostPort      int    // 0 lets Docker pick a free port
+	Protocol      string // "tcp" (default) or "udp"
+}
+
+// Port returns the container port in Docker's form, e.g. "80/tcp"
+func (p PortMapping) Port() string {
+	return strconv.Itoa(p.ContainerPort) + "/" + cmp.Or(p.Protocol, "tcp")
+}
+
+// HostKey returns the fixed host port in the same form, or "" if Docker picks it
+func (p PortMapping) HostKey() string {
+	if p.HostPort == 0 {
+		return ""
+	}
+	return strconv.Itoa(p.HostPort) + "/" + cmp.Or(p.Protocol, "tcp")
+}
+
+// Mount types
+const (
+	MountBind   = "bind"   // a directory on the node's host
+	MountVolume = "volume" // a Docker named volume, created on first use
+)
+
+// Mount attaches a host directory or named volume to the container
+type Mount struct {
+	Type     string // MountBind or MountVolume
+	Source   string // host path for bind mounts, volume name for volumes
+	Target   string // absolute path inside the container
+	ReadOnly bool
+	// RemoveOnExpiry removes a named volume this mount creates once the
+	// container expires; used by the cluster, not passed to Docker
+	RemoveOnExpiry bool
+}
+
+// HostPorts returns the host port Docker published for each container port
+// of a started container, keyed like PortMapping.Port
+func HostPorts(ctx context.Context, rt ContainerRuntime, id string) (map[string]int, error) {
+	inspect, err := rt.InspectContainer(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if inspect.NetworkSettings == nil {
+		return nil, nil
+	}
+	ports := make(map[string]int)
+	for port, bindings := range inspect.NetworkSettings.Ports {
+		// IPv4 and IPv6 bindings share the port; the first one will do
+		if len(bindings) == 0 {
+			continue
+		}
+		if n, err := strconv.Atoi(bindings[0].HostPort); err == nil {
+			ports[string(port)] = n
+		}
+	}
+	return ports, nil
+}
+
+// HealthCheck configures a Docker health check for a container
+type HealthCheck struct {
+	Test     []string      // command to run, e.g. ["curl", "-f", "http://localhost/"]; exit 0 means healthy
+	Interval time.Duration // time between checks, 0 for the daemon default
+	Timeout  time.Duration // time before a check is considered hung, 0 for the daemon default
+	Retries  int           // consecutive failures before unhealthy, 0 for the daemon default
+}
+
+// config converts the health check into the form expected by the Docker API
+func (h *HealthCheck) config() *containerTypes.HealthConfig {
+	test := h.Test
+	switch {
+	case len(test) == 0:
+		test = []string{"NONE"}
+	case test[0] != "CMD" && test[0] != "CMD-SHELL" && test[0] != "NONE":
+		test = append([]string{"CMD"}, test...)
+	}
+	return &containerTypes.HealthConfig{
+		Test:     test,
+		Interval: h.Interval,
+		Timeout:  h.Timeout,
+		Retries:  h.Retries,
+	}
 }
 
+// PinnedImage returns the reference to create and pull the container from:
+// Image at ImageDigest, if known
+func (s ContainerSpec) PinnedImage() string {
+	return PinImage(s.Image, s.ImageDigest)
+}
+
+// PullOptions returns the options for pulling the spec's image
+func (s ContainerSpec) PullOptions() PullOptions {
+	return PullOptions{Auth: s.RegistryAuth, OnProgress: s.OnPullProgress}
+}
+
+// envList converts environment variables to Docker's KEY=value form, sorted by key
+func envList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		list = append(list, k+"="+env[k])
+	}
+	return list
+}
+
+// cfsPeriod is the CPU period in microseconds that CPUQuota is measured against
+const cfsPeriod = 100000
+
 // CreateContainer creates a container with the given spec
 func (dc *DockerClient) CreateContainer(ctx context.Context, spec ContainerSpec) (string, error) {
 	config := &containerTypes.Config{
-		Image: spec.Image,
-		Cmd:   spec.Command,
+		Image:      spec.PinnedImage(),
+		Cmd:        spec.Command,
+		Entrypoint: spec.Entrypoint,
+		Env:        envList(spec.Env),
+		Labels:     map[string]string{ManagedLabel: "true"},
+	}
+	for k, v := range spec.Labels {
+		config.Labels[k] = v
+	}
+	if spec.HealthCheck != nil {
+		config.Healthcheck = spec.HealthCheck.config()
 	}
 
 	hostConfig := &containerTypes.HostConfig{
 		Resources: containerTypes.Resources{
-			NanoCPUs: int64(spec.CPU * 1e9), // convert to nanoseconds
-			Memory:   spec.Memory * 1024 * 1024,
+			NanoCPUs:  int64(spec.CPU * 1e9), // convert to nanoseconds
+			Memory:    spec.Memory * 1024 * 1024,
+			CPUShares: spec.CPUShares,
 		},
 	}
+	for _, m := range spec.Mounts {
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:     mount.Type(m.Type),
+			Source:   m.Source,
+			Target:   m.Target,
+			ReadOnly: m.ReadOnly,
+		})
+	}
+	if len(spec.Ports) > 0 {
+		config.ExposedPorts = make(nat.PortSet, len(spec.Ports))
+		hostConfig.PortBindings = make(nat.PortMap, len(spec.Ports))
+		for _, p := range spec.Ports {
+			port := nat.Port(p.Port())
+			config.ExposedPorts[port] = struct{}{}
+			hostPort := ""
+			if p.HostPort > 0 {
+				hostPort = strconv.Itoa(p.HostPort)
+			}
+			hostConfig.PortBindings[port] = append(hostConfig.PortBindings[port], nat.PortBinding{HostPort: hostPort})
+		}
+	}
+	if spec.CPUQuota > 0 {
+		// Docker rejects NanoCPUs combined with a CFS quota
+		hostConfig.NanoCPUs = 0
+		hostConfig.CPUPeriod = cfsPeriod
+		hostConfig.CPUQuota = spec.CPUQuota
+	}
+	switch {
+	case spec.MemorySwapMB > 0:
+		hostConfig.MemorySwap = spec.MemorySwapMB * 1024 * 1024
+	case spec.MemorySwapMB < 0:
+		hostConfig.MemorySwap = -1
+	}
+	if spec.GPU > 0 {
+		hostConfig.DeviceRequests = []containerTypes.DeviceRequest{{
+			Count:        spec.GPU,
+			Capabilities: [][]string{{"gpu"}},
+		}}
+	}
 
 	networkingConfig := &networkTypes.NetworkingConfig{}
+	if spec.Network != "" {
+		if err := dc.EnsureNetwork(ctx, spec.Network); err != nil {
+			return "", fmt.Errorf("failed to ensure network %s: %w", spec.Network, err)
+		}
+		networkingConfig.EndpointsConfig = map[string]*networkTypes.EndpointSettings{
+			spec.Network: {},
+		}
+	}
 
 	resp, err := dc.cli.ContainerCreate(ctx, config, hostConfig, networkingConfig, nil, spec.Name)
 	if err != nil {
@@ -70,14 +419,73 @@ func (dc *DockerClient) CreateContainer(ctx context.Context, spec ContainerSpec)
 	return resp.ID, nil
 }
 
+// EnsureNetwork creates a user-defined bridge network called name unless it
+// already exists. Containers on such a network resolve each other by name.
+func (dc *DockerClient) EnsureNetwork(ctx context.Context, name string) error {
+	_, err := dc.cli.NetworkInspect(ctx, name, networkTypes.InspectOptions{})
+	if err == nil {
+		return nil
+	}
+	if !cerrdefs.IsNotFound(err) {
+		return err
+	}
+
+	_, err = dc.cli.NetworkCreate(ctx, name, networkTypes.CreateOptions{
+		Driver: "bridge",
+		Labels: map[string]string{ManagedLabel: "true"},
+	})
+	if cerrdefs.IsConflict(err) {
+		return nil // created concurrently
+	}
+	return err
+}
+
+// UpdateContainer changes the CPU, memory and swap limits of a container in
+// place. memorySwapMB is as in ContainerSpec; 0 keeps Docker's default of
+// swap equal to memory.
+func (dc *DockerClient) UpdateContainer(ctx context.Context, id string, cpu float64, memoryMB, memorySwapMB int64) error {
+	memory := memoryMB * 1024 * 1024
+	// The swap limit is always sent, since Docker rejects a memory limit
+	// above the current one
+	swap := 2 * memory
+	switch {
+	case memorySwapMB > 0:
+		swap = memorySwapMB * 1024 * 1024
+	case memorySwapMB < 0:
+		swap = -1
+	}
+	_, err := dc.cli.ContainerUpdate(ctx, id, containerTypes.UpdateConfig{
+		Resources: containerTypes.Resources{
+			NanoCPUs:   int64(cpu * 1e9),
+			Memory:     memory,
+			MemorySwap: swap,
+		},
+	})
+	return err
+}
+
 // StartContainer starts a container by ID
 func (dc *DockerClient) StartContainer(ctx context.Context, id string) error {
 	return dc.cli.ContainerStart(ctx, id, containerTypes.StartOptions{})
 }
 
-// StopContainer stops a running container
-func (dc *DockerClient) StopContainer(ctx context.Context, id string) error {
-	return dc.cli.ContainerStop(ctx, id, containerTypes.StopOptions{})
+// StopContainer stops a running container, waiting up to timeout seconds
+// before killing it. A timeout <= 0 uses the daemon's default grace period.
+func (dc *DockerClient) StopContainer(ctx context.Context, id string, timeout int) error {
+	return dc.cli.ContainerStop(ctx, id, stopOptions(timeout))
+}
+
+func stopOptions(timeout int) containerTypes.StopOptions {
+	if timeout <= 0 {
+		return containerTypes.StopOptions{}
+	}
+	return containerTypes.StopOptions{Timeout: &timeout}
+}
+
+// RestartContainer stops and starts a container, waiting up to timeout seconds
+// for it to stop. A timeout <= 0 uses the daemon's default grace period.
+func (dc *DockerClient) RestartContainer(ctx context.Context, id string, timeout int) error {
+	return dc.cli.ContainerRestart(ctx, id, stopOptions(timeout))
 }
 
 // RemoveContainer deletes a container
@@ -87,10 +495,107 @@ func (dc *DockerClient) RemoveContainer(ctx context.Context, id string) error {
 
 // ListContainers returns containers created by this tool
 func (dc *DockerClient) ListContainers(ctx context.Context) ([]containerTypes.Summary, error) {
-	return dc.cli.ContainerList(ctx, containerTypes.ListOptions{All: true})
+	return dc.cli.ContainerList(ctx, containerTypes.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", ManagedLabel)),
+	})
 }
 
 // InspectContainer returns detailed container info
 func (dc *DockerClient) InspectContainer(ctx context.Context, id string) (containerTypes.InspectResponse, error) {
 	return dc.cli.ContainerInspect(ctx, id)
 }
+
+// ExecResult is the outcome of a command run inside a container
+type ExecResult struct {
+	ExitCode int
+	Output   string // combined stdout and stderr
+}
+
+// Exec runs cmd inside a running container and waits for it to finish.
+// Cancelling ctx aborts the wait.
+func (dc *DockerClient) Exec(ctx context.Context, id string, cmd []string) (ExecResult, error) {
+	created, err := dc.cli.ContainerExecCreate(ctx, id, containerTypes.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return ExecResult{}, err
+	}
+
+	resp, err := dc.cli.ContainerExecAttach(ctx, created.ID, containerTypes.ExecAttachOptions{})
+	if err != nil {
+		return ExecResult{}, err
+	}
+	defer resp.Close()
+
+	// Closing the hijacked connection unblocks the copy below when ctx ends
+	stop := context.AfterFunc(ctx, resp.Close)
+	defer stop()
+
+	var out bytes.Buffer
+	if _, err := stdcopy.StdCopy(&out, &out, resp.Reader); err != nil {
+		if ctx.Err() != nil {
+			return ExecResult{}, ctx.Err()
+		}
+		return ExecResult{}, err
+	}
+
+	inspect, err := dc.cli.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	return ExecResult{ExitCode: inspect.ExitCode, Output: out.String()}, nil
+}
+
+// ContainerStats is a point-in-time resource usage sample of a container
+type ContainerStats struct {
+	CPUPercent    float64 // percent of one core, e.g. 150 for one and a half cores
+	MemoryUsageMB int64
+	MemoryLimitMB int64
+
+	// Totals since the container started
+	NetworkRxBytes  uint64
+	NetworkTxBytes  uint64
+	BlockReadBytes  uint64
+	BlockWriteBytes uint64
+}
+
+// Stats samples a container's CPU, memory, network and block I/O usage. It
+// blocks for about a second while the daemon takes two CPU readings.
+func (dc *DockerClient) Stats(ctx context.Context, id string) (ContainerStats, error) {
+	resp, err := dc.cli.ContainerStats(ctx, id, false)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+	defer resp.Body.Close()
+
+	var s containerTypes.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return ContainerStats{}, fmt.Errorf("failed to decode stats: %w", err)
+	}
+
+	stats := ContainerStats{
+		MemoryUsageMB: int64(s.MemoryStats.Usage / (1024 * 1024)),
+		MemoryLimitMB: int64(s.MemoryStats.Limit / (1024 * 1024)),
+	}
+	for _, n := range s.Networks {
+		stats.NetworkRxBytes += n.RxBytes
+		stats.NetworkTxBytes += n.TxBytes
+	}
+	for _, e := range s.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(e.Op) { // "Read" on cgroup v1, "read" on v2
+		case "read":
+			stats.BlockReadBytes += e.Value
+		case "write":
+			stats.BlockWriteBytes += e.Value
+		}
+	}
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(s.CPUStats.SystemUsage) - float64(s.PreCPUStats.SystemUsage)
+	if cpuDelta > 0 && systemDelta > 0 {
+		stats.CPUPercent = cpuDelta / systemDelta * float64(s.CPUStats.OnlineCPUs) * 100
+	}
+	return stats, nil
+}
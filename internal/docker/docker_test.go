@@ -0,0 +1,661 @@
+package docker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	containerTypes "github.com/docker/docker/api/types/container"
+	networkTypes "github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// fakeDaemon serves handler as the Docker API, answering version
+// negotiation itself, and returns a client talking to it
+func fakeDaemon(t *testing.T, handler http.HandlerFunc) *DockerClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/_ping") {
+			w.Header().Set("API-Version", "1.45")
+			w.Write([]byte("OK"))
+			return
+		}
+		// Strip the version prefix, e.g. /v1.45/images/create
+		if rest, ok := strings.CutPrefix(r.URL.Path, "/v1.45"); ok {
+			r.URL.Path = rest
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(srv.URL, "http://"))
+	t.Setenv("DOCKER_TLS_VERIFY", "")
+	t.Setenv("DOCKER_CERT_PATH", "")
+	dc, err := NewDockerClient()
+	if err != nil {
+		t.Fatalf("NewDockerClient: %v", err)
+	}
+	return dc
+}
+
+// createRequest creates a container for spec on a fake daemon and returns
+// the request Docker received
+func createRequest(t *testing.T, spec ContainerSpec) containerTypes.CreateRequest {
+	t.Helper()
+	var req containerTypes.CreateRequest
+	dc := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/create" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding create request: %v", err)
+		}
+		w.Write([]byte(`{"Id":"c1"}`))
+	})
+	if _, err := dc.CreateContainer(context.Background(), spec); err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+	if req.Config == nil || req.HostConfig == nil {
+		t.Fatal("create request without a config")
+	}
+	return req
+}
+
+func TestNewDockerClientWithHost(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "tcp://127.0.0.1:2375")
+	t.Setenv("DOCKER_TLS_VERIFY", "")
+	t.Setenv("DOCKER_CERT_PATH", "")
+
+	dc, err := NewDockerClientWithHost("tcp://10.0.0.5:2376")
+	if err != nil {
+		t.Fatalf("NewDockerClientWithHost: %v", err)
+	}
+	if got := dc.cli.DaemonHost(); got != "tcp://10.0.0.5:2376" {
+		t.Errorf("daemon host %q, want the one passed in over DOCKER_HOST", got)
+	}
+
+	if _, err := NewDockerClientWithHost("10.0.0.5"); err == nil {
+		t.Error("host without a scheme accepted")
+	}
+}
+
+func TestRegistryAuthEncode(t *testing.T) {
+	auth := &RegistryAuth{Username: "ci", Password: "s3cret", ServerAddress: "registry.example.com"}
+	encoded, err := auth.Encode()
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	data, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("%q is not base64: %v", encoded, err)
+	}
+	var decoded struct{ Username, Password, ServerAddress string }
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("decoded auth %s: %v", data, err)
+	}
+	if decoded.Username != "ci" || decoded.Password != "s3cret" || decoded.ServerAddress != "registry.example.com" {
+		t.Errorf("decoded auth = %+v", decoded)
+	}
+
+	token := &RegistryAuth{Token: "cHJlLWVuY29kZWQ="}
+	if got, _ := token.Encode(); got != token.Token {
+		t.Errorf("Encode with a token = %q, want the token as is", got)
+	}
+}
+
+func TestPullImageSendsRegistryAuth(t *testing.T) {
+	var gotAuth, gotImage string
+	dc := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images/create" {
+			http.NotFound(w, r)
+			return
+		}
+		gotAuth = r.Header.Get("X-Registry-Auth")
+		gotImage = r.URL.Query().Get("fromImage")
+		w.Write([]byte(`{"status":"Pull complete"}`))
+	})
+
+	auth := &RegistryAuth{Username: "ci", Password: "s3cret"}
+	if err := dc.PullImage(context.Background(), "registry.example.com/team/app:1.0", PullOptions{Auth: auth}); err != nil {
+		t.Fatalf("PullImage: %v", err)
+	}
+	want, _ := auth.Encode()
+	if gotAuth != want {
+		t.Errorf("X-Registry-Auth = %q, want %q", gotAuth, want)
+	}
+	if gotImage != "registry.example.com/team/app" {
+		t.Errorf("pulled %q, want registry.example.com/team/app", gotImage)
+	}
+
+	if err := dc.PullImage(context.Background(), "nginx", PullOptions{}); err != nil {
+		t.Fatalf("anonymous PullImage: %v", err)
+	}
+	if gotAuth != "" {
+		t.Errorf("anonymous pull sent X-Registry-Auth %q", gotAuth)
+	}
+}
+
+func TestRegistryHost(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"nginx", DockerHubRegistry},
+		{"library/nginx:1.27", DockerHubRegistry},
+		{"ghcr.io/org/app:v1", "ghcr.io"},
+		{"registry.example.com:5000/app@sha256:" + strings.Repeat("a", 64), "registry.example.com:5000"},
+	}
+	for _, tt := range tests {
+		if got, err := RegistryHost(tt.image); err != nil || got != tt.want {
+			t.Errorf("RegistryHost(%q) = %q, %v; want %q", tt.image, got, err, tt.want)
+		}
+	}
+	if _, err := RegistryHost("Not A Reference"); err == nil {
+		t.Error("invalid reference accepted")
+	}
+}
+
+func TestNormalizeRegistryHost(t *testing.T) {
+	tests := map[string]string{
+		"https://index.docker.io/v1/":      DockerHubRegistry,
+		"registry-1.docker.io":             DockerHubRegistry,
+		"docker.io":                        DockerHubRegistry,
+		"http://Registry.Example.com:5000": "registry.example.com:5000",
+		"ghcr.io/org":                      "ghcr.io",
+	}
+	for server, want := range tests {
+		if got := NormalizeRegistryHost(server); got != want {
+			t.Errorf("NormalizeRegistryHost(%q) = %q, want %q", server, got, want)
+		}
+	}
+}
+
+func TestNormalizeImage(t *testing.T) {
+	tests := map[string]string{
+		"nginx":                           "nginx:latest",
+		"docker.io/library/nginx":         "nginx:latest",
+		"nginx:1.27":                      "nginx:1.27",
+		"ghcr.io/org/app":                 "ghcr.io/org/app:latest",
+		"registry.example.com:5000/app:2": "registry.example.com:5000/app:2",
+		"Not A Reference":                 "Not A Reference",
+	}
+	for image, want := range tests {
+		if got := NormalizeImage(image); got != want {
+			t.Errorf("NormalizeImage(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
+
+func TestPinImage(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	tests := []struct {
+		image, digest string
+		want          string
+	}{
+		{"nginx:1.27", digest, "nginx@" + digest},
+		{"docker.io/library/nginx", digest, "nginx@" + digest},
+		{"ghcr.io/org/app@" + digest, digest, "ghcr.io/org/app@" + digest},
+		{"nginx:1.27", "", "nginx:1.27"},
+	}
+	for _, tt := range tests {
+		got := PinImage(tt.image, tt.digest)
+		if got != tt.want {
+			t.Errorf("PinImage(%q, %q) = %q, want %q", tt.image, tt.digest, got, tt.want)
+		}
+		if tt.digest != "" && RefDigest(got) != tt.digest {
+			t.Errorf("RefDigest(%q) = %q, want %q", got, RefDigest(got), tt.digest)
+		}
+	}
+	if d := RefDigest("nginx:1.27"); d != "" {
+		t.Errorf("RefDigest of a tag = %q, want none", d)
+	}
+}
+
+func TestReadPullProgress(t *testing.T) {
+	stream := `{"status":"Pulling from library/nginx","id":"latest"}
+{"status":"Downloading","id":"a1b2","progressDetail":{"current":512,"total":2048}}
+{"status":"Pull complete","id":"a1b2"}
+`
+	var got []PullProgress
+	if err := readPullProgress(strings.NewReader(stream), func(p PullProgress) { got = append(got, p) }); err != nil {
+		t.Fatalf("readPullProgress: %v", err)
+	}
+	want := []PullProgress{
+		{ID: "latest", Status: "Pulling from library/nginx"},
+		{ID: "a1b2", Status: "Downloading", Current: 512, Total: 2048},
+		{ID: "a1b2", Status: "Pull complete"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d updates, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("update %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// Without a callback the stream is still drained
+	if err := readPullProgress(strings.NewReader(stream), nil); err != nil {
+		t.Errorf("readPullProgress without a callback: %v", err)
+	}
+}
+
+func TestReadPullProgressErrors(t *testing.T) {
+	for name, stream := range map[string]string{
+		"error in stream": `{"status":"Downloading"}
+{"error":"manifest for nginx:nope not found"}`,
+		"malformed stream": `{"status":`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := readPullProgress(strings.NewReader(stream), nil); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+	err := readPullProgress(strings.NewReader(`{"error":"manifest for nginx:nope not found"}`), nil)
+	if err == nil || err.Error() != "manifest for nginx:nope not found" {
+		t.Errorf("err = %v, want the daemon's message", err)
+	}
+}
+
+func TestStopContainerTimeout(t *testing.T) {
+	for _, tt := range []struct {
+		timeout int
+		wantT   string
+	}{
+		{0, ""},
+		{30, "30"},
+	} {
+		var gotT string
+		var called bool
+		dc := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+			called = r.URL.Path == "/containers/c1/stop"
+			gotT = r.URL.Query().Get("t")
+			w.WriteHeader(http.StatusNoContent)
+		})
+		if err := dc.StopContainer(context.Background(), "c1", tt.timeout); err != nil {
+			t.Fatalf("StopContainer: %v", err)
+		}
+		if !called || gotT != tt.wantT {
+			t.Errorf("timeout %d: stop called %v with t=%q, want t=%q", tt.timeout, called, gotT, tt.wantT)
+		}
+	}
+}
+
+func TestCreateContainerHealthcheck(t *testing.T) {
+	req := createRequest(t, ContainerSpec{Image: "nginx", HealthCheck: &HealthCheck{
+		Test:     []string{"curl", "-f", "http://localhost/"},
+		Interval: 5 * time.Second,
+		Retries:  3,
+	}})
+	hc := req.Config.Healthcheck
+	if hc == nil {
+		t.Fatal("no health check in the create config")
+	}
+	if strings.Join(hc.Test, " ") != "CMD curl -f http://localhost/" || hc.Interval != 5*time.Second || hc.Retries != 3 {
+		t.Errorf("health check %+v, want the curl command every 5s with 3 retries", hc)
+	}
+
+	if req := createRequest(t, ContainerSpec{Image: "nginx"}); req.Config.Healthcheck != nil {
+		t.Errorf("health check %+v without one in the spec", req.Config.Healthcheck)
+	}
+}
+
+func TestParseRestartPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		name    string
+		max     int
+		wantErr bool
+	}{
+		{"", "", 0, false},
+		{"always", RestartAlways, 0, false},
+		{"on-failure", RestartOnFailure, 0, false},
+		{"on-failure:5", RestartOnFailure, 5, false},
+		{"on-failure:0", "", 0, true},
+		{"on-failure:x", "", 0, true},
+		{"always:3", "", 0, true},
+		{"sometimes", "", 0, true},
+	}
+	for _, tt := range tests {
+		name, maxRestarts, ok := ParseRestartPolicy(tt.policy)
+		if ok == tt.wantErr || (ok && (name != tt.name || maxRestarts != tt.max)) {
+			t.Errorf("ParseRestartPolicy(%q) = %q, %d, %v", tt.policy, name, maxRestarts, ok)
+		}
+		if ValidRestartPolicy(tt.policy) != ok {
+			t.Errorf("ValidRestartPolicy(%q) disagrees with ParseRestartPolicy", tt.policy)
+		}
+	}
+}
+
+func TestCreateContainerCommand(t *testing.T) {
+	req := createRequest(t, ContainerSpec{Image: "postgres", Command: []string{"postgres", "-c", "fsync=off"}, Entrypoint: []string{"/init.sh"}})
+	if strings.Join(req.Config.Cmd, " ") != "postgres -c fsync=off" || strings.Join(req.Config.Entrypoint, " ") != "/init.sh" {
+		t.Errorf("create config cmd %q, entrypoint %q; want the spec's", req.Config.Cmd, req.Config.Entrypoint)
+	}
+
+	// The image's defaults apply unless overridden
+	if req := createRequest(t, ContainerSpec{Image: "postgres"}); req.Config.Cmd != nil || req.Config.Entrypoint != nil {
+		t.Errorf("create config cmd %q, entrypoint %q; want none", req.Config.Cmd, req.Config.Entrypoint)
+	}
+}
+
+func TestCreateContainerEnv(t *testing.T) {
+	req := createRequest(t, ContainerSpec{Image: "web", Env: map[string]string{"PORT": "8080", "DEBUG": "", "APP": "a=b"}})
+	if got := strings.Join(req.Config.Env, " "); got != "APP=a=b DEBUG= PORT=8080" {
+		t.Errorf("create config env %q, want KEY=value pairs sorted by key", req.Config.Env)
+	}
+}
+
+func TestCreateContainerPorts(t *testing.T) {
+	req := createRequest(t, ContainerSpec{Image: "web", Ports: []PortMapping{
+		{ContainerPort: 80, HostPort: 8080},
+		{ContainerPort: 53, Protocol: "udp"},
+	}})
+	if len(req.Config.ExposedPorts) != 2 {
+		t.Errorf("exposed ports %v, want 80/tcp and 53/udp", req.Config.ExposedPorts)
+	}
+	bindings := req.HostConfig.PortBindings
+	if b := bindings["80/tcp"]; len(b) != 1 || b[0].HostPort != "8080" {
+		t.Errorf("80/tcp bound to %v, want host port 8080", b)
+	}
+	if b := bindings["53/udp"]; len(b) != 1 || b[0].HostPort != "" {
+		t.Errorf("53/udp bound to %v, want a port Docker picks", b)
+	}
+}
+
+func TestCreateContainerMounts(t *testing.T) {
+	req := createRequest(t, ContainerSpec{Image: "postgres", Mounts: []Mount{
+		{Type: MountVolume, Source: "pgdata", Target: "/var/lib/postgresql/data"},
+		{Type: MountBind, Source: "/srv/conf", Target: "/etc/postgresql", ReadOnly: true},
+	}})
+	mounts := req.HostConfig.Mounts
+	if len(mounts) != 2 {
+		t.Fatalf("mounts %+v, want the volume and the bind mount", mounts)
+	}
+	if m := mounts[0]; m.Type != "volume" || m.Source != "pgdata" || m.Target != "/var/lib/postgresql/data" || m.ReadOnly {
+		t.Errorf("first mount %+v, want pgdata read-write", m)
+	}
+	if m := mounts[1]; m.Type != "bind" || m.Source != "/srv/conf" || !m.ReadOnly {
+		t.Errorf("second mount %+v, want /srv/conf read-only", m)
+	}
+}
+
+func TestCreateContainerBurstLimits(t *testing.T) {
+	const mb = 1024 * 1024
+	tests := []struct {
+		name string
+		spec ContainerSpec
+		want containerTypes.Resources
+	}{
+		{"defaults", ContainerSpec{CPU: 1, Memory: 512},
+			containerTypes.Resources{NanoCPUs: 1e9, Memory: 512 * mb}},
+		{"swap", ContainerSpec{CPU: 1, Memory: 512, MemorySwapMB: 1024},
+			containerTypes.Resources{NanoCPUs: 1e9, Memory: 512 * mb, MemorySwap: 1024 * mb}},
+		{"unlimited swap", ContainerSpec{CPU: 1, Memory: 512, MemorySwapMB: -1},
+			containerTypes.Resources{NanoCPUs: 1e9, Memory: 512 * mb, MemorySwap: -1}},
+		{"shares", ContainerSpec{CPU: 1, Memory: 512, CPUShares: 256},
+			containerTypes.Resources{NanoCPUs: 1e9, Memory: 512 * mb, CPUShares: 256}},
+		{"quota", ContainerSpec{CPU: 1, Memory: 512, CPUQuota: 150000},
+			containerTypes.Resources{Memory: 512 * mb, CPUPeriod: 100000, CPUQuota: 150000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.spec.Image = "worker"
+			got := createRequest(t, tt.spec).HostConfig.Resources
+			if got.NanoCPUs != tt.want.NanoCPUs || got.Memory != tt.want.Memory || got.MemorySwap != tt.want.MemorySwap ||
+				got.CPUShares != tt.want.CPUShares || got.CPUPeriod != tt.want.CPUPeriod || got.CPUQuota != tt.want.CPUQuota {
+				t.Errorf("resources %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateContainerRequestsGPUs(t *testing.T) {
+	req := createRequest(t, ContainerSpec{Image: "pytorch", GPU: 2})
+	devices := req.HostConfig.DeviceRequests
+	if len(devices) != 1 || devices[0].Count != 2 || len(devices[0].Capabilities) != 1 || devices[0].Capabilities[0][0] != "gpu" {
+		t.Errorf("device requests = %+v, want 2 GPUs", devices)
+	}
+
+	if req := createRequest(t, ContainerSpec{Image: "nginx"}); len(req.HostConfig.DeviceRequests) != 0 {
+		t.Errorf("device requests = %+v without GPUs, want none", req.HostConfig.DeviceRequests)
+	}
+}
+
+func TestUpdateContainer(t *testing.T) {
+	const mb = 1024 * 1024
+	tests := []struct {
+		name     string
+		swapMB   int64
+		wantSwap int64
+	}{
+		{"default swap", 0, 1024 * mb},
+		{"explicit swap", 768, 768 * mb},
+		{"unlimited swap", -1, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path string
+			var update containerTypes.UpdateConfig
+			dc := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+					t.Errorf("decoding update request: %v", err)
+				}
+				w.Write([]byte(`{}`))
+			})
+			if err := dc.UpdateContainer(context.Background(), "c1", 1.5, 512, tt.swapMB); err != nil {
+				t.Fatalf("UpdateContainer: %v", err)
+			}
+			if path != "/containers/c1/update" {
+				t.Errorf("sent to %s, want /containers/c1/update", path)
+			}
+			if update.NanoCPUs != 1.5e9 || update.Memory != 512*mb || update.MemorySwap != tt.wantSwap {
+				t.Errorf("updated to %d nano CPUs, %d memory, %d swap; want 1.5e9, %d and %d",
+					update.NanoCPUs, update.Memory, update.MemorySwap, 512*mb, tt.wantSwap)
+			}
+		})
+	}
+}
+
+func TestExec(t *testing.T) {
+	var created containerTypes.ExecOptions
+	dc := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/c1/exec":
+			if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+				t.Errorf("decoding exec create request: %v", err)
+			}
+			w.Write([]byte(`{"Id":"e1"}`))
+		case "/exec/e1/start":
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("Hijack: %v", err)
+				return
+			}
+			defer conn.Close()
+			buf.WriteString("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+			stdcopy.NewStdWriter(buf, stdcopy.Stdout).Write([]byte("hi\n"))
+			stdcopy.NewStdWriter(buf, stdcopy.Stderr).Write([]byte("oops\n"))
+			buf.Flush()
+		case "/exec/e1/json":
+			w.Write([]byte(`{"ID":"e1","ExitCode":3}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	res, err := dc.Exec(context.Background(), "c1", []string{"sh", "-c", "echo hi"})
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if strings.Join(created.Cmd, " ") != "sh -c echo hi" || !created.AttachStdout || !created.AttachStderr || created.Tty {
+		t.Errorf("created exec %+v, want the command with stdout and stderr attached and no TTY", created)
+	}
+	if res.ExitCode != 3 || res.Output != "hi\noops\n" {
+		t.Errorf("Exec = %+v, want exit code 3 and both streams", res)
+	}
+}
+
+func TestProbeValidate(t *testing.T) {
+	tests := []struct {
+		probe Probe
+		valid bool
+	}{
+		{Probe{Type: ProbeHTTP, Port: 80}, true},
+		{Probe{Type: ProbeTCP, Port: 5432, Action: ProbeActionRestart}, true},
+		{Probe{Type: ProbeExec, Command: []string{"pg_isready"}, Action: ProbeActionReplace}, true},
+		{Probe{Type: ProbeHTTP}, false},
+		{Probe{Type: ProbeTCP, Port: 70000}, false},
+		{Probe{Type: ProbeExec}, false},
+		{Probe{Type: "grpc", Port: 80}, false},
+		{Probe{Type: ProbeTCP, Port: 80, FailureThreshold: -1}, false},
+		{Probe{Type: ProbeTCP, Port: 80, Action: "reboot"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.probe.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%+v) = %v, want valid %v", tt.probe, err, tt.valid)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(app.Close)
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(app.URL, "http://"))
+	appPort, _ := strconv.Atoi(port)
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	dc := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/c1/json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"Id":"c1","NetworkSettings":{"Networks":{"bridge":{"IPAddress":"127.0.0.1"}}}}`))
+	})
+	tests := []struct {
+		probe   Probe
+		healthy bool
+	}{
+		{Probe{Type: ProbeHTTP, Port: appPort, Path: "healthz"}, true},
+		{Probe{Type: ProbeHTTP, Port: appPort, Path: "/ready"}, false},
+		{Probe{Type: ProbeTCP, Port: appPort}, true},
+		{Probe{Type: ProbeTCP, Port: closedPort}, false},
+	}
+	for _, tt := range tests {
+		res, err := dc.Probe(context.Background(), "c1", tt.probe)
+		if err != nil {
+			t.Fatalf("Probe(%+v): %v", tt.probe, err)
+		}
+		if res.Healthy != tt.healthy || (!res.Healthy && res.Message == "") {
+			t.Errorf("Probe(%+v) = %+v, want healthy %v", tt.probe, res, tt.healthy)
+		}
+	}
+	if _, err := dc.Probe(context.Background(), "missing", Probe{Type: ProbeTCP, Port: appPort}); err == nil {
+		t.Error("probing a missing container succeeded")
+	}
+}
+
+func TestStats(t *testing.T) {
+	dc := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/c1/stats" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{
+			"cpu_stats": {"cpu_usage": {"total_usage": 3000}, "system_cpu_usage": 20000, "online_cpus": 2},
+			"precpu_stats": {"cpu_usage": {"total_usage": 1000}, "system_cpu_usage": 10000},
+			"memory_stats": {"usage": 268435456, "limit": 536870912},
+			"networks": {"eth0": {"rx_bytes": 100, "tx_bytes": 10}, "eth1": {"rx_bytes": 50, "tx_bytes": 5}},
+			"blkio_stats": {"io_service_bytes_recursive": [
+				{"op": "Read", "value": 4096}, {"op": "write", "value": 1024}, {"op": "Total", "value": 5120}
+			]}
+		}`))
+	})
+	stats, err := dc.Stats(context.Background(), "c1")
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	want := ContainerStats{CPUPercent: 40, MemoryUsageMB: 256, MemoryLimitMB: 512,
+		NetworkRxBytes: 150, NetworkTxBytes: 15, BlockReadBytes: 4096, BlockWriteBytes: 1024}
+	if stats != want {
+		t.Errorf("stats %+v, want %+v", stats, want)
+	}
+}
+
+func TestRestartContainer(t *testing.T) {
+	var path, gotT string
+	dc := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+		path, gotT = r.URL.Path, r.URL.Query().Get("t")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	if err := dc.RestartContainer(context.Background(), "c1", 10); err != nil {
+		t.Fatalf("RestartContainer: %v", err)
+	}
+	if path != "/containers/c1/restart" || gotT != "10" {
+		t.Errorf("sent %s with t=%q, want /containers/c1/restart with t=10", path, gotT)
+	}
+}
+
+func TestCreateContainerOnNetwork(t *testing.T) {
+	for _, exists := range []bool{false, true} {
+		var networkCreate networkTypes.CreateRequest
+		var req containerTypes.CreateRequest
+		created := false
+		dc := fakeDaemon(t, func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/networks/appnet":
+				if !exists {
+					http.Error(w, `{"message":"network appnet not found"}`, http.StatusNotFound)
+					return
+				}
+				w.Write([]byte(`{"Name":"appnet","Id":"n1"}`))
+			case r.URL.Path == "/networks/create":
+				created = true
+				if err := json.NewDecoder(r.Body).Decode(&networkCreate); err != nil {
+					t.Errorf("decoding network create request: %v", err)
+				}
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"Id":"n1"}`))
+			case r.URL.Path == "/containers/create":
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("decoding create request: %v", err)
+				}
+				w.Write([]byte(`{"Id":"c1"}`))
+			default:
+				http.NotFound(w, r)
+			}
+		})
+
+		if _, err := dc.CreateContainer(context.Background(), ContainerSpec{Name: "web", Image: "nginx", Network: "appnet"}); err != nil {
+			t.Fatalf("CreateContainer: %v", err)
+		}
+		if created == exists {
+			t.Errorf("network exists %v: created %v", exists, created)
+		}
+		if created && (networkCreate.Name != "appnet" || networkCreate.Driver != "bridge" || networkCreate.Labels[ManagedLabel] != "true") {
+			t.Errorf("created network %+v, want a managed bridge called appnet", networkCreate)
+		}
+		if req.NetworkingConfig == nil || req.NetworkingConfig.EndpointsConfig["appnet"] == nil {
+			t.Errorf("networking config %+v, want an endpoint on appnet", req.NetworkingConfig)
+		}
+	}
+}
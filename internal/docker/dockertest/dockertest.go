@@ -0,0 +1,800 @@
+// Package dockertest provides an in-memory docker.ContainerRuntime, so that
+// managers and clusters can be tested without a Docker daemon
+package dockertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	containerTypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+
+	"mini-cloud/internal/docker"
+)
+
+// Container states
+const (
+	StateCreated = "created"
+	StateRunning = "running"
+	StateExited  = "exited"
+)
+
+// firstHostPort is the first port handed out for ports Docker would pick
+const firstHostPort = 32768
+
+// Container is a container held by a Runtime
+type Container struct {
+	ID        string
+	Spec      docker.ContainerSpec // as passed to CreateContainer
+	State     string               // one of the State* constants
+	ExitCode  int
+	Health    string // "starting", "healthy" or "unhealthy"; empty without a health check
+	CreatedAt time.Time
+	HostPorts map[string]int // "80/tcp" -> host port, while running
+	Restarts  int            // calls to RestartContainer
+	CPU       float64        // limits, as created or last updated
+	MemoryMB  int64
+	SwapMB    int64 // memory plus swap, as in docker.ContainerSpec
+
+	LastStopTimeout int // timeout passed to the last StopContainer or RestartContainer
+}
+
+// Runtime is an in-memory container runtime. Containers start and stop
+// instantly; tests drive them through SetExited, SetHealth and friends. The
+// zero value is not usable; call New.
+type Runtime struct {
+	mu         sync.Mutex
+	containers map[string]*Container
+	images     map[string]docker.Image // pulled images by reference
+	digests    map[string]string       // image -> registry digest
+	volumes    map[string]docker.Volume
+	networks   map[string]bool
+	stats      map[string]docker.ContainerStats
+	execs      map[string]docker.ExecResult
+	probes     map[string]docker.ProbeResult
+	logs       map[string][2]string // stdout and stderr
+	failures   map[string]error     // operation -> error it returns
+	calls      map[string]int       // operation -> times called
+	hook       func(ctx context.Context, op, arg string) error
+	nextPort   int
+	pingErr    error
+}
+
+var _ docker.ContainerRuntime = (*Runtime)(nil)
+
+// lastID numbers containers across every runtime, so that like Docker's IDs
+// they never collide between the nodes of a cluster
+var lastID atomic.Int64
+
+// New returns an empty runtime
+func New() *Runtime {
+	return &Runtime{
+		containers: make(map[string]*Container),
+		images:     make(map[string]docker.Image),
+		digests:    make(map[string]string),
+		volumes:    make(map[string]docker.Volume),
+		networks:   make(map[string]bool),
+		stats:      make(map[string]docker.ContainerStats),
+		execs:      make(map[string]docker.ExecResult),
+		probes:     make(map[string]docker.ProbeResult),
+		logs:       make(map[string][2]string),
+		failures:   make(map[string]error),
+		calls:      make(map[string]int),
+		nextPort:   firstHostPort,
+	}
+}
+
+// Fail makes every later call of the operation op, a ContainerRuntime
+// method name such as "StartContainer", return err. A nil err clears it.
+func (rt *Runtime) Fail(op string, err error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if err == nil {
+		delete(rt.failures, op)
+		return
+	}
+	rt.failures[op] = err
+}
+
+// SetHook installs fn to run, without the runtime's lock, at the start of
+// every operation with its name and main argument (container ID, image or
+// name). A non-nil error is returned by the operation. Hooks may block, e.g.
+// to hold an operation until ctx ends.
+func (rt *Runtime) SetHook(fn func(ctx context.Context, op, arg string) error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.hook = fn
+}
+
+// Calls returns how often the operation op was called
+func (rt *Runtime) Calls(op string) int {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.calls[op]
+}
+
+// begin counts a call of op and runs the hook and injected failure for it
+func (rt *Runtime) begin(ctx context.Context, op, arg string) error {
+	rt.mu.Lock()
+	rt.calls[op]++
+	hook := rt.hook
+	rt.mu.Unlock()
+
+	if hook != nil {
+		if err := hook(ctx, op, arg); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.failures[op]
+}
+
+// notFound returns the error Docker reports for a missing object
+func notFound(kind, name string) error {
+	return cerrdefs.ErrNotFound.WithMessage(fmt.Sprintf("no such %s: %s", kind, name))
+}
+
+// containerLocked looks up a container by ID or name. Caller must hold the lock.
+func (rt *Runtime) containerLocked(id string) (*Container, error) {
+	if c, ok := rt.containers[id]; ok {
+		return c, nil
+	}
+	for _, c := range rt.containers {
+		if c.Spec.Name != "" && c.Spec.Name == id {
+			return c, nil
+		}
+	}
+	return nil, notFound("container", id)
+}
+
+// Container returns a copy of container id, or false if it doesn't exist
+func (rt *Runtime) Container(id string) (Container, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	c, err := rt.containerLocked(id)
+	if err != nil {
+		return Container{}, false
+	}
+	return *c, true
+}
+
+// Containers returns copies of every container, sorted by ID
+func (rt *Runtime) Containers() []Container {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	out := make([]Container, 0, len(rt.containers))
+	for _, c := range rt.containers {
+		out = append(out, *c)
+	}
+	slices.SortFunc(out, func(a, b Container) int { return strings.Compare(a.ID, b.ID) })
+	return out
+}
+
+// Running returns how many containers are running
+func (rt *Runtime) Running() int {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	n := 0
+	for _, c := range rt.containers {
+		if c.State == StateRunning {
+			n++
+		}
+	}
+	return n
+}
+
+// SetExited stops container id as if its process exited with code
+func (rt *Runtime) SetExited(id string, code int) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if c, err := rt.containerLocked(id); err == nil {
+		c.State, c.ExitCode, c.HostPorts = StateExited, code, nil
+	}
+}
+
+// Remove deletes container id behind the manager's back
+func (rt *Runtime) Remove(id string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if c, err := rt.containerLocked(id); err == nil {
+		delete(rt.containers, c.ID)
+	}
+}
+
+// AddContainer adds a running container that wasn't created through the
+// runtime, e.g. one left over from before a restart, and returns its ID
+func (rt *Runtime) AddContainer(spec docker.ContainerSpec) string {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	c := rt.createLocked(spec)
+	rt.startLocked(c)
+	return c.ID
+}
+
+// SetHealth sets the Docker health status of container id
+func (rt *Runtime) SetHealth(id, status string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if c, err := rt.containerLocked(id); err == nil {
+		c.Health = status
+	}
+}
+
+// SetStats sets what Stats reports for container id
+func (rt *Runtime) SetStats(id string, stats docker.ContainerStats) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.stats[id] = stats
+}
+
+// SetExecResult sets what Exec returns for container id; by default commands
+// succeed and echo their arguments
+func (rt *Runtime) SetExecResult(id string, res docker.ExecResult) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.execs[id] = res
+}
+
+// SetProbeResult sets what Probe reports for container id; probes pass by default
+func (rt *Runtime) SetProbeResult(id string, res docker.ProbeResult) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.probes[id] = res
+}
+
+// SetLogs sets the output ContainerLogs returns for container id
+func (rt *Runtime) SetLogs(id, stdout, stderr string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.logs[id] = [2]string{stdout, stderr}
+}
+
+// SetImageDigest sets the registry digest image resolves to once pulled
+func (rt *Runtime) SetImageDigest(image, digest string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.digests[image] = digest
+}
+
+// AddImage makes image present as if pulled earlier
+func (rt *Runtime) AddImage(img docker.Image) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	for _, tag := range img.Tags {
+		rt.images[tag] = img
+	}
+}
+
+// HasImage reports whether image has been pulled
+func (rt *Runtime) HasImage(image string) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	_, ok := rt.images[docker.NormalizeImage(image)]
+	return ok
+}
+
+// SetPingError makes Ping fail with err, or succeed again if err is nil
+func (rt *Runtime) SetPingError(err error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.pingErr = err
+}
+
+// Ping fails with the error set by SetPingError
+func (rt *Runtime) Ping(ctx context.Context) error {
+	if err := rt.begin(ctx, "Ping", ""); err != nil {
+		return err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.pingErr
+}
+
+// PullImage records image as present and reports a single progress message
+func (rt *Runtime) PullImage(ctx context.Context, image string, opts docker.PullOptions) error {
+	if err := rt.begin(ctx, "PullImage", image); err != nil {
+		return err
+	}
+	rt.mu.Lock()
+	ref := docker.NormalizeImage(image)
+	if _, ok := rt.images[ref]; !ok {
+		rt.images[ref] = docker.Image{ID: "sha256:" + strconv.Itoa(len(rt.images)+1), Tags: []string{ref}, CreatedAt: time.Now()}
+	}
+	rt.mu.Unlock()
+	if opts.OnProgress != nil {
+		opts.OnProgress(docker.PullProgress{Status: "Pull complete"})
+	}
+	return nil
+}
+
+// ListImages lists the pulled images
+func (rt *Runtime) ListImages(ctx context.Context) ([]docker.Image, error) {
+	if err := rt.begin(ctx, "ListImages", ""); err != nil {
+		return nil, err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	byID := make(map[string]docker.Image)
+	for _, img := range rt.images {
+		byID[img.ID] = img
+	}
+	out := slices.Collect(maps.Values(byID))
+	slices.SortFunc(out, func(a, b docker.Image) int { return strings.Compare(a.ID, b.ID) })
+	return out, nil
+}
+
+// RemoveImage removes image unless a container uses it
+func (rt *Runtime) RemoveImage(ctx context.Context, ref string) error {
+	if err := rt.begin(ctx, "RemoveImage", ref); err != nil {
+		return err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	ref = docker.NormalizeImage(ref)
+	for _, c := range rt.containers {
+		if docker.NormalizeImage(c.Spec.Image) == ref {
+			return cerrdefs.ErrConflict.WithMessage("image is being used by container " + c.ID)
+		}
+	}
+	delete(rt.images, ref)
+	return nil
+}
+
+// ImageDigest returns the digest set by SetImageDigest, or the one image pins
+func (rt *Runtime) ImageDigest(ctx context.Context, image string) (string, error) {
+	if err := rt.begin(ctx, "ImageDigest", image); err != nil {
+		return "", err
+	}
+	if digest := docker.RefDigest(image); digest != "" {
+		return digest, nil
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.digests[image], nil
+}
+
+// CreateContainer creates a container from spec, rejecting taken names like Docker
+func (rt *Runtime) CreateContainer(ctx context.Context, spec docker.ContainerSpec) (string, error) {
+	if err := rt.begin(ctx, "CreateContainer", spec.Name); err != nil {
+		return "", err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if spec.Name != "" {
+		if _, err := rt.containerLocked(spec.Name); err == nil {
+			return "", cerrdefs.ErrConflict.WithMessage(fmt.Sprintf("container name %q is already in use", spec.Name))
+		}
+	}
+	if spec.Network != "" {
+		rt.networks[spec.Network] = true
+	}
+	return rt.createLocked(spec).ID, nil
+}
+
+// createLocked adds a created container. Caller must hold the lock.
+func (rt *Runtime) createLocked(spec docker.ContainerSpec) *Container {
+	labels := map[string]string{docker.ManagedLabel: "true"}
+	maps.Copy(labels, spec.Labels)
+	spec.Labels = labels
+
+	c := &Container{
+		ID:        fmt.Sprintf("c%04d", lastID.Add(1)),
+		Spec:      spec,
+		State:     StateCreated,
+		CreatedAt: time.Now(),
+	}
+	c.CPU, c.MemoryMB, c.SwapMB = spec.CPU, spec.Memory, spec.MemorySwapMB
+	rt.containers[c.ID] = c
+	return c
+}
+
+// startLocked runs c and publishes its ports. Caller must hold the lock.
+func (rt *Runtime) startLocked(c *Container) {
+	c.State, c.ExitCode = StateRunning, 0
+	if c.Spec.HealthCheck != nil && c.Health == "" {
+		c.Health = "starting"
+	}
+	c.HostPorts = nil
+	for _, p := range c.Spec.Ports {
+		if c.HostPorts == nil {
+			c.HostPorts = make(map[string]int)
+		}
+		port := p.HostPort
+		if port == 0 {
+			port = rt.nextPort
+			rt.nextPort++
+		}
+		c.HostPorts[p.Port()] = port
+	}
+}
+
+// StartContainer runs a created or stopped container
+func (rt *Runtime) StartContainer(ctx context.Context, id string) error {
+	if err := rt.begin(ctx, "StartContainer", id); err != nil {
+		return err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	c, err := rt.containerLocked(id)
+	if err != nil {
+		return err
+	}
+	rt.startLocked(c)
+	return nil
+}
+
+// StopContainer stops a container with exit code 0
+func (rt *Runtime) StopContainer(ctx context.Context, id string, timeout int) error {
+	if err := rt.begin(ctx, "StopContainer", id); err != nil {
+		return err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	c, err := rt.containerLocked(id)
+	if err != nil {
+		return err
+	}
+	c.LastStopTimeout = timeout
+	if c.State == StateRunning {
+		c.State, c.ExitCode, c.HostPorts = StateExited, 0, nil
+	}
+	return nil
+}
+
+// RestartContainer stops and starts a container
+func (rt *Runtime) RestartContainer(ctx context.Context, id string, timeout int) error {
+	if err := rt.begin(ctx, "RestartContainer", id); err != nil {
+		return err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	c, err := rt.containerLocked(id)
+	if err != nil {
+		return err
+	}
+	c.LastStopTimeout = timeout
+	c.Restarts++
+	rt.startLocked(c)
+	return nil
+}
+
+// RemoveContainer deletes a container, running or not
+func (rt *Runtime) RemoveContainer(ctx context.Context, id string) error {
+	if err := rt.begin(ctx, "RemoveContainer", id); err != nil {
+		return err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	c, err := rt.containerLocked(id)
+	if err != nil {
+		return err
+	}
+	delete(rt.containers, c.ID)
+	return nil
+}
+
+// ListContainers lists every container, like DockerClient lists managed ones
+func (rt *Runtime) ListContainers(ctx context.Context) ([]containerTypes.Summary, error) {
+	if err := rt.begin(ctx, "ListContainers", ""); err != nil {
+		return nil, err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	out := make([]containerTypes.Summary, 0, len(rt.containers))
+	for _, c := range rt.containers {
+		s := containerTypes.Summary{
+			ID:      c.ID,
+			Names:   []string{"/" + c.Spec.Name},
+			Image:   c.Spec.Image,
+			Labels:  maps.Clone(c.Spec.Labels),
+			State:   c.State,
+			Created: c.CreatedAt.Unix(),
+		}
+		for port, host := range c.HostPorts {
+			num, proto, _ := strings.Cut(port, "/")
+			private, _ := strconv.Atoi(num)
+			s.Ports = append(s.Ports, containerTypes.Port{PrivatePort: uint16(private), PublicPort: uint16(host), Type: proto})
+		}
+		out = append(out, s)
+	}
+	slices.SortFunc(out, func(a, b containerTypes.Summary) int { return strings.Compare(a.ID, b.ID) })
+	return out, nil
+}
+
+// InspectContainer reports a container's state, health and published ports
+func (rt *Runtime) InspectContainer(ctx context.Context, id string) (containerTypes.InspectResponse, error) {
+	if err := rt.begin(ctx, "InspectContainer", id); err != nil {
+		return containerTypes.InspectResponse{}, err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	c, err := rt.containerLocked(id)
+	if err != nil {
+		return containerTypes.InspectResponse{}, err
+	}
+
+	state := &containerTypes.State{
+		Status:   containerTypes.ContainerState(c.State),
+		Running:  c.State == StateRunning,
+		ExitCode: c.ExitCode,
+	}
+	if c.Health != "" {
+		state.Health = &containerTypes.Health{Status: containerTypes.HealthStatus(c.Health)}
+	}
+	ports := make(nat.PortMap, len(c.HostPorts))
+	for port, host := range c.HostPorts {
+		ports[nat.Port(port)] = []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: strconv.Itoa(host)}}
+	}
+	return containerTypes.InspectResponse{
+		ContainerJSONBase: &containerTypes.ContainerJSONBase{
+			ID:         c.ID,
+			Name:       "/" + c.Spec.Name,
+			State:      state,
+			HostConfig: &containerTypes.HostConfig{},
+		},
+		Config: &containerTypes.Config{Image: c.Spec.Image, Labels: maps.Clone(c.Spec.Labels)},
+		NetworkSettings: &containerTypes.NetworkSettings{
+			NetworkSettingsBase: containerTypes.NetworkSettingsBase{Ports: ports},
+		},
+	}, nil
+}
+
+// UpdateContainer records the new limits of a container
+func (rt *Runtime) UpdateContainer(ctx context.Context, id string, cpu float64, memoryMB, memorySwapMB int64) error {
+	if err := rt.begin(ctx, "UpdateContainer", id); err != nil {
+		return err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	c, err := rt.containerLocked(id)
+	if err != nil {
+		return err
+	}
+	c.CPU, c.MemoryMB, c.SwapMB = cpu, memoryMB, memorySwapMB
+	return nil
+}
+
+// Exec returns the result set by SetExecResult, or echoes cmd with exit code 0
+func (rt *Runtime) Exec(ctx context.Context, id string, cmd []string) (docker.ExecResult, error) {
+	if err := rt.begin(ctx, "Exec", id); err != nil {
+		return docker.ExecResult{}, err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	c, err := rt.containerLocked(id)
+	if err != nil {
+		return docker.ExecResult{}, err
+	}
+	if c.State != StateRunning {
+		return docker.ExecResult{}, cerrdefs.ErrConflict.WithMessage("container " + c.ID + " is not running")
+	}
+	if res, ok := rt.execs[c.ID]; ok {
+		return res, nil
+	}
+	return docker.ExecResult{Output: strings.Join(cmd, " ") + "\n"}, nil
+}
+
+// ExecTTY starts a session echoing what is typed, like a shell that prints
+// its input. Typing "exit" ends it with the exit code set by SetExecResult.
+func (rt *Runtime) ExecTTY(ctx context.Context, id string, cmd []string) (docker.ExecSession, error) {
+	if err := rt.begin(ctx, "ExecTTY", id); err != nil {
+		return nil, err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	c, err := rt.containerLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.State != StateRunning {
+		return nil, cerrdefs.ErrConflict.WithMessage("container " + c.ID + " is not running")
+	}
+	pr, pw := io.Pipe()
+	return &echoSession{r: pr, w: pw, code: rt.execs[c.ID].ExitCode}, nil
+}
+
+// echoSession is the docker.ExecSession started by ExecTTY
+type echoSession struct {
+	r    *io.PipeReader
+	w    *io.PipeWriter
+	code int
+
+	mu     sync.Mutex
+	exited bool
+}
+
+func (s *echoSession) Read(p []byte) (int, error) { return s.r.Read(p) }
+
+func (s *echoSession) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	if err == nil && strings.TrimSpace(string(p)) == "exit" {
+		s.mu.Lock()
+		s.exited = true
+		s.mu.Unlock()
+		s.w.Close()
+	}
+	return n, err
+}
+
+func (s *echoSession) Close() error {
+	s.r.Close()
+	return s.w.Close()
+}
+
+func (s *echoSession) Resize(context.Context, uint, uint) error { return nil }
+
+func (s *echoSession) ExitCode(context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.exited {
+		return 0, docker.ErrExecRunning
+	}
+	return s.code, nil
+}
+
+// Probe returns the result set by SetProbeResult, healthy by default
+func (rt *Runtime) Probe(ctx context.Context, id string, p docker.Probe) (docker.ProbeResult, error) {
+	if err := rt.begin(ctx, "Probe", id); err != nil {
+		return docker.ProbeResult{}, err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	c, err := rt.containerLocked(id)
+	if err != nil {
+		return docker.ProbeResult{}, err
+	}
+	if res, ok := rt.probes[c.ID]; ok {
+		return res, nil
+	}
+	return docker.ProbeResult{Healthy: true}, nil
+}
+
+// Stats returns the sample set by SetStats, zero by default
+func (rt *Runtime) Stats(ctx context.Context, id string) (docker.ContainerStats, error) {
+	if err := rt.begin(ctx, "Stats", id); err != nil {
+		return docker.ContainerStats{}, err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	c, err := rt.containerLocked(id)
+	if err != nil {
+		return docker.ContainerStats{}, err
+	}
+	return rt.stats[c.ID], nil
+}
+
+// ContainerLogs returns the output set by SetLogs, multiplexed like Docker's.
+// Following is not supported; the stream always ends.
+func (rt *Runtime) ContainerLogs(ctx context.Context, id string, opts docker.LogOptions) (io.ReadCloser, error) {
+	if err := rt.begin(ctx, "ContainerLogs", id); err != nil {
+		return nil, err
+	}
+	rt.mu.Lock()
+	c, err := rt.containerLocked(id)
+	if err != nil {
+		rt.mu.Unlock()
+		return nil, err
+	}
+	logs := rt.logs[c.ID]
+	rt.mu.Unlock()
+
+	pr, pw := io.Pipe()
+	go func() {
+		stdout := stdcopy.NewStdWriter(pw, stdcopy.Stdout)
+		stderr := stdcopy.NewStdWriter(pw, stdcopy.Stderr)
+		_, err := io.WriteString(stdout, tailLines(logs[0], opts.Tail))
+		if err == nil && logs[1] != "" {
+			_, err = io.WriteString(stderr, tailLines(logs[1], opts.Tail))
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// tailLines returns the last n lines of s, or all of them if n <= 0
+func tailLines(s string, n int) string {
+	if n <= 0 {
+		return s
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines[max(len(lines)-n, 0):], "")
+}
+
+// CreateVolume creates a volume unless it exists
+func (rt *Runtime) CreateVolume(ctx context.Context, name string, labels map[string]string) error {
+	if err := rt.begin(ctx, "CreateVolume", name); err != nil {
+		return err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if _, ok := rt.volumes[name]; !ok {
+		all := map[string]string{docker.ManagedLabel: "true"}
+		maps.Copy(all, labels)
+		rt.volumes[name] = docker.Volume{Name: name, Labels: all, CreatedAt: time.Now()}
+	}
+	return nil
+}
+
+// ListVolumes lists the volumes, sorted by name
+func (rt *Runtime) ListVolumes(ctx context.Context) ([]docker.Volume, error) {
+	if err := rt.begin(ctx, "ListVolumes", ""); err != nil {
+		return nil, err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	out := slices.Collect(maps.Values(rt.volumes))
+	slices.SortFunc(out, func(a, b docker.Volume) int { return strings.Compare(a.Name, b.Name) })
+	return out, nil
+}
+
+// RemoveVolume removes a volume unless a container mounts it
+func (rt *Runtime) RemoveVolume(ctx context.Context, name string) error {
+	if err := rt.begin(ctx, "RemoveVolume", name); err != nil {
+		return err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if _, ok := rt.volumes[name]; !ok {
+		return notFound("volume", name)
+	}
+	for _, c := range rt.containers {
+		for _, m := range c.Spec.Mounts {
+			if m.Type == docker.MountVolume && m.Source == name {
+				return cerrdefs.ErrConflict.WithMessage("volume is in use by container " + c.ID)
+			}
+		}
+	}
+	delete(rt.volumes, name)
+	return nil
+}
+
+// ListNetworks lists the networks containers were attached to, sorted by name
+func (rt *Runtime) ListNetworks(ctx context.Context) ([]string, error) {
+	if err := rt.begin(ctx, "ListNetworks", ""); err != nil {
+		return nil, err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return slices.Sorted(maps.Keys(rt.networks)), nil
+}
+
+// RemoveNetwork removes a network unless a container is attached to it
+func (rt *Runtime) RemoveNetwork(ctx context.Context, name string) error {
+	if err := rt.begin(ctx, "RemoveNetwork", name); err != nil {
+		return err
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if !rt.networks[name] {
+		return notFound("network", name)
+	}
+	for _, c := range rt.containers {
+		if c.Spec.Network == name {
+			return cerrdefs.ErrConflict.WithMessage("network has active endpoints")
+		}
+	}
+	delete(rt.networks, name)
+	return nil
+}
+
+// ErrInjected is a convenient error for Fail and hooks; retries treat it as transient
+var ErrInjected = errors.New("dockertest: injected failure")
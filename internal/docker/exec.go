@@ -0,0 +1,76 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	containerTypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// ExecSession is an interactive command running on a TTY inside a
+// container. Reading returns the terminal's output and writing types into it.
+type ExecSession interface {
+	io.ReadWriteCloser
+	Resize(ctx context.Context, rows, cols uint) error
+	// ExitCode returns the command's exit code once its output has ended
+	ExitCode(ctx context.Context) (int, error)
+}
+
+// ErrExecRunning is returned by ExitCode while the command is still running
+var ErrExecRunning = errors.New("command is still running")
+
+// ExecTTY starts cmd on a new TTY inside a running container. Closing the
+// session hangs up the terminal.
+func (dc *DockerClient) ExecTTY(ctx context.Context, id string, cmd []string) (ExecSession, error) {
+	created, err := dc.cli.ContainerExecCreate(ctx, id, containerTypes.ExecOptions{
+		Cmd:          cmd,
+		Env:          []string{"TERM=xterm"},
+		Tty:          true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := dc.cli.ContainerExecAttach(ctx, created.ID, containerTypes.ExecAttachOptions{Tty: true})
+	if err != nil {
+		return nil, err
+	}
+	return &execSession{cli: dc.cli, id: created.ID, resp: resp}, nil
+}
+
+// execSession is an ExecSession on a local Docker daemon; with a TTY the
+// output is not multiplexed
+type execSession struct {
+	cli  *client.Client
+	id   string
+	resp types.HijackedResponse
+}
+
+func (s *execSession) Read(p []byte) (int, error)  { return s.resp.Reader.Read(p) }
+func (s *execSession) Write(p []byte) (int, error) { return s.resp.Conn.Write(p) }
+
+func (s *execSession) Close() error {
+	s.resp.Close()
+	return nil
+}
+
+func (s *execSession) Resize(ctx context.Context, rows, cols uint) error {
+	return s.cli.ContainerExecResize(ctx, s.id, containerTypes.ResizeOptions{Height: rows, Width: cols})
+}
+
+func (s *execSession) ExitCode(ctx context.Context) (int, error) {
+	inspect, err := s.cli.ContainerExecInspect(ctx, s.id)
+	if err != nil {
+		return 0, err
+	}
+	if inspect.Running {
+		return 0, ErrExecRunning
+	}
+	return inspect.ExitCode, nil
+}
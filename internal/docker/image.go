@@ -0,0 +1,109 @@
+package docker
+
+import (
+	"context"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/distribution/reference"
+	imageTypes "github.com/docker/docker/api/types/image"
+)
+
+// Image is an image present on a node
+type Image struct {
+	ID        string
+	Tags      []string // e.g. "nginx:latest"
+	Digests   []string // e.g. "nginx@sha256:..."
+	SizeBytes int64
+	CreatedAt time.Time
+}
+
+// ListImages lists the images present on the node
+func (dc *DockerClient) ListImages(ctx context.Context) ([]Image, error) {
+	summaries, err := dc.cli.ImageList(ctx, imageTypes.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	images := make([]Image, 0, len(summaries))
+	for _, s := range summaries {
+		images = append(images, Image{
+			ID:        s.ID,
+			Tags:      s.RepoTags,
+			Digests:   s.RepoDigests,
+			SizeBytes: s.Size,
+			CreatedAt: time.Unix(s.Created, 0),
+		})
+	}
+	return images, nil
+}
+
+// RemoveImage removes an image reference from the node, deleting the image
+// once nothing refers to it. References already gone are not an error, and
+// images a container uses are kept with a conflict error.
+func (dc *DockerClient) RemoveImage(ctx context.Context, ref string) error {
+	_, err := dc.cli.ImageRemove(ctx, ref, imageTypes.RemoveOptions{PruneChildren: true})
+	if cerrdefs.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// ImageDigest returns the registry digest, e.g. "sha256:...", of the local
+// image, as pulled from image's repository. Images that were never pushed to
+// or pulled from a registry have none, and "" is returned.
+func (dc *DockerClient) ImageDigest(ctx context.Context, image string) (string, error) {
+	if digest := RefDigest(image); digest != "" {
+		return digest, nil
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+	resp, err := dc.cli.ImageInspect(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	for _, rd := range resp.RepoDigests {
+		if pinned, err := reference.ParseNormalizedNamed(rd); err == nil && pinned.Name() == named.Name() {
+			return RefDigest(rd), nil
+		}
+	}
+	return "", nil
+}
+
+// RefDigest returns the digest an image reference pins, e.g. "sha256:..."
+// for "nginx@sha256:...", or "" if it has none
+func RefDigest(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return ""
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		return digested.Digest().String()
+	}
+	return ""
+}
+
+// PinImage returns a reference to image's repository at digest, e.g.
+// "nginx@sha256:..." for "nginx:1.27". Without a digest image is returned as is.
+func PinImage(image, digest string) string {
+	if digest == "" {
+		return image
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	return reference.FamiliarName(named) + "@" + digest
+}
+
+// NormalizeImage returns image in the short form Docker lists it in, with the
+// "latest" tag added if it has neither tag nor digest, e.g. "nginx:latest"
+// for "docker.io/library/nginx". Invalid references are returned unchanged.
+func NormalizeImage(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	return reference.FamiliarString(reference.TagNameOnly(named))
+}
@@ -0,0 +1,31 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"strconv"
+
+	containerTypes "github.com/docker/docker/api/types/container"
+)
+
+// LogOptions selects the log lines ContainerLogs returns
+type LogOptions struct {
+	Tail   int  // number of most recent lines, 0 for all of them
+	Follow bool // keep streaming new output until the container stops
+}
+
+// ContainerLogs returns the container's stdout and stderr multiplexed as
+// by the Docker API; split them with stdcopy.StdCopy. When following, the
+// stream ends once the container stops. The caller must close the stream.
+func (dc *DockerClient) ContainerLogs(ctx context.Context, id string, opts LogOptions) (io.ReadCloser, error) {
+	tail := "all"
+	if opts.Tail > 0 {
+		tail = strconv.Itoa(opts.Tail)
+	}
+	return dc.cli.ContainerLogs(ctx, id, containerTypes.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       tail,
+		Follow:     opts.Follow,
+	})
+}
@@ -0,0 +1,28 @@
+package docker
+
+import (
+	"context"
+
+	"github.com/docker/docker/api/types/filters"
+	networkTypes "github.com/docker/docker/api/types/network"
+)
+
+// ListNetworks returns the names of the networks created by mini-cloud
+func (dc *DockerClient) ListNetworks(ctx context.Context) ([]string, error) {
+	networks, err := dc.cli.NetworkList(ctx, networkTypes.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", ManagedLabel)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(networks))
+	for _, n := range networks {
+		names = append(names, n.Name)
+	}
+	return names, nil
+}
+
+// RemoveNetwork removes a network, failing if a container is still attached
+func (dc *DockerClient) RemoveNetwork(ctx context.Context, name string) error {
+	return dc.cli.NetworkRemove(ctx, name)
+}
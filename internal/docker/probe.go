@@ -0,0 +1,175 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Probe types
+const (
+	ProbeHTTP = "http" // GET Path on Port answers 2xx or 3xx
+	ProbeTCP  = "tcp"  // Port accepts a connection
+	ProbeExec = "exec" // Command exits 0 inside the container
+)
+
+// Actions taken once a probe has failed FailureThreshold times in a row
+const (
+	ProbeActionNone    = ""        // only mark the container unhealthy
+	ProbeActionRestart = "restart" // restart it in place
+	ProbeActionReplace = "replace" // remove it and schedule a new one
+)
+
+// Probe defaults
+const (
+	DefaultProbeInterval         = 10 * time.Second
+	DefaultProbeTimeout          = time.Second
+	DefaultProbeFailureThreshold = 3
+)
+
+// Probe is a liveness check the manager runs against a container from its node
+type Probe struct {
+	Type             string
+	Port             int      // container port checked by http and tcp probes
+	Path             string   // request path of http probes, "/" if empty
+	Command          []string // run by exec probes
+	Interval         time.Duration
+	Timeout          time.Duration
+	FailureThreshold int    // consecutive failures before the container is unhealthy
+	Action           string // one of the ProbeAction* constants
+}
+
+// Validate checks that the probe is complete for its type
+func (p *Probe) Validate() error {
+	switch p.Type {
+	case ProbeHTTP, ProbeTCP:
+		if p.Port < 1 || p.Port > 65535 {
+			return fmt.Errorf("%s probe needs a port between 1 and 65535", p.Type)
+		}
+	case ProbeExec:
+		if len(p.Command) == 0 {
+			return errors.New("exec probe needs a command")
+		}
+	default:
+		return fmt.Errorf("unknown probe type %q (expected http, tcp or exec)", p.Type)
+	}
+	switch {
+	case p.Interval < 0 || p.Timeout < 0 || p.FailureThreshold < 0:
+		return errors.New("probe interval, timeout and failure threshold must not be negative")
+	case p.Action != ProbeActionNone && p.Action != ProbeActionRestart && p.Action != ProbeActionReplace:
+		return fmt.Errorf("unknown probe action %q (expected restart or replace)", p.Action)
+	}
+	return nil
+}
+
+// IntervalOrDefault returns the time between two probes
+func (p *Probe) IntervalOrDefault() time.Duration {
+	if p.Interval > 0 {
+		return p.Interval
+	}
+	return DefaultProbeInterval
+}
+
+// TimeoutOrDefault returns how long one probe may take
+func (p *Probe) TimeoutOrDefault() time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return DefaultProbeTimeout
+}
+
+// Threshold returns the consecutive failures that make a container unhealthy
+func (p *Probe) Threshold() int {
+	if p.FailureThreshold > 0 {
+		return p.FailureThreshold
+	}
+	return DefaultProbeFailureThreshold
+}
+
+// ProbeResult is the outcome of one probe
+type ProbeResult struct {
+	Healthy bool
+	Message string // why the probe failed
+}
+
+// Probe runs p once against container id. A failing probe is reported in the
+// result; errors mean the container couldn't be probed at all.
+func (dc *DockerClient) Probe(ctx context.Context, id string, p Probe) (ProbeResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.TimeoutOrDefault())
+	defer cancel()
+
+	if p.Type == ProbeExec {
+		res, err := dc.Exec(ctx, id, p.Command)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			return ProbeResult{Message: "timed out"}, nil
+		case err != nil:
+			return ProbeResult{}, err
+		case res.ExitCode != 0:
+			return ProbeResult{Message: fmt.Sprintf("exit code %d: %s", res.ExitCode, strings.TrimSpace(res.Output))}, nil
+		}
+		return ProbeResult{Healthy: true}, nil
+	}
+
+	addr, err := dc.probeAddr(ctx, id, p.Port)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	if p.Type == ProbeTCP {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return ProbeResult{Message: err.Error()}, nil
+		}
+		conn.Close()
+		return ProbeResult{Healthy: true}, nil
+	}
+
+	path := p.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+path, nil)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return ProbeResult{Message: err.Error()}, nil
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return ProbeResult{Message: "HTTP " + resp.Status}, nil
+	}
+	return ProbeResult{Healthy: true}, nil
+}
+
+// probeAddr returns the address port of container id is reached at from the
+// node: its IP on the first of its networks, or localhost on the host network
+func (dc *DockerClient) probeAddr(ctx context.Context, id string, port int) (string, error) {
+	inspect, err := dc.InspectContainer(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if inspect.HostConfig != nil && inspect.HostConfig.NetworkMode.IsHost() {
+		return net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), nil
+	}
+	if inspect.NetworkSettings != nil {
+		names := make([]string, 0, len(inspect.NetworkSettings.Networks))
+		for name := range inspect.NetworkSettings.Networks {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if ep := inspect.NetworkSettings.Networks[name]; ep != nil && ep.IPAddress != "" {
+				return net.JoinHostPort(ep.IPAddress, strconv.Itoa(port)), nil
+			}
+		}
+	}
+	return "", errors.New("container has no IP address")
+}
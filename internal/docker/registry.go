@@ -0,0 +1,33 @@
+package docker
+
+import (
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+// DockerHubRegistry is the host images without a registry are pulled from
+const DockerHubRegistry = "docker.io"
+
+// RegistryHost returns the registry an image is pulled from, e.g.
+// "registry.example.com:5000", or DockerHubRegistry for "nginx"
+func RegistryHost(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+	return reference.Domain(named), nil
+}
+
+// NormalizeRegistryHost reduces a registry address as written in credentials,
+// e.g. "https://index.docker.io/v1/", to the host RegistryHost returns
+func NormalizeRegistryHost(server string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	host = strings.ToLower(host)
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return DockerHubRegistry
+	}
+	return host
+}
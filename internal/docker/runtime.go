@@ -0,0 +1,38 @@
+package docker
+
+import (
+	"context"
+	"io"
+
+	containerTypes "github.com/docker/docker/api/types/container"
+)
+
+// ContainerRuntime is the container engine a node schedules onto.
+// DockerClient implements it; other implementations can stand in for a daemon.
+type ContainerRuntime interface {
+	Ping(ctx context.Context) error
+	PullImage(ctx context.Context, image string, opts PullOptions) error
+	ListImages(ctx context.Context) ([]Image, error)
+	RemoveImage(ctx context.Context, ref string) error
+	ImageDigest(ctx context.Context, image string) (string, error)
+	CreateContainer(ctx context.Context, spec ContainerSpec) (string, error)
+	StartContainer(ctx context.Context, id string) error
+	StopContainer(ctx context.Context, id string, timeout int) error
+	RestartContainer(ctx context.Context, id string, timeout int) error
+	RemoveContainer(ctx context.Context, id string) error
+	ListContainers(ctx context.Context) ([]containerTypes.Summary, error)
+	InspectContainer(ctx context.Context, id string) (containerTypes.InspectResponse, error)
+	UpdateContainer(ctx context.Context, id string, cpu float64, memoryMB, memorySwapMB int64) error
+	Exec(ctx context.Context, id string, cmd []string) (ExecResult, error)
+	ExecTTY(ctx context.Context, id string, cmd []string) (ExecSession, error)
+	Probe(ctx context.Context, id string, p Probe) (ProbeResult, error)
+	Stats(ctx context.Context, id string) (ContainerStats, error)
+	ContainerLogs(ctx context.Context, id string, opts LogOptions) (io.ReadCloser, error)
+	CreateVolume(ctx context.Context, name string, labels map[string]string) error
+	ListVolumes(ctx context.Context) ([]Volume, error)
+	RemoveVolume(ctx context.Context, name string) error
+	ListNetworks(ctx context.Context) ([]string, error)
+	RemoveNetwork(ctx context.Context, name string) error
+}
+
+var _ ContainerRuntime = (*DockerClient)(nil)
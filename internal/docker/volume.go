@@ -0,0 +1,48 @@
+package docker
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types/filters"
+	volumeTypes "github.com/docker/docker/api/types/volume"
+)
+
+// Volume is a named volume created by mini-cloud
+type Volume struct {
+	Name      string
+	Labels    map[string]string
+	CreatedAt time.Time
+}
+
+// CreateVolume creates the named volume with labels, marked as managed. If
+// it already exists, Docker leaves it and its labels as they are.
+func (dc *DockerClient) CreateVolume(ctx context.Context, name string, labels map[string]string) error {
+	all := map[string]string{ManagedLabel: "true"}
+	for k, v := range labels {
+		all[k] = v
+	}
+	_, err := dc.cli.VolumeCreate(ctx, volumeTypes.CreateOptions{Name: name, Labels: all})
+	return err
+}
+
+// ListVolumes lists the volumes created by mini-cloud
+func (dc *DockerClient) ListVolumes(ctx context.Context) ([]Volume, error) {
+	resp, err := dc.cli.VolumeList(ctx, volumeTypes.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", ManagedLabel)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	volumes := make([]Volume, 0, len(resp.Volumes))
+	for _, v := range resp.Volumes {
+		created, _ := time.Parse(time.RFC3339, v.CreatedAt)
+		volumes = append(volumes, Volume{Name: v.Name, Labels: v.Labels, CreatedAt: created})
+	}
+	return volumes, nil
+}
+
+// RemoveVolume removes a volume, failing if a container still uses it
+func (dc *DockerClient) RemoveVolume(ctx context.Context, name string) error {
+	return dc.cli.VolumeRemove(ctx, name, false)
+}
@@ -0,0 +1,100 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Type identifies a container lifecycle transition
+type Type string
+
+const (
+	Provisioned Type = "provisioned"
+	Terminated  Type = "terminated"
+	Expired     Type = "expired"
+	Restarted   Type = "restarted"
+	Renewed     Type = "renewed" // TTL extended or removed
+	Failed      Type = "failed"
+	Preempted   Type = "preempted" // terminated to make room for a higher-priority container
+	Unhealthy   Type = "unhealthy" // failed its probe too many times in a row
+
+	ScheduleFailed Type = "schedule_failed" // no container was created; Name identifies the request
+	Scaled         Type = "scaled"          // the autoscaler changed a replica count; Name identifies the workload
+
+	// Node events carry only NodeID
+	NodeDown    Type = "node_down" // missed too many heartbeats
+	NodeUp      Type = "node_up"   // answering heartbeats again
+	NodeAdded   Type = "node_added"
+	NodeRemoved Type = "node_removed"
+)
+
+// Event describes a lifecycle change of a container
+type Event struct {
+	Type        Type      `json:"type"`
+	ContainerID string    `json:"containerId,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	NodeID      string    `json:"nodeId,omitempty"`
+	Time        time.Time `json:"time"`
+	Message     string    `json:"message,omitempty"`
+}
+
+// subscriberBuffer is how far a subscriber may fall behind before events are dropped for it
+const subscriberBuffer = 64
+
+// Bus fans events out to subscribers. Publishing never blocks: a subscriber
+// whose buffer is full misses the event.
+type Bus struct {
+	mu      sync.Mutex
+	subs    map[<-chan Event]chan Event
+	history *History // every published event, per container
+}
+
+// NewBus creates an event bus without subscribers
+func NewBus() *Bus {
+	return &Bus{subs: make(map[<-chan Event]chan Event), history: NewHistory()}
+}
+
+// History returns the events published for container id, oldest first
+func (b *Bus) History(id string) ([]Event, bool) {
+	return b.history.For(id)
+}
+
+// Subscribe returns a channel receiving every event published from now on
+func (b *Bus) Subscribe() <-chan Event {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[ch] = ch
+	return ch
+}
+
+// Unsubscribe stops delivery to ch and closes it
+func (b *Bus) Unsubscribe(ch <-chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if sub, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(sub)
+	}
+}
+
+// Publish records e in the history and delivers it to every subscriber,
+// stamping the time if unset
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.history.Record(e)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, sub := range b.subs {
+		select {
+		case sub <- e:
+		default: // slow subscriber, drop
+		}
+	}
+}
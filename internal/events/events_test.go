@@ -0,0 +1,60 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusDeliversEvents(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe()
+	defer bus.Unsubscribe(sub)
+
+	bus.Publish(Event{Type: Provisioned, ContainerID: "c1", Name: "web", NodeID: "node1"})
+
+	select {
+	case e := <-sub:
+		if e.Type != Provisioned || e.ContainerID != "c1" || e.NodeID != "node1" {
+			t.Errorf("received %+v, want c1 provisioned on node1", e)
+		}
+		if e.Time.IsZero() {
+			t.Error("event time was not stamped")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+}
+
+func TestSlowSubscriberDoesNotBlock(t *testing.T) {
+	bus := NewBus()
+	slow := bus.Subscribe()
+	defer bus.Unsubscribe(slow)
+
+	done := make(chan struct{})
+	go func() {
+		for range subscriberBuffer + 10 {
+			bus.Publish(Event{Type: Restarted, ContainerID: "c1"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a subscriber that never reads")
+	}
+	if len(slow) != subscriberBuffer {
+		t.Errorf("slow subscriber holds %d events, want a full buffer of %d", len(slow), subscriberBuffer)
+	}
+}
+
+func TestUnsubscribeClosesChannel(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe()
+	bus.Unsubscribe(sub)
+	bus.Unsubscribe(sub) // a second call is harmless
+
+	bus.Publish(Event{Type: Terminated, ContainerID: "c1"})
+	if _, ok := <-sub; ok {
+		t.Error("received an event after unsubscribing")
+	}
+}
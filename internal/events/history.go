@@ -0,0 +1,57 @@
+package events
+
+import "sync"
+
+// Bounds on the lifecycle history kept in memory
+const (
+	MaxHistoryPerContainer = 50   // oldest entries of a container are dropped beyond this
+	MaxHistoryContainers   = 1000 // the earliest-seen container is forgotten beyond this
+)
+
+// History is an append-only log of lifecycle events per container
+type History struct {
+	mu      sync.Mutex
+	entries map[string][]Event
+	order   []string // container IDs, oldest first
+}
+
+// NewHistory creates an empty history
+func NewHistory() *History {
+	return &History{entries: make(map[string][]Event)}
+}
+
+// Record appends e to its container's history. Events without a container ID are ignored.
+func (h *History) Record(e Event) {
+	if e.ContainerID == "" {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	log, ok := h.entries[e.ContainerID]
+	if !ok {
+		h.order = append(h.order, e.ContainerID)
+		if len(h.order) > MaxHistoryContainers {
+			delete(h.entries, h.order[0])
+			h.order = h.order[1:]
+		}
+	}
+	log = append(log, e)
+	if len(log) > MaxHistoryPerContainer {
+		log = log[len(log)-MaxHistoryPerContainer:]
+	}
+	h.entries[e.ContainerID] = log
+}
+
+// For returns a copy of the history of container id, oldest first
+func (h *History) For(id string) ([]Event, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	log, ok := h.entries[id]
+	if !ok {
+		return nil, false
+	}
+	return append([]Event(nil), log...), true
+}
@@ -0,0 +1,58 @@
+package events
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHistoryRecordsInOrder(t *testing.T) {
+	h := NewHistory()
+	h.Record(Event{Type: Provisioned, ContainerID: "c1"})
+	h.Record(Event{Type: Provisioned, ContainerID: "c2"})
+	h.Record(Event{Type: Renewed, ContainerID: "c1"})
+	h.Record(Event{Type: NodeDown, NodeID: "node1"}) // not about a container
+	h.Record(Event{Type: Terminated, ContainerID: "c1"})
+
+	got, ok := h.For("c1")
+	if !ok {
+		t.Fatal("no history for c1")
+	}
+	want := []Type{Provisioned, Renewed, Terminated}
+	if len(got) != len(want) {
+		t.Fatalf("history %+v, want %v", got, want)
+	}
+	for i, e := range got {
+		if e.Type != want[i] {
+			t.Errorf("entry %d is %s, want %s", i, e.Type, want[i])
+		}
+	}
+
+	got[0].Type = Failed
+	if again, _ := h.For("c1"); again[0].Type != Provisioned {
+		t.Error("changing the returned history changed the log")
+	}
+	if _, ok := h.For(""); ok {
+		t.Error("recorded an event without a container ID")
+	}
+}
+
+func TestHistoryIsBounded(t *testing.T) {
+	h := NewHistory()
+	for i := range MaxHistoryPerContainer + 5 {
+		h.Record(Event{Type: Restarted, ContainerID: "c1", Message: fmt.Sprint(i)})
+	}
+	got, _ := h.For("c1")
+	if len(got) != MaxHistoryPerContainer || got[0].Message != "5" {
+		t.Errorf("kept %d entries starting at %q, want the newest %d", len(got), got[0].Message, MaxHistoryPerContainer)
+	}
+
+	for i := range MaxHistoryContainers {
+		h.Record(Event{Type: Provisioned, ContainerID: fmt.Sprintf("n%d", i)})
+	}
+	if _, ok := h.For("c1"); ok {
+		t.Error("the earliest-seen container was not forgotten")
+	}
+	if _, ok := h.For("n0"); !ok {
+		t.Error("a newer container was forgotten")
+	}
+}
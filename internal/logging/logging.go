@@ -0,0 +1,121 @@
+// Package logging builds structured loggers for each component of mini-cloud,
+// with levels that can be changed per component while running
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Levels hands out a logger per component and holds each component's level
+type Levels struct {
+	mu       sync.Mutex
+	handler  slog.Handler
+	fallback slog.Level
+	levels   map[string]*slog.LevelVar
+}
+
+// New returns Levels logging through h, with every component at fallback
+// until changed. h should accept all levels; filtering happens per component.
+func New(h slog.Handler, fallback slog.Level) *Levels {
+	return &Levels{handler: h, fallback: fallback, levels: make(map[string]*slog.LevelVar)}
+}
+
+// Logger returns the logger for component, tagged with a "component" attribute
+func (l *Levels) Logger(component string) *slog.Logger {
+	h := &componentHandler{
+		Handler: l.handler.WithAttrs([]slog.Attr{slog.String("component", component)}),
+		level:   l.levelVar(component),
+	}
+	return slog.New(h)
+}
+
+// levelVar returns component's level, creating it at the fallback level
+func (l *Levels) levelVar(component string) *slog.LevelVar {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	v, ok := l.levels[component]
+	if !ok {
+		v = new(slog.LevelVar)
+		v.Set(l.fallback)
+		l.levels[component] = v
+	}
+	return v
+}
+
+// SetLevel changes the level of component, including loggers already handed out
+func (l *Levels) SetLevel(component string, level slog.Level) {
+	l.levelVar(component).Set(level)
+}
+
+// Levels returns the current level of every known component
+func (l *Levels) Levels() map[string]slog.Level {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make(map[string]slog.Level, len(l.levels))
+	for c, v := range l.levels {
+		out[c] = v.Level()
+	}
+	return out
+}
+
+// Apply sets levels from a spec such as "info,cluster=debug,api=warn". A bare
+// level sets the fallback for components not named in the spec.
+func (l *Levels) Apply(spec string) error {
+	parsed := make(map[string]slog.Level)
+	fallback := l.fallback
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		component, name, named := strings.Cut(part, "=")
+		if !named {
+			name = component
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(name)); err != nil {
+			return fmt.Errorf("invalid log level %q: %w", part, err)
+		}
+		if named {
+			parsed[component] = level
+		} else {
+			fallback = level
+		}
+	}
+
+	l.mu.Lock()
+	l.fallback = fallback
+	for c, v := range l.levels {
+		if _, ok := parsed[c]; !ok {
+			v.Set(fallback)
+		}
+	}
+	l.mu.Unlock()
+
+	for c, level := range parsed {
+		l.SetLevel(c, level)
+	}
+	return nil
+}
+
+// componentHandler drops records below its component's level
+type componentHandler struct {
+	slog.Handler
+	level *slog.LevelVar
+}
+
+func (h *componentHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && h.Handler.Enabled(ctx, level)
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &componentHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	return &componentHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLevelsPerComponent(t *testing.T) {
+	var buf bytes.Buffer
+	levels := New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}), slog.LevelInfo)
+	cluster := levels.Logger("cluster")
+	api := levels.Logger("api")
+
+	cluster.Debug("hidden")
+	levels.SetLevel("cluster", slog.LevelDebug)
+	cluster.Debug("shown")
+	api.Debug("hidden")
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") {
+		t.Errorf("logged below a component's level:\n%s", out)
+	}
+	if !strings.Contains(out, "msg=shown component=cluster") {
+		t.Errorf("debug record of cluster missing after raising its level:\n%s", out)
+	}
+}
+
+func TestApply(t *testing.T) {
+	levels := New(slog.DiscardHandler, slog.LevelInfo)
+	levels.Logger("cluster")
+	levels.Logger("api")
+	levels.Logger("manager")
+
+	if err := levels.Apply("warn, cluster=debug,api=error"); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	got := levels.Levels()
+	want := map[string]slog.Level{"cluster": slog.LevelDebug, "api": slog.LevelError, "manager": slog.LevelWarn}
+	for c, level := range want {
+		if got[c] != level {
+			t.Errorf("%s at %v, want %v", c, got[c], level)
+		}
+	}
+	levels.Logger("agent")
+	if level := levels.Levels()["agent"]; level != slog.LevelWarn {
+		t.Errorf("new component at %v, want the applied fallback warn", level)
+	}
+
+	if err := levels.Apply("cluster=loud"); err == nil {
+		t.Error("invalid level accepted")
+	}
+	if level := levels.Levels()["cluster"]; level != slog.LevelDebug {
+		t.Errorf("cluster at %v after a rejected spec, want it unchanged", level)
+	}
+}
@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"time"
+
+	containerTypes "github.com/docker/docker/api/types/container"
+
+	"mini-cloud/internal/docker"
+)
+
+// Labels recording which node owns a container and how it was created, so
+// that a manager that lost its state can adopt the container again
+const (
+	NodeLabel = "mini-cloud.node"
+	SpecLabel = "mini-cloud.spec" // JSON-encoded ContainerInfo
+)
+
+// LabelSpec returns spec with labels marking it as owned by nodeID and
+// recording its metadata
+func LabelSpec(spec docker.ContainerSpec, nodeID string) docker.ContainerSpec {
+	info := NewContainerInfo("", nodeID, spec)
+	info.Status = ""
+	data, _ := json.Marshal(info) // ContainerInfo always encodes
+
+	labels := maps.Clone(spec.Labels)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[NodeLabel] = nodeID
+	labels[SpecLabel] = string(data)
+	spec.Labels = labels
+	return spec
+}
+
+// adoptableInfo rebuilds the metadata of a running container from its labels
+func adoptableInfo(c containerTypes.Summary) (*ContainerInfo, error) {
+	data, ok := c.Labels[SpecLabel]
+	if !ok {
+		return nil, fmt.Errorf("missing %s label", SpecLabel)
+	}
+	var info ContainerInfo
+	if err := json.Unmarshal([]byte(data), &info); err != nil {
+		return nil, fmt.Errorf("invalid %s label: %w", SpecLabel, err)
+	}
+	info.ID = c.ID
+	info.CreatedAt = time.Unix(c.Created, 0)
+	info.Status = "running"
+	for _, p := range c.Ports {
+		if p.PublicPort == 0 {
+			continue
+		}
+		if info.HostPorts == nil {
+			info.HostPorts = make(map[string]int)
+		}
+		info.HostPorts[fmt.Sprintf("%d/%s", p.PrivatePort, p.Type)] = int(p.PublicPort)
+	}
+	return &info, nil
+}
@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// containersBucket holds one JSON-encoded ContainerInfo per container ID
+var containersBucket = []byte("containers")
+
+// BoltStore keeps state in a BoltDB file, writing each container in its own
+// transaction instead of rewriting the whole state
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens or creates the BoltDB file at path. It fails if
+// another process holds the file for longer than a second.
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state database: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(containersBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to prepare state database: %w", err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Close releases the database file
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// Load reads every stored container
+func (s *BoltStore) Load() (map[string]*ContainerInfo, error) {
+	loaded := make(map[string]*ContainerInfo)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(containersBucket).ForEach(func(k, v []byte) error {
+			var info ContainerInfo
+			if err := json.Unmarshal(v, &info); err != nil {
+				return fmt.Errorf("failed to parse container %s: %w", k, err)
+			}
+			loaded[string(k)] = &info
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+	return loaded, nil
+}
+
+// Save replaces the stored containers with state in one transaction
+func (s *BoltStore) Save(state map[string]*ContainerInfo) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(containersBucket); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucket(containersBucket)
+		if err != nil {
+			return err
+		}
+		for id, info := range state {
+			if err := putInfo(b, id, info); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Put saves a single container
+func (s *BoltStore) Put(info *ContainerInfo) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putInfo(tx.Bucket(containersBucket), info.ID, info)
+	})
+}
+
+// Delete removes a single container; removing one that isn't stored is not an error
+func (s *BoltStore) Delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(containersBucket).Delete([]byte(id))
+	})
+}
+
+func putInfo(b *bolt.Bucket, id string, info *ContainerInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(id), data)
+}
@@ -0,0 +1,91 @@
+package manager
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"mini-cloud/internal/docker"
+)
+
+// openTestStore opens a bolt store in the test's temp dir, closed when the test ends
+func openTestStore(t *testing.T, path string) *BoltStore {
+	t.Helper()
+	s, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("OpenBoltStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestBoltStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node1.state.db")
+	s := openTestStore(t, path)
+
+	if err := s.Save(map[string]*ContainerInfo{
+		"a": {ID: "a", Name: "web"},
+		"b": {ID: "b", Name: "db"},
+	}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := s.Put(&ContainerInfo{ID: "c", Name: "cache", MemoryMB: 64}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Delete("a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.Delete("nope"); err != nil {
+		t.Errorf("Delete of an unknown container: %v", err)
+	}
+	s.Close()
+
+	loaded, err := openTestStore(t, path).Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(loaded) != 2 || loaded["b"].Name != "db" || loaded["c"].MemoryMB != 64 {
+		t.Errorf("loaded %+v, want b and c", loaded)
+	}
+}
+
+// recordingStore counts full saves on top of a bolt store
+type recordingStore struct {
+	*BoltStore
+	saves int
+}
+
+func (s *recordingStore) Save(state map[string]*ContainerInfo) error {
+	s.saves++
+	return s.BoltStore.Save(state)
+}
+
+func TestManagerWritesSingleContainers(t *testing.T) {
+	m, _ := newTestManager(t)
+	ctx := context.Background()
+	store := &recordingStore{BoltStore: openTestStore(t, filepath.Join(t.TempDir(), "state.db"))}
+	m.SetStore(store)
+
+	web, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	db, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "db", Image: "postgres", CPU: 1})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	if err := m.TerminateContainer(ctx, web.ID); err != nil {
+		t.Fatalf("TerminateContainer: %v", err)
+	}
+
+	if store.saves != 0 {
+		t.Errorf("state rewritten %d times, want single-container writes only", store.saves)
+	}
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(loaded) != 1 || loaded[db.ID] == nil {
+		t.Errorf("stored %v, want only %s", loaded, db.ID)
+	}
+}
@@ -1,10 +1,17 @@
 package manager
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"mini-cloud/internal/docker"
+	"mini-cloud/internal/events"
+	"mini-cloud/internal/metrics"
 	"mini-cloud/internal/resourcemanager"
+	"mini-cloud/internal/retry"
 	"sync"
 	"time"
 )
@@ -12,36 +19,346 @@ import (
 // ContainerInfo holds metadata about a running container
 type ContainerInfo struct {
 	ID        string
+	NodeID    string
+	Namespace string
 	Name      string
 	Image     string
 	CPU       float64
 	MemoryMB  int64
+	GPU       int
+	DiskMB    int
 	CreatedAt time.Time
 	Status    string
+	ExitCode  int // set when Status is "exited"
 	TTL       time.Duration
+
+	ImageDigest   string // registry digest the container was created from, "" if unknown
+	RestartPolicy string
+	RestartCount  int
+	StopTimeout   int  // seconds, 0 for the daemon default
+	Priority      int  // higher-priority containers may preempt lower ones
+	Burstable     bool // may be placed on an overcommitted node
+	Network       string
+	HealthCheck   *docker.HealthCheck
+	Probe         *docker.Probe
+	ProbeFailures int // consecutive failed probes
+	Command       []string
+	Entrypoint    []string
+	Env           map[string]string
+	Ports         []docker.PortMapping // as requested
+	HostPorts     map[string]int       // "80/tcp" -> port published on the node, once started
+	Mounts        []docker.Mount
+	MemorySwapMB  int64
+	CPUShares     int64
+	CPUQuota      int64
+	NodeSelector  map[string]string // node labels the container was constrained to
+	Labels        map[string]string // user labels, matched by anti-affinity rules
+	AntiAffinity  map[string]string // labels of containers it must not share a node with
+
+	AntiAffinityKey     string // containers with the same key are spread across nodes
+	RequireAntiAffinity bool
+
+	terminating bool // being stopped and removed; not refreshed or restarted
+}
+
+// snapshot returns a copy of info that stays consistent after the mutex is
+// released. Maps and slices are shared; they are replaced, never modified.
+func (info *ContainerInfo) snapshot() *ContainerInfo {
+	c := *info
+	return &c
+}
+
+// resourceSpec returns the resources reserved for the container
+func (info *ContainerInfo) resourceSpec() resourcemanager.ResourceSpec {
+	return resourcemanager.ResourceSpec{
+		CPU:    info.CPU,
+		Memory: int(info.MemoryMB),
+		GPU:    info.GPU,
+		DiskMB: info.DiskMB,
+	}
+}
+
+// Spec rebuilds a container spec from the tracked metadata, for rescheduling
+// containers whose original spec is no longer available
+func (info *ContainerInfo) Spec() docker.ContainerSpec {
+	return docker.ContainerSpec{
+		Image:         info.Image,
+		ImageDigest:   info.ImageDigest,
+		Name:          info.Name,
+		Namespace:     info.Namespace,
+		CPU:           info.CPU,
+		Memory:        info.MemoryMB,
+		GPU:           info.GPU,
+		DiskMB:        info.DiskMB,
+		TTL:           info.TTL,
+		RestartPolicy: info.RestartPolicy,
+		StopTimeout:   info.StopTimeout,
+		Priority:      info.Priority,
+		Burstable:     info.Burstable,
+		Network:       info.Network,
+		HealthCheck:   info.HealthCheck,
+		Probe:         info.Probe,
+		Command:       info.Command,
+		Entrypoint:    info.Entrypoint,
+		Env:           info.Env,
+		Ports:         info.Ports,
+		Mounts:        info.Mounts,
+		MemorySwapMB:  info.MemorySwapMB,
+		CPUShares:     info.CPUShares,
+		CPUQuota:      info.CPUQuota,
+		NodeSelector:  info.NodeSelector,
+		Labels:        info.Labels,
+		AntiAffinity:  info.AntiAffinity,
+
+		AntiAffinityKey:     info.AntiAffinityKey,
+		RequireAntiAffinity: info.RequireAntiAffinity,
+	}
+}
+
+// NewContainerInfo returns the metadata of a container just started from spec
+func NewContainerInfo(id, nodeID string, spec docker.ContainerSpec) *ContainerInfo {
+	return &ContainerInfo{
+		ID:        id,
+		NodeID:    nodeID,
+		Namespace: spec.Namespace,
+		Name:      spec.Name,
+		Image:     spec.Image,
+		CPU:       spec.CPU,
+		MemoryMB:  spec.Memory,
+		GPU:       spec.GPU,
+		DiskMB:    spec.DiskMB,
+		CreatedAt: time.Now(),
+		Status:    "running",
+		TTL:       spec.TTL,
+
+		ImageDigest:   spec.ImageDigest,
+		RestartPolicy: spec.RestartPolicy,
+		StopTimeout:   spec.StopTimeout,
+		Priority:      spec.Priority,
+		Burstable:     spec.Burstable,
+		Network:       spec.Network,
+		HealthCheck:   spec.HealthCheck,
+		Probe:         spec.Probe,
+		Command:       spec.Command,
+		Entrypoint:    spec.Entrypoint,
+		Env:           spec.Env,
+		Ports:         spec.Ports,
+		Mounts:        spec.Mounts,
+		MemorySwapMB:  spec.MemorySwapMB,
+		CPUShares:     spec.CPUShares,
+		CPUQuota:      spec.CPUQuota,
+		NodeSelector:  spec.NodeSelector,
+		Labels:        spec.Labels,
+		AntiAffinity:  spec.AntiAffinity,
+
+		AntiAffinityKey:     spec.AntiAffinityKey,
+		RequireAntiAffinity: spec.RequireAntiAffinity,
+	}
 }
 
+// ResourceSpecFor returns the resources a container spec needs reserved
+func ResourceSpecFor(spec docker.ContainerSpec) resourcemanager.ResourceSpec {
+	return resourcemanager.ResourceSpec{
+		CPU:    spec.CPU,
+		Memory: int(spec.Memory),
+		GPU:    spec.GPU,
+		DiskMB: spec.DiskMB,
+	}
+}
+
+// ErrNotFound is returned for containers that are not tracked
+var ErrNotFound = errors.New("container not found")
+
+// ErrInsufficientResources is returned when the node cannot fit a reservation
+var ErrInsufficientResources = errors.New("insufficient resources")
+
+// ErrNameConflict is returned when a container with the requested name already exists
+var ErrNameConflict = errors.New("container name already in use")
+
+// DefaultMaxRestarts bounds how often a crashed container is restarted
+const DefaultMaxRestarts = 3
+
+// cleanupTimeout bounds removing a container that failed to start
+const cleanupTimeout = 10 * time.Second
+
 // Manager controls the lifecycle of containers
 type Manager struct {
-	docker    *docker.DockerClient
+	docker    docker.ContainerRuntime
 	mutex     sync.Mutex
 	state     map[string]*ContainerInfo
 	resources *resourcemanager.ResourceManager
+	store     Store // if set, state is saved here after every mutation
+
+	maxRestarts int
+	retry       retry.Policy    // for transient Docker errors while provisioning
+	nodeID      string          // for log and event context
+	events      *events.Bus     // lifecycle events are published here if set
+	log         *slog.Logger    // slog.Default() if nil
+	onExpire    func(id string) // see SetExpireHook
+
+	probedAt map[string]time.Time // when each probed container was last probed
 }
 
 // NewManager initializes a Manager instance
-func NewManager(dc *docker.DockerClient, rm *resourcemanager.ResourceManager) *Manager {
+func NewManager(dc docker.ContainerRuntime, rm *resourcemanager.ResourceManager) *Manager {
 	return &Manager{
-		docker:    dc,
-		state:     make(map[string]*ContainerInfo),
-		resources: rm,
+		docker:      dc,
+		state:       make(map[string]*ContainerInfo),
+		resources:   rm,
+		maxRestarts: DefaultMaxRestarts,
+		probedAt:    make(map[string]time.Time),
+		retry:       retry.DefaultPolicy,
 	}
 }
 
+// SetRetryPolicy sets how transient Docker errors are retried while provisioning
+func (m *Manager) SetRetryPolicy(p retry.Policy) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.retry = p
+}
+
+// RetryPolicy returns how transient Docker errors are retried while provisioning
+func (m *Manager) RetryPolicy() retry.Policy {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.retry
+}
+
+// SetNodeID sets the ID of the node this manager runs on, used as log context
+func (m *Manager) SetNodeID(id string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.nodeID = id
+}
+
+// SetEventBus makes the manager publish lifecycle events to bus
+func (m *Manager) SetEventBus(bus *events.Bus) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.events = bus
+}
+
+// publishLocked publishes a lifecycle event if an event bus is set. Caller must hold the mutex.
+func (m *Manager) publishLocked(t events.Type, info *ContainerInfo, msg string) {
+	if m.events == nil {
+		return
+	}
+	m.events.Publish(events.Event{
+		Type:        t,
+		ContainerID: info.ID,
+		Name:        info.Name,
+		NodeID:      m.nodeID,
+		Message:     msg,
+	})
+}
+
+// SetExpireHook registers f to be called with the ID of every container
+// removed because its TTL expired. f is called without the mutex held.
+func (m *Manager) SetExpireHook(f func(id string)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.onExpire = f
+}
+
+// SetLogger replaces the logger used for container lifecycle messages. Call
+// it before starting the background loops.
+func (m *Manager) SetLogger(l *slog.Logger) {
+	m.log = l
+}
+
+// logger returns the manager's logger, or the default one if none was set,
+// annotated with this manager's node
+func (m *Manager) logger() *slog.Logger {
+	return cmp.Or(m.log, slog.Default()).With("node_id", m.nodeID)
+}
+
+// SetMaxRestarts sets how many times a container is restarted by its restart policy
+func (m *Manager) SetMaxRestarts(n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.maxRestarts = n
+}
+
 func (m *Manager) AddContainer(id string, info *ContainerInfo) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	m.state[id] = info
+	m.persistLocked(id)
+}
+
+// SetStore makes the manager save its state to store after every mutation.
+// A ContainerStore is given only the containers that changed.
+func (m *Manager) SetStore(store Store) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.store = store
+}
+
+// SetStatePath enables saving state to a JSON file at path after every provision/terminate
+func (m *Manager) SetStatePath(path string) {
+	m.SetStore(NewFileStore(path))
+}
+
+// SaveState writes all tracked containers to path as JSON
+func (m *Manager) SaveState(path string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return NewFileStore(path).Save(m.state)
+}
+
+// LoadState repopulates tracked containers from a file written by SaveState.
+// Resources for loaded containers are reserved again on this node.
+// A missing file is not an error.
+func (m *Manager) LoadState(path string) error {
+	return m.Restore(NewFileStore(path))
+}
+
+// Restore repopulates tracked containers from store and reserves their
+// resources again on this node
+func (m *Manager) Restore(store Store) error {
+	loaded, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for id, info := range loaded {
+		if !m.resources.Allocate(info.Name, info.resourceSpec()) {
+			m.logger().Warn("insufficient resources to restore reservation", "container_id", id)
+		}
+		m.state[id] = info
+	}
+	return nil
+}
+
+// persistLocked saves state to the configured store, if any. Given the IDs
+// of the changed containers, a ContainerStore writes only those; otherwise
+// the full state is saved. Caller must hold the mutex.
+func (m *Manager) persistLocked(ids ...string) {
+	if m.store == nil {
+		return
+	}
+	cs, ok := m.store.(ContainerStore)
+	if !ok || len(ids) == 0 {
+		if err := m.store.Save(m.state); err != nil {
+			m.logger().Error("failed to save state", "error", err)
+		}
+		return
+	}
+	for _, id := range ids {
+		var err error
+		if info, tracked := m.state[id]; tracked {
+			err = cs.Put(info)
+		} else {
+			err = cs.Delete(id)
+		}
+		if err != nil {
+			m.logger().Error("failed to save state", "container_id", id, "error", err)
+		}
+	}
 }
 
 // ProvisionContainer creates and starts a container
@@ -49,11 +366,22 @@ func (m *Manager) ProvisionContainer(ctx context.Context, spec docker.ContainerS
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	rSpec := resourcemanager.ResourceSpec{
-		CPU:    spec.CPU,
-		Memory: int(spec.Memory),
+	info, err := m.provisionLocked(ctx, spec)
+	if err != nil {
+		m.publishLocked(events.Failed, &ContainerInfo{Name: spec.Name}, err.Error())
+		return nil, err
+	}
+	m.publishLocked(events.Provisioned, info, "")
+	return info.snapshot(), nil
+}
+
+func (m *Manager) provisionLocked(ctx context.Context, spec docker.ContainerSpec) (*ContainerInfo, error) {
+	if _, taken := m.findByNameLocked(spec.Name); taken {
+		return nil, fmt.Errorf("%w: %q", ErrNameConflict, spec.Name)
 	}
 
+	rSpec := ResourceSpecFor(spec)
+
 	if !m.resources.CanAllocate(rSpec) {
 		return nil, fmt.Errorf("insufficient resources to allocate container")
 	}
@@ -62,85 +390,590 @@ func (m *Manager) ProvisionContainer(ctx context.Context, spec docker.ContainerS
 		return nil, fmt.Errorf("failed to reserve resources")
 	}
 
-	if err := m.docker.PullImage(ctx, spec.Image); err != nil {
+	if err := retry.Do(ctx, m.retry, func() error {
+		return m.docker.PullImage(ctx, spec.PinnedImage(), spec.PullOptions())
+	}); err != nil {
 		m.resources.Release(spec.Name)
 		return nil, fmt.Errorf("failed to pull image: %w", err)
 	}
 
-	id, err := m.docker.CreateContainer(ctx, spec)
-	if err != nil {
+	var id string
+	if err := retry.Do(ctx, m.retry, func() error {
+		var err error
+		id, err = m.docker.CreateContainer(ctx, LabelSpec(spec, m.nodeID))
+		return err
+	}); err != nil {
 		m.resources.Release(spec.Name)
 		return nil, fmt.Errorf("failed to create container: %w", err)
 	}
 
-	if err := m.docker.StartContainer(ctx, id); err != nil {
+	if err := retry.Do(ctx, m.retry, func() error {
+		return m.docker.StartContainer(ctx, id)
+	}); err != nil {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+		defer cancel()
+		if rmErr := m.docker.RemoveContainer(cleanupCtx, id); rmErr != nil {
+			m.logger().Warn("failed to remove container after start failure", "container_id", id, "error", rmErr)
+		}
 		m.resources.Release(spec.Name)
 		return nil, fmt.Errorf("failed to start container: %w", err)
 	}
 
-	info := &ContainerInfo{
-		ID:        id,
-		Name:      spec.Name,
-		Image:     spec.Image,
-		CPU:       spec.CPU,
-		MemoryMB:  spec.Memory,
-		CreatedAt: time.Now(),
-		Status:    "running",
-		TTL:       spec.TTL,
-	}
+	info := NewContainerInfo(id, m.nodeID, spec)
+	m.refreshHostPortsLocked(ctx, info)
 	m.state[id] = info
+	m.persistLocked(id)
 
 	return info, nil
 }
 
-// TerminateContainer stops and removes a container
+// TerminateContainer stops and removes a container using its configured stop timeout
 func (m *Manager) TerminateContainer(ctx context.Context, id string) error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	return m.TerminateContainerWithTimeout(ctx, id, 0)
+}
 
+// TerminateContainerWithTimeout stops and removes a container, overriding its
+// stop timeout with stopTimeout seconds when stopTimeout > 0
+func (m *Manager) TerminateContainerWithTimeout(ctx context.Context, id string, stopTimeout int) error {
+	return m.terminate(ctx, id, stopTimeout, events.Terminated)
+}
+
+// Preempt terminates a container to make room for a higher-priority one
+func (m *Manager) Preempt(ctx context.Context, id string) error {
+	return m.terminate(ctx, id, 0, events.Preempted)
+}
+
+// terminate stops and removes a container and publishes reason as its event
+// type. The mutex is released while the container stops, which may take up
+// to its stop timeout.
+func (m *Manager) terminate(ctx context.Context, id string, stopTimeout int, reason events.Type) error {
+	m.mutex.Lock()
 	info, exists := m.state[id]
 	if !exists {
-		return fmt.Errorf("container not found")
+		m.mutex.Unlock()
+		return ErrNotFound
 	}
-
-	if err := m.docker.StopContainer(ctx, id); err != nil {
-		return fmt.Errorf("stop error: %w", err)
+	if stopTimeout <= 0 {
+		stopTimeout = info.StopTimeout
 	}
+	info.terminating = true
+	m.mutex.Unlock()
 
-	if err := m.docker.RemoveContainer(ctx, id); err != nil {
-		return fmt.Errorf("remove error: %w", err)
+	err := m.docker.StopContainer(ctx, id, stopTimeout)
+	if err != nil {
+		err = fmt.Errorf("stop error: %w", err)
+	} else if err = m.docker.RemoveContainer(ctx, id); err != nil {
+		err = fmt.Errorf("remove error: %w", err)
 	}
 
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	current, exists := m.state[id]
+	if err != nil {
+		if exists {
+			current.terminating = false // still there, so refreshed and restarted again
+		}
+		return err
+	}
+	if !exists {
+		return ErrNotFound // terminated concurrently
+	}
 	m.resources.Release(info.Name)
 	delete(m.state, id)
+	m.persistLocked(id)
+	metrics.ContainersTerminated.Inc()
+	m.publishLocked(reason, info, "")
 	return nil
 }
 
-// GetContainerStatus returns metadata about a container
+// UpdateResources changes a running container's CPU and memory in place.
+// An increase is rejected if the node does not have enough headroom. The
+// new limits are reserved before, and the mutex released while, Docker
+// applies them.
+func (m *Manager) UpdateResources(ctx context.Context, id string, cpu float64, memoryMB int64) (*ContainerInfo, error) {
+	m.mutex.Lock()
+	info, ok := m.state[id]
+	if !ok {
+		m.mutex.Unlock()
+		return nil, ErrNotFound
+	}
+
+	oldSpec := info.resourceSpec()
+	newSpec := oldSpec
+	newSpec.CPU = cpu
+	newSpec.Memory = int(memoryMB)
+
+	if !m.resources.Resize(info.Name, newSpec) {
+		m.mutex.Unlock()
+		return nil, fmt.Errorf("%w: node cannot fit %.2f CPU / %d MB", ErrInsufficientResources, cpu, memoryMB)
+	}
+	name := info.Name
+	swap := scaledSwap(info.MemorySwapMB, info.MemoryMB, memoryMB)
+	m.mutex.Unlock()
+
+	err := m.docker.UpdateContainer(ctx, id, cpu, memoryMB, swap)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	info, ok = m.state[id]
+	if !ok {
+		return nil, ErrNotFound // terminated meanwhile, which released the reservation
+	}
+	if err != nil {
+		m.resources.Resize(name, oldSpec)
+		return nil, fmt.Errorf("failed to update container: %w", err)
+	}
+
+	info.CPU = cpu
+	info.MemoryMB = memoryMB
+	info.MemorySwapMB = swap
+	m.persistLocked(id)
+	return info.snapshot(), nil
+}
+
+// scaledSwap returns the memory plus swap limit for a container whose memory
+// limit changes from oldMB to newMB, keeping the ratio of an explicit limit.
+// Unlimited (-1) and default (0) swap are kept as they are.
+func scaledSwap(swapMB, oldMB, newMB int64) int64 {
+	switch {
+	case swapMB <= 0:
+		return swapMB
+	case oldMB <= 0:
+		return max(swapMB, newMB) // swap must not be below memory
+	}
+	return swapMB * newMB / oldMB
+}
+
+// RenewTTL makes a tracked container expire ttl from now. A ttl of 0 makes
+// it permanent, so it is never reaped.
+func (m *Manager) RenewTTL(id string, ttl time.Duration) (*ContainerInfo, error) {
+	if ttl < 0 {
+		return nil, errors.New("TTL must not be negative")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	info, ok := m.state[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	// TTL is measured from creation
+	info.TTL = 0
+	if ttl > 0 {
+		info.TTL = time.Since(info.CreatedAt) + ttl
+	}
+	m.persistLocked(id)
+	m.publishLocked(events.Renewed, info, "")
+	return info.snapshot(), nil
+}
+
+// RestartContainer restarts a tracked container in place. Its resource
+// reservation is kept. stopTimeout overrides the container's stop timeout when > 0.
+func (m *Manager) RestartContainer(ctx context.Context, id string, stopTimeout int) (*ContainerInfo, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	info, ok := m.state[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if stopTimeout <= 0 {
+		stopTimeout = info.StopTimeout
+	}
+	if err := m.docker.RestartContainer(ctx, id, stopTimeout); err != nil {
+		return nil, fmt.Errorf("failed to restart container: %w", err)
+	}
+
+	info.Status = "running"
+	info.ExitCode = 0
+	info.ProbeFailures = 0
+	m.refreshHostPortsLocked(ctx, info)
+	m.persistLocked(id)
+	m.publishLocked(events.Restarted, info, "")
+	return info.snapshot(), nil
+}
+
+// Exec runs cmd inside a tracked container
+func (m *Manager) Exec(ctx context.Context, id string, cmd []string) (docker.ExecResult, error) {
+	m.mutex.Lock()
+	_, ok := m.state[id]
+	m.mutex.Unlock()
+	if !ok {
+		return docker.ExecResult{}, ErrNotFound
+	}
+
+	return m.docker.Exec(ctx, id, cmd)
+}
+
+// Stats samples the actual resource usage of a container
+func (m *Manager) Stats(ctx context.Context, id string) (docker.ContainerStats, error) {
+	m.mutex.Lock()
+	_, ok := m.state[id]
+	m.mutex.Unlock()
+	if !ok {
+		return docker.ContainerStats{}, ErrNotFound
+	}
+
+	return m.docker.Stats(ctx, id)
+}
+
+// ExecTTY starts cmd on a TTY inside a running container. The caller must
+// close the session.
+func (m *Manager) ExecTTY(ctx context.Context, id string, cmd []string) (docker.ExecSession, error) {
+	m.mutex.Lock()
+	_, ok := m.state[id]
+	m.mutex.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return m.docker.ExecTTY(ctx, id, cmd)
+}
+
+// Logs returns the logs of a container, multiplexed as by the Docker API.
+// The caller must close the stream.
+func (m *Manager) Logs(ctx context.Context, id string, opts docker.LogOptions) (io.ReadCloser, error) {
+	m.mutex.Lock()
+	_, ok := m.state[id]
+	m.mutex.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return m.docker.ContainerLogs(ctx, id, opts)
+}
+
+// LiveState is a container's state as currently reported by Docker
+type LiveState struct {
+	Status string // e.g. "running", "exited"
+	Health string // "starting", "healthy" or "unhealthy"; empty without a health check
+}
+
+// LiveState inspects a tracked container in Docker
+func (m *Manager) LiveState(ctx context.Context, id string) (LiveState, error) {
+	m.mutex.Lock()
+	_, ok := m.state[id]
+	m.mutex.Unlock()
+	if !ok {
+		return LiveState{}, ErrNotFound
+	}
+
+	inspect, err := m.docker.InspectContainer(ctx, id)
+	if err != nil {
+		return LiveState{}, err
+	}
+	var live LiveState
+	if s := inspect.State; s != nil {
+		live.Status = s.Status
+		if s.Health != nil {
+			live.Health = s.Health.Status
+		}
+	}
+	return live, nil
+}
+
+// healthPollInterval is how often WaitHealthy inspects a container
+const healthPollInterval = 500 * time.Millisecond
+
+// WaitHealthy blocks until Docker reports the container healthy, or running
+// if it has no health check. It fails if the container stops, and returns
+// ctx.Err() if ctx ends first.
+func (m *Manager) WaitHealthy(ctx context.Context, id string) error {
+	m.mutex.Lock()
+	_, ok := m.state[id]
+	m.mutex.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+
+	ticker := time.NewTicker(healthPollInterval)
+	defer ticker.Stop()
+	for {
+		inspect, err := m.docker.InspectContainer(ctx, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if s := inspect.State; s != nil {
+			if !s.Running {
+				return fmt.Errorf("container is %s", s.Status)
+			}
+			if s.Health == nil || s.Health.Status == "healthy" {
+				return nil
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Forget stops tracking a container and releases its resources without
+// touching Docker, e.g. because the node's daemon is unreachable
+func (m *Manager) Forget(id string) (*ContainerInfo, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	info, ok := m.state[id]
+	if !ok {
+		return nil, false
+	}
+	m.resources.Release(info.Name)
+	delete(m.state, id)
+	m.persistLocked(id)
+	return info, true
+}
+
+// GetContainerStatus returns a copy of a container's metadata
 func (m *Manager) GetContainerStatus(ctx context.Context, id string) (*ContainerInfo, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
 	info, ok := m.state[id]
 	if !ok {
-		return nil, fmt.Errorf("container not found")
+		return nil, ErrNotFound
 	}
-	return info, nil
+	return info.snapshot(), nil
+}
+
+// FindByName returns a copy of the tracked container with the given name, if any
+func (m *Manager) FindByName(name string) (*ContainerInfo, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	info, ok := m.findByNameLocked(name)
+	if !ok {
+		return nil, false
+	}
+	return info.snapshot(), true
 }
 
-// ListActiveContainers returns all tracked containers
+func (m *Manager) findByNameLocked(name string) (*ContainerInfo, bool) {
+	for _, info := range m.state {
+		if info.Name == name {
+			return info, true
+		}
+	}
+	return nil, false
+}
+
+// ListActiveContainers returns copies of all tracked containers
 func (m *Manager) ListActiveContainers(ctx context.Context) ([]*ContainerInfo, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
 	var containers []*ContainerInfo
 	for _, info := range m.state {
-		containers = append(containers, info)
+		containers = append(containers, info.snapshot())
 	}
 	return containers, nil
 }
 
+// ReconcileSummary reports what Reconcile changed
+type ReconcileSummary struct {
+	Checked int // tracked containers examined
+	Pruned  int // entries dropped because their container no longer exists
+	Adopted int // untracked running containers of this node taken over
+	Removed int // untracked stopped containers of this node deleted
+}
+
+// Reconcile drops tracked containers that no longer exist in Docker and
+// releases their resources. Untracked containers labelled for this node, e.g.
+// provisioned before a crash that lost the state, are adopted if running and
+// removed otherwise.
+func (m *Manager) Reconcile(ctx context.Context) (ReconcileSummary, error) {
+	actual, err := m.docker.ListContainers(ctx)
+	if err != nil {
+		return ReconcileSummary{}, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	existing := make(map[string]bool, len(actual))
+	for _, c := range actual {
+		existing[c.ID] = true
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	summary := ReconcileSummary{Checked: len(m.state)}
+	for id, info := range m.state {
+		if existing[id] {
+			continue
+		}
+		m.resources.Release(info.Name)
+		delete(m.state, id)
+		summary.Pruned++
+	}
+
+	for _, c := range actual {
+		if _, tracked := m.state[c.ID]; tracked || m.nodeID == "" || c.Labels[NodeLabel] != m.nodeID {
+			continue
+		}
+		if c.State != "running" {
+			if err := m.docker.RemoveContainer(ctx, c.ID); err != nil {
+				m.logger().Warn("failed to remove stopped untracked container", "container_id", c.ID, "error", err)
+				continue
+			}
+			summary.Removed++
+			continue
+		}
+
+		info, err := adoptableInfo(c)
+		if err != nil {
+			m.logger().Warn("cannot adopt container", "container_id", c.ID, "error", err)
+			continue
+		}
+		if !m.resources.Allocate(info.Name, info.resourceSpec()) {
+			m.logger().Warn("insufficient resources to restore reservation", "container_id", c.ID)
+		}
+		m.state[c.ID] = info
+		summary.Adopted++
+	}
+
+	if summary.Pruned > 0 || summary.Adopted > 0 {
+		m.persistLocked()
+	}
+	return summary, nil
+}
+
+// RefreshStatuses updates the status of every tracked container from Docker
+// and restarts stopped containers according to their restart policy
+func (m *Manager) RefreshStatuses(ctx context.Context) {
+	m.mutex.Lock()
+	ids := make([]string, 0, len(m.state))
+	for id := range m.state {
+		ids = append(ids, id)
+	}
+	m.mutex.Unlock()
+
+	for _, id := range ids {
+		inspect, err := m.docker.InspectContainer(ctx, id)
+		if err != nil {
+			m.logger().Warn("failed to inspect container", "container_id", id, "error", err)
+			continue
+		}
+		if inspect.State == nil {
+			continue
+		}
+
+		m.mutex.Lock()
+		restart := false
+		if info, ok := m.state[id]; ok && !info.terminating {
+			// A failing probe overrides Docker's view of a running container
+			if inspect.State.Status != "running" || info.Status != StatusUnhealthy {
+				info.Status = inspect.State.Status
+			}
+			info.ExitCode = 0
+			if inspect.State.Status == "exited" {
+				info.ExitCode = inspect.State.ExitCode
+			}
+			restart = m.shouldRestartLocked(info)
+		}
+		m.mutex.Unlock()
+
+		if restart {
+			m.restartContainer(ctx, id)
+		}
+	}
+}
+
+// shouldRestartLocked reports whether a stopped container should be restarted.
+// "on-failure:N" overrides the manager's maximum number of restarts. Caller
+// must hold the mutex.
+func (m *Manager) shouldRestartLocked(info *ContainerInfo) bool {
+	if info.terminating {
+		return false
+	}
+	policy, limit, _ := docker.ParseRestartPolicy(info.RestartPolicy)
+	if limit == 0 {
+		limit = m.maxRestarts
+	}
+	if info.Status != "exited" || info.RestartCount >= limit {
+		return false
+	}
+	switch policy {
+	case docker.RestartAlways:
+		return true
+	case docker.RestartOnFailure:
+		return info.ExitCode != 0
+	}
+	return false
+}
+
+// refreshHostPortsLocked records the host ports Docker published for a
+// started container, which differ on every start for ports it picked.
+// Caller must hold the mutex.
+func (m *Manager) refreshHostPortsLocked(ctx context.Context, info *ContainerInfo) {
+	if len(info.Ports) == 0 {
+		return
+	}
+	ports, err := docker.HostPorts(ctx, m.docker, info.ID)
+	if err != nil {
+		m.logger().Warn("failed to read published ports", "container_id", info.ID, "error", err)
+		return
+	}
+	info.HostPorts = ports
+}
+
+// restartContainer starts a stopped container again. Its resource reservation
+// is still held, so nothing is re-allocated.
+func (m *Manager) restartContainer(ctx context.Context, id string) {
+	err := m.docker.StartContainer(ctx, id)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	info, ok := m.state[id]
+	if !ok {
+		return
+	}
+	info.RestartCount++
+	if err != nil {
+		m.publishLocked(events.Failed, info, fmt.Sprintf("restart attempt %d: %v", info.RestartCount, err))
+		m.logger().Error("failed to restart container", "container_id", id, "attempt", info.RestartCount, "error", err)
+	} else {
+		info.Status = "running"
+		info.ExitCode = 0
+		info.ProbeFailures = 0
+		m.refreshHostPortsLocked(ctx, info)
+		m.publishLocked(events.Restarted, info, fmt.Sprintf("restart policy attempt %d", info.RestartCount))
+		m.logger().Info("restarted container", "container_id", id, "attempt", info.RestartCount)
+	}
+	m.persistLocked(id)
+}
+
+// StartStatusLoop periodically refreshes container statuses from Docker
+func (m *Manager) StartStatusLoop(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.RefreshStatuses(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// StartExpirationLoop periodically terminates containers whose TTL has
+// passed. An interval of 0 or less disables TTL reaping.
 func (m *Manager) StartExpirationLoop(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		m.logger().Info("TTL reaping disabled")
+		return
+	}
+
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
@@ -163,16 +996,24 @@ func (m *Manager) cleanupExpiredContainers(ctx context.Context) {
 	defer m.mutex.Unlock()
 
 	for id, info := range m.state {
+		if ctx.Err() != nil {
+			return
+		}
 		if info.TTL > 0 && info.CreatedAt.Add(info.TTL).Before(now) {
 			// Unlock temporarily while terminating (avoid deadlock)
+			onExpire := m.onExpire
 			m.mutex.Unlock()
-			err := m.TerminateContainer(ctx, id)
+			err := m.terminate(ctx, id, 0, events.Expired)
+			if err == nil && onExpire != nil {
+				onExpire(id)
+			}
 			m.mutex.Lock()
 
 			if err != nil {
-				fmt.Printf("Failed to auto-terminate expired container %s: %v\n", id, err)
+				m.logger().Error("failed to terminate expired container", "container_id", id, "error", err)
 			} else {
-				fmt.Printf("Auto-terminated expired container %s\n", id)
+				metrics.ContainersExpired.Inc()
+				m.logger().Info("terminated expired container", "container_id", id, "ttl", info.TTL, "age", now.Sub(info.CreatedAt))
 			}
 		}
 	}
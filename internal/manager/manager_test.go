@@ -0,0 +1,799 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/docker/dockertest"
+	"mini-cloud/internal/events"
+	"mini-cloud/internal/resourcemanager"
+	"mini-cloud/internal/retry"
+)
+
+// newTestManager returns a manager for node "node1" with 4 cores and 4GB on
+// an in-memory runtime, without retry backoff
+func newTestManager(t *testing.T) (*Manager, *dockertest.Runtime) {
+	t.Helper()
+	rt := dockertest.New()
+	m := NewManager(rt, resourcemanager.NewResourceManager(4, 4096))
+	m.SetNodeID("node1")
+	m.SetRetryPolicy(retry.Policy{MaxAttempts: 1})
+	return m, rt
+}
+
+func TestProvisionContainer(t *testing.T) {
+	m, rt := newTestManager(t)
+	ctx := context.Background()
+
+	info, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1.5, Memory: 512})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	if info.Status != "running" || info.NodeID != "node1" || info.Name != "web" {
+		t.Errorf("info = %+v, want web running on node1", info)
+	}
+
+	c, ok := rt.Container(info.ID)
+	if !ok || c.State != dockertest.StateRunning {
+		t.Fatalf("container %s not running in the runtime: %+v", info.ID, c)
+	}
+	if rt.Calls("PullImage") != 1 {
+		t.Error("image was not pulled")
+	}
+	if got := m.resources.AllocatedCPUSum(); got != 1.5 {
+		t.Errorf("allocated CPU = %v, want 1.5", got)
+	}
+	if got := m.resources.AllocatedMemorySum(); got != 512 {
+		t.Errorf("allocated memory = %v, want 512", got)
+	}
+	if got, err := m.GetContainerStatus(ctx, info.ID); err != nil || got.ID != info.ID || got.Name != info.Name {
+		t.Errorf("GetContainerStatus = %v, %v; want the provisioned container", got, err)
+	}
+}
+
+func TestProvisionContainerInsufficientResources(t *testing.T) {
+	m, rt := newTestManager(t)
+
+	if _, err := m.ProvisionContainer(context.Background(), docker.ContainerSpec{Name: "big", Image: "nginx", CPU: 8}); err == nil {
+		t.Fatal("ProvisionContainer succeeded beyond the node's capacity")
+	}
+	if n := len(rt.Containers()); n != 0 {
+		t.Errorf("%d containers created, want none", n)
+	}
+	if got := m.resources.AllocatedCPUSum(); got != 0 {
+		t.Errorf("allocated CPU = %v, want 0", got)
+	}
+}
+
+func TestProvisionContainerReleasesOnCreateFailure(t *testing.T) {
+	m, rt := newTestManager(t)
+	rt.Fail("CreateContainer", dockertest.ErrInjected)
+
+	_, err := m.ProvisionContainer(context.Background(), docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+	if !errors.Is(err, dockertest.ErrInjected) {
+		t.Fatalf("err = %v, want the create error", err)
+	}
+	if got := m.resources.AllocatedCPUSum(); got != 0 {
+		t.Errorf("allocated CPU = %v after failed create, want 0", got)
+	}
+}
+
+func TestTerminateContainer(t *testing.T) {
+	m, rt := newTestManager(t)
+	ctx := context.Background()
+	bus := events.NewBus()
+	m.SetEventBus(bus)
+	sub := bus.Subscribe()
+	defer bus.Unsubscribe(sub)
+
+	info, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "db", Image: "postgres", CPU: 1, Memory: 256, StopTimeout: 30})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	if err := m.TerminateContainer(ctx, info.ID); err != nil {
+		t.Fatalf("TerminateContainer: %v", err)
+	}
+
+	if _, ok := rt.Container(info.ID); ok {
+		t.Error("container still exists in the runtime")
+	}
+	if rt.Calls("StopContainer") != 1 {
+		t.Errorf("StopContainer called %d times, want 1", rt.Calls("StopContainer"))
+	}
+	if _, err := m.GetContainerStatus(ctx, info.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetContainerStatus after terminate: err = %v, want ErrNotFound", err)
+	}
+	if got := m.resources.AllocatedCPUSum(); got != 0 {
+		t.Errorf("allocated CPU = %v, want 0", got)
+	}
+	if err := m.TerminateContainer(ctx, info.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second TerminateContainer: err = %v, want ErrNotFound", err)
+	}
+
+	var types []events.Type
+	for len(types) < 2 {
+		select {
+		case e := <-sub:
+			types = append(types, e.Type)
+		case <-time.After(time.Second):
+			t.Fatalf("events = %v, want provisioned and terminated", types)
+		}
+	}
+	if types[0] != events.Provisioned || types[1] != events.Terminated {
+		t.Errorf("events = %v, want provisioned and terminated", types)
+	}
+}
+
+func TestTerminateStopTimeout(t *testing.T) {
+	tests := []struct {
+		name          string
+		specTimeout   int
+		requested     int
+		wantStopAfter int
+	}{
+		{"daemon default", 0, 0, 0},
+		{"from spec", 30, 0, 30},
+		{"overridden", 30, 5, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, rt := newTestManager(t)
+			ctx := context.Background()
+			info, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "db", Image: "postgres", StopTimeout: tt.specTimeout})
+			if err != nil {
+				t.Fatalf("ProvisionContainer: %v", err)
+			}
+
+			// Keep the stopped container around to look at it
+			rt.Fail("RemoveContainer", dockertest.ErrInjected)
+			if err := m.TerminateContainerWithTimeout(ctx, info.ID, tt.requested); !errors.Is(err, dockertest.ErrInjected) {
+				t.Fatalf("err = %v, want the remove error", err)
+			}
+			c, _ := rt.Container(info.ID)
+			if c.LastStopTimeout != tt.wantStopAfter {
+				t.Errorf("stop timeout = %d, want %d", c.LastStopTimeout, tt.wantStopAfter)
+			}
+		})
+	}
+}
+
+func TestCleanupExpiredContainers(t *testing.T) {
+	m, rt := newTestManager(t)
+	ctx := context.Background()
+
+	expired, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "expired", Image: "nginx", CPU: 1, TTL: time.Minute})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	fresh, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "fresh", Image: "nginx", CPU: 1, TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	permanent, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "permanent", Image: "nginx", CPU: 1})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	m.mutex.Lock()
+	for _, info := range m.state {
+		info.CreatedAt = time.Now().Add(-2 * time.Minute)
+	}
+	m.mutex.Unlock()
+	var reaped []string
+	m.SetExpireHook(func(id string) { reaped = append(reaped, id) })
+
+	m.cleanupExpiredContainers(ctx)
+
+	if _, ok := rt.Container(expired.ID); ok {
+		t.Error("expired container was not removed")
+	}
+	if len(reaped) != 1 || reaped[0] != expired.ID {
+		t.Errorf("expire hook called with %v, want [%s]", reaped, expired.ID)
+	}
+	for _, info := range []*ContainerInfo{fresh, permanent} {
+		if _, err := m.GetContainerStatus(ctx, info.ID); err != nil {
+			t.Errorf("%s was reaped: %v", info.Name, err)
+		}
+	}
+	if got := m.resources.AllocatedCPUSum(); got != 2 {
+		t.Errorf("allocated CPU = %v, want 2 after reaping one of three", got)
+	}
+}
+
+// provisionExpired provisions a container whose one-minute TTL has passed
+func provisionExpired(t *testing.T, m *Manager, name string) *ContainerInfo {
+	t.Helper()
+	info, err := m.ProvisionContainer(context.Background(), docker.ContainerSpec{Name: name, Image: "nginx", CPU: 1, TTL: time.Minute})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	m.mutex.Lock()
+	m.state[info.ID].CreatedAt = time.Now().Add(-2 * time.Minute)
+	m.mutex.Unlock()
+	return info
+}
+
+func TestRenewTTLToPermanent(t *testing.T) {
+	m, rt := newTestManager(t)
+	m.SetLogger(slog.New(slog.DiscardHandler))
+	ctx := context.Background()
+	kept := provisionExpired(t, m, "kept")
+	reaped := provisionExpired(t, m, "reaped")
+
+	if _, err := m.RenewTTL(kept.ID, -time.Minute); err == nil {
+		t.Error("negative TTL accepted")
+	}
+	info, err := m.RenewTTL(kept.ID, 0)
+	if err != nil {
+		t.Fatalf("RenewTTL: %v", err)
+	}
+	if info.TTL != 0 {
+		t.Errorf("TTL %v after making the container permanent, want 0", info.TTL)
+	}
+
+	m.cleanupExpiredContainers(ctx)
+
+	if _, ok := rt.Container(kept.ID); !ok {
+		t.Error("permanent container was reaped past its original expiry")
+	}
+	if _, ok := rt.Container(reaped.ID); ok {
+		t.Error("expired container was not reaped")
+	}
+}
+
+func TestExpirationLoopDisabled(t *testing.T) {
+	m, rt := newTestManager(t)
+	m.SetLogger(slog.New(slog.DiscardHandler))
+	info := provisionExpired(t, m, "web")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.StartExpirationLoop(ctx, 0)
+	time.Sleep(50 * time.Millisecond)
+
+	if _, ok := rt.Container(info.ID); !ok {
+		t.Error("expired container was reaped with reaping disabled")
+	}
+}
+
+func TestExpirationLoopStops(t *testing.T) {
+	m, rt := newTestManager(t)
+	m.SetLogger(slog.New(slog.DiscardHandler))
+	first := provisionExpired(t, m, "first")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.StartExpirationLoop(ctx, 5*time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := rt.Container(first.ID); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expired container was not reaped")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	time.Sleep(20 * time.Millisecond) // let the loop see the cancellation
+	second := provisionExpired(t, m, "second")
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := rt.Container(second.ID); !ok {
+		t.Error("container reaped after the loop's context was cancelled")
+	}
+}
+
+func TestReconcileDropsMissingContainers(t *testing.T) {
+	m, rt := newTestManager(t)
+	ctx := context.Background()
+	gone, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "gone", Image: "nginx", CPU: 1, Memory: 128})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	kept, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "kept", Image: "nginx", CPU: 2, Memory: 256})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	rt.Remove(gone.ID) // removed behind mini-cloud's back
+
+	summary, err := m.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if summary != (ReconcileSummary{Checked: 2, Pruned: 1}) {
+		t.Errorf("summary = %+v, want 2 checked and 1 pruned", summary)
+	}
+	if _, err := m.GetContainerStatus(ctx, gone.ID); err == nil {
+		t.Error("removed container still tracked")
+	}
+	if _, err := m.GetContainerStatus(ctx, kept.ID); err != nil {
+		t.Errorf("existing container dropped: %v", err)
+	}
+	if cpu, mem := m.resources.AllocatedCPUSum(), m.resources.AllocatedMemorySum(); cpu != 2 || mem != 256 {
+		t.Errorf("reserved %v CPU, %v MB; want only kept's 2 and 256", cpu, mem)
+	}
+}
+
+func TestReconcileListFailure(t *testing.T) {
+	m, rt := newTestManager(t)
+	info, err := m.ProvisionContainer(context.Background(), docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	rt.Fail("ListContainers", dockertest.ErrInjected)
+
+	if _, err := m.Reconcile(context.Background()); !errors.Is(err, dockertest.ErrInjected) {
+		t.Errorf("err = %v, want the list error", err)
+	}
+	if _, err := m.GetContainerStatus(context.Background(), info.ID); err != nil {
+		t.Errorf("container dropped after a failed list: %v", err)
+	}
+}
+
+func TestReconcileAdoptsNodeContainers(t *testing.T) {
+	m, rt := newTestManager(t)
+	ctx := context.Background()
+	web, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1, Memory: 256, TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	stopped, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "stopped", Image: "nginx", CPU: 1})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	rt.SetExited(stopped.ID, 0)
+	other := rt.AddContainer(LabelSpec(docker.ContainerSpec{Name: "other", Image: "nginx", CPU: 1}, "node2"))
+
+	// A manager that lost its state, on the same runtime
+	lost := NewManager(rt, resourcemanager.NewResourceManager(4, 4096))
+	lost.SetNodeID("node1")
+	summary, err := lost.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if summary != (ReconcileSummary{Adopted: 1, Removed: 1}) {
+		t.Errorf("summary = %+v, want 1 adopted and 1 removed", summary)
+	}
+	got, err := lost.GetContainerStatus(ctx, web.ID)
+	if err != nil {
+		t.Fatalf("running container not adopted: %v", err)
+	}
+	if got.Name != "web" || got.TTL != time.Hour || got.NodeID != "node1" {
+		t.Errorf("adopted %+v, want web with its TTL on node1", got)
+	}
+	if _, ok := rt.Container(stopped.ID); ok {
+		t.Error("stopped container of this node was not removed")
+	}
+	if _, ok := rt.Container(other); !ok {
+		t.Error("another node's container was removed")
+	}
+	if cpu, mem := lost.resources.AllocatedCPUSum(), lost.resources.AllocatedMemorySum(); cpu != 1 || mem != 256 {
+		t.Errorf("reserved %v CPU, %v MB after adopting; want 1 and 256", cpu, mem)
+	}
+}
+
+func TestProvisionContainerCleansUpOnStartFailure(t *testing.T) {
+	for _, removeFails := range []bool{false, true} {
+		m, rt := newTestManager(t)
+		rt.Fail("StartContainer", dockertest.ErrInjected)
+		if removeFails {
+			rt.Fail("RemoveContainer", errors.New("daemon gone"))
+		}
+
+		_, err := m.ProvisionContainer(context.Background(), docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1, Memory: 256})
+		if !errors.Is(err, dockertest.ErrInjected) {
+			t.Errorf("remove fails %v: err = %v, want the start error", removeFails, err)
+		}
+		if rt.Calls("RemoveContainer") != 1 {
+			t.Errorf("remove fails %v: RemoveContainer called %d times, want 1", removeFails, rt.Calls("RemoveContainer"))
+		}
+		if !removeFails && len(rt.Containers()) != 0 {
+			t.Error("created container was left behind")
+		}
+		if cpu, mem := m.resources.AllocatedCPUSum(), m.resources.AllocatedMemorySum(); cpu != 0 || mem != 0 {
+			t.Errorf("remove fails %v: reserved %v CPU, %v MB after failed start; want 0", removeFails, cpu, mem)
+		}
+		if infos, _ := m.ListActiveContainers(context.Background()); len(infos) != 0 {
+			t.Errorf("remove fails %v: tracking %v after failed start", removeFails, infos)
+		}
+	}
+}
+
+func TestRefreshStatuses(t *testing.T) {
+	m, rt := newTestManager(t)
+	ctx := context.Background()
+	crashed, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "crashed", Image: "nginx", CPU: 1})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	running, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "running", Image: "nginx", CPU: 1})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	rt.SetExited(crashed.ID, 3)
+
+	m.RefreshStatuses(ctx)
+
+	if got, _ := m.GetContainerStatus(ctx, crashed.ID); got.Status != "exited" || got.ExitCode != 3 {
+		t.Errorf("crashed: status %q, exit code %d; want exited with 3", got.Status, got.ExitCode)
+	}
+	if got, _ := m.GetContainerStatus(ctx, running.ID); got.Status != "running" || got.ExitCode != 0 {
+		t.Errorf("running: status %q, exit code %d; want running", got.Status, got.ExitCode)
+	}
+}
+
+func TestRefreshStatusesWhileReading(t *testing.T) {
+	m, rt := newTestManager(t)
+	ctx := context.Background()
+	info, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	rt.SetExited(info.ID, 1)
+
+	// Run with -race: readers must only ever see copies
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 50 {
+			m.RefreshStatuses(ctx)
+		}
+	}()
+	for range 50 {
+		if got, err := m.GetContainerStatus(ctx, info.ID); err != nil || got.Status == "" {
+			t.Fatalf("GetContainerStatus = %+v, %v", got, err)
+		}
+		infos, _ := m.ListActiveContainers(ctx)
+		for _, got := range infos {
+			_ = got.Status
+		}
+	}
+	<-done
+
+	if info.Status != "running" {
+		t.Errorf("returned info changed to %q by a refresh, want the running snapshot", info.Status)
+	}
+	if got, _ := m.GetContainerStatus(ctx, info.ID); got.Status != "exited" {
+		t.Errorf("status %q, want exited", got.Status)
+	}
+}
+
+func TestRestartPolicy(t *testing.T) {
+	tests := []struct {
+		policy      string
+		exitCode    int
+		wantRestart bool
+	}{
+		{"", 1, false},
+		{docker.RestartNever, 1, false},
+		{docker.RestartOnFailure, 1, true},
+		{docker.RestartOnFailure, 0, false},
+		{docker.RestartAlways, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s exit %d", tt.policy, tt.exitCode), func(t *testing.T) {
+			m, rt := newTestManager(t)
+			ctx := context.Background()
+			info, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "app", Image: "nginx", CPU: 1, RestartPolicy: tt.policy})
+			if err != nil {
+				t.Fatalf("ProvisionContainer: %v", err)
+			}
+			rt.SetExited(info.ID, tt.exitCode)
+
+			m.RefreshStatuses(ctx)
+
+			c, _ := rt.Container(info.ID)
+			got, _ := m.GetContainerStatus(ctx, info.ID)
+			if restarted := c.State == dockertest.StateRunning; restarted != tt.wantRestart {
+				t.Errorf("restarted = %v, want %v", restarted, tt.wantRestart)
+			}
+			if tt.wantRestart && (got.Status != "running" || got.RestartCount != 1) {
+				t.Errorf("status %q after %d restarts, want running after 1", got.Status, got.RestartCount)
+			}
+			if cpu := m.resources.AllocatedCPUSum(); cpu != 1 {
+				t.Errorf("allocated CPU = %v, want the reservation kept", cpu)
+			}
+		})
+	}
+}
+
+func TestTerminatingContainerIsNotRestarted(t *testing.T) {
+	m, rt := newTestManager(t)
+	ctx := context.Background()
+	info, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "app", Image: "nginx", CPU: 1, RestartPolicy: docker.RestartAlways})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+
+	// The container has exited, but the stop has not returned yet
+	stopping, release := make(chan struct{}), make(chan struct{})
+	rt.SetHook(func(ctx context.Context, op, id string) error {
+		if op == "StopContainer" {
+			rt.SetExited(id, 0)
+			close(stopping)
+			<-release
+		}
+		return nil
+	})
+	done := make(chan error, 1)
+	go func() { done <- m.TerminateContainer(ctx, info.ID) }()
+	<-stopping
+
+	m.RefreshStatuses(ctx)
+	if c, _ := rt.Container(info.ID); c.State != dockertest.StateExited {
+		t.Errorf("state %s, want the terminating container left exited", c.State)
+	}
+	if got, _ := m.GetContainerStatus(ctx, info.ID); got.Status != "running" || got.RestartCount != 0 {
+		t.Errorf("status %q after %d restarts, want it untouched", got.Status, got.RestartCount)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("TerminateContainer: %v", err)
+	}
+	if _, ok := rt.Container(info.ID); ok {
+		t.Error("container still exists after terminate")
+	}
+}
+
+func TestRestartRepublishesPorts(t *testing.T) {
+	m, rt := newTestManager(t)
+	ctx := context.Background()
+	info, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1,
+		RestartPolicy: docker.RestartAlways, Ports: []docker.PortMapping{{ContainerPort: 80}}})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	before := info.HostPorts["80/tcp"]
+	if before == 0 {
+		t.Fatalf("host ports %v, want 80/tcp published", info.HostPorts)
+	}
+
+	rt.SetExited(info.ID, 1)
+	m.RefreshStatuses(ctx)
+	got, _ := m.GetContainerStatus(ctx, info.ID)
+	if after := got.HostPorts["80/tcp"]; after == 0 || after == before {
+		t.Errorf("80/tcp on %d after a restart, want the newly picked port instead of %d", after, before)
+	}
+}
+
+func TestRestartPolicyLimit(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   int
+	}{
+		{docker.RestartOnFailure, 2}, // the manager's maximum
+		{"on-failure:4", 4},
+		{"on-failure:1", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			m, rt := newTestManager(t)
+			m.SetMaxRestarts(2)
+			ctx := context.Background()
+			info, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "flaky", Image: "nginx", RestartPolicy: tt.policy})
+			if err != nil {
+				t.Fatalf("ProvisionContainer: %v", err)
+			}
+
+			for range tt.want + 1 {
+				rt.SetExited(info.ID, 1)
+				m.RefreshStatuses(ctx)
+			}
+
+			got, _ := m.GetContainerStatus(ctx, info.ID)
+			if got.RestartCount != tt.want || got.Status != "exited" {
+				t.Errorf("status %q after %d restarts, want exited after %d", got.Status, got.RestartCount, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpiryIsLogged(t *testing.T) {
+	m, _ := newTestManager(t)
+	var buf bytes.Buffer
+	m.SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	ctx := context.Background()
+
+	info, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1, TTL: time.Minute})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	m.mutex.Lock()
+	m.state[info.ID].CreatedAt = time.Now().Add(-2 * time.Minute)
+	m.mutex.Unlock()
+	m.cleanupExpiredContainers(ctx)
+
+	var found bool
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var rec map[string]any
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("log output is not JSON: %v", err)
+		}
+		if rec["msg"] != "terminated expired container" {
+			continue
+		}
+		found = true
+		if rec["container_id"] != info.ID || rec["node_id"] != "node1" {
+			t.Errorf("logged %v, want container %s on node1", rec, info.ID)
+		}
+		if _, ok := rec["ttl"]; !ok {
+			t.Errorf("logged %v without the TTL", rec)
+		}
+	}
+	if !found {
+		t.Errorf("no expiry logged in %q", buf.String())
+	}
+}
+
+func TestUpdateResources(t *testing.T) {
+	m, rt := newTestManager(t)
+	ctx := context.Background()
+	info, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1, Memory: 512})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+
+	if _, err := m.UpdateResources(ctx, info.ID, 2, 1024); err != nil {
+		t.Fatalf("UpdateResources: %v", err)
+	}
+	c, _ := rt.Container(info.ID)
+	if c.CPU != 2 || c.MemoryMB != 1024 {
+		t.Errorf("runtime limits %v CPU, %d MB; want 2 and 1024", c.CPU, c.MemoryMB)
+	}
+	if cpu, mem := m.resources.AllocatedCPUSum(), m.resources.AllocatedMemorySum(); cpu != 2 || mem != 1024 {
+		t.Errorf("reserved %v CPU, %v MB; want 2 and 1024", cpu, mem)
+	}
+
+	// More than the node has
+	if _, err := m.UpdateResources(ctx, info.ID, 8, 1024); !errors.Is(err, ErrInsufficientResources) {
+		t.Errorf("growing past capacity: err = %v, want ErrInsufficientResources", err)
+	}
+	// The runtime refuses
+	rt.Fail("UpdateContainer", dockertest.ErrInjected)
+	if _, err := m.UpdateResources(ctx, info.ID, 1, 256); !errors.Is(err, dockertest.ErrInjected) {
+		t.Errorf("failed update: err = %v, want the runtime's error", err)
+	}
+	if cpu, mem := m.resources.AllocatedCPUSum(), m.resources.AllocatedMemorySum(); cpu != 2 || mem != 1024 {
+		t.Errorf("reserved %v CPU, %v MB after rejected updates; want 2 and 1024 unchanged", cpu, mem)
+	}
+	if got, _ := m.GetContainerStatus(ctx, info.ID); got.CPU != 2 || got.MemoryMB != 1024 {
+		t.Errorf("tracked %v CPU, %d MB after rejected updates; want 2 and 1024", got.CPU, got.MemoryMB)
+	}
+}
+
+func TestProvisionRetriesTransientErrors(t *testing.T) {
+	m, rt := newTestManager(t)
+	m.SetRetryPolicy(retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+	failures := map[string]int{"PullImage": 2, "StartContainer": 2}
+	rt.SetHook(func(_ context.Context, op, _ string) error {
+		if failures[op] > 0 {
+			failures[op]--
+			return dockertest.ErrInjected
+		}
+		return nil
+	})
+
+	info, err := m.ProvisionContainer(context.Background(), docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	if rt.Calls("PullImage") != 3 || rt.Calls("StartContainer") != 3 {
+		t.Errorf("pulled %d and started %d times, want 3 each", rt.Calls("PullImage"), rt.Calls("StartContainer"))
+	}
+	if c, ok := rt.Container(info.ID); !ok || c.State != dockertest.StateRunning {
+		t.Error("container is not running after the retries")
+	}
+}
+
+func TestProvisionDoesNotRetryPermanentErrors(t *testing.T) {
+	m, rt := newTestManager(t)
+	m.SetRetryPolicy(retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+	rt.Fail("PullImage", cerrdefs.ErrNotFound.WithMessage("no such image"))
+
+	if _, err := m.ProvisionContainer(context.Background(), docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1}); err == nil {
+		t.Fatal("ProvisionContainer succeeded without its image")
+	}
+	if rt.Calls("PullImage") != 1 {
+		t.Errorf("pulled %d times, want a missing image tried once", rt.Calls("PullImage"))
+	}
+	if got := m.resources.AllocatedCPUSum(); got != 0 {
+		t.Errorf("allocated CPU = %v after failed pull, want 0", got)
+	}
+}
+
+func TestWaitHealthy(t *testing.T) {
+	m, rt := newTestManager(t)
+	ctx := context.Background()
+	info, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1,
+		HealthCheck: &docker.HealthCheck{Test: []string{"true"}}})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+
+	// starting, then unhealthy, then healthy
+	var inspects atomic.Int32
+	rt.SetHook(func(_ context.Context, op, id string) error {
+		if op == "InspectContainer" {
+			switch inspects.Add(1) {
+			case 2:
+				rt.SetHealth(id, "unhealthy")
+			case 3:
+				rt.SetHealth(id, "healthy")
+			}
+		}
+		return nil
+	})
+	if err := m.WaitHealthy(ctx, info.ID); err != nil {
+		t.Fatalf("WaitHealthy: %v", err)
+	}
+	if n := inspects.Load(); n != 3 {
+		t.Errorf("inspected %d times, want 3", n)
+	}
+}
+
+func TestWaitHealthyGivesUp(t *testing.T) {
+	m, rt := newTestManager(t)
+	ctx := context.Background()
+	info, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1,
+		HealthCheck: &docker.HealthCheck{Test: []string{"true"}}})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	rt.SetHealth(info.ID, "unhealthy")
+
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := m.WaitHealthy(waitCtx, info.ID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitHealthy of an unhealthy container: err = %v, want DeadlineExceeded", err)
+	}
+
+	rt.SetExited(info.ID, 1)
+	if err := m.WaitHealthy(ctx, info.ID); err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitHealthy of an exited container: err = %v, want it reported at once", err)
+	}
+}
+
+func TestUpdateResourcesKeepsSwap(t *testing.T) {
+	tests := []struct {
+		name     string
+		swapMB   int64
+		wantSwap int64
+	}{
+		{"default", 0, 0},
+		{"unlimited", -1, -1},
+		{"scaled", 768, 1536}, // 1.5x memory before and after
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, rt := newTestManager(t)
+			ctx := context.Background()
+			info, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "app", Image: "nginx", CPU: 1, Memory: 512, MemorySwapMB: tt.swapMB})
+			if err != nil {
+				t.Fatalf("ProvisionContainer: %v", err)
+			}
+
+			info, err = m.UpdateResources(ctx, info.ID, 2, 1024)
+			if err != nil {
+				t.Fatalf("UpdateResources: %v", err)
+			}
+			c, _ := rt.Container(info.ID)
+			if c.CPU != 2 || c.MemoryMB != 1024 || c.SwapMB != tt.wantSwap {
+				t.Errorf("limits = %v CPU, %d MB, %d MB swap; want 2, 1024, %d", c.CPU, c.MemoryMB, c.SwapMB, tt.wantSwap)
+			}
+			if info.MemorySwapMB != tt.wantSwap {
+				t.Errorf("tracked swap = %d, want %d", info.MemorySwapMB, tt.wantSwap)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/events"
+)
+
+// StatusUnhealthy is the status of a running container failing its probe
+const StatusUnhealthy = "unhealthy"
+
+// probeConcurrency bounds the probes in flight on one node
+const probeConcurrency = 8
+
+// RunProbes probes every running container whose probe is due. A container
+// failing FailureThreshold probes in a row is marked unhealthy and, depending
+// on the probe's action, restarted or reported with an Unhealthy event for
+// the cluster to replace. The action is repeated every FailureThreshold
+// failures until the container recovers.
+func (m *Manager) RunProbes(ctx context.Context) {
+	now := time.Now()
+
+	m.mutex.Lock()
+	due := make(map[string]docker.Probe)
+	for id, info := range m.state {
+		if info.Probe == nil || info.terminating || (info.Status != "running" && info.Status != StatusUnhealthy) {
+			continue
+		}
+		if last, ok := m.probedAt[id]; ok && now.Sub(last) < info.Probe.IntervalOrDefault() {
+			continue
+		}
+		m.probedAt[id] = now
+		due[id] = *info.Probe
+	}
+	for id := range m.probedAt {
+		if _, ok := m.state[id]; !ok {
+			delete(m.probedAt, id)
+		}
+	}
+	m.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, probeConcurrency)
+	for id, p := range due {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			m.probe(ctx, id, p)
+		}()
+	}
+	wg.Wait()
+}
+
+// probe runs p against container id and records the outcome
+func (m *Manager) probe(ctx context.Context, id string, p docker.Probe) {
+	res, err := m.docker.Probe(ctx, id, p)
+	if err != nil {
+		// Not the container's fault, e.g. the daemon is unreachable
+		m.logger().Warn("failed to probe container", "container_id", id, "error", err)
+		return
+	}
+
+	m.mutex.Lock()
+	info, ok := m.state[id]
+	if !ok || (info.Status != "running" && info.Status != StatusUnhealthy) {
+		m.mutex.Unlock()
+		return
+	}
+	if res.Healthy {
+		if info.Status == StatusUnhealthy {
+			info.Status = "running"
+			m.logger().Info("container healthy again", "container_id", id)
+			m.persistLocked(id)
+		}
+		info.ProbeFailures = 0
+		m.mutex.Unlock()
+		return
+	}
+
+	info.ProbeFailures++
+	threshold := p.Threshold()
+	if info.ProbeFailures < threshold || info.ProbeFailures%threshold != 0 {
+		m.mutex.Unlock()
+		return
+	}
+	info.Status = StatusUnhealthy
+	msg := fmt.Sprintf("%d %s probes failed: %s", info.ProbeFailures, p.Type, res.Message)
+	m.publishLocked(events.Unhealthy, info, msg)
+	m.logger().Warn("container unhealthy", "container_id", id, "failures", info.ProbeFailures, "reason", res.Message)
+	m.persistLocked(id)
+	stopTimeout := info.StopTimeout
+	m.mutex.Unlock()
+
+	if p.Action == docker.ProbeActionRestart {
+		m.restartUnhealthy(ctx, id, stopTimeout)
+	}
+}
+
+// restartUnhealthy restarts a container that failed its probe, keeping its
+// resource reservation
+func (m *Manager) restartUnhealthy(ctx context.Context, id string, stopTimeout int) {
+	err := m.docker.RestartContainer(ctx, id, stopTimeout)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	info, ok := m.state[id]
+	if !ok {
+		return
+	}
+	if err != nil {
+		m.logger().Error("failed to restart unhealthy container", "container_id", id, "error", err)
+		return
+	}
+	info.RestartCount++
+	info.Status = "running"
+	info.ExitCode = 0
+	info.ProbeFailures = 0
+	m.refreshHostPortsLocked(ctx, info)
+	m.publishLocked(events.Restarted, info, "failed probe")
+	m.logger().Info("restarted unhealthy container", "container_id", id, "attempt", info.RestartCount)
+	m.persistLocked(id)
+}
+
+// StartProbeLoop runs due probes every interval, which should be shorter
+// than the probes' own intervals
+func (m *Manager) StartProbeLoop(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.RunProbes(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
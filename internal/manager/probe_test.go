@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mini-cloud/internal/docker"
+	"mini-cloud/internal/events"
+)
+
+func TestRunProbes(t *testing.T) {
+	m, rt := newTestManager(t)
+	ctx := context.Background()
+	bus := events.NewBus()
+	m.SetEventBus(bus)
+	sub := bus.Subscribe()
+	defer bus.Unsubscribe(sub)
+
+	probe := &docker.Probe{Type: docker.ProbeHTTP, Port: 80, Interval: time.Nanosecond, FailureThreshold: 2}
+	info, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "web", Image: "nginx", CPU: 1, Probe: probe})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	<-sub // provisioned
+
+	rt.SetProbeResult(info.ID, docker.ProbeResult{Message: "HTTP 503"})
+	m.RunProbes(ctx)
+	if got, _ := m.GetContainerStatus(ctx, info.ID); got.Status != "running" || got.ProbeFailures != 1 {
+		t.Errorf("after one failure: %s with %d failures, want running with 1", got.Status, got.ProbeFailures)
+	}
+	m.RunProbes(ctx)
+	if got, _ := m.GetContainerStatus(ctx, info.ID); got.Status != StatusUnhealthy {
+		t.Errorf("after the threshold: %s, want unhealthy", got.Status)
+	}
+	select {
+	case e := <-sub:
+		if e.Type != events.Unhealthy || e.ContainerID != info.ID {
+			t.Errorf("event %+v, want unhealthy for %s", e, info.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no unhealthy event")
+	}
+
+	// Docker still sees it running; the failed probe wins until it passes
+	m.RefreshStatuses(ctx)
+	if got, _ := m.GetContainerStatus(ctx, info.ID); got.Status != StatusUnhealthy {
+		t.Errorf("after a refresh: %s, want still unhealthy", got.Status)
+	}
+	rt.SetProbeResult(info.ID, docker.ProbeResult{Healthy: true})
+	m.RunProbes(ctx)
+	if got, _ := m.GetContainerStatus(ctx, info.ID); got.Status != "running" || got.ProbeFailures != 0 {
+		t.Errorf("after passing: %s with %d failures, want running with none", got.Status, got.ProbeFailures)
+	}
+	if rt.Calls("RestartContainer") != 0 {
+		t.Error("container restarted without a restart action")
+	}
+}
+
+func TestProbeRestartsUnhealthy(t *testing.T) {
+	m, rt := newTestManager(t)
+	ctx := context.Background()
+
+	probe := &docker.Probe{Type: docker.ProbeExec, Command: []string{"true"}, Interval: time.Nanosecond, FailureThreshold: 1, Action: docker.ProbeActionRestart}
+	info, err := m.ProvisionContainer(ctx, docker.ContainerSpec{Name: "worker", Image: "busybox", CPU: 1, Probe: probe})
+	if err != nil {
+		t.Fatalf("ProvisionContainer: %v", err)
+	}
+	rt.SetProbeResult(info.ID, docker.ProbeResult{Message: "exit code 1"})
+	m.RunProbes(ctx)
+
+	if rt.Calls("RestartContainer") != 1 {
+		t.Errorf("RestartContainer called %d times, want 1", rt.Calls("RestartContainer"))
+	}
+	got, _ := m.GetContainerStatus(ctx, info.ID)
+	if got.Status != "running" || got.RestartCount != 1 || got.ProbeFailures != 0 {
+		t.Errorf("after the restart: %s, %d restarts, %d failures; want running, 1 and 0", got.Status, got.RestartCount, got.ProbeFailures)
+	}
+	if got := m.resources.AllocatedCPUSum(); got != 1 {
+		t.Errorf("allocated CPU = %v after the restart, want the reservation kept", got)
+	}
+}
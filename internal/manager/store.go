@@ -0,0 +1,78 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Store persists a manager's tracked containers so they survive a restart
+// of the control plane. Save is called with the full state after every
+// mutation, unless the store is a ContainerStore; implementations must not
+// keep a reference to it.
+type Store interface {
+	Load() (map[string]*ContainerInfo, error)
+	Save(state map[string]*ContainerInfo) error
+}
+
+// ContainerStore is a Store that can also write a single container. The
+// manager uses Put and Delete for changes to one container so they don't
+// rewrite the whole state.
+type ContainerStore interface {
+	Store
+	Put(info *ContainerInfo) error
+	Delete(id string) error
+}
+
+// FileStore keeps state as a JSON file
+type FileStore struct {
+	Path string
+}
+
+// NewFileStore returns a Store backed by the JSON file at path
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+// Load reads the state file. A missing file is an empty state.
+func (s *FileStore) Load() (map[string]*ContainerInfo, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+
+	var loaded map[string]*ContainerInfo
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("failed to parse state: %w", err)
+	}
+	return loaded, nil
+}
+
+// Save writes state to the file
+func (s *FileStore) Save(state map[string]*ContainerInfo) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename so a crash never leaves a truncated file
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
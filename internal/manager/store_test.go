@@ -0,0 +1,54 @@
+package manager
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mini-cloud/internal/resourcemanager"
+)
+
+func TestStateSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node1.state.json")
+	m := NewManager(nil, resourcemanager.NewResourceManager(4, 4096))
+	m.SetStatePath(path)
+
+	web := &ContainerInfo{ID: "c1", Name: "web", Image: "nginx", CPU: 1, MemoryMB: 256,
+		CreatedAt: time.Now().Add(-time.Minute), Status: "running", TTL: time.Hour,
+		NodeSelector: map[string]string{"disk": "ssd"}}
+	m.AddContainer(web.ID, web)
+	m.AddContainer("c2", &ContainerInfo{ID: "c2", Name: "db", Image: "postgres", CPU: 2, MemoryMB: 1024, Status: "running"})
+
+	// A new process reading the same file
+	restarted := NewManager(nil, resourcemanager.NewResourceManager(4, 4096))
+	if err := restarted.LoadState(path); err != nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	got, err := restarted.GetContainerStatus(context.Background(), web.ID)
+	if err != nil {
+		t.Fatalf("GetContainerStatus after restart: %v", err)
+	}
+	if got.Name != "web" || got.TTL != time.Hour || !got.CreatedAt.Equal(web.CreatedAt) {
+		t.Errorf("restored %+v, want web with its TTL and creation time", got)
+	}
+	if sel := got.Spec().NodeSelector; sel["disk"] != "ssd" {
+		t.Errorf("restored node selector %v, want disk=ssd", sel)
+	}
+	if infos, _ := restarted.ListActiveContainers(context.Background()); len(infos) != 2 {
+		t.Errorf("restored %d containers, want 2", len(infos))
+	}
+	if cpu, mem := restarted.resources.AllocatedCPUSum(), restarted.resources.AllocatedMemorySum(); cpu != 3 || mem != 1280 {
+		t.Errorf("reserved %v CPU, %v MB after restore; want 3 and 1280", cpu, mem)
+	}
+}
+
+func TestLoadStateMissingFile(t *testing.T) {
+	m := NewManager(nil, resourcemanager.NewResourceManager(4, 4096))
+	if err := m.LoadState(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("LoadState of a missing file: %v", err)
+	}
+	if infos, _ := m.ListActiveContainers(context.Background()); len(infos) != 0 {
+		t.Errorf("loaded %v, want nothing", infos)
+	}
+}
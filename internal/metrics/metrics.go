@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing value exported in the Prometheus text format
+type Counter struct {
+	name  string
+	help  string
+	value atomic.Uint64
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Value returns the current count
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+var (
+	mu       sync.Mutex
+	counters []*Counter
+)
+
+// NewCounter creates a counter and registers it for export
+func NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	mu.Lock()
+	counters = append(counters, c)
+	mu.Unlock()
+	return c
+}
+
+// Cluster-wide lifecycle counters
+var (
+	ContainersScheduled  = NewCounter("minicloud_containers_scheduled_total", "Containers successfully scheduled")
+	ContainersTerminated = NewCounter("minicloud_containers_terminated_total", "Containers terminated, including expirations")
+	ContainersExpired    = NewCounter("minicloud_containers_expired_total", "Containers terminated because their TTL elapsed")
+	SchedulingFailures   = NewCounter("minicloud_scheduling_failures_total", "Provision requests that could not be scheduled")
+)
+
+// WriteCounters writes every registered counter in the Prometheus text format
+func WriteCounters(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, c := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, c.help, c.name, c.name, c.Value())
+	}
+}
+
+// Sample is one labelled value of a gauge
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// WriteGauge writes a gauge with the given samples in the Prometheus text format
+func WriteGauge(w io.Writer, name, help string, samples []Sample) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %g\n", name, formatLabels(s.Labels), s.Value)
+	}
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%q", k, labels[k])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
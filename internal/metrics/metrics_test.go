@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteCounters(t *testing.T) {
+	c := NewCounter("test_events_total", "Events seen by the test")
+	c.Inc()
+	c.Inc()
+
+	var out strings.Builder
+	WriteCounters(&out)
+	want := "# HELP test_events_total Events seen by the test\n# TYPE test_events_total counter\ntest_events_total 2\n"
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("output:\n%s\nwant it to contain:\n%s", out.String(), want)
+	}
+}
+
+func TestWriteGauge(t *testing.T) {
+	var out strings.Builder
+	WriteGauge(&out, "test_free_cores", "Free cores", []Sample{
+		{Labels: map[string]string{"zone": "a", "node": "node1"}, Value: 1.5},
+		{Value: 4},
+	})
+	want := `# HELP test_free_cores Free cores
+# TYPE test_free_cores gauge
+test_free_cores{node="node1",zone="a"} 1.5
+test_free_cores 4
+`
+	if out.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,53 @@
+package pki
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnroll(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, csr, err := NewRequest("node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := ca.Enroll(csr, "node1")
+	if err != nil {
+		t.Fatalf("Enroll: %v", err)
+	}
+	cert, err := ParseCertificate(certPEM)
+	if err != nil || cert.Subject.CommonName != "node1" {
+		t.Fatalf("certificate = %v, %v; want one for node1", cert, err)
+	}
+	if _, err := ca.Enroll(csr, "node1"); !errors.Is(err, ErrEnrolled) {
+		t.Errorf("second Enroll: err = %v, want ErrEnrolled", err)
+	}
+
+	// A reloaded CA remembers the enrollment until its record is removed
+	ca, err = LoadOrCreateCA(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca.Enroll(csr, "node1"); !errors.Is(err, ErrEnrolled) {
+		t.Errorf("Enroll after reload: err = %v, want ErrEnrolled", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "nodes", "node1.pem")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ca.Enroll(csr, "node1"); err != nil {
+		t.Errorf("Enroll after removing the record: %v", err)
+	}
+
+	for _, id := range []string{"", "../ca", ".hidden", "a/b"} {
+		if _, err := ca.Enroll(csr, id); err == nil {
+			t.Errorf("Enroll(%q) succeeded", id)
+		}
+	}
+}
@@ -1,68 +1,232 @@
 package resourcemanager
 
 import (
+	"fmt"
 	"sync"
 )
 
 type ResourceSpec struct {
 	CPU    float64 // in cores
 	Memory int     // in MB
+	GPU    int     // number of devices
+	DiskMB int     // in MB
 }
 
 type ResourceManager struct {
 	TotalCPU    float64
 	TotalMemory int
+	TotalGPU    int
+	TotalDisk   int // in MB
+
+	// Kept free for the OS and Docker daemon; never allocated to containers
+	ReservedCPU    float64
+	ReservedMemory int
 
 	allocatedCPU    map[string]float64
 	allocatedMemory map[string]int
+	allocatedGPU    map[string]int
+	allocatedDisk   map[string]int
+
+	cpuOvercommit float64 // schedulable CPU is TotalCPU * cpuOvercommit
 
 	mu sync.Mutex
 }
 
 func NewResourceManager(cpu float64, memory int) *ResourceManager {
+	return NewResourceManagerWithCapacity(ResourceSpec{CPU: cpu, Memory: memory})
+}
+
+// NewResourceManagerWithCapacity creates a ResourceManager tracking every resource in total
+func NewResourceManagerWithCapacity(total ResourceSpec) *ResourceManager {
+	return NewResourceManagerWithReserved(total, ResourceSpec{})
+}
+
+// NewResourceManagerWithReserved creates a ResourceManager that keeps the CPU
+// and memory in reserved free for the host; only total - reserved is schedulable
+func NewResourceManagerWithReserved(total, reserved ResourceSpec) *ResourceManager {
 	return &ResourceManager{
-		TotalCPU:        cpu,
-		TotalMemory:     memory,
+		ReservedCPU:     reserved.CPU,
+		ReservedMemory:  reserved.Memory,
+		TotalCPU:        total.CPU,
+		TotalMemory:     total.Memory,
+		TotalGPU:        total.GPU,
+		TotalDisk:       total.DiskMB,
 		allocatedCPU:    make(map[string]float64),
 		allocatedMemory: make(map[string]int),
+		allocatedGPU:    make(map[string]int),
+		allocatedDisk:   make(map[string]int),
+		cpuOvercommit:   1.0,
 	}
 }
 
-func (rm *ResourceManager) CanAllocate(spec ResourceSpec) bool {
+// SetCPUOvercommit lets requested CPU exceed TotalCPU by factor, e.g. 2.0 lets
+// a 4-core node accept 8 requested cores. Factors below 1 are treated as 1.
+// Memory is never overcommitted.
+func (rm *ResourceManager) SetCPUOvercommit(factor float64) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.cpuOvercommit = max(factor, 1.0)
+}
+
+// SchedulableCPU returns how many CPU cores can be allocated in total,
+// excluding the reservation and including overcommit
+func (rm *ResourceManager) SchedulableCPU() float64 {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
+	return rm.schedulableCPULocked()
+}
 
-	usedCPU := 0.0
-	usedMem := 0
+func (rm *ResourceManager) schedulableCPULocked() float64 {
+	return (rm.TotalCPU - rm.ReservedCPU) * rm.cpuOvercommit
+}
+
+// SchedulableMemory returns how much memory in MB can be allocated in total, excluding the reservation
+func (rm *ResourceManager) SchedulableMemory() int {
+	return rm.TotalMemory - rm.ReservedMemory
+}
+
+// usedLocked sums all current allocations. Caller must hold the mutex.
+func (rm *ResourceManager) usedLocked() ResourceSpec {
+	used := ResourceSpec{}
 	for _, v := range rm.allocatedCPU {
-		usedCPU += v
+		used.CPU += v
 	}
 	for _, v := range rm.allocatedMemory {
-		usedMem += v
+		used.Memory += v
+	}
+	for _, v := range rm.allocatedGPU {
+		used.GPU += v
+	}
+	for _, v := range rm.allocatedDisk {
+		used.DiskMB += v
+	}
+	return used
+}
+
+// fitsLocked reports whether spec fits in the remaining capacity. Caller must hold the mutex.
+func (rm *ResourceManager) fitsLocked(spec ResourceSpec) bool {
+	return rm.fitsScaledLocked(spec, 1, 1)
+}
+
+// fitsScaledLocked reports whether spec fits once the schedulable CPU and
+// memory are multiplied by the given factors. Caller must hold the mutex.
+func (rm *ResourceManager) fitsScaledLocked(spec ResourceSpec, cpuFactor, memoryFactor float64) bool {
+	used := rm.usedLocked()
+	return used.CPU+spec.CPU <= rm.schedulableCPULocked()*cpuFactor &&
+		float64(used.Memory+spec.Memory) <= float64(rm.SchedulableMemory())*memoryFactor &&
+		used.GPU+spec.GPU <= rm.TotalGPU &&
+		used.DiskMB+spec.DiskMB <= rm.TotalDisk
+}
+
+// Shortfall describes the first resource spec does not fit in, e.g.
+// "insufficient CPU (need 4, free 2)", or returns "" if spec fits
+func (rm *ResourceManager) Shortfall(spec ResourceSpec) string {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	used := rm.usedLocked()
+	switch {
+	case used.CPU+spec.CPU > rm.schedulableCPULocked():
+		return fmt.Sprintf("insufficient CPU (need %g, free %g)", spec.CPU, max(rm.schedulableCPULocked()-used.CPU, 0))
+	case used.Memory+spec.Memory > rm.SchedulableMemory():
+		return fmt.Sprintf("insufficient memory (need %dMB, free %dMB)", spec.Memory, max(rm.SchedulableMemory()-used.Memory, 0))
+	case used.GPU+spec.GPU > rm.TotalGPU:
+		return fmt.Sprintf("insufficient GPU (need %d, free %d)", spec.GPU, rm.TotalGPU-used.GPU)
+	case used.DiskMB+spec.DiskMB > rm.TotalDisk:
+		return fmt.Sprintf("insufficient disk (need %dMB, free %dMB)", spec.DiskMB, rm.TotalDisk-used.DiskMB)
 	}
+	return ""
+}
 
-	return (usedCPU+spec.CPU <= rm.TotalCPU) && (usedMem+spec.Memory <= rm.TotalMemory)
+func (rm *ResourceManager) CanAllocate(spec ResourceSpec) bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	return rm.fitsLocked(spec)
+}
+
+// CanAllocateWithout reports whether spec would fit once the named
+// allocations are released
+func (rm *ResourceManager) CanAllocateWithout(spec ResourceSpec, names ...string) bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	for _, name := range names {
+		spec.CPU -= rm.allocatedCPU[name]
+		spec.Memory -= rm.allocatedMemory[name]
+		spec.GPU -= rm.allocatedGPU[name]
+		spec.DiskMB -= rm.allocatedDisk[name]
+	}
+	return rm.fitsLocked(spec)
 }
 
 func (rm *ResourceManager) Allocate(id string, spec ResourceSpec) bool {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
-	usedCPU := 0.0
-	usedMem := 0
-	for _, v := range rm.allocatedCPU {
-		usedCPU += v
+	if !rm.fitsLocked(spec) {
+		return false
 	}
-	for _, v := range rm.allocatedMemory {
-		usedMem += v
+
+	rm.allocatedCPU[id] = spec.CPU
+	rm.allocatedMemory[id] = spec.Memory
+	rm.allocatedGPU[id] = spec.GPU
+	rm.allocatedDisk[id] = spec.DiskMB
+	return true
+}
+
+// CanOvercommit reports whether spec fits once the schedulable CPU and memory
+// are multiplied by the given factors. GPUs and disk are never overcommitted.
+func (rm *ResourceManager) CanOvercommit(spec ResourceSpec, cpuFactor, memoryFactor float64) bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	return rm.fitsScaledLocked(spec, cpuFactor, memoryFactor)
+}
+
+// AllocateOvercommitted reserves spec for id like Allocate, but against the
+// schedulable CPU and memory multiplied by the given factors
+func (rm *ResourceManager) AllocateOvercommitted(id string, spec ResourceSpec, cpuFactor, memoryFactor float64) bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if !rm.fitsScaledLocked(spec, cpuFactor, memoryFactor) {
+		return false
 	}
 
-	if usedCPU+spec.CPU > rm.TotalCPU || usedMem+spec.Memory > rm.TotalMemory {
+	rm.allocatedCPU[id] = spec.CPU
+	rm.allocatedMemory[id] = spec.Memory
+	rm.allocatedGPU[id] = spec.GPU
+	rm.allocatedDisk[id] = spec.DiskMB
+	return true
+}
+
+// Resize replaces the reservation for id with spec if the node can fit the
+// difference. The current reservation does not count against the new one.
+func (rm *ResourceManager) Resize(id string, spec ResourceSpec) bool {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	current := ResourceSpec{
+		CPU:    rm.allocatedCPU[id],
+		Memory: rm.allocatedMemory[id],
+		GPU:    rm.allocatedGPU[id],
+		DiskMB: rm.allocatedDisk[id],
+	}
+	delta := ResourceSpec{
+		CPU:    spec.CPU - current.CPU,
+		Memory: spec.Memory - current.Memory,
+		GPU:    spec.GPU - current.GPU,
+		DiskMB: spec.DiskMB - current.DiskMB,
+	}
+	if !rm.fitsLocked(delta) {
 		return false
 	}
 
 	rm.allocatedCPU[id] = spec.CPU
 	rm.allocatedMemory[id] = spec.Memory
+	rm.allocatedGPU[id] = spec.GPU
+	rm.allocatedDisk[id] = spec.DiskMB
 	return true
 }
 
@@ -72,24 +236,32 @@ func (rm *ResourceManager) Release(id string) {
 
 	delete(rm.allocatedCPU, id)
 	delete(rm.allocatedMemory, id)
+	delete(rm.allocatedGPU, id)
+	delete(rm.allocatedDisk, id)
 }
 
-func (rm *ResourceManager) Usage() ResourceSpec {
+// Allocations returns a snapshot of the resources reserved under each ID
+func (rm *ResourceManager) Allocations() map[string]ResourceSpec {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
-	usedCPU := 0.0
-	usedMem := 0
-	for _, v := range rm.allocatedCPU {
-		usedCPU += v
-	}
-	for _, v := range rm.allocatedMemory {
-		usedMem += v
-	}
-	return ResourceSpec{
-		CPU:    usedCPU,
-		Memory: usedMem,
+	out := make(map[string]ResourceSpec, len(rm.allocatedCPU))
+	for id := range rm.allocatedCPU {
+		out[id] = ResourceSpec{
+			CPU:    rm.allocatedCPU[id],
+			Memory: rm.allocatedMemory[id],
+			GPU:    rm.allocatedGPU[id],
+			DiskMB: rm.allocatedDisk[id],
+		}
 	}
+	return out
+}
+
+func (rm *ResourceManager) Usage() ResourceSpec {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	return rm.usedLocked()
 }
 
 func (rm *ResourceManager) AllocatedCPUSum() float64 {
@@ -111,3 +283,23 @@ func (rm *ResourceManager) AllocatedMemorySum() int {
 	}
 	return sum
 }
+
+func (rm *ResourceManager) AllocatedGPUSum() int {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	sum := 0
+	for _, g := range rm.allocatedGPU {
+		sum += g
+	}
+	return sum
+}
+
+func (rm *ResourceManager) AllocatedDiskSum() int {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	sum := 0
+	for _, d := range rm.allocatedDisk {
+		sum += d
+	}
+	return sum
+}
@@ -0,0 +1,163 @@
+package resourcemanager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAllocateGPU(t *testing.T) {
+	rm := NewResourceManagerWithCapacity(ResourceSpec{CPU: 8, Memory: 8192, GPU: 2})
+
+	if !rm.Allocate("train", ResourceSpec{CPU: 1, GPU: 2}) {
+		t.Fatal("Allocate of both GPUs failed")
+	}
+	if rm.CanAllocate(ResourceSpec{CPU: 1, GPU: 1}) {
+		t.Error("CanAllocate reports a GPU free on a node whose GPUs are taken")
+	}
+	if !rm.CanAllocate(ResourceSpec{CPU: 1}) {
+		t.Error("CanAllocate refuses a container without GPUs")
+	}
+	if got := rm.Usage().GPU; got != 2 {
+		t.Errorf("used GPUs = %d, want 2", got)
+	}
+
+	rm.Release("train")
+	if got := rm.AllocatedGPUSum(); got != 0 {
+		t.Errorf("allocated GPUs = %d after release, want 0", got)
+	}
+	if rm.Allocate("big", ResourceSpec{GPU: 3}) {
+		t.Error("allocated more GPUs than the node has")
+	}
+}
+
+func TestAllocateDisk(t *testing.T) {
+	rm := NewResourceManagerWithCapacity(ResourceSpec{CPU: 8, Memory: 8192, DiskMB: 10240})
+
+	if !rm.Allocate("db", ResourceSpec{CPU: 1, Memory: 512, DiskMB: 8192}) {
+		t.Fatal("Allocate within the disk capacity failed")
+	}
+	if rm.Allocate("logs", ResourceSpec{CPU: 1, Memory: 512, DiskMB: 4096}) {
+		t.Error("allocated beyond the disk capacity with CPU and memory to spare")
+	}
+	if got := rm.Shortfall(ResourceSpec{CPU: 1, DiskMB: 4096}); got != "insufficient disk (need 4096MB, free 2048MB)" {
+		t.Errorf("Shortfall = %q", got)
+	}
+	rm.Release("db")
+	if !rm.Allocate("logs", ResourceSpec{CPU: 1, Memory: 512, DiskMB: 4096}) {
+		t.Error("Allocate failed after the disk was released")
+	}
+	if got := rm.AllocatedDiskSum(); got != 4096 {
+		t.Errorf("allocated disk = %d, want 4096", got)
+	}
+}
+
+func TestCPUOvercommit(t *testing.T) {
+	rm := NewResourceManager(4, 8192)
+	rm.SetCPUOvercommit(2)
+
+	if got := rm.SchedulableCPU(); got != 8 {
+		t.Errorf("schedulable CPU = %v, want 8", got)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if !rm.Allocate(id, ResourceSpec{CPU: 2.5, Memory: 1024}) {
+			t.Fatalf("Allocate(%s) failed below the overcommit ceiling", id)
+		}
+	}
+	if rm.Allocate("d", ResourceSpec{CPU: 1, Memory: 1024}) {
+		t.Error("allocated beyond the overcommit ceiling")
+	}
+	if !rm.Allocate("e", ResourceSpec{CPU: 0.5, Memory: 1024}) {
+		t.Error("Allocate up to the ceiling failed")
+	}
+
+	// Memory is never overcommitted
+	if rm.Allocate("f", ResourceSpec{Memory: 8192}) {
+		t.Error("memory was overcommitted")
+	}
+
+	rm.SetCPUOvercommit(0.5)
+	if got := rm.SchedulableCPU(); got != 4 {
+		t.Errorf("schedulable CPU = %v with a factor below 1, want 4", got)
+	}
+}
+
+func TestReservedResources(t *testing.T) {
+	fits := func(rm *ResourceManager) int {
+		n := 0
+		for rm.Allocate(string(rune('a'+n)), ResourceSpec{CPU: 1, Memory: 512}) {
+			n++
+		}
+		return n
+	}
+
+	if n := fits(NewResourceManager(4, 4096)); n != 4 {
+		t.Fatalf("%d containers fit without a reservation, want 4", n)
+	}
+	rm := NewResourceManagerWithReserved(ResourceSpec{CPU: 4, Memory: 4096}, ResourceSpec{CPU: 1, Memory: 512})
+	if got := rm.SchedulableCPU(); got != 3 {
+		t.Errorf("schedulable CPU = %v, want 3", got)
+	}
+	if got := rm.SchedulableMemory(); got != 3584 {
+		t.Errorf("schedulable memory = %d, want 3584", got)
+	}
+	if n := fits(rm); n != 3 {
+		t.Errorf("%d containers fit with a reservation, want 3", n)
+	}
+
+	// The reservation bounds memory too
+	rm = NewResourceManagerWithReserved(ResourceSpec{CPU: 4, Memory: 2048}, ResourceSpec{Memory: 1024})
+	if n := fits(rm); n != 2 {
+		t.Errorf("%d containers fit with memory reserved, want 2", n)
+	}
+}
+
+func TestAllocateOvercommitted(t *testing.T) {
+	rm := NewResourceManagerWithCapacity(ResourceSpec{CPU: 2, Memory: 1024, GPU: 1})
+	if !rm.Allocate("base", ResourceSpec{CPU: 2, Memory: 1024}) {
+		t.Fatal("Allocate of the whole node failed")
+	}
+
+	if !rm.CanOvercommit(ResourceSpec{CPU: 2, Memory: 512}, 2, 1.5) {
+		t.Error("CanOvercommit refuses a spec within the scaled capacity")
+	}
+	if rm.CanOvercommit(ResourceSpec{CPU: 1, GPU: 2}, 2, 2) {
+		t.Error("CanOvercommit scaled the GPUs")
+	}
+	if !rm.AllocateOvercommitted("burst", ResourceSpec{CPU: 2, Memory: 512}, 2, 1.5) {
+		t.Fatal("AllocateOvercommitted within the scaled capacity failed")
+	}
+	if rm.AllocateOvercommitted("more", ResourceSpec{CPU: 0.5}, 2, 1.5) {
+		t.Error("allocated beyond the scaled CPU")
+	}
+	if got := rm.Shortfall(ResourceSpec{CPU: 1}); got != "insufficient CPU (need 1, free 0)" {
+		t.Errorf("Shortfall on an overcommitted node = %q", got)
+	}
+}
+
+func TestAllocations(t *testing.T) {
+	rm := NewResourceManagerWithCapacity(ResourceSpec{CPU: 8, Memory: 8192, GPU: 1, DiskMB: 10240})
+	want := map[string]ResourceSpec{
+		"web":   {CPU: 0.5, Memory: 256},
+		"db":    {CPU: 2, Memory: 2048, DiskMB: 4096},
+		"train": {CPU: 1, Memory: 1024, GPU: 1},
+	}
+	for id, spec := range want {
+		if !rm.Allocate(id, spec) {
+			t.Fatalf("Allocate(%s) failed", id)
+		}
+	}
+	rm.Allocate("gone", ResourceSpec{CPU: 1, Memory: 128})
+	rm.Release("gone")
+
+	got := rm.Allocations()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Allocations() = %v, want %v", got, want)
+	}
+
+	// The snapshot is a copy
+	got["web"] = ResourceSpec{CPU: 4}
+	delete(got, "db")
+	if again := rm.Allocations(); !reflect.DeepEqual(again, want) {
+		t.Errorf("Allocations() = %v after changing a snapshot, want %v", again, want)
+	}
+}
@@ -0,0 +1,64 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+)
+
+// Policy controls how often and how fast a failing operation is retried
+type Policy struct {
+	MaxAttempts    int           // total attempts including the first; <= 1 disables retries
+	InitialBackoff time.Duration // wait before the second attempt, doubled after every failure
+	MaxBackoff     time.Duration // upper bound on the wait, 0 for none
+}
+
+// DefaultPolicy retries transient Docker errors twice with a short backoff
+var DefaultPolicy = Policy{
+	MaxAttempts:    3,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+}
+
+// Do runs op until it succeeds, fails with a permanent error, the attempts
+// are exhausted or ctx is done. The last error is returned.
+func Do(ctx context.Context, p Policy, op func() error) error {
+	backoff := p.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= p.MaxAttempts || !IsTransient(err) {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+// IsTransient reports whether an operation failing with err may succeed if
+// retried. Errors such as a missing image or a name conflict are permanent.
+func IsTransient(err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case cerrdefs.IsNotFound(err),
+		cerrdefs.IsInvalidArgument(err),
+		cerrdefs.IsConflict(err),
+		cerrdefs.IsAlreadyExists(err),
+		cerrdefs.IsUnauthorized(err),
+		cerrdefs.IsPermissionDenied(err),
+		cerrdefs.IsNotImplemented(err):
+		return false
+	}
+	return true
+}
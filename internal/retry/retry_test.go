@@ -0,0 +1,64 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+)
+
+var errBusy = errors.New("daemon busy")
+
+func TestDoRetriesTransientErrors(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond}, func() error {
+		calls++
+		if calls < 3 {
+			return errBusy
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("Do = %v after %d calls, want success on the third", err, calls)
+	}
+}
+
+func TestDoGivesUp(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    Policy
+		err       error
+		wantCalls int
+	}{
+		{"attempts exhausted", Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond}, errBusy, 3},
+		{"retries disabled", Policy{MaxAttempts: 1}, errBusy, 1},
+		{"permanent error", Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond}, cerrdefs.ErrNotFound, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := Do(context.Background(), tt.policy, func() error {
+				calls++
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) || calls != tt.wantCalls {
+				t.Errorf("Do = %v after %d calls, want %v after %d", err, calls, tt.err, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDoStopsWhenContextEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := Do(ctx, Policy{MaxAttempts: 5, InitialBackoff: time.Hour}, func() error {
+		calls++
+		cancel()
+		return errBusy
+	})
+	if !errors.Is(err, errBusy) || calls != 1 {
+		t.Errorf("Do = %v after %d calls, want the last error without waiting out the backoff", err, calls)
+	}
+}
@@ -0,0 +1,200 @@
+// Package terminal carries interactive exec sessions over WebSocket. Binary
+// frames hold terminal input and output; text frames hold Control messages:
+// resizes from the client and, last, the command's exit code from the server.
+package terminal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"mini-cloud/internal/docker"
+)
+
+// Control is a JSON message sent in a text frame
+type Control struct {
+	Resize   *Size  `json:"resize,omitempty"`   // client to server
+	ExitCode *int   `json:"exitCode,omitempty"` // server to client, once the command exits
+	Error    string `json:"error,omitempty"`    // server to client, if the exit code is unknown
+}
+
+// Size is a terminal size in characters
+type Size struct {
+	Rows uint `json:"rows"`
+	Cols uint `json:"cols"`
+}
+
+// controlTimeout bounds resizing the terminal and reading the exit code
+const controlTimeout = 10 * time.Second
+
+// frame is one WebSocket message, keeping whether it was text or binary
+type frame struct {
+	text bool
+	data []byte
+}
+
+// frames sends and receives frame values
+var frames = websocket.Codec{
+	Marshal: func(v any) ([]byte, byte, error) {
+		f := v.(frame)
+		if f.text {
+			return f.data, websocket.TextFrame, nil
+		}
+		return f.data, websocket.BinaryFrame, nil
+	},
+	Unmarshal: func(msg []byte, payloadType byte, v any) error {
+		f := v.(*frame)
+		f.text = payloadType == websocket.TextFrame
+		f.data = msg
+		return nil
+	},
+}
+
+// sendControl sends c in a text frame
+func sendControl(ws *websocket.Conn, c Control) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return frames.Send(ws, frame{text: true, data: data})
+}
+
+// Attach upgrades r to a WebSocket and serves sess on it, closing sess if
+// the upgrade fails. The Origin header isn't checked: clients authenticate
+// with a bearer token, which browsers don't attach to cross-site WebSocket
+// requests.
+func Attach(w http.ResponseWriter, r *http.Request, sess docker.ExecSession) {
+	served := false
+	websocket.Server{
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			served = true
+			Serve(ws, sess)
+		},
+	}.ServeHTTP(w, r)
+	if !served {
+		sess.Close()
+	}
+}
+
+// Serve connects ws to sess until the command exits or the client goes
+// away, then closes both. The exit code is sent before closing.
+func Serve(ws *websocket.Conn, sess docker.ExecSession) {
+	defer ws.Close()
+	defer sess.Close()
+
+	go func() {
+		for {
+			var f frame
+			if err := frames.Receive(ws, &f); err != nil {
+				sess.Close() // the client hung up
+				return
+			}
+			if !f.text {
+				if _, err := sess.Write(f.data); err != nil {
+					return
+				}
+				continue
+			}
+			var c Control
+			if json.Unmarshal(f.data, &c) == nil && c.Resize != nil {
+				ctx, cancel := context.WithTimeout(context.Background(), controlTimeout)
+				_ = sess.Resize(ctx, c.Resize.Rows, c.Resize.Cols)
+				cancel()
+			}
+		}
+	}()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := sess.Read(buf)
+		if n > 0 {
+			if frames.Send(ws, frame{data: buf[:n]}) != nil {
+				return
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), controlTimeout)
+	defer cancel()
+	var c Control
+	if code, err := sess.ExitCode(ctx); err != nil {
+		c.Error = err.Error()
+	} else {
+		c.ExitCode = &code
+	}
+	_ = sendControl(ws, c)
+}
+
+// NewSession returns the client side of a connection served by Serve
+func NewSession(ws *websocket.Conn) docker.ExecSession {
+	return &session{ws: ws}
+}
+
+// session is an ExecSession reached over WebSocket
+type session struct {
+	ws      *websocket.Conn
+	pending []byte // output received but not read yet
+
+	mu   sync.Mutex
+	exit *Control // set once the server reported how the command ended
+}
+
+func (s *session) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		var f frame
+		if err := frames.Receive(s.ws, &f); err != nil {
+			return 0, err
+		}
+		if !f.text {
+			s.pending = f.data
+			continue
+		}
+		var c Control
+		if json.Unmarshal(f.data, &c) == nil && (c.ExitCode != nil || c.Error != "") {
+			s.mu.Lock()
+			s.exit = &c
+			s.mu.Unlock()
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *session) Write(p []byte) (int, error) {
+	if err := frames.Send(s.ws, frame{data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *session) Close() error {
+	return s.ws.Close()
+}
+
+func (s *session) Resize(_ context.Context, rows, cols uint) error {
+	return sendControl(s.ws, Control{Resize: &Size{Rows: rows, Cols: cols}})
+}
+
+func (s *session) ExitCode(context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.exit == nil:
+		return 0, docker.ErrExecRunning
+	case s.exit.Error != "":
+		return 0, errors.New(s.exit.Error)
+	}
+	return *s.exit.ExitCode, nil
+}
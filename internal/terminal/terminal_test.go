@@ -0,0 +1,92 @@
+package terminal
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/websocket"
+
+	"mini-cloud/internal/docker"
+)
+
+// fakeSession is a command that prints its input and records resizes; it
+// exits with code 7 once its input is closed
+type fakeSession struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+
+	mu    sync.Mutex
+	sizes []Size
+}
+
+func newFakeSession() *fakeSession {
+	r, w := io.Pipe()
+	return &fakeSession{r: r, w: w}
+}
+
+func (s *fakeSession) Read(p []byte) (int, error) { return s.r.Read(p) }
+
+func (s *fakeSession) Write(p []byte) (int, error) {
+	if string(p) == "\x04" { // Ctrl-D ends the input
+		return len(p), s.w.Close()
+	}
+	return s.w.Write(p)
+}
+
+func (s *fakeSession) Close() error { return s.w.Close() }
+
+func (s *fakeSession) Resize(_ context.Context, rows, cols uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sizes = append(s.sizes, Size{Rows: rows, Cols: cols})
+	return nil
+}
+
+func (s *fakeSession) ExitCode(context.Context) (int, error) { return 7, nil }
+
+func TestAttach(t *testing.T) {
+	fake := newFakeSession()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Attach(w, r, fake)
+	}))
+	defer srv.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), "", srv.URL)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	var sess docker.ExecSession = NewSession(ws)
+	defer sess.Close()
+	ctx := context.Background()
+
+	if _, err := sess.ExitCode(ctx); err != docker.ErrExecRunning {
+		t.Errorf("exit code while running: err = %v, want ErrExecRunning", err)
+	}
+	if err := sess.Resize(ctx, 40, 120); err != nil {
+		t.Fatalf("Resize: %v", err)
+	}
+	if _, err := sess.Write([]byte("ls\n")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := sess.Write([]byte("\x04")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	out, err := io.ReadAll(sess)
+	if err != nil || string(out) != "ls\n" {
+		t.Errorf("output %q, %v; want the command's", out, err)
+	}
+	if code, err := sess.ExitCode(ctx); err != nil || code != 7 {
+		t.Errorf("exit code %d, %v; want 7", code, err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.sizes) != 1 || fake.sizes[0] != (Size{Rows: 40, Cols: 120}) {
+		t.Errorf("resizes %+v, want 40x120", fake.sizes)
+	}
+}
@@ -1,47 +1,435 @@
 package main
 
 import (
+	"cmp"
 	"context"
-	"log"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"log/slog"
+	"mini-cloud/internal/agent"
 	"mini-cloud/internal/api"
+	"mini-cloud/internal/audit"
 	"mini-cloud/internal/cluster"
+	"mini-cloud/internal/config"
 	"mini-cloud/internal/docker"
+	"mini-cloud/internal/logging"
 	"mini-cloud/internal/manager"
+	"mini-cloud/internal/pki"
 	"mini-cloud/internal/resourcemanager"
+	"mini-cloud/internal/tracing"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
 func main() {
-	ctx := context.Background()
+	// Cancelled on SIGINT/SIGTERM, which stops the background loops
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Create node 1
-	dc1, err := docker.NewDockerClient()
-	if err != nil {
-		log.Fatalf("failed to create docker client 1: %v", err)
+	logs := logging.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}), slog.LevelInfo)
+	slog.SetDefault(logs.Logger("main"))
+
+	configPath := flag.String("config", "", "path to a JSON or YAML cluster config (default: built-in two-node cluster)")
+	provisionRate := flag.Float64("provision-rate", api.DefaultProvisionRate, "provision requests allowed per second")
+	provisionBurst := flag.Int("provision-burst", api.DefaultProvisionBurst, "provision requests allowed in a burst")
+	scheduleTimeout := flag.Duration("schedule-timeout", api.DefaultScheduleTimeout, "maximum time for a provision request, including image pulls")
+	addr := flag.String("addr", ":8080", "address to serve the API on (overrides the config's addr)")
+	tlsCert := flag.String("tls-cert", "", "certificate file; with -tls-key serves HTTPS")
+	tlsKey := flag.String("tls-key", "", "private key file for -tls-cert")
+	tlsClientCA := flag.String("tls-client-ca", "", "CA file; if set, clients must present a certificate it signed")
+	httpRedirect := flag.String("http-redirect-addr", "", "address serving plain HTTP that redirects to HTTPS, e.g. :80")
+	pkiDir := flag.String("pki-dir", "pki", "directory holding the CA that signs node agent certificates")
+	auditPath := flag.String("audit-log", "audit.log", "file recording every mutating API request (empty to disable)")
+	deploymentsPath := flag.String("deployments", "deployments.json", "file persisting deployments across restarts")
+	logLevel := flag.String("log-level", "info", `log levels, e.g. "info,cluster=debug"; components are main, api, cluster and manager`)
+	flag.Parse()
+
+	if err := logs.Apply(*logLevel); err != nil {
+		fatal("invalid -log-level", "error", err)
+	}
+
+	cfg := config.Default()
+	if *configPath != "" {
+		var err error
+		if cfg, err = config.Load(*configPath); err != nil {
+			fatal("failed to load config", "path", *configPath, "error", err)
+		}
+	}
+	if cfg.Addr != "" && !flagSet("addr") {
+		*addr = cfg.Addr
 	}
-	rm1 := resourcemanager.NewResourceManager(4.0, 8192)
-	mgr1 := manager.NewManager(dc1, rm1)
-	mgr1.StartExpirationLoop(ctx, 15*time.Second)
 
-	// Create node 2
-	dc2, err := docker.NewDockerClient()
+	shutdownTracing, err := tracing.Setup(ctx)
 	if err != nil {
-		log.Fatalf("failed to create docker client 2: %v", err)
+		fatal("failed to set up tracing", "error", err)
 	}
-	rm2 := resourcemanager.NewResourceManager(8.0, 16384)
-	mgr2 := manager.NewManager(dc2, rm2)
-	mgr2.StartExpirationLoop(ctx, 15*time.Second)
+	defer func() {
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(sctx); err != nil {
+			slog.Error("tracing shutdown failed", "error", err)
+		}
+	}()
 
-	node1 := &cluster.Node{ID: "node1", Docker: dc1, Resources: rm1, Manager: mgr1}
-	node2 := &cluster.Node{ID: "node2", Docker: dc2, Resources: rm2, Manager: mgr2}
+	opts := nodeOptions{expiration: cfg.Expiration(), stateStore: cfg.StateStore, logs: logs}
+	var ca *pki.CA
+	if cfg.JoinToken != "" {
+		if ca, err = pki.LoadOrCreateCA(*pkiDir); err != nil {
+			fatal("failed to load CA", "dir", *pkiDir, "error", err)
+		}
+		if opts.agentCert, err = ca.ClientCertificate(); err != nil {
+			fatal("failed to issue control plane certificate", "error", err)
+		}
+		opts.agentCA = ca.Pool()
+	}
 
-	nodes := map[string]*cluster.Node{
-		node1.ID: node1,
-		node2.ID: node2,
+	nodes := make(map[string]*cluster.Node, len(cfg.Nodes))
+	for _, nc := range cfg.Nodes {
+		node, err := newNode(ctx, nc, opts)
+		if err != nil {
+			fatal("failed to set up node", "node_id", nc.ID, "error", err)
+		}
+		nodes[nc.ID] = node
 	}
 
 	clusterMgr := cluster.NewClusterManager(nodes)
+	clusterMgr.SetLogger(logs.Logger("cluster"))
+	clusterMgr.SetPullBeforeReserve(cfg.PullBeforeReserve)
+	clusterMgr.SetNetworkIsolation(cfg.NetworkIsolation)
+	strategy, err := cluster.ParseStrategy(cfg.Strategy)
+	if err != nil {
+		fatal("invalid config", "error", err)
+	}
+	clusterMgr.SetStrategy(strategy)
+	if w := cfg.ScoreWeights; w != nil {
+		clusterMgr.SetScoreWeights(cluster.ScoreWeights{CPU: w.CPU, Memory: w.Memory, GPU: w.GPU, Disk: w.Disk})
+	}
+	if o := cfg.Overcommit; o != nil {
+		policy := cluster.OvercommitPolicy{CPU: o.CPU, Memory: o.Memory, MaxUtilization: o.Utilization()}
+		if err := clusterMgr.SetOvercommitPolicy(policy); err != nil {
+			fatal("invalid config", "error", err)
+		}
+		clusterMgr.StartUsageLoop(ctx, o.Interval())
+	}
+	clusterMgr.SetImageDigestAllowlist(cfg.ImageDigestAllowlist)
+	if err := applyRegistries(clusterMgr, cfg); err != nil {
+		fatal("failed to load registry credentials", "error", err)
+	}
+	if cfg.RegistriesFile != "" {
+		go watchRegistries(ctx, clusterMgr, cfg)
+	}
+	clusterMgr.StartHealthCheckLoop(ctx, 10*time.Second)
+	clusterMgr.StartRemediationLoop(ctx)
+	clusterMgr.StartAutoscaleLoop(ctx, 30*time.Second)
+	deploymentStore := cluster.NewFileDeploymentStore(*deploymentsPath)
+	if err := clusterMgr.RestoreDeployments(deploymentStore); err != nil {
+		fatal("failed to restore deployments", "path", *deploymentsPath, "error", err)
+	}
+	clusterMgr.SetDeploymentStore(deploymentStore)
+	clusterMgr.StartDeploymentLoop(ctx, 10*time.Second)
+	clusterMgr.StartResourceReconcileLoop(ctx, time.Minute)
+	clusterMgr.StartVolumeLoop(ctx, time.Minute)
+	clusterMgr.StartImageLoop(ctx, time.Minute)
+	if g := cfg.ImageGC; g != nil {
+		policy := cluster.ImageGCPolicy{IdlePeriod: g.Idle(), DiskThreshold: g.DiskThreshold, Keep: g.Keep}
+		if err := clusterMgr.SetImageGCPolicy(policy); err != nil {
+			fatal("invalid config", "error", err)
+		}
+		clusterMgr.StartImageGCLoop(ctx, g.Every())
+	}
+	if cfg.NetworkIsolation {
+		clusterMgr.StartNetworkLoop(ctx, time.Minute)
+	}
 	srv := api.NewClusterServer(clusterMgr)
+	srv.SetLogger(logs.Logger("api"))
+	srv.SetLogLevels(logs)
+	srv.SetBindMountRoots(cfg.BindMountRoots)
+	if ca != nil {
+		srv.SetJoin(ca, cfg.JoinToken, cfg.JoinTTL())
+	}
+	keys, err := cfg.Keys()
+	if err != nil {
+		fatal("failed to load API keys", "error", err)
+	}
+	if err := srv.SetAPIKeys(keys); err != nil {
+		fatal("invalid API keys", "error", err)
+	}
+	if cfg.JWT != nil {
+		if err := srv.SetJWT(*cfg.JWT); err != nil {
+			fatal("invalid JWT config", "error", err)
+		}
+	}
+	if len(keys) == 0 && cfg.JWT == nil {
+		slog.Warn("no API keys or JWT configured; the API is open to anyone who can reach it")
+	}
+	if *auditPath != "" {
+		auditLog, err := audit.OpenFileLog(*auditPath)
+		if err != nil {
+			fatal("failed to open audit log", "path", *auditPath, "error", err)
+		}
+		defer auditLog.Close()
+		srv.SetAuditLog(auditLog)
+	}
+	srv.SetProvisionRateLimit(*provisionRate, *provisionBurst)
+	srv.SetScheduleTimeout(*scheduleTimeout)
+	srv.SetNodeFactory(func(nc config.NodeConfig) (*cluster.Node, error) {
+		return newNode(ctx, nc, opts)
+	})
+
+	// done is closed once in-flight requests and rollouts have drained
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		slog.Info("shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("server shutdown failed", "error", err)
+		}
+		if err := clusterMgr.Shutdown(shutdownCtx); err != nil {
+			slog.Error("cluster shutdown failed", "error", err)
+		}
+	}()
+
+	if *tlsCert != "" || *tlsKey != "" {
+		err := srv.SetTLS(api.TLSOptions{CertFile: *tlsCert, KeyFile: *tlsKey, ClientCAFile: *tlsClientCA, RedirectAddr: *httpRedirect})
+		if err != nil {
+			fatal("invalid TLS settings", "error", err)
+		}
+	} else if *tlsClientCA != "" || *httpRedirect != "" {
+		fatal("-tls-client-ca and -http-redirect-addr need -tls-cert and -tls-key")
+	}
+
+	if err := srv.Run(*addr); err != nil {
+		fatal("server failed", "error", err)
+	}
+	<-done
+}
+
+// nodeOptions are the settings shared by every node
+type nodeOptions struct {
+	expiration time.Duration // TTL reaping interval, 0 to disable
+	stateStore string        // config.StateStoreBolt or config.StateStoreFile
+	logs       *logging.Levels
+
+	// agentCA and agentCert secure connections to node agents with mutual
+	// TLS; when agentCA is nil agents are reached as configured
+	agentCA   *x509.CertPool
+	agentCert tls.Certificate
+}
+
+// newNode creates a node from its config, restores its persisted state and
+// starts its background loops, which end when the node is stopped or ctx is
+// done.
+func newNode(ctx context.Context, nc config.NodeConfig, opts nodeOptions) (*cluster.Node, error) {
+	capacity := resourcemanager.ResourceSpec{
+		CPU:    nc.CPU,
+		Memory: nc.Memory,
+		GPU:    nc.GPU,
+		DiskMB: nc.Disk,
+	}
+
+	var rt docker.ContainerRuntime
+	switch {
+	case nc.Agent != "":
+		client := agent.NewClient(nc.Agent)
+		if opts.agentCA != nil {
+			if !strings.HasPrefix(nc.Agent, "https://") {
+				return nil, fmt.Errorf("agent %s must use https when joinToken is set", nc.Agent)
+			}
+			client = agent.NewTLSClient(nc.Agent, agent.ClientTLS(opts.agentCA, opts.agentCert, nc.ID))
+		}
+		if capacity.CPU == 0 || capacity.Memory == 0 {
+			offered, err := client.Capacity(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get capacity from agent: %w", err)
+			}
+			capacity.CPU = cmp.Or(capacity.CPU, offered.CPU)
+			capacity.Memory = cmp.Or(capacity.Memory, offered.Memory)
+			capacity.GPU = cmp.Or(capacity.GPU, offered.GPU)
+			capacity.DiskMB = cmp.Or(capacity.DiskMB, offered.DiskMB)
+		}
+		rt = client
+	case nc.DockerHost != "":
+		dc, err := docker.NewDockerClientWithHost(nc.DockerHost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create docker client: %w", err)
+		}
+		rt = dc
+	default:
+		dc, err := docker.NewDockerClient()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create docker client: %w", err)
+		}
+		rt = dc
+	}
+	rm := resourcemanager.NewResourceManagerWithCapacity(capacity)
+	mgr := manager.NewManager(rt, rm)
+	mgr.SetLogger(opts.logs.Logger("manager"))
+	mgr.SetNodeID(nc.ID) // before Restore, so its logs name the node
+
+	store, closeStore, err := openStore(nc.ID, opts.stateStore)
+	if err != nil {
+		return nil, err
+	}
+	if err := mgr.Restore(store); err != nil {
+		closeStore()
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+	mgr.SetStore(store)
+	if summary, err := mgr.Reconcile(ctx); err != nil {
+		slog.Error("failed to reconcile", "node_id", nc.ID, "error", err)
+	} else if summary.Pruned > 0 || summary.Adopted > 0 || summary.Removed > 0 {
+		slog.Info("reconciled containers with Docker", "node_id", nc.ID, "checked", summary.Checked,
+			"pruned", summary.Pruned, "adopted", summary.Adopted, "removed", summary.Removed)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stop := func() {
+		cancel()
+		closeStore()
+	}
+	mgr.StartExpirationLoop(ctx, opts.expiration)
+	mgr.StartStatusLoop(ctx, 5*time.Second)
+	mgr.StartProbeLoop(ctx, time.Second)
+
+	return &cluster.Node{
+		ID:        nc.ID,
+		Docker:    rt,
+		Resources: rm,
+		Manager:   mgr,
+		Labels:    nc.Labels,
+
+		MaxConcurrentCreates: nc.MaxConcurrentCreates,
+		Stop:                 stop,
+	}, nil
+}
+
+// openStore opens the store a node's containers are saved to and returns a
+// function closing it. A bolt store takes over the node's JSON state file
+// the first time it is opened.
+func openStore(nodeID, kind string) (manager.Store, func(), error) {
+	file := manager.NewFileStore(nodeID + ".state.json")
+	if kind == config.StateStoreFile {
+		return file, func() {}, nil
+	}
+
+	db, err := manager.OpenBoltStore(nodeID + ".state.db")
+	if err != nil {
+		return nil, nil, err
+	}
+	closeDB := func() {
+		if err := db.Close(); err != nil {
+			slog.Error("failed to close state database", "node_id", nodeID, "error", err)
+		}
+	}
+	if err := migrateState(file, db); err != nil {
+		closeDB()
+		return nil, nil, fmt.Errorf("failed to migrate %s: %w", file.Path, err)
+	}
+	return db, closeDB, nil
+}
+
+// migrateState copies the containers in a JSON state file into an empty
+// bolt store and renames the file so it isn't read again
+func migrateState(file *manager.FileStore, db *manager.BoltStore) error {
+	state, err := file.Load()
+	if err != nil || len(state) == 0 {
+		return err
+	}
+	existing, err := db.Load()
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		slog.Warn("ignoring state file, the state database is already in use", "path", file.Path)
+		return nil
+	}
+	if err := db.Save(state); err != nil {
+		return err
+	}
+	slog.Info("migrated state file to the state database", "path", file.Path, "containers", len(state))
+	return os.Rename(file.Path, file.Path+".migrated")
+}
+
+// registryReloadInterval is how often the registries file is checked for changes
+const registryReloadInterval = 30 * time.Second
+
+// applyRegistries hands the configured registry credentials to the cluster
+func applyRegistries(cm *cluster.ClusterManager, cfg *config.Config) error {
+	creds, err := cfg.RegistryCredentials()
+	if err != nil {
+		return err
+	}
+	auths := make(map[string]docker.RegistryAuth, len(creds))
+	for _, r := range creds {
+		auths[docker.NormalizeRegistryHost(r.Server)] = docker.RegistryAuth{
+			Username:      r.Username,
+			Password:      r.Password,
+			ServerAddress: r.Server,
+			Token:         r.Token,
+		}
+	}
+	cm.SetRegistryCredentials(auths)
+	return nil
+}
+
+// watchRegistries reloads the registry credentials when the registries file
+// changes or on SIGHUP. An unreadable or invalid file keeps the current ones.
+func watchRegistries(ctx context.Context, cm *cluster.ClusterManager, cfg *config.Config) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(registryReloadInterval)
+	defer ticker.Stop()
+
+	modTime := fileModTime(cfg.RegistriesFile)
+	for {
+		select {
+		case <-ticker.C:
+			t := fileModTime(cfg.RegistriesFile)
+			if t.Equal(modTime) {
+				continue
+			}
+			modTime = t
+		case <-hup:
+		case <-ctx.Done():
+			return
+		}
+		if err := applyRegistries(cm, cfg); err != nil {
+			slog.Warn("failed to reload registry credentials", "path", cfg.RegistriesFile, "error", err)
+			continue
+		}
+		slog.Info("reloaded registry credentials", "path", cfg.RegistriesFile)
+	}
+}
+
+// fileModTime returns when path was last modified, or the zero time if it
+// can't be read
+func fileModTime(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// fatal logs an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
 
-	log.Fatal(srv.Run(":8080"))
+// flagSet reports whether the named flag was given on the command line
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
 }